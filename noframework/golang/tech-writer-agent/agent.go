@@ -2,27 +2,123 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
 	"regexp"
 	"strings"
+	"time"
 )
 
-// ReActAgent implements the ReAct (Reasoning and Acting) pattern
-type ReActAgent struct {
+// Agent is implemented by each agent strategy (ReAct, plan-and-execute,
+// hierarchical)
+type Agent interface {
+	// Run answers userPrompt, using tools as needed
+	Run(userPrompt string) (string, error)
+	// Truncated reports whether the answer was forced before exploration finished
+	Truncated() bool
+	// Interrupted reports whether the run was stopped early at the user's request
+	Interrupted() bool
+	// Iterations returns the number of LLM turns the run used
+	Iterations() int
+	// Sources returns the files read successfully during the run
+	Sources() []string
+	// Observations returns the successful tool results gathered during the run
+	Observations() []Observation
+}
+
+// agentCore holds the state and plumbing shared by the agent strategies:
+// time limits, tracing, tool execution and bookkeeping of what was observed
+type agentCore struct {
 	llmClient    LLMClient
 	systemPrompt string
 	maxIters     int
 	verbose      bool
+	opts         AgentOptions
+	runDeadline  time.Time
+	iterations   int      // LLM turns used so far, bounded by maxIters
+	sources      []string // files successfully read, in first-read order
+	truncated    bool     // the loop was cut short and the answer forced
+	interrupted  bool     // the user asked the run to stop
+	observations []Observation
+	toolCalls    map[string]*toolCallRecord // distinct tool calls in the current conversation, by toolCallKey
+	corrections  int                        // loop corrections issued in the current conversation
+	stuck        error                      // set when the agent keeps looping despite corrections
 }
 
+// toolCallRecord tracks a distinct tool call (name and arguments) within a
+// conversation, for answering repeats and detecting loops
+type toolCallRecord struct {
+	iteration   int    // iteration of the first call
+	observation string // result of the most recent execution
+	succeeded   bool   // the result can be reused instead of running the tool again
+	repeats     int    // identical calls after the first
+}
+
+// ReActAgent implements the ReAct (Reasoning and Acting) pattern
+type ReActAgent struct {
+	agentCore
+	history string // conversation up to and including the last final answer
+}
+
+// FollowUpAgent is implemented by agents that can answer further questions
+// with the context accumulated during Run
+type FollowUpAgent interface {
+	FollowUp(question string) (string, error)
+}
+
+// Observation is a tool result gathered during the run
+type Observation struct {
+	Tool    string
+	Args    map[string]interface{}
+	Content string
+}
+
+// AgentOptions holds optional limits and behaviours for the agent loop
+type AgentOptions struct {
+	// IterationTimeout bounds the time spent on a single iteration (LLM call
+	// plus tool call). Zero means no limit.
+	IterationTimeout time.Duration
+	
+	// MaxDuration bounds the wall-clock time of the whole loop. When it
+	// passes, the model is asked for a best-effort answer from what it has
+	// gathered so far. Zero means no limit.
+	MaxDuration time.Duration
+	
+	// Interrupt is closed when the user asks the run to stop (Ctrl-C). The
+	// current iteration finishes, then the model is asked for a best-effort
+	// answer as when MaxDuration passes. May be nil.
+	Interrupt <-chan struct{}
+	
+	// Events receives progress events (iterations, LLM and tool calls, the
+	// final answer). May be nil.
+	Events EventSink
+}
+
+// errTimeout is returned by runWithTimeout when the deadline passes first
+var errTimeout = errors.New("timed out")
+
+// errLoopDetected is returned when the agent keeps repeating the same action
+// after being told to stop
+var errLoopDetected = errors.New("agent is stuck in a loop")
+
 // NewReActAgent creates a new ReAct agent
-func NewReActAgent(llmClient LLMClient, systemPrompt string, maxIters int, verbose bool) *ReActAgent {
-	return &ReActAgent{
+func NewReActAgent(llmClient LLMClient, systemPrompt string, maxIters int, verbose bool, opts AgentOptions) *ReActAgent {
+	return &ReActAgent{agentCore: newAgentCore(llmClient, systemPrompt, maxIters, verbose, opts)}
+}
+
+// newAgentCore creates the shared agent state
+func newAgentCore(llmClient LLMClient, systemPrompt string, maxIters int, verbose bool, opts AgentOptions) agentCore {
+	if opts.Events == nil {
+		opts.Events = NopSink{}
+	}
+	return agentCore{
 		llmClient:    llmClient,
 		systemPrompt: systemPrompt,
 		maxIters:     maxIters,
 		verbose:      verbose,
+		opts:         opts,
 	}
 }
 
@@ -57,34 +153,70 @@ User Request: %s
 
 Thought:`, toolDescriptions, userPrompt)
 	
-	// ReAct loop
-	for i := 0; i < a.maxIters; i++ {
-		if a.verbose {
-			log.Printf("Iteration %d/%d", i+1, a.maxIters)
+	a.startClock()
+	a.resetToolCalls()
+	return a.loop(conversationHistory, a.maxIters)
+}
+
+// FollowUp answers a further question in the same conversation as the
+// previous Run, so earlier observations stay in context and tools remain
+// available. Each follow-up gets its own iteration budget and time limit.
+func (a *ReActAgent) FollowUp(question string) (string, error) {
+	if a.history == "" {
+		return "", fmt.Errorf("no previous analysis to follow up on")
+	}
+	
+	conversationHistory := a.history + fmt.Sprintf(`
+
+Follow-up Question: %s
+
+Answer the follow-up question using the same format, calling tools again if you need more information, and finish with a Final Answer.
+
+Thought:`, question)
+	
+	a.startClock()
+	// Earlier results are still in the conversation; only the loop allowance restarts
+	a.corrections, a.stuck = 0, nil
+	return a.loop(conversationHistory, FOLLOW_UP_MAX_ITERATIONS)
+}
+
+// loop runs ReAct iterations from conversationHistory until a final answer
+func (a *ReActAgent) loop(conversationHistory string, maxIters int) (string, error) {
+	for i := 0; i < maxIters; i++ {
+		if a.outOfTime() {
+			log.Printf("Time limit of %s reached after %d iterations; requesting a best-effort answer", a.opts.MaxDuration, i)
+			finalAnswer, err := a.forceFinalAnswer(conversationHistory, i+1, "You have run out of time.")
+			a.history = conversationHistory + "\nFinal Answer: " + finalAnswer
+			return finalAnswer, err
+		}
+		if a.interruptRequested() {
+			log.Printf("Interrupted after %d iterations; requesting a best-effort answer", i)
+			finalAnswer, err := a.forceFinalAnswer(conversationHistory, i+1, "The user has asked you to stop.")
+			a.history = conversationHistory + "\nFinal Answer: " + finalAnswer
+			return finalAnswer, err
 		}
 		
+		a.iterations++
+		a.opts.Events.OnIteration(IterationEvent{Iteration: i + 1, MaxIterations: maxIters})
+		
+		deadline := a.iterationDeadline()
+		
 		// Get LLM response
-		response, err := a.llmClient.Complete(conversationHistory, a.systemPrompt, 0.0)
+		response, err := a.complete(conversationHistory, i+1, deadline)
+		if errors.Is(err, errTimeout) {
+			// Nothing to add to the history; the next iteration retries the same turn
+			// (or forces the final answer if the run deadline has passed)
+			continue
+		}
 		if err != nil {
 			return "", fmt.Errorf("LLM error in iteration %d: %w", i+1, err)
 		}
 		
-		if a.verbose {
-			log.Printf("LLM Response:\n%s", response)
-		}
-		
 		// Check if we have a final answer
-		if strings.Contains(response, "Final Answer:") {
-			// Extract final answer
-			parts := strings.Split(response, "Final Answer:")
-			if len(parts) >= 2 {
-				finalAnswer := strings.TrimSpace(parts[1])
-				// Remove any trailing markers
-				if idx := strings.Index(finalAnswer, "\nThought:"); idx > 0 {
-					finalAnswer = finalAnswer[:idx]
-				}
-				return finalAnswer, nil
-			}
+		if finalAnswer, ok := extractFinalAnswer(response); ok {
+			a.opts.Events.OnFinal(FinalEvent{Iteration: i + 1, Answer: finalAnswer})
+			a.history = conversationHistory + response
+			return finalAnswer, nil
 		}
 		
 		// Parse action and action input
@@ -95,19 +227,10 @@ Thought:`, toolDescriptions, userPrompt)
 			continue
 		}
 		
-		if a.verbose {
-			log.Printf("Action: %s", action)
-			log.Printf("Action Input: %v", actionInput)
-		}
-		
 		// Execute the tool
-		observation, err := a.executeTool(action, actionInput)
-		if err != nil {
-			observation = fmt.Sprintf("Error: %v", err)
-		}
-		
-		if a.verbose {
-			log.Printf("Observation: %s", observation)
+		observation := a.useTool(action, actionInput, i+1, deadline)
+		if a.stuck != nil {
+			return "", fmt.Errorf("iteration %d: %w", i+1, a.stuck)
 		}
 		
 		// Add to conversation history
@@ -119,30 +242,264 @@ Thought:`, toolDescriptions, userPrompt)
 		conversationHistory += "Thought: "
 	}
 	
-	return "", fmt.Errorf("reached maximum iterations (%d) without finding a final answer", a.maxIters)
+	return "", fmt.Errorf("reached maximum iterations (%d) without finding a final answer", maxIters)
 }
 
-// getToolDescriptions returns formatted descriptions of available tools
-func (a *ReActAgent) getToolDescriptions() string {
-	var descriptions []string
+// startClock starts the wall-clock limit for a run
+func (a *agentCore) startClock() {
+	a.runDeadline = time.Time{}
+	if a.opts.MaxDuration > 0 {
+		a.runDeadline = time.Now().Add(a.opts.MaxDuration)
+	}
+}
+
+// outOfTime reports whether the run's wall-clock limit has passed
+func (a *agentCore) outOfTime() bool {
+	return !a.runDeadline.IsZero() && time.Now().After(a.runDeadline)
+}
+
+// interruptRequested reports whether the user has asked the run to stop,
+// remembering the request for Interrupted
+func (a *agentCore) interruptRequested() bool {
+	if isClosed(a.opts.Interrupt) {
+		a.interrupted = true
+	}
+	return a.interrupted
+}
+
+// isClosed reports whether ch has been closed, without blocking. A nil
+// channel is never closed.
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// iterationDeadline returns the deadline for an iteration starting now: the
+// earlier of the iteration timeout and the run deadline (zero if neither applies)
+func (a *agentCore) iterationDeadline() time.Time {
+	deadline := a.runDeadline
+	if a.opts.IterationTimeout > 0 {
+		iterationDeadline := time.Now().Add(a.opts.IterationTimeout)
+		if deadline.IsZero() || iterationDeadline.Before(deadline) {
+			deadline = iterationDeadline
+		}
+	}
+	return deadline
+}
+
+// finalDeadline is the deadline of the call writing the final answer: only
+// the iteration timeout, since that answer is owed even once MaxDuration has
+// passed
+func (a *agentCore) finalDeadline() time.Time {
+	if a.opts.IterationTimeout > 0 {
+		return time.Now().Add(a.opts.IterationTimeout)
+	}
+	return time.Time{}
+}
+
+// complete calls the LLM within deadline and reports the call to the event
+// sink. A timed-out call returns errTimeout.
+func (a *agentCore) complete(prompt string, iteration int, deadline time.Time) (string, error) {
+	started := time.Now()
+	response, err := runWithTimeout(deadline, func() (string, error) {
+		return a.llmClient.Complete(prompt, a.systemPrompt, 0.0)
+	})
+	a.opts.Events.OnLLMCall(LLMCallEvent{
+		Iteration: iteration,
+		Response:  response,
+		Err:       err,
+		Duration:  time.Since(started),
+	})
+	return response, err
+}
+
+// resetToolCalls forgets earlier tool calls and loop corrections. Call it
+// whenever the model starts a conversation that doesn't include their
+// observations.
+func (a *agentCore) resetToolCalls() {
+	a.toolCalls = make(map[string]*toolCallRecord)
+	a.corrections = 0
+	a.stuck = nil
+}
+
+// useTool executes a tool within deadline and returns the observation to show
+// the model. Failures become "Error: ..." observations; successes are kept as
+// observations and, for file reads, as sources. Repeating a successful call
+// from the same conversation returns a short reminder instead of the result.
+// Beyond LOOP_REPEAT_LIMIT repeats of any call the model gets a corrective
+// message, and after LOOP_MAX_CORRECTIONS of those a.stuck is set.
+func (a *agentCore) useTool(action string, actionInput map[string]interface{}, iteration int, deadline time.Time) string {
+	started := time.Now()
+	key := toolCallKey(action, actionInput)
+	record, seen := a.toolCalls[key]
+	if seen {
+		record.repeats++
+		if observation, ok := a.repeatedToolCall(action, actionInput, record); ok {
+			a.opts.Events.OnToolCall(ToolCallEvent{
+				Iteration:   iteration,
+				Tool:        action,
+				Args:        actionInput,
+				Observation: observation,
+				Cached:      true,
+				Duration:    time.Since(started),
+			})
+			return observation
+		}
+	}
+	
+	observation, err := runWithTimeout(deadline, func() (string, error) {
+		return a.executeTool(action, actionInput)
+	})
+	if errors.Is(err, errTimeout) {
+		observation = fmt.Sprintf("Error: tool %s did not finish within the time limit. Try a narrower request.", action)
+	} else if err != nil {
+		observation = fmt.Sprintf("Error: %v", err)
+	}
+	if err == nil {
+		a.recordSource(actionInput, observation)
+		a.observations = append(a.observations, Observation{Tool: action, Args: actionInput, Content: observation})
+	}
+	if a.toolCalls != nil {
+		if !seen {
+			record = &toolCallRecord{iteration: iteration}
+			a.toolCalls[key] = record
+		}
+		record.observation = observation
+		record.succeeded = err == nil
+	}
+	a.opts.Events.OnToolCall(ToolCallEvent{
+		Iteration:   iteration,
+		Tool:        action,
+		Args:        actionInput,
+		Observation: observation,
+		Err:         err,
+		Duration:    time.Since(started),
+	})
+	return observation
+}
+
+// repeatedToolCall returns the observation for a call identical to an earlier
+// one, or false if the tool should run again (a failed call that isn't yet
+// looping may have been transient)
+func (a *agentCore) repeatedToolCall(action string, actionInput map[string]interface{}, record *toolCallRecord) (string, bool) {
+	if record.repeats > LOOP_REPEAT_LIMIT {
+		a.corrections++
+		if a.corrections > LOOP_MAX_CORRECTIONS {
+			args, _ := json.Marshal(actionInput)
+			a.stuck = fmt.Errorf("%w: %s(%s) was issued %d times despite %d corrections", errLoopDetected, action, args, record.repeats+1, LOOP_MAX_CORRECTIONS)
+			log.Printf("Aborting: %v", a.stuck)
+		}
+		preview := record.observation
+		if len(preview) > LOOP_RESULT_PREVIEW_CHARS {
+			preview = preview[:LOOP_RESULT_PREVIEW_CHARS] + "... (truncated)"
+		}
+		return fmt.Sprintf("SYSTEM NOTICE: You have already issued this exact action %d times; it was first run in iteration %d and its result was:\n%s\nRepeating it will not produce anything new. Choose a different action, or give your Final Answer if you have enough information.", record.repeats+1, record.iteration, preview), true
+	}
+	if record.succeeded {
+		return fmt.Sprintf("Already retrieved above: %s was called with the same arguments in iteration %d and its result is unchanged. Use that observation instead of repeating the call.", action, record.iteration), true
+	}
+	return "", false
+}
+
+// toolCallKey identifies a tool call by name and arguments. json.Marshal
+// sorts map keys, so equal arguments give equal keys.
+func toolCallKey(action string, args map[string]interface{}) string {
+	encoded, _ := json.Marshal(args)
+	return action + "\x00" + string(encoded)
+}
+
+// forceFinalAnswer asks the model for a final answer without further tool use
+// and marks the run as truncated. If the reply lacks a "Final Answer:" marker
+// the whole reply is used. The call is bounded by finalDeadline, as the run's
+// may already have passed.
+func (a *agentCore) forceFinalAnswer(conversationHistory string, iteration int, reason string) (string, error) {
+	a.truncated = true
 	
-	descriptions = append(descriptions, `1. find_all_matching_files: Find files matching a pattern while respecting .gitignore
-   Arguments:
-   - directory (string, required): Directory to search in
-   - pattern (string, optional): File pattern to match (glob format), default: "*"
-   - respect_gitignore (bool, optional): Whether to respect .gitignore patterns, default: true
-   - include_hidden (bool, optional): Whether to include hidden files, default: false
-   - include_subdirs (bool, optional): Whether to include subdirectories, default: true`)
+	prompt := conversationHistory + fmt.Sprintf(`
+
+%s Do not use any more tools. Using only the observations above, write your best-effort final answer now, noting any areas you could not investigate.
+Final Answer:`, reason)
 	
-	descriptions = append(descriptions, `2. read_file: Read the contents of a file
-   Arguments:
-   - file_path (string, required): Path to the file to read`)
+	a.iterations++
+	response, err := a.complete(prompt, iteration, a.finalDeadline())
+	if err != nil {
+		return "", fmt.Errorf("LLM error while forcing final answer: %w", err)
+	}
 	
-	return strings.Join(descriptions, "\n\n")
+	finalAnswer, ok := extractFinalAnswer(response)
+	if !ok {
+		finalAnswer = strings.TrimSpace(response)
+	}
+	a.opts.Events.OnFinal(FinalEvent{Iteration: iteration, Answer: finalAnswer, Truncated: true})
+	return finalAnswer, nil
+}
+
+// Truncated reports whether the final answer was forced before the agent
+// finished exploring
+func (a *agentCore) Truncated() bool {
+	return a.truncated
+}
+
+// Iterations returns the number of LLM turns used so far
+func (a *agentCore) Iterations() int {
+	return a.iterations
+}
+
+// Interrupted reports whether the user stopped the run before it finished
+func (a *agentCore) Interrupted() bool {
+	return a.interrupted
+}
+
+// Observations returns the successful tool results gathered during the run
+func (a *agentCore) Observations() []Observation {
+	return a.observations
+}
+
+// Sources returns the files the agent read successfully during the run
+func (a *agentCore) Sources() []string {
+	return a.sources
+}
+
+// recordSource remembers the file behind a successful file-reading tool call
+func (a *agentCore) recordSource(args map[string]interface{}, observation string) {
+	path, ok := args["file_path"].(string)
+	if !ok || path == "" {
+		return
+	}
+	// Tools report problems such as missing files as {"error": ...} results
+	var result map[string]interface{}
+	if json.Unmarshal([]byte(observation), &result) == nil {
+		if _, failed := result["error"]; failed {
+			return
+		}
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	a.addSource(path)
+}
+
+// addSource adds path to the sources unless it is already listed
+func (a *agentCore) addSource(path string) {
+	for _, existing := range a.sources {
+		if existing == path {
+			return
+		}
+	}
+	a.sources = append(a.sources, path)
+}
+
+// getToolDescriptions returns formatted descriptions of available tools
+func (a *agentCore) getToolDescriptions() string {
+	return DescribeTools()
 }
 
 // parseAction extracts action and action input from the response
-func (a *ReActAgent) parseAction(response string) (string, map[string]interface{}, error) {
+func (a *agentCore) parseAction(response string) (string, map[string]interface{}, error) {
 	// Look for Action: and Action Input:
 	actionRegex := regexp.MustCompile(`Action:\s*(.+?)(?:\n|$)`)
 	inputRegex := regexp.MustCompile(`Action Input:\s*(.+?)(?:\n|$)`)
@@ -172,10 +529,61 @@ func (a *ReActAgent) parseAction(response string) (string, map[string]interface{
 }
 
 // executeTool executes a tool and returns the observation
-func (a *ReActAgent) executeTool(toolName string, args map[string]interface{}) (string, error) {
+func (a *agentCore) executeTool(toolName string, args map[string]interface{}) (string, error) {
 	result, err := ExecuteTool(toolName, args)
 	if err != nil {
 		return "", err
 	}
 	return result, nil
-}
\ No newline at end of file
+}
+
+// extractFinalAnswer returns the text after "Final Answer:" in response, if any
+func extractFinalAnswer(response string) (string, bool) {
+	parts := strings.Split(response, "Final Answer:")
+	if len(parts) < 2 {
+		return "", false
+	}
+	finalAnswer := strings.TrimSpace(parts[1])
+	// Remove any trailing markers
+	if idx := strings.Index(finalAnswer, "\nThought:"); idx > 0 {
+		finalAnswer = finalAnswer[:idx]
+	}
+	return finalAnswer, true
+}
+
+// errorString returns err's message, or "" for a nil error
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// runWithTimeout runs fn and stops waiting for it once the deadline passes.
+// A zero deadline waits indefinitely. Neither the HTTP client nor the tools
+// accept a context, so an abandoned call is left to finish in the background.
+func runWithTimeout(deadline time.Time, fn func() (string, error)) (string, error) {
+	if deadline.IsZero() {
+		return fn()
+	}
+	
+	type result struct {
+		output string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := fn()
+		done <- result{output, err}
+	}()
+	
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	
+	select {
+	case r := <-done:
+		return r.output, r.err
+	case <-timer.C:
+		return "", errTimeout
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+// PresetAPIReference writes a reference of the public API (--preset api-reference)
+const PresetAPIReference = "api-reference"
+
+// API_REFERENCE_PROMPT is the task of --preset api-reference
+const API_REFERENCE_PROMPT = `Write an API reference for this repository: a document to look things up in, listing its public interface completely and precisely, not a narrative analysis of how it works.
+
+Find the public surface first, then document each part of it that exists, leaving out the others:
+- Libraries and packages: the exported symbols, from extract_symbols for Go and get_file_outline for other languages. Only public ones: exported Go identifiers, names without a leading underscore or listed in __all__ in Python, what the package's entry point exports in JavaScript and TypeScript, public and protected members in Java and C#, pub items in Rust, and the declarations of public headers in C and C++.
+- HTTP and RPC endpoints: from summarize_openapi for OpenAPI and Swagger specs and extract_protobuf for .proto files, or else from the route registrations found with search_in_files (such as http.HandleFunc, router.get, @app.route or @GetMapping).
+- Command-line interfaces: the commands, subcommands, flags and environment variables, from the argument parsing code (flag, cobra, argparse, click, clap, commander and the like) found with search_in_files.
+
+Start with a level-1 heading and a short paragraph saying what the reference covers and how it is organised. Give each kind of interface a level-2 heading (## Packages, ## HTTP API, ## Command-line interface, and so on) and each package, module, resource or command a level-3 heading. For every entry, give:
+- its exact signature, route or usage in a code block, in the source's language;
+- one or two sentences on what it does, from its doc comment where there is one;
+- its parameters, fields, flags or request and response bodies, with types, defaults and whether they are required, in a table where there are several;
+- its return values and errors, or status codes, where the code shows them;
+- the file and line it is defined at.
+Group methods under their type, and order entries as the source does, or alphabetically within a group.
+
+Take every name, type and default from the tool results or the file, not from memory. Don't describe internals, unexported helpers or tests, and don't leave a public symbol out because it is dull: a reference is only useful when it is complete. Where a large surface doesn't fit, document the most used packages in full and list the rest by name with one line each.`
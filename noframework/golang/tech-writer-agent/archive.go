@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Limits of list_archive and read_archive_member
+const (
+	ARCHIVE_MAX_ENTRIES     = 500
+	ARCHIVE_MAX_MEMBER_READ = 64 * 1024
+)
+
+// Archive formats, recognised by their content rather than their extension
+const (
+	ArchiveZip   = "zip" // also jar, war, whl, ...
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	ArchiveTarBz = "tar.bz2"
+)
+
+// ArchiveEntry is a file inside an archive
+type ArchiveEntry struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified,omitempty"` // RFC 3339
+}
+
+// ArchiveListResult represents the files in an archive
+type ArchiveListResult struct {
+	Archive   string         `json:"archive"`
+	Format    string         `json:"format"`
+	Files     []ArchiveEntry `json:"files"`
+	Count     int            `json:"count"`               // files in the archive
+	Truncated bool           `json:"truncated,omitempty"` // more than ARCHIVE_MAX_ENTRIES files
+}
+
+// ArchiveMemberResult represents a file read from an archive
+type ArchiveMemberResult struct {
+	Archive   string `json:"archive"`
+	Member    string `json:"member"`
+	Size      int64  `json:"size"`
+	Content   string `json:"content"`
+	Truncated bool   `json:"truncated,omitempty"` // only the first ARCHIVE_MAX_MEMBER_READ bytes are returned
+}
+
+// errMemberFound stops walking an archive once the wanted member is read
+var errMemberFound = errors.New("member found")
+
+// archiveFormat recognises a zip or (compressed) tar archive from its first
+// bytes, returning "" for anything else
+func archiveFormat(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(file, header)
+	header = header[:n]
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ArchiveZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz, nil
+	case bytes.HasPrefix(header, []byte("BZh")):
+		return ArchiveTarBz, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return ArchiveTar, nil
+	}
+	return "", nil
+}
+
+// walkArchive calls visit for each regular file in the archive. visit
+// returning an error stops the walk with that error.
+func walkArchive(filePath, format string, visit func(entry ArchiveEntry, content io.Reader) error) error {
+	if format == ArchiveZip {
+		reader, err := zip.OpenReader(filePath)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		for _, file := range reader.File {
+			if file.FileInfo().IsDir() {
+				continue
+			}
+			entry := ArchiveEntry{Name: file.Name, Size: int64(file.UncompressedSize64), Modified: archiveTime(file.Modified)}
+			err := func() error {
+				content, err := file.Open()
+				if err != nil {
+					return err
+				}
+				defer content.Close()
+				return visit(entry, content)
+			}()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var stream io.Reader = bufio.NewReader(file)
+	switch format {
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(stream)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		stream = gz
+	case ArchiveTarBz:
+		stream = bzip2.NewReader(stream)
+	}
+	reader := tar.NewReader(stream)
+	for first := true; ; first = false {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// A gzip or bzip2 file that doesn't hold a tar archive
+			if first && format != ArchiveTar && (errors.Is(err, tar.ErrHeader) || errors.Is(err, io.ErrUnexpectedEOF)) {
+				return fmt.Errorf("it is a single compressed file, not a tar archive")
+			}
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		entry := ArchiveEntry{Name: header.Name, Size: header.Size, Modified: archiveTime(header.ModTime)}
+		if err := visit(entry, reader); err != nil {
+			return err
+		}
+	}
+}
+
+func archiveTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// openArchive checks the path argument and recognises the archive's format.
+// The returned map is the error to report to the agent, if any.
+func openArchive(args map[string]interface{}) (string, string, map[string]string, error) {
+	filePath, ok := args["path"].(string)
+	if !ok || filePath == "" {
+		return "", "", nil, fmt.Errorf("path parameter is required")
+	}
+	format, err := archiveFormat(filePath)
+	if os.IsNotExist(err) {
+		return "", "", map[string]string{"error": fmt.Sprintf("File not found: %s", filePath)}, nil
+	}
+	if err != nil {
+		return "", "", map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	if format == "" {
+		return "", "", map[string]string{"error": fmt.Sprintf("%s is not a zip, jar, tar, tar.gz or tar.bz2 archive", filePath)}, nil
+	}
+	return filePath, format, nil, nil
+}
+
+// listArchive implements the list_archive tool: the files in a zip, jar or
+// tar archive with their sizes
+func listArchive(args map[string]interface{}) (interface{}, error) {
+	filePath, format, failure, err := openArchive(args)
+	if failure != nil || err != nil {
+		return failure, err
+	}
+
+	result := ArchiveListResult{Archive: filePath, Format: format, Files: []ArchiveEntry{}}
+	err = walkArchive(filePath, format, func(entry ArchiveEntry, _ io.Reader) error {
+		result.Count++
+		if len(result.Files) < ARCHIVE_MAX_ENTRIES {
+			result.Files = append(result.Files, entry)
+		} else {
+			result.Truncated = true
+		}
+		return nil
+	})
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading %s archive %s: %s", format, filePath, err)}, nil
+	}
+	return result, nil
+}
+
+// readArchiveMember implements the read_archive_member tool: the text of one
+// file inside an archive, without extracting it
+func readArchiveMember(args map[string]interface{}) (interface{}, error) {
+	filePath, format, failure, err := openArchive(args)
+	if failure != nil || err != nil {
+		return failure, err
+	}
+	member, ok := args["member"].(string)
+	if !ok || member == "" {
+		return nil, fmt.Errorf("member parameter is required")
+	}
+	member = strings.TrimPrefix(path.Clean("/"+member), "/")
+
+	var result *ArchiveMemberResult
+	var content []byte
+	err = walkArchive(filePath, format, func(entry ArchiveEntry, reader io.Reader) error {
+		if strings.TrimPrefix(path.Clean("/"+entry.Name), "/") != member {
+			return nil
+		}
+		// The size in the header can't be trusted (e.g. a zip bomb), so
+		// read at most one byte more than returned
+		data, err := io.ReadAll(io.LimitReader(reader, ARCHIVE_MAX_MEMBER_READ+1))
+		if err != nil {
+			return err
+		}
+		content = data
+		result = &ArchiveMemberResult{Archive: filePath, Member: entry.Name, Size: entry.Size}
+		return errMemberFound
+	})
+	if err != nil && err != errMemberFound {
+		return map[string]string{"error": fmt.Sprintf("Error reading %s archive %s: %s", format, filePath, err)}, nil
+	}
+	if result == nil {
+		return map[string]string{"error": fmt.Sprintf("%s has no file %s; use list_archive to see its files", filePath, member)}, nil
+	}
+	if isBinaryContent(content[:min(len(content), 512)]) {
+		return map[string]string{"error": fmt.Sprintf("Cannot read binary file: %s in %s", member, filePath)}, nil
+	}
+	if len(content) > ARCHIVE_MAX_MEMBER_READ {
+		content = content[:ARCHIVE_MAX_MEMBER_READ]
+		result.Truncated = true
+	}
+	result.Content = strings.ToValidUTF8(string(content), "")
+	return *result, nil
+}
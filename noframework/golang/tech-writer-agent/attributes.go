@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Linguist attributes marking files that are not the project's own code:
+// vendored dependencies and generated files, such as minified bundles or
+// protobuf code. The file tools hide them unless --include-generated is set.
+const (
+	LinguistVendored  = "linguist-vendored"
+	LinguistGenerated = "linguist-generated"
+)
+
+// attributeRule is a line of a .gitattributes file setting or unsetting
+// linguist attributes
+type attributeRule struct {
+	pattern gitignorePattern
+	attrs   map[string]bool // e.g. linguist-generated, or -linguist-generated as false
+}
+
+// attributesFile is the linguist rules of a .gitattributes file
+type attributesFile struct {
+	Path   string
+	prefix string // of the walked directory relative to the file's base, "" or ending in "/"
+	rules  []attributeRule
+}
+
+// linguistAttributes are the .gitattributes files of a walked directory in
+// git's order of precedence: the repository's .git/info/attributes, then
+// the .gitattributes at its root
+type linguistAttributes []attributesFile
+
+// loadLinguistAttributes loads the linguist rules that apply to absDir,
+// returning nil if there are none. Like the exclude files, their patterns
+// are relative to the repository root, or absDir outside a repository.
+func loadLinguistAttributes(absDir string) linguistAttributes {
+	root, gitDir := findGitDir(absDir)
+	if gitDir == "" {
+		root = absDir
+	}
+	prefix := ""
+	if root != absDir {
+		rel, err := filepath.Rel(root, absDir)
+		if err != nil {
+			return nil
+		}
+		prefix = filepath.ToSlash(rel) + "/"
+	}
+	var attributes linguistAttributes
+	files := []string{filepath.Join(root, ".gitattributes")}
+	if gitDir != "" {
+		files = append([]string{filepath.Join(gitDir, "info", "attributes")}, files...)
+	}
+	for _, path := range files {
+		if rules := parseLinguistAttributes(path); len(rules) > 0 {
+			attributes = append(attributes, attributesFile{Path: path, prefix: prefix, rules: rules})
+		}
+	}
+	return attributes
+}
+
+// parseLinguistAttributes reads the lines of a .gitattributes file that
+// set, unset ("-attr", "attr=false") or reset ("!attr") a linguist
+// attribute
+func parseLinguistAttributes(path string) []attributeRule {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	var rules []attributeRule
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "!") {
+			continue // negative patterns are not allowed in .gitattributes
+		}
+		attrs := make(map[string]bool)
+		for _, field := range fields[1:] {
+			name, value, hasValue := strings.Cut(strings.TrimLeft(field, "-!"), "=")
+			if name != LinguistVendored && name != LinguistGenerated {
+				continue
+			}
+			attrs[name] = field[0] != '-' && field[0] != '!' && (!hasValue || (value != "false" && value != "0"))
+		}
+		if len(attrs) == 0 {
+			continue
+		}
+		// A pattern naming a directory matches nothing in .gitattributes
+		if pattern, ok := parseGitignorePattern(fields[0], line); ok && !pattern.dirOnly {
+			rules = append(rules, attributeRule{pattern: pattern, attrs: attrs})
+		}
+	}
+	return rules
+}
+
+// marked returns the linguist attribute that marks the file relPath
+// (relative to the walked directory) and the rule setting it, or "" if the
+// file is the project's own. For each attribute the last rule mentioning
+// it decides, and the first file with one takes precedence.
+func (a linguistAttributes) marked(relPath string) (string, *attributesFile, *attributeRule) {
+	for _, name := range []string{LinguistVendored, LinguistGenerated} {
+		for i := range a {
+			file := &a[i]
+			slashPath := file.prefix + filepath.ToSlash(relPath)
+			var decided *attributeRule
+			for j := len(file.rules) - 1; j >= 0 && decided == nil; j-- {
+				if _, ok := file.rules[j].attrs[name]; ok && file.rules[j].pattern.match(slashPath, false) {
+					decided = &file.rules[j]
+				}
+			}
+			if decided == nil {
+				continue
+			}
+			if decided.attrs[name] {
+				return name, file, decided
+			}
+			break
+		}
+	}
+	return "", nil, nil
+}
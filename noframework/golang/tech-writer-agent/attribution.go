@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Version identifies this build in attribution footers. Release builds set it
+// with -ldflags "-X main.Version=v1.2.3".
+var Version = "dev"
+
+// Attribution modes accepted by --attribution
+const (
+	AttributionNone       = "none"       // no attribution
+	AttributionFooter     = "footer"     // visible footer line plus the machine-readable comment
+	AttributionComment    = "comment"    // machine-readable comment only
+	AttributionProvenance = "provenance" // provenance block (tool, model, commit, time, prompt hash) plus the comment
+)
+
+// attributionMarker prefixes the HTML comment so downstream tools can find it
+const attributionMarker = "tech-writer-agent:attribution"
+
+// Attribution describes how a document was made
+type Attribution struct {
+	Model       string
+	Repo        string // the --repo, if any
+	Commit      string // git HEAD of the analysed tree, if any
+	PromptHash  string // of the prompt file, see promptHash
+	GeneratedAt time.Time
+}
+
+// attributionRecord is the JSON payload of the attribution comment
+type attributionRecord struct {
+	Generator   string `json:"generator"`
+	Version     string `json:"version"`
+	Model       string `json:"model"`
+	Repo        string `json:"repo,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	PromptHash  string `json:"prompt_hash,omitempty"`
+	GeneratedAt string `json:"generated_at"`
+}
+
+// addAttribution appends an attribution footer to document according to mode.
+// The HTML comment stays invisible when the Markdown is rendered, e.g.
+//
+//	<!-- tech-writer-agent:attribution {"generator":"tech-writer-agent",...} -->
+func addAttribution(document, mode string, attribution Attribution) (string, error) {
+	if mode == "" || mode == AttributionNone {
+		return document, nil
+	}
+	if mode != AttributionFooter && mode != AttributionComment && mode != AttributionProvenance {
+		return "", fmt.Errorf("unknown attribution mode %q (expected %s, %s, %s or %s)", mode, AttributionNone, AttributionFooter, AttributionComment, AttributionProvenance)
+	}
+
+	generatedAt := attribution.GeneratedAt.UTC().Format(time.RFC3339)
+	record, err := json.Marshal(attributionRecord{
+		Generator:   "tech-writer-agent",
+		Version:     Version,
+		Model:       attribution.Model,
+		Repo:        attribution.Repo,
+		Commit:      attribution.Commit,
+		PromptHash:  attribution.PromptHash,
+		GeneratedAt: generatedAt,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error encoding attribution: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(document, "\n"))
+	b.WriteString("\n\n")
+	switch mode {
+	case AttributionFooter:
+		fmt.Fprintf(&b, "---\n\n*Generated by tech-writer-agent %s with model %s on %s.*\n\n",
+			Version, attribution.Model, attribution.GeneratedAt.UTC().Format("2006-01-02"))
+	case AttributionProvenance:
+		// The same fields in the same order every time, for readers and scripts
+		b.WriteString("---\n\n**Provenance**\n\n")
+		fmt.Fprintf(&b, "- Tool: tech-writer-agent %s\n", Version)
+		fmt.Fprintf(&b, "- Model: %s\n", attribution.Model)
+		if attribution.Repo != "" {
+			fmt.Fprintf(&b, "- Repository: %s\n", attribution.Repo)
+		}
+		if attribution.Commit != "" {
+			fmt.Fprintf(&b, "- Commit: `%s`\n", attribution.Commit)
+		} else {
+			b.WriteString("- Commit: none (not a git work tree)\n")
+		}
+		fmt.Fprintf(&b, "- Generated: %s\n", generatedAt)
+		if attribution.PromptHash != "" {
+			fmt.Fprintf(&b, "- Prompt: `%s`\n", attribution.PromptHash)
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "<!-- %s %s -->\n", attributionMarker, record)
+	return b.String(), nil
+}
+
+// promptHash identifies the text of a prompt file, so documents made with
+// the same prompt can be recognised: "sha256:" and its hexadecimal digest
+func promptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
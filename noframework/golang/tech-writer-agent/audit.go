@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord is one line of the audit log: what was sent where and how much
+// it cost, but never the prompt or completion text
+type AuditRecord struct {
+	Timestamp        string `json:"timestamp"`
+	Provider         string `json:"provider"`
+	Model            string `json:"model"`
+	Endpoint         string `json:"endpoint"`
+	Status           int    `json:"status,omitempty"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	TotalTokens      int    `json:"total_tokens"`
+	PayloadSHA256    string `json:"payload_sha256"`
+	PayloadBytes     int    `json:"payload_bytes"`
+	DurationMs       int64  `json:"duration_ms"`
+	Error            string `json:"error,omitempty"`
+}
+
+// AuditLog appends one JSON line per outbound LLM request to a file
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// auditLog records every provider request when set; see openAuditLog
+var auditLog *AuditLog
+
+// openAuditLog starts recording provider requests to path, appending to any
+// existing log. Call it before creating LLM clients.
+func openAuditLog(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %w", err)
+	}
+	auditLog = &AuditLog{file: file}
+	return nil
+}
+
+// Write appends record to the log
+func (l *AuditLog) Write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the log file
+func (l *AuditLog) Close() error {
+	return l.file.Close()
+}
+
+// auditTransport records each request made through it in an AuditLog. A
+// request whose record cannot be written fails, so nothing is sent unaudited.
+type auditTransport struct {
+	base     http.RoundTripper
+	provider string
+	log      *AuditLog
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var payload []byte
+	if req.Body != nil {
+		var err error
+		if payload, err = io.ReadAll(req.Body); err != nil {
+			return nil, fmt.Errorf("error reading request for audit: %w", err)
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(payload))
+	}
+	var request struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(payload, &request)
+	hash := sha256.Sum256(payload)
+
+	started := time.Now()
+	record := AuditRecord{
+		Timestamp:     started.UTC().Format(time.RFC3339Nano),
+		Provider:      t.provider,
+		Model:         request.Model,
+		Endpoint:      req.URL.Host + req.URL.Path,
+		PayloadSHA256: hex.EncodeToString(hash[:]),
+		PayloadBytes:  len(payload),
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		record.DurationMs = time.Since(started).Milliseconds()
+		record.Error = err.Error()
+		if auditErr := t.log.Write(record); auditErr != nil {
+			return nil, fmt.Errorf("error writing audit log: %w", auditErr)
+		}
+		return nil, err
+	}
+
+	// Read the body to find the token counts, then hand it back unchanged
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var usage struct {
+		Usage TokenUsage `json:"usage"`
+	}
+	json.Unmarshal(body, &usage)
+
+	record.DurationMs = time.Since(started).Milliseconds()
+	record.Status = resp.StatusCode
+	record.PromptTokens = usage.Usage.PromptTokens
+	record.CompletionTokens = usage.Usage.CompletionTokens
+	record.TotalTokens = usage.Usage.TotalTokens
+	if err := t.log.Write(record); err != nil {
+		return nil, fmt.Errorf("error writing audit log: %w", err)
+	}
+	return resp, nil
+}
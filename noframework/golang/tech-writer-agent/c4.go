@@ -0,0 +1,312 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PresetC4 documents the architecture as C4 model views (--preset c4)
+const PresetC4 = "c4"
+
+// The --c4-syntax of the C4 diagrams
+const (
+	C4Mermaid     = "mermaid"     // Mermaid's C4Context, C4Container and C4Component diagrams
+	C4Structurizr = "structurizr" // one Structurizr DSL workspace with the views
+)
+
+// C4_PROMPT is the task of --preset c4, which c4SyntaxPrompt completes
+const C4_PROMPT = `Document the software architecture of this repository as C4 model views, for an architecture review. Work it out from the code, the manifests, the deployment files (Dockerfiles, docker-compose, Kubernetes, Terraform, CI) and the configuration:
+- the people who use the system and the external systems it depends on or serves, such as identity providers, payment services, third-party APIs and email;
+- its containers: the units deployed or run separately, such as web apps, APIs, workers, command-line tools, databases, caches and queues, with their technology;
+- the components inside the most important containers: the major packages, modules or services and how they call each other.
+
+Start with a level-1 heading naming the system and a short paragraph on what it does. Then use these level-2 headings, in this order:
+## System Context
+The context view: the system as one box, its users and the external systems, and what flows between them. Follow it with a table of the people and external systems and their roles.
+## Containers
+The container view: the containers inside the system boundary with their technology and how they communicate (protocol, synchronous or not), with the users and external systems of the context view. Follow it with a table of the containers: name, technology, responsibility and where its code lives.
+## Components
+A level-3 heading and a component view for each container with meaningful internal structure, at most three, each followed by a table of its components and where their code lives.
+## Assumptions and gaps
+What the files don't show and you inferred, such as the deployment topology or external systems only named in configuration, so that reviewers know what to check.
+
+Every element and relationship must come from the files: cite the file that shows it in the tables. Label each relationship with a short verb phrase, e.g. "Reads orders from", and its technology where known, e.g. "JSON/HTTPS", "SQL" or "AMQP". Keep each view to about 15 elements.`
+
+// C4_MERMAID_PROMPT asks for the views as Mermaid diagrams, in the syntax
+// validateC4 accepts
+const C4_MERMAID_PROMPT = `Draw each view as a fenced ` + "```mermaid" + ` block in its section, in Mermaid's C4 syntax: C4Context for the context view, C4Container for the container view and C4Component for a component view. Write one statement per line, for example:
+C4Container
+title Containers of Shop
+Person(customer, "Customer", "Buys products")
+System_Ext(payments, "Stripe", "Card payments")
+System_Boundary(shop, "Shop") {
+  Container(web, "Web app", "React", "The storefront")
+  ContainerDb(db, "Database", "PostgreSQL", "Orders and products")
+}
+Rel(customer, web, "Browses", "HTTPS")
+Rel(web, payments, "Charges cards with", "JSON/HTTPS")
+Rel(web, db, "Reads and writes", "SQL")
+Aliases are letters, digits and underscores. Declare each element once per diagram, quote every label, description and technology, and only relate aliases declared in the same diagram.`
+
+// C4_STRUCTURIZR_PROMPT asks for the views as one Structurizr DSL workspace,
+// in the syntax validateStructurizr accepts
+const C4_STRUCTURIZR_PROMPT = `Write the model and its views as one Structurizr DSL workspace, in a single fenced ` + "```structurizr" + ` block under a last level-2 heading, ## Workspace. Declare every person, software system, container and component once, with an identifier, and the relationships between them. Define the views in its views block: a systemContext view, a container view and a component view for each container described, each including * with autoLayout and with a key. Don't draw the views in the other sections: name the view's key there, and keep their tables. Identifiers are letters, digits and underscores, and relationships are written as source -> destination "Description" "Technology" between declared identifiers. For example:
+workspace "Shop" {
+  model {
+    customer = person "Customer" "Buys products"
+    payments = softwareSystem "Stripe" "Card payments"
+    shop = softwareSystem "Shop" {
+      web = container "Web app" "The storefront" "React"
+      db = container "Database" "Orders and products" "PostgreSQL"
+    }
+    customer -> web "Browses" "HTTPS"
+    web -> payments "Charges cards with" "JSON/HTTPS"
+    web -> db "Reads and writes" "SQL"
+  }
+  views {
+    systemContext shop "context" {
+      include *
+      autoLayout
+    }
+    container shop "containers" {
+      include *
+      autoLayout
+    }
+  }
+}`
+
+// c4SyntaxPrompt returns the instructions of --preset c4 for syntax
+func c4SyntaxPrompt(syntax string) string {
+	if syntax == C4Structurizr {
+		return C4_STRUCTURIZR_PROMPT
+	}
+	return C4_MERMAID_PROMPT
+}
+
+// c4Statement matches a statement of a Mermaid C4 diagram, a macro call
+// such as Rel(a, b, "Uses") that may open a boundary's block
+var c4Statement = regexp.MustCompile(`^([A-Za-z_]+)\s*\((.*)\)\s*(\{)?$`)
+
+// The Mermaid C4 macros: those that declare an element, a boundary with a
+// block, or a relationship, and those that only style the diagram
+var (
+	c4Elements = map[string]bool{
+		"Person": true, "Person_Ext": true,
+		"System": true, "System_Ext": true, "SystemDb": true, "SystemDb_Ext": true, "SystemQueue": true, "SystemQueue_Ext": true,
+		"Container": true, "Container_Ext": true, "ContainerDb": true, "ContainerDb_Ext": true, "ContainerQueue": true, "ContainerQueue_Ext": true,
+		"Component": true, "Component_Ext": true, "ComponentDb": true, "ComponentDb_Ext": true, "ComponentQueue": true, "ComponentQueue_Ext": true,
+	}
+	c4Boundaries = map[string]bool{
+		"Boundary": true, "Enterprise_Boundary": true, "System_Boundary": true, "Container_Boundary": true,
+		"Deployment_Node": true, "Node": true, "Node_L": true, "Node_R": true,
+	}
+	c4Relationships = map[string]bool{
+		"Rel": true, "BiRel": true, "Rel_U": true, "Rel_Up": true, "Rel_D": true, "Rel_Down": true,
+		"Rel_L": true, "Rel_Left": true, "Rel_R": true, "Rel_Right": true, "Rel_Back": true,
+	}
+	c4Styles = map[string]bool{
+		"UpdateElementStyle": true, "UpdateRelStyle": true, "UpdateBoundaryStyle": true, "UpdateLayoutConfig": true,
+		"AddElementTag": true, "AddRelTag": true,
+	}
+)
+
+// validateC4 checks the statements of a Mermaid C4 diagram after its
+// declaration: the macros and their arguments, the boundaries' blocks, and
+// that relationships join declared elements
+func validateC4(lines []mermaidStatement) error {
+	declared := make(map[string]bool)
+	type relationship struct {
+		line     int
+		from, to string
+	}
+	var relationships []relationship
+	depth := 0
+	for _, line := range lines {
+		switch {
+		case line.text == "}":
+			if depth == 0 {
+				return fmt.Errorf("line %d: unbalanced \"}\"", line.number)
+			}
+			depth--
+			continue
+		case line.text == "{":
+			depth++
+			continue
+		case strings.HasPrefix(line.text, "title ") || line.text == "title":
+			continue
+		}
+		m := c4Statement.FindStringSubmatch(line.text)
+		if m == nil {
+			return fmt.Errorf("line %d: expected a C4 statement such as Container(alias, \"Label\"), found %q", line.number, truncateRunes(line.text, 40))
+		}
+		name, opens := m[1], m[3] != ""
+		if err := balanced(m[2]); err != nil {
+			return fmt.Errorf("line %d: %s: %v", line.number, name, err)
+		}
+		var args []string
+		for _, arg := range splitOutsideQuotes(m[2], ',') {
+			args = append(args, strings.Trim(strings.TrimSpace(arg), `"`))
+		}
+		switch {
+		case c4Elements[name] || c4Boundaries[name]:
+			if len(args) < 2 || args[0] == "" {
+				return fmt.Errorf("line %d: %s needs an alias and a label", line.number, name)
+			}
+			if opens && !c4Boundaries[name] {
+				return fmt.Errorf("line %d: %s can't open a block", line.number, name)
+			}
+			declared[args[0]] = true
+		case c4Relationships[name]:
+			if len(args) < 3 {
+				return fmt.Errorf("line %d: %s needs two aliases and a label", line.number, name)
+			}
+			relationships = append(relationships, relationship{line.number, args[0], args[1]})
+		case c4Styles[name] || name == "RelIndex":
+		default:
+			return fmt.Errorf("line %d: unknown C4 macro %q", line.number, name)
+		}
+		if opens {
+			depth++
+		}
+	}
+	if depth > 0 {
+		return fmt.Errorf("%d unclosed \"{\"", depth)
+	}
+	for _, rel := range relationships {
+		for _, alias := range []string{rel.from, rel.to} {
+			if !declared[alias] {
+				return fmt.Errorf("line %d: relationship with undeclared element %q", rel.line, alias)
+			}
+		}
+	}
+	return nil
+}
+
+var (
+	// structurizrAssignment declares an identifier, as in web = container "Web"
+	structurizrAssignment = regexp.MustCompile(`^([A-Za-z0-9_-]+)\s*=\s*[A-Za-z]`)
+	// structurizrRelationship is a relationship, whose source may be implied
+	// inside the block of an element
+	structurizrRelationship = regexp.MustCompile(`^(?:(\S+)\s+)?->\s*(\S+)`)
+	// structurizrView is a view of an element, with its scope
+	structurizrView = regexp.MustCompile(`^(systemContext|container|component|dynamic|deployment)\s+([^\s"{]+)`)
+)
+
+// validateStructurizr checks a Structurizr DSL workspace: its declaration,
+// closed quotes and balanced braces, that it has a model and views, and
+// that relationships and views refer to declared identifiers. Like
+// validateMermaid, it is a check of the mistakes models make, not a parser.
+func validateStructurizr(source string) (string, error) {
+	var lines []mermaidStatement
+	comment := false
+	for i, text := range strings.Split(source, "\n") {
+		text = strings.TrimSpace(text)
+		if comment {
+			if _, after, ok := strings.Cut(text, "*/"); ok {
+				comment, text = false, strings.TrimSpace(after)
+			} else {
+				continue
+			}
+		}
+		if strings.HasPrefix(text, "/*") {
+			if _, after, ok := strings.Cut(text[2:], "*/"); ok {
+				text = strings.TrimSpace(after)
+			} else {
+				comment = true
+				continue
+			}
+		}
+		if text != "" && !strings.HasPrefix(text, "#") && !strings.HasPrefix(text, "//") {
+			lines = append(lines, mermaidStatement{number: i + 1, text: text})
+		}
+	}
+	if len(lines) == 0 {
+		return "", fmt.Errorf("the workspace is empty")
+	}
+	if !strings.HasPrefix(lines[0].text, "workspace") {
+		return "", fmt.Errorf("line %d: expected the workspace declaration, found %q", lines[0].number, truncateRunes(lines[0].text, 40))
+	}
+
+	declared := map[string]bool{"this": true}
+	type reference struct {
+		line int
+		id   string
+	}
+	var references []reference
+	sections := make(map[string]bool)
+	depth, hierarchical := 0, false
+	for _, line := range lines {
+		if strings.Count(line.text, `"`)%2 != 0 {
+			return "workspace", fmt.Errorf("line %d: unclosed quote", line.number)
+		}
+		unquoted := strings.Join(splitQuoted(line.text), " ")
+		if depth == 1 {
+			sections[strings.Fields(unquoted + " {")[0]] = true
+		}
+		if strings.HasPrefix(line.text, "!identifiers") && strings.Contains(line.text, "hierarchical") {
+			hierarchical = true
+		}
+		if m := structurizrAssignment.FindStringSubmatch(line.text); m != nil {
+			declared[m[1]] = true
+		} else if m := structurizrRelationship.FindStringSubmatch(line.text); m != nil {
+			for _, id := range m[1:] {
+				if id != "" {
+					references = append(references, reference{line.number, id})
+				}
+			}
+		} else if m := structurizrView.FindStringSubmatch(line.text); m != nil && m[2] != "*" {
+			references = append(references, reference{line.number, m[2]})
+		}
+		depth += strings.Count(unquoted, "{") - strings.Count(unquoted, "}")
+		if depth < 0 {
+			return "workspace", fmt.Errorf("line %d: unbalanced \"}\"", line.number)
+		}
+	}
+	if depth > 0 {
+		return "workspace", fmt.Errorf("%d unclosed \"{\"", depth)
+	}
+	for _, section := range []string{"model", "views"} {
+		if !sections[section] {
+			return "workspace", fmt.Errorf("the workspace has no %s block", section)
+		}
+	}
+	for _, ref := range references {
+		// Hierarchical identifiers such as shop.web are declared by parts
+		if hierarchical || strings.Contains(ref.id, ".") {
+			continue
+		}
+		if !declared[ref.id] {
+			return "workspace", fmt.Errorf("line %d: undeclared identifier %q", ref.line, ref.id)
+		}
+	}
+	return "workspace", nil
+}
+
+// splitQuoted returns the parts of text outside double quotes
+func splitQuoted(text string) []string {
+	parts := strings.Split(text, `"`)
+	var outside []string
+	for i := 0; i < len(parts); i += 2 {
+		outside = append(outside, parts[i])
+	}
+	return outside
+}
+
+// c4Workspace returns the Structurizr DSL of document's first structurizr
+// block, or "" if it has none
+func c4Workspace(document string) string {
+	for _, diagram := range findDiagrams(strings.Split(document, "\n")) {
+		if diagram.Language == C4Structurizr {
+			return strings.TrimSpace(diagram.Source) + "\n"
+		}
+	}
+	return ""
+}
+
+// c4WorkspacePath is where the workspace of the result saved at outputFile
+// goes, next to it as a .dsl file
+func c4WorkspacePath(outputFile string) string {
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".dsl"
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateStructurizr(t *testing.T) {
+	workspace := `workspace "Shop" {
+  /* The model
+     and its views */
+  model {
+    customer = person "Customer" "Buys {things}"
+    shop = softwareSystem "Shop" {
+      web = container "Web app" "The storefront" "React" {
+        -> db "Reads from"
+      }
+      db = container "Database"
+    }
+    # Comments aren't statements -> nowhere
+    customer -> web "Browses" "HTTPS"
+  }
+  views {
+    systemContext shop "context" {
+      include *
+      autoLayout
+    }
+    container shop "containers" {
+      include *
+    }
+  }
+}`
+	tests := []struct {
+		name      string
+		workspace string
+		wantErr   string // "" for valid
+	}{
+		{"workspace", workspace, ""},
+		{"hierarchical identifiers", "workspace {\n  !identifiers hierarchical\n  model {\n    s = softwareSystem \"S\" {\n      a = container \"A\"\n    }\n    s.a -> s \"Uses\"\n  }\n  views {\n  }\n}", ""},
+		{"undeclared identifier", strings.Replace(workspace, "customer -> web", "customer -> api", 1), `line 13: undeclared identifier "api"`},
+		{"undeclared view scope", strings.Replace(workspace, "container shop", "container store", 1), `undeclared identifier "store"`},
+		{"unclosed quote", strings.Replace(workspace, `"Browses"`, `"Browses`, 1), "line 13: unclosed quote"},
+		{"unbalanced braces", strings.TrimSuffix(workspace, "}"), `1 unclosed "{"`},
+		{"no views", "workspace {\n  model {\n  }\n}", "the workspace has no views block"},
+		{"not a workspace", "model {\n}", "expected the workspace declaration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateStructurizr(tt.workspace)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validateStructurizr() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("validateStructurizr() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// checkDiagrams checks the workspace of a C4 result too
+	document := "# Shop\n\n## Workspace\n\n```structurizr\n" + strings.TrimSuffix(workspace, "}") + "\n```\n"
+	if _, checks := checkDiagrams(document, nil); len(checks) != 1 || checks[0].Valid || checks[0].Type != "workspace" {
+		t.Errorf("checkDiagrams() = %+v, want one invalid workspace", checks)
+	}
+	if got := c4Workspace(document); !strings.HasPrefix(got, "workspace \"Shop\" {\n") || !strings.HasSuffix(got, "  }\n") {
+		t.Errorf("c4Workspace() = %q", got)
+	}
+}
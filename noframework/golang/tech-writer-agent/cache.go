@@ -0,0 +1,250 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CachedRepo is one clone in the cache directory
+type CachedRepo struct {
+	Name     string // owner/repo, or owner/repo@ref
+	Path     string
+	Size     int64     // bytes on disk, .git included
+	LastUsed time.Time // when it was cloned or last reused
+}
+
+// listCache returns the clones in cacheDir, most recently used first. The
+// cache holds owner/repo directories; dot-directories such as the memory
+// notes are not clones.
+func listCache(cacheDir string) ([]CachedRepo, error) {
+	cacheDir = expandHome(cacheDir)
+	owners, err := os.ReadDir(cacheDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache directory: %w", err)
+	}
+	var repos []CachedRepo
+	for _, owner := range owners {
+		if !owner.IsDir() || strings.HasPrefix(owner.Name(), ".") {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(cacheDir, owner.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading cache directory: %w", err)
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || !entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(cacheDir, owner.Name(), entry.Name())
+			repos = append(repos, CachedRepo{
+				Name:     owner.Name() + "/" + entry.Name(),
+				Path:     path,
+				Size:     diskUsage(path),
+				LastUsed: info.ModTime(),
+			})
+		}
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].LastUsed.After(repos[j].LastUsed) })
+	return repos, nil
+}
+
+// diskUsage adds up the sizes of the files under dir, skipping what can't be
+// read
+func diskUsage(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			if info, err := entry.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// touchCachedRepo marks a reused clone as used now, for the age limit
+func touchCachedRepo(path string) {
+	now := time.Now()
+	os.Chtimes(path, now, now)
+}
+
+// pruneCache removes the clones in cacheDir unused for longer than maxAge,
+// then the least recently used until the rest fit in maxSize. A zero limit
+// doesn't apply; the clone at keep, the one about to be analysed, is never
+// removed. It returns the removed clones.
+func pruneCache(cacheDir string, maxAge time.Duration, maxSize int64, keep string) ([]CachedRepo, error) {
+	repos, err := listCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, repo := range repos {
+		total += repo.Size
+	}
+	var removed []CachedRepo
+	// Oldest first
+	for i := len(repos) - 1; i >= 0; i-- {
+		repo := repos[i]
+		tooOld := maxAge > 0 && time.Since(repo.LastUsed) > maxAge
+		tooBig := maxSize > 0 && total > maxSize
+		if (!tooOld && !tooBig) || sameDir(repo.Path, keep) {
+			continue
+		}
+		if err := removeCachedRepo(repo.Path); err != nil {
+			return removed, fmt.Errorf("error removing %s: %w", repo.Name, err)
+		}
+		total -= repo.Size
+		removed = append(removed, repo)
+	}
+	return removed, nil
+}
+
+// clearCache removes every clone in cacheDir, leaving the memory notes
+func clearCache(cacheDir string) ([]CachedRepo, error) {
+	repos, err := listCache(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	for i, repo := range repos {
+		if err := removeCachedRepo(repo.Path); err != nil {
+			return repos[:i], fmt.Errorf("error removing %s: %w", repo.Name, err)
+		}
+	}
+	return repos, nil
+}
+
+// removeCachedRepo removes a clone, or a tree extracted from a tarball with
+// the record of its commit
+func removeCachedRepo(path string) error {
+	os.Remove(path + TARBALL_COMMIT_SUFFIX)
+	return os.RemoveAll(path)
+}
+
+// sameDir reports whether the paths name the same directory
+func sameDir(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// parseAge parses a cache age limit: a Go duration such as "12h", or a
+// number of days such as "30d"
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid age %q", value)
+		}
+		return time.Duration(n * 24 * float64(time.Hour)), nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return age, nil
+}
+
+// parseSize parses a cache size limit in bytes, or with a KB, MB or GB
+// suffix (powers of 1024; "5G" and "5GB" are the same)
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40} {
+		if trimmed, ok := strings.CutSuffix(number, suffix); ok {
+			number, multiplier = trimmed, m
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// runCache implements the cache command, which lists, prunes or clears the
+// cloned repositories in the cache directory
+func runCache(argv []string) error {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	cacheDir := fs.String("cache-dir", "~/.cache/github", "Directory of cached repositories")
+	var maxAge time.Duration
+	var maxSize int64
+	fs.Func("max-age", "prune: remove clones unused for longer than this, e.g. 30d or 12h", func(value string) (err error) {
+		maxAge, err = parseAge(value)
+		return err
+	})
+	fs.Func("max-size", "prune: then remove the least recently used clones until the cache fits in this, e.g. 5GB", func(value string) (err error) {
+		maxSize, err = parseSize(value)
+		return err
+	})
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cache list|prune|clear [--cache-dir DIR] [--max-age AGE] [--max-size SIZE]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	if len(argv) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no cache command given")
+	}
+	command := argv[0]
+	fs.Parse(argv[1:])
+
+	switch command {
+	case "list":
+		repos, err := listCache(*cacheDir)
+		if err != nil {
+			return err
+		}
+		var total int64
+		out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(out, "REPOSITORY\tSIZE\tLAST USED")
+		for _, repo := range repos {
+			total += repo.Size
+			fmt.Fprintf(out, "%s\t%s\t%s\n", repo.Name, formatBytes(int(repo.Size)), repo.LastUsed.Format("2006-01-02 15:04"))
+		}
+		out.Flush()
+		fmt.Printf("%d repositories, %s in %s\n", len(repos), formatBytes(int(total)), expandHome(*cacheDir))
+		return nil
+
+	case "prune", "clear":
+		var removed []CachedRepo
+		var err error
+		if command == "prune" {
+			if maxAge == 0 && maxSize == 0 {
+				return fmt.Errorf("cache prune needs --max-age or --max-size")
+			}
+			removed, err = pruneCache(*cacheDir, maxAge, maxSize, "")
+		} else {
+			removed, err = clearCache(*cacheDir)
+		}
+		var freed int64
+		for _, repo := range removed {
+			freed += repo.Size
+			fmt.Printf("removed %s (%s)\n", repo.Name, formatBytes(int(repo.Size)))
+		}
+		fmt.Printf("%d repositories removed, %s freed\n", len(removed), formatBytes(int(freed)))
+		return err
+
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown cache command %q", command)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneCache(t *testing.T) {
+	cacheDir := writeFixture(t, map[string]string{
+		"a/old/data":                 strings.Repeat("x", 1000),
+		"a/recent/data":              strings.Repeat("x", 1000),
+		"b/large@v1/data":            strings.Repeat("x", 3000),
+		"b/current/data":             strings.Repeat("x", 1000),
+		".tech-writer-memory/a.json": "{}",
+	})
+	now := time.Now()
+	for name, age := range map[string]time.Duration{"a/old": 40 * 24 * time.Hour, "b/large@v1": 2 * time.Hour, "a/recent": time.Hour, "b/current": 0} {
+		if err := os.Chtimes(filepath.Join(cacheDir, name), now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	repos, err := listCache(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, repo := range repos {
+		names = append(names, repo.Name)
+	}
+	if want := []string{"b/current", "a/recent", "b/large@v1", "a/old"}; !slices.Equal(names, want) {
+		t.Errorf("listCache() = %v, want %v", names, want)
+	}
+
+	// The old clone goes by age, then the least recently used until 2500
+	// bytes remain, sparing the one in use
+	removed, err := pruneCache(cacheDir, 30*24*time.Hour, 2500, filepath.Join(cacheDir, "a", "recent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, repo := range removed {
+		names = append(names, repo.Name)
+	}
+	if want := []string{"a/old", "b/large@v1"}; !slices.Equal(names, want) {
+		t.Errorf("pruneCache() removed %v, want %v", names, want)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, ".tech-writer-memory", "a.json")); err != nil {
+		t.Errorf("pruneCache() removed the memory notes: %v", err)
+	}
+}
+
+func TestParseCacheLimits(t *testing.T) {
+	ages := map[string]time.Duration{"30d": 30 * 24 * time.Hour, "12h": 12 * time.Hour, "1.5d": 36 * time.Hour}
+	for value, want := range ages {
+		if got, err := parseAge(value); err != nil || got != want {
+			t.Errorf("parseAge(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	sizes := map[string]int64{"5GB": 5 << 30, "5g": 5 << 30, "500MB": 500 << 20, "1.5K": 1536, "2048": 2048}
+	for value, want := range sizes {
+		if got, err := parseSize(value); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "-1d", "soon", "5XB"} {
+		if _, err := parseAge(value); err == nil {
+			t.Errorf("parseAge(%q) succeeded", value)
+		}
+	}
+	for _, value := range []string{"", "-5MB", "5XB"} {
+		if _, err := parseSize(value); err == nil {
+			t.Errorf("parseSize(%q) succeeded", value)
+		}
+	}
+}
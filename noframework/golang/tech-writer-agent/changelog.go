@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PresetChangelog writes a changelog between two tags (--preset changelog)
+const PresetChangelog = "changelog"
+
+// CHANGELOG_MAX_COMMITS caps the commits listed in the changelog prompt
+const CHANGELOG_MAX_COMMITS = 500
+
+// CHANGELOG_PROMPT is the task of --preset changelog, which the commits and
+// changes of the release precede
+const CHANGELOG_PROMPT = `Write the changelog of this release for the project's users, from the commits and changes above.
+
+Start with a level-1 heading naming the release and the one it follows, then group the entries under these level-2 headings, in this order:
+## Breaking changes
+Anything that requires users to change their code, configuration or commands: removed or renamed APIs, options and files, changed defaults and behaviour, raised requirements. Commits marked [breaking] say so themselves. Write "None." if there are none, so readers know to upgrade freely.
+## Features
+New functionality and notable improvements.
+## Fixes
+Bugs fixed, described by the problem users saw.
+## Other changes
+Only what users may notice otherwise, such as performance, documentation or dependency updates; leave this section out if there is nothing.
+
+Each entry is one line in plain language saying what changed for users, not how, followed by the short commit hashes (and pull request numbers from the messages) in parentheses. Merge commits that belong to one change into one entry. Skip merge commits, version bumps and changes to CI, tests or internal refactoring that users don't see. When a commit message doesn't make its effect clear, read its changes with git_diff before classifying it; for each breaking change, say what users must do.`
+
+// breakingSubjectPattern matches a Conventional Commits subject marked as a
+// breaking change, such as "feat!: ..." or "fix(api)!: ..."
+var breakingSubjectPattern = regexp.MustCompile(`^[A-Za-z]+(?:\([^)]*\))?!:`)
+
+// previousTag returns the latest tag before ref in directory, the start of
+// the release ref ends. A shallow clone lacks the history to tell, so for a
+// clone it is the origin's tag that comes before ref in version order, or
+// the highest if ref isn't a tag.
+func previousTag(directory, ref string, cloned bool) (string, error) {
+	output, err := runGit(directory, "describe", "--tags", "--abbrev=0", ref+"^")
+	if err == nil || !cloned {
+		return strings.TrimSpace(output), err
+	}
+	remote, lsErr := runGit(directory, "ls-remote", "--tags", "--refs", "origin")
+	if lsErr != nil {
+		return "", err
+	}
+	previous := ""
+	refIsTag := strings.Contains(remote+"\n", "\trefs/tags/"+ref+"\n")
+	for _, line := range strings.Split(remote, "\n") {
+		_, name, ok := strings.Cut(strings.TrimSpace(line), "\trefs/tags/")
+		if !ok || name == ref || (refIsTag && compareVersions(name, ref) > 0) {
+			continue
+		}
+		if previous == "" || compareVersions(name, previous) > 0 {
+			previous = name
+		}
+	}
+	if previous == "" {
+		return "", err
+	}
+	return previous, nil
+}
+
+// compareVersions orders version tags such as v1.9.0 and v1.10.0 by their
+// numbers rather than as text: runs of digits compare as numbers, the rest
+// as text
+func compareVersions(a, b string) int {
+	for a != "" && b != "" {
+		aRun, bRun := versionRun(a), versionRun(b)
+		a, b = a[len(aRun):], b[len(bRun):]
+		aNumber, bNumber := aRun[0] >= '0' && aRun[0] <= '9', bRun[0] >= '0' && bRun[0] <= '9'
+		switch {
+		case aNumber && bNumber:
+			aRun, bRun = strings.TrimLeft(aRun, "0"), strings.TrimLeft(bRun, "0")
+			if len(aRun) != len(bRun) {
+				return len(aRun) - len(bRun)
+			}
+		case aNumber != bNumber:
+			if aNumber {
+				return 1
+			}
+			return -1
+		}
+		if c := strings.Compare(aRun, bRun); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// versionRun returns the run of digits or of other characters s starts with
+func versionRun(s string) string {
+	digit := s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digit {
+		i++
+	}
+	return s[:i]
+}
+
+// changelogChanges describes the commits and changes of diffRange for the
+// prompt of --preset changelog. A shallow clone is first deepened back to
+// diffRange's start where it can be.
+func changelogChanges(directory string, cloned bool, diffRange *DiffRange) (string, error) {
+	shallow := false
+	if output, err := runGit(directory, "rev-parse", "--is-shallow-repository"); err == nil && strings.TrimSpace(output) == "true" {
+		shallow = true
+		if cloned {
+			// The clone stays shallow, but from diffRange's start on
+			_, err := runGit(directory, "fetch", "--quiet", "--shallow-exclude="+diffRange.From, "origin", diffRange.ToCommit)
+			shallow = err != nil
+		}
+	}
+
+	// Each commit starts with a record separator; fields are unit-separated
+	output, err := runGit(directory, "log", "--format=%x1e%h%x1f%s%x1f%b", diffRange.FromCommit+".."+diffRange.ToCommit)
+	if err != nil {
+		return "", err
+	}
+	var commits []string
+	for _, record := range strings.Split(output, "\x1e") {
+		fields := strings.SplitN(record, "\x1f", 3)
+		if len(fields) < 3 {
+			continue
+		}
+		line := fields[0] + " " + fields[1]
+		if breakingSubjectPattern.MatchString(fields[1]) || strings.Contains(fields[2], "BREAKING CHANGE") {
+			line += " [breaking]"
+		}
+		commits = append(commits, line)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "The release goes from %s (commit %s) to %s (commit %s).\n\n", diffRange.From, diffRange.FromCommit, diffRange.To, diffRange.ToCommit)
+	fmt.Fprintf(&b, "Commits (%d, newest first):\n", len(commits))
+	for i, commit := range commits {
+		if i == CHANGELOG_MAX_COMMITS {
+			fmt.Fprintf(&b, "  ... and %d more; use git_log for them\n", len(commits)-i)
+			break
+		}
+		fmt.Fprintf(&b, "  %s\n", commit)
+	}
+	if shallow {
+		fmt.Fprintf(&b, "The clone's history may not reach back to %s, so commits may be missing; rely on the diff for what changed.\n", diffRange.From)
+	}
+	b.WriteString("\n")
+	changes, err := describeChanges(directory, diffRange)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(changes)
+	return b.String(), nil
+}
+
+// changelogFileName names the changelog of repoName's release diffRange,
+// e.g. "widget-changelog-v1.1.0..v1.2.0.md"
+func changelogFileName(repoName string, diffRange *DiffRange, extension string) string {
+	return sanitizeFilename(fmt.Sprintf("%s-changelog-%s..%s", repoName, diffRange.From, diffRange.To)) + extension
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	ordered := []string{"v0.9", "v1.2.0", "v1.2.0-rc1", "v1.9.0", "v1.10.0", "v1.10.1", "v2", "v10.0"}
+	for i := 1; i < len(ordered); i++ {
+		if compareVersions(ordered[i-1], ordered[i]) >= 0 || compareVersions(ordered[i], ordered[i-1]) <= 0 {
+			t.Errorf("compareVersions(%q, %q) doesn't order them", ordered[i-1], ordered[i])
+		}
+	}
+	if compareVersions("v1.02", "v1.2") != 0 {
+		t.Errorf("compareVersions() compares leading zeros")
+	}
+}
+
+// gitFixture runs the git commands in dir, each given as its arguments
+func gitFixture(t *testing.T, dir string, commands ...[]string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	for _, args := range commands {
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=t", "-c", "user.email=t@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+}
+
+func TestChangelogChanges(t *testing.T) {
+	repo := t.TempDir()
+	gitFixture(t, repo, []string{"init", "-q"})
+	commit := func(file, message string, tag ...string) {
+		if err := os.WriteFile(filepath.Join(repo, file), []byte(message), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitFixture(t, repo, []string{"add", "-A"}, []string{"commit", "-q", "-m", message})
+		if len(tag) > 0 {
+			gitFixture(t, repo, []string{"tag", tag[0]})
+		}
+	}
+	commit("a.txt", "initial", "v1.9.0")
+	commit("a.txt", "fix: old bug", "v1.10.0")
+	commit("b.txt", "feat!: drop the old API")
+	commit("c.txt", "Add widgets\n\nBREAKING CHANGE: widgets replace gadgets", "v1.11.0")
+
+	// In the repository, the tag before the release comes from its history
+	if tag, err := previousTag(repo, "v1.11.0", false); err != nil || tag != "v1.10.0" {
+		t.Errorf("previousTag() = %q, %v, want v1.10.0", tag, err)
+	}
+
+	// A shallow clone has only the release's commit, so the origin's tags
+	// are compared instead, and the history is fetched back to the start
+	clone := filepath.Join(t.TempDir(), "clone")
+	gitFixture(t, repo, []string{"clone", "-q", "--depth", "1", "--branch", "v1.11.0", "file://" + repo, clone})
+	from, err := previousTag(clone, "v1.11.0", true)
+	if err != nil || from != "v1.10.0" {
+		t.Fatalf("previousTag() in a clone = %q, %v, want v1.10.0", from, err)
+	}
+	diffRange, err := resolveDiffRange(clone, true, from, "v1.11.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := changelogChanges(clone, true, diffRange)
+	if err != nil {
+		t.Fatalf("changelogChanges() = %v", err)
+	}
+	for _, want := range []string{"Commits (2, newest first):", " Add widgets [breaking]\n", " feat!: drop the old API [breaking]\n", "Changed files (2, +4 -0 lines):"} {
+		if !strings.Contains(changes, want) {
+			t.Errorf("changelogChanges() lacks %q in:\n%s", want, changes)
+		}
+	}
+	if strings.Contains(changes, "old bug") || strings.Contains(changes, "may not reach back") {
+		t.Errorf("changelogChanges() reaches beyond the release or misses history:\n%s", changes)
+	}
+
+	if name := changelogFileName("widget", diffRange, ".md"); name != "widget-changelog-v1.10.0..v1.11.0.md" {
+		t.Errorf("changelogFileName() = %q", name)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runFollowUpChat reads follow-up questions from in, one per line, and writes
+// the agent's answers to out until the user types "exit" or input ends
+func runFollowUpChat(agent FollowUpAgent, in io.Reader, out io.Writer) error {
+	fmt.Fprintln(out, "\nAsk follow-up questions about the codebase (type \"exit\" or press Ctrl-D to finish).")
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(out, "\n> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		question := strings.TrimSpace(scanner.Text())
+		switch strings.ToLower(question) {
+		case "":
+			continue
+		case "exit", "quit":
+			return nil
+		}
+
+		answer, err := agent.FollowUp(question)
+		if err != nil {
+			fmt.Fprintf(out, "Error: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(out, "\n%s\n", answer)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Kinds of file content. The file tools read text and UTF-16 text (decoded),
+// skip binary files, and read minified files and lockfiles only when asked
+// to, since they fill the context with little the model can use.
+const (
+	FileText     = "text"
+	FileUTF16    = "utf-16 text"
+	FileBinary   = "binary"
+	FileMinified = "minified"
+	FileLockfile = "lockfile"
+)
+
+// Limits of the file classification
+const (
+	CLASSIFY_SAMPLE_BYTES = 8 * 1024 // read from the start of a file
+	MINIFIED_MIN_BYTES    = 4 * 1024 // smaller files are never classified minified
+	MINIFIED_LINE_CHARS   = 1000     // a line at least this long...
+	MINIFIED_AVERAGE_LINE = 250      // ...with lines this long on average marks minified code
+	UTF16_MAX_BYTES       = 8 * 1024 * 1024
+)
+
+// lockfileNames are the files package managers generate to pin dependency
+// versions; the manifests say the same far more briefly
+var lockfileNames = map[string]bool{
+	"package-lock.json": true, "npm-shrinkwrap.json": true, "yarn.lock": true, "pnpm-lock.yaml": true,
+	"bun.lock": true, "Cargo.lock": true, "Gemfile.lock": true, "poetry.lock": true, "Pipfile.lock": true,
+	"uv.lock": true, "pdm.lock": true, "composer.lock": true, "go.sum": true, "mix.lock": true,
+	"pubspec.lock": true, "Podfile.lock": true, "packages.lock.json": true, "flake.lock": true,
+	"Package.resolved": true, "gradle.lockfile": true,
+}
+
+// proseExtensions are never classified minified: unwrapped paragraphs have
+// long lines too
+var proseExtensions = map[string]bool{".md": true, ".markdown": true, ".txt": true, ".rst": true, ".adoc": true, ".tex": true}
+
+// FileClass is what a file's content is and why it was classified so
+type FileClass struct {
+	Kind   string `json:"kind"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// fileClassLists are the extensions --text-extensions and
+// --binary-extensions classify without looking at the content
+var fileClassLists = struct {
+	sync.RWMutex
+	text   []string
+	binary []string
+}{}
+
+// setFileClassLists sets the extensions always read as text and those never
+// read
+func setFileClassLists(text, binary []string) {
+	fileClassLists.Lock()
+	defer fileClassLists.Unlock()
+	fileClassLists.text = text
+	fileClassLists.binary = binary
+}
+
+// parseExtensions splits a comma-separated list of extensions, such as
+// ".svg,min.js", into lower-case extensions with a leading dot
+func parseExtensions(value string) []string {
+	var extensions []string
+	for _, extension := range strings.Split(value, ",") {
+		extension = strings.ToLower(strings.TrimSpace(extension))
+		if extension == "" {
+			continue
+		}
+		if !strings.HasPrefix(extension, ".") {
+			extension = "." + extension
+		}
+		extensions = append(extensions, extension)
+	}
+	return extensions
+}
+
+// listedExtension returns the extension of extensions that name ends with,
+// or ""
+func listedExtension(name string, extensions []string) string {
+	name = strings.ToLower(name)
+	for _, extension := range extensions {
+		if strings.HasSuffix(name, extension) {
+			return extension
+		}
+	}
+	return ""
+}
+
+// classifyFile decides what a file's content is from its name, its size and
+// the first CLASSIFY_SAMPLE_BYTES of it
+func classifyFile(path string) FileClass {
+	name := filepath.Base(path)
+	fileClassLists.RLock()
+	text, binary := listedExtension(name, fileClassLists.text), listedExtension(name, fileClassLists.binary)
+	fileClassLists.RUnlock()
+	if text != "" {
+		return FileClass{Kind: FileText, Reason: fmt.Sprintf("--text-extensions lists %s", text)}
+	}
+	if binary != "" {
+		return FileClass{Kind: FileBinary, Reason: fmt.Sprintf("--binary-extensions lists %s", binary)}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return FileClass{Kind: FileBinary, Reason: "it could not be opened"}
+	}
+	defer file.Close()
+	sample := make([]byte, CLASSIFY_SAMPLE_BYTES)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FileClass{Kind: FileBinary, Reason: "it could not be read"}
+	}
+	sample = sample[:n]
+	size := int64(n)
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+
+	if class := classifyContent(sample); class.Kind != FileText {
+		return class
+	}
+	if lockfileNames[name] {
+		return FileClass{Kind: FileLockfile, Reason: fmt.Sprintf("%s is generated by a package manager to pin dependency versions", name)}
+	}
+	if size >= MINIFIED_MIN_BYTES && !proseExtensions[strings.ToLower(filepath.Ext(name))] {
+		if reason := minifiedReason(sample, size); reason != "" {
+			return FileClass{Kind: FileMinified, Reason: reason}
+		}
+	}
+	return FileClass{Kind: FileText}
+}
+
+// classifyContent tells text from UTF-16 text and binary content by the
+// first bytes of a file
+func classifyContent(sample []byte) FileClass {
+	if len(sample) >= 2 && (sample[0] == 0xFF && sample[1] == 0xFE || sample[0] == 0xFE && sample[1] == 0xFF) {
+		return FileClass{Kind: FileUTF16, Reason: "it starts with a UTF-16 byte order mark"}
+	}
+	if bytes.IndexByte(sample, 0) < 0 {
+		if printableShare(sample) < 0.8 {
+			return FileClass{Kind: FileBinary, Reason: "most of its first bytes are not printable text"}
+		}
+		return FileClass{Kind: FileText}
+	}
+	// UTF-16 without a byte order mark has a NUL in every other byte for
+	// ASCII text
+	if len(sample) >= 16 {
+		var even, odd int
+		for i, b := range sample {
+			if b == 0 && i%2 == 0 {
+				even++
+			} else if b == 0 {
+				odd++
+			}
+		}
+		half := len(sample) / 2
+		if (odd > half*9/10 && even == 0) || (even > half*9/10 && odd == 0) {
+			return FileClass{Kind: FileUTF16, Reason: "every other byte is NUL, as in UTF-16 text"}
+		}
+	}
+	return FileClass{Kind: FileBinary, Reason: "it contains NUL bytes"}
+}
+
+// printableShare is the share of the bytes of sample that are printable
+// UTF-8 text or whitespace. A character cut off at the end counts as text.
+func printableShare(sample []byte) float64 {
+	if len(sample) == 0 {
+		return 1
+	}
+	printable := 0
+	for i := 0; i < len(sample); {
+		r, width := utf8.DecodeRune(sample[i:])
+		if r == utf8.RuneError && width <= 1 {
+			if !utf8.FullRune(sample[i:]) {
+				printable += len(sample) - i
+				break
+			}
+			i++
+			continue
+		}
+		if unicode.IsPrint(r) || r == '\n' || r == '\r' || r == '\t' || r == '\f' || r == '\ufeff' {
+			printable += width
+		}
+		i += width
+	}
+	return float64(printable) / float64(len(sample))
+}
+
+// minifiedReason says why the sample of a file of the given size looks like
+// minified code, or returns "": one line running past the sample, or long
+// lines that are long on average too
+func minifiedReason(sample []byte, size int64) string {
+	if size > int64(len(sample)) && bytes.IndexByte(sample, '\n') < 0 {
+		return fmt.Sprintf("its first %s are a single line", formatBytes(len(sample)))
+	}
+	lines := bytes.Split(bytes.TrimRight(sample, "\n"), []byte("\n"))
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, utf8.RuneCount(line))
+	}
+	average := utf8.RuneCount(sample) / len(lines)
+	if longest >= MINIFIED_LINE_CHARS && average >= MINIFIED_AVERAGE_LINE {
+		return fmt.Sprintf("its lines average %d characters and the longest has %d", average, longest)
+	}
+	return ""
+}
+
+// readUTF16 decodes a UTF-16 file, little-endian unless its byte order mark
+// or NUL bytes say otherwise
+func readUTF16(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	bigEndian := false
+	switch {
+	case len(data) >= 2 && data[0] == 0xFE && data[1] == 0xFF:
+		bigEndian, data = true, data[2:]
+	case len(data) >= 2 && data[0] == 0xFF && data[1] == 0xFE:
+		data = data[2:]
+	case len(data) >= 2 && data[0] == 0 && data[1] != 0:
+		bigEndian = true
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
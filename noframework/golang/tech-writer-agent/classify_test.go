@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestClassifyFile(t *testing.T) {
+	utf16 := "\xff\xfe" + strings.Join(strings.Split("Hello, world\n", ""), "\x00") + "\x00"
+	dir := writeFixture(t, map[string]string{
+		"main.go":           "package main\n\nfunc main() {}\n",
+		"notes.md":          strings.Repeat("這是一段沒有換行的中文說明。", 400) + "\n",
+		"utf16.txt":         utf16,
+		"logo.png":          "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"vendor.min.js":     strings.Repeat("var a=function(){return 1};", 400),
+		"bundle.js":         strings.Repeat("!function(){"+strings.Repeat("a.b(c);", 200)+"}();\n", 10),
+		"small.min.js":      "var a=1;",
+		"package-lock.json": "{\"lockfileVersion\": 3}\n",
+		"data.snap":         "exports[`x`] = 1;\n",
+		"icon.svg":          "<svg>" + strings.Repeat("<path d=\"M0 0L10 10\"/>", 300) + "</svg>",
+	})
+	setFileClassLists([]string{".svg"}, []string{".snap"})
+	t.Cleanup(func() { setFileClassLists(nil, nil) })
+
+	tests := map[string]string{
+		"main.go":           FileText,
+		"notes.md":          FileText, // prose isn't minified, and isn't binary for being non-ASCII
+		"utf16.txt":         FileUTF16,
+		"logo.png":          FileBinary,
+		"vendor.min.js":     FileMinified,
+		"bundle.js":         FileMinified,
+		"small.min.js":      FileText,
+		"package-lock.json": FileLockfile,
+		"data.snap":         FileBinary,
+		"icon.svg":          FileText,
+	}
+	for name, want := range tests {
+		if got := classifyFile(filepath.Join(dir, name)); got.Kind != want {
+			t.Errorf("classifyFile(%s) = %+v, want %s", name, got, want)
+		} else if want != FileText && got.Reason == "" {
+			t.Errorf("classifyFile(%s) gives no reason", name)
+		}
+	}
+
+	content, err := readUTF16(filepath.Join(dir, "utf16.txt"))
+	if err != nil || content != "Hello, world\n" {
+		t.Errorf("readUTF16() = %q, %v", content, err)
+	}
+}
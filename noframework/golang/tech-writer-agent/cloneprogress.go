@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of the clone progress display
+const (
+	CLONE_PROGRESS_STEP   = 25 // percent between lines when not on a terminal
+	CLONE_MESSAGE_LINES   = 20 // git messages kept for error reports
+	DEFAULT_CLONE_TIMEOUT = 30 * time.Minute
+)
+
+// gitProgressLine matches git's progress lines, such as "Receiving objects:
+// 45% (450/1000), 1.20 MiB | 512.00 KiB/s" or "remote: Counting objects:
+// 100% (719/719), done."
+var gitProgressLine = regexp.MustCompile(`^(?:remote: )?([A-Z][a-z]+(?: [a-z]+)*):\s+(\d+)% \((\d+)/(\d+)\)(?:, ([^|,]+?))?(?: \| ([^,]+?))?(?:, done\.)?\s*$`)
+
+// cloneProgress renders the progress git reports while cloning, one
+// updating line per phase on a terminal and a line every
+// CLONE_PROGRESS_STEP percent elsewhere. It keeps git's other messages for
+// error reports.
+type cloneProgress struct {
+	mu       sync.Mutex
+	out      io.Writer // nil shows nothing (--quiet)
+	terminal bool
+	label    string
+	phase    string
+	shown    int // percent of the phase last shown
+	partial  []byte
+	messages []string
+}
+
+// newCloneProgress shows the progress of cloning label on out, or nothing if
+// out is nil
+func newCloneProgress(out io.Writer, label string) *cloneProgress {
+	return &cloneProgress{out: out, terminal: out != nil && isTerminal(out), label: label}
+}
+
+// Write takes git's stderr, whose progress lines end in carriage returns
+func (p *cloneProgress) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partial = append(p.partial, data...)
+	for {
+		end := bytes.IndexAny(p.partial, "\r\n")
+		if end < 0 {
+			break
+		}
+		p.line(strings.TrimSpace(string(p.partial[:end])))
+		p.partial = p.partial[end+1:]
+	}
+	return len(data), nil
+}
+
+func (p *cloneProgress) line(line string) {
+	if line == "" {
+		return
+	}
+	match := gitProgressLine.FindStringSubmatch(line)
+	if match == nil {
+		if len(p.messages) == CLONE_MESSAGE_LINES {
+			p.messages = p.messages[1:]
+		}
+		p.messages = append(p.messages, line)
+		return
+	}
+	if p.out == nil {
+		return
+	}
+	phase, percent := match[1], 0
+	fmt.Sscan(match[2], &percent)
+	text := fmt.Sprintf("%s: %s %d%% (%s/%s)", p.label, strings.ToLower(phase), percent, match[3], match[4])
+	if match[5] != "" {
+		text += ", " + match[5]
+	}
+	if match[6] != "" {
+		text += " | " + match[6]
+	}
+
+	newPhase := phase != p.phase
+	if p.terminal {
+		if newPhase && p.phase != "" {
+			fmt.Fprintln(p.out)
+		}
+		fmt.Fprintf(p.out, "\r\033[K%s", text)
+	} else if newPhase || percent >= p.shown+CLONE_PROGRESS_STEP || (percent == 100 && p.shown < 100) {
+		fmt.Fprintln(p.out, text)
+	} else {
+		return
+	}
+	p.phase, p.shown = phase, percent
+}
+
+// done ends the progress display
+func (p *cloneProgress) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.terminal && p.phase != "" {
+		fmt.Fprintln(p.out)
+	}
+	p.phase, p.shown = "", 0
+}
+
+// message returns git's messages other than progress, for an error
+func (p *cloneProgress) message() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return strings.Join(p.messages, "\n")
+}
+
+// cloneSession runs the git commands of one clone or refresh under a shared
+// deadline (--clone-timeout), showing the progress of the downloads
+type cloneSession struct {
+	ctx      context.Context
+	timeout  time.Duration
+	progress io.Writer // nil shows none
+	label    string    // the repository, as progress lines start
+}
+
+// newCloneSession starts the deadline of cloning label; the returned
+// function releases it
+func newCloneSession(label string, opts CloneOptions) (*cloneSession, context.CancelFunc) {
+	ctx, cancel := context.Background(), context.CancelFunc(func() {})
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+	}
+	return &cloneSession{ctx: ctx, timeout: opts.Timeout, progress: opts.Progress, label: label}, cancel
+}
+
+// git runs git in dir ("" for the current directory). The commands that
+// download, clone, fetch and checkout, report their progress.
+func (s *cloneSession) git(dir string, args ...string) error {
+	command := args[0]
+	if command == "clone" || command == "fetch" || command == "checkout" {
+		args = append([]string{command, "--progress"}, args[1:]...)
+	}
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	progress := newCloneProgress(s.progress, s.label)
+	cmd := exec.CommandContext(s.ctx, "git", args...)
+	cmd.Stderr = progress
+	err := cmd.Run()
+	progress.done()
+	switch {
+	case errors.Is(s.ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("git %s timed out after %s (--clone-timeout)", command, s.timeout)
+	case err != nil && progress.message() != "":
+		return fmt.Errorf("git %s: %s", command, progress.message())
+	case err != nil:
+		return fmt.Errorf("git %s: %w", command, err)
+	}
+	return nil
+}
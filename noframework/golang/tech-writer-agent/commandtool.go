@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of the command tools declared in the --config file, unless a tool
+// sets its own
+const (
+	COMMAND_TOOL_DEFAULT_TIMEOUT    = 30 * time.Second
+	COMMAND_TOOL_DEFAULT_MAX_OUTPUT = 64 * 1024 // bytes of standard output, and again of standard error
+)
+
+// commandToolEnv are the variables of the agent's environment a command
+// tool's process inherits. The rest, API keys among them, are withheld.
+var commandToolEnv = []string{"PATH", "HOME", "LANG", "LC_ALL", "TMPDIR", "TERM"}
+
+// commandPlaceholderPattern matches the {{argument}} placeholders of a
+// command template
+var commandPlaceholderPattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// CommandToolConfig declares a tool that runs a shell command, e.g.
+//
+//	{"name": "list_migrations", "description": "...",
+//	 "arguments": [{"name": "dir", "type": "string", "required": true}],
+//	 "command": "ls {{dir}}/migrations"}
+//
+// Each {{argument}} in the command is replaced by the argument's value,
+// quoted for the shell, so values can't inject commands of their own.
+type CommandToolConfig struct {
+	Name           string                `json:"name"`
+	Description    string                `json:"description"`
+	Arguments      []CommandToolArgument `json:"arguments"`
+	Command        string                `json:"command"`          // run with sh -c in the repository directory
+	Timeout        string                `json:"timeout"`          // e.g. "10s"; COMMAND_TOOL_DEFAULT_TIMEOUT if empty
+	MaxOutputBytes int                   `json:"max_output_bytes"` // COMMAND_TOOL_DEFAULT_MAX_OUTPUT if 0
+}
+
+// CommandToolArgument is an argument of a command tool, as in the tool
+// descriptions the model sees
+type CommandToolArgument struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // string (the default), integer, number or bool
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Default     string `json:"default"` // used when the model leaves the argument out
+}
+
+// CommandToolResult is the outcome of running a command tool
+type CommandToolResult struct {
+	ExitCode  int    `json:"exit_code"`
+	Output    string `json:"output"`
+	Stderr    string `json:"stderr,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"` // output beyond the tool's limit was dropped
+	TimedOut  bool   `json:"timed_out,omitempty"`
+}
+
+// validate checks a command tool's declaration
+func (c CommandToolConfig) validate() error {
+	if !pluginToolNamePattern.MatchString(c.Name) {
+		return fmt.Errorf("invalid tool name %q", c.Name)
+	}
+	if strings.TrimSpace(c.Command) == "" {
+		return fmt.Errorf("tool %s has no command", c.Name)
+	}
+	if _, err := c.timeout(); err != nil {
+		return fmt.Errorf("tool %s: %w", c.Name, err)
+	}
+	if c.MaxOutputBytes < 0 {
+		return fmt.Errorf("tool %s: max_output_bytes must not be negative", c.Name)
+	}
+	declared := make(map[string]bool)
+	for _, arg := range c.Arguments {
+		switch arg.Type {
+		case "", ArgString, ArgInteger, ArgNumber, ArgBool:
+		default:
+			return fmt.Errorf("tool %s: argument %s has unknown type %q", c.Name, arg.Name, arg.Type)
+		}
+		declared[arg.Name] = true
+	}
+	for _, match := range commandPlaceholderPattern.FindAllStringSubmatch(c.Command, -1) {
+		if !declared[match[1]] {
+			return fmt.Errorf("tool %s: command uses undeclared argument %s", c.Name, match[1])
+		}
+	}
+	return nil
+}
+
+// timeout returns the tool's time limit
+func (c CommandToolConfig) timeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return COMMAND_TOOL_DEFAULT_TIMEOUT, nil
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", c.Timeout)
+	}
+	return timeout, nil
+}
+
+// newCommandTool returns the tool a CommandToolConfig declares, which runs
+// its command in directory. The command runs with the tool's time limit and
+// output limit, and with only the commandToolEnv variables of the agent's
+// environment plus TECH_WRITER_DIRECTORY.
+func newCommandTool(config CommandToolConfig, directory string) Tool {
+	// The command is stopped at its own timeout; ExecuteTool waits a little longer
+	timeout, _ := config.timeout()
+	tool := Tool{Name: config.Name, Description: config.Description, Limits: ToolLimits{Timeout: timeout + 5*time.Second}}
+	for _, arg := range config.Arguments {
+		tool.Arguments = append(tool.Arguments, ToolArgument{Name: arg.Name, Type: arg.kind(), Description: arg.Description, Required: arg.Required, Default: arg.Default})
+	}
+	tool.Function = func(args map[string]interface{}) (interface{}, error) {
+		command, err := renderCommand(config, args)
+		if err != nil {
+			return nil, err
+		}
+		return runCommandTool(config, command, directory), nil
+	}
+	return tool
+}
+
+// renderCommand fills in the placeholders of a command template with the
+// arguments' values, quoted for the shell
+func renderCommand(config CommandToolConfig, args map[string]interface{}) (string, error) {
+	values := make(map[string]string)
+	for _, arg := range config.Arguments {
+		value, given := args[arg.Name]
+		if !given || value == nil {
+			if arg.Required {
+				return "", fmt.Errorf("%s parameter is required", arg.Name)
+			}
+			values[arg.Name] = arg.Default
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			values[arg.Name] = value
+		case float64:
+			values[arg.Name] = strconv.FormatFloat(value, 'f', -1, 64)
+		case bool:
+			values[arg.Name] = strconv.FormatBool(value)
+		default:
+			return "", fmt.Errorf("%s must be a %s", arg.Name, arg.kind())
+		}
+	}
+	return commandPlaceholderPattern.ReplaceAllStringFunc(config.Command, func(placeholder string) string {
+		name := commandPlaceholderPattern.FindStringSubmatch(placeholder)[1]
+		return shellQuote(values[name])
+	}), nil
+}
+
+// kind returns the argument's type, which defaults to string
+func (a CommandToolArgument) kind() string {
+	if a.Type == "" {
+		return "string"
+	}
+	return a.Type
+}
+
+// shellQuote quotes s as a single word for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// runCommandTool runs a rendered command. Failures to run it are reported
+// as {"error": ...} results; a non-zero exit status is part of the result,
+// since commands like grep use it to say they found nothing.
+func runCommandTool(config CommandToolConfig, command, directory string) interface{} {
+	timeout, _ := config.timeout()
+	maxOutput := config.MaxOutputBytes
+	if maxOutput == 0 {
+		maxOutput = COMMAND_TOOL_DEFAULT_MAX_OUTPUT
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = directory
+	cmd.Env = []string{"TECH_WRITER_DIRECTORY=" + directory}
+	for _, name := range commandToolEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			cmd.Env = append(cmd.Env, name+"="+value)
+		}
+	}
+	stdout := &limitedBuffer{limit: maxOutput}
+	stderr := &limitedBuffer{limit: maxOutput}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	cmd.WaitDelay = time.Second // don't wait for background processes holding the output open
+
+	err := cmd.Run()
+	result := CommandToolResult{
+		Output:    strings.ToValidUTF8(stdout.String(), ""),
+		Stderr:    strings.ToValidUTF8(stderr.String(), ""),
+		Truncated: stdout.truncated || stderr.truncated,
+		TimedOut:  ctx.Err() == context.DeadlineExceeded,
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case result.TimedOut:
+		result.ExitCode = -1
+	default:
+		return map[string]string{"error": fmt.Sprintf("Error running %s: %s", config.Name, err)}
+	}
+	return result
+}
+
+// limitedBuffer keeps the first limit bytes written to it and counts the
+// rest as truncated
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); len(p) > room {
+		b.Buffer.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
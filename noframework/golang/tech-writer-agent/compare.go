@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Labels of the two code bases of a --compare run, with which the tools
+// address them, e.g. "a:src/main.go" or "b:" for the root of the second
+const (
+	COMPARE_LABEL_A = "a"
+	COMPARE_LABEL_B = "b"
+)
+
+// Comparison is the second code base of a --compare run
+type Comparison struct {
+	Repo      string `json:"repo,omitempty"` // repository it was cloned from, if any
+	Directory string `json:"directory"`
+	Commit    string `json:"commit,omitempty"`
+	Name      string `json:"name"`
+}
+
+// configureComparison resolves --compare, a directory or else a repository
+// (on GitHub, or a bare repository or file:// URL on disk), which is cloned
+// like --repo
+func configureComparison(target, cacheDir string, clone CloneOptions) (*Comparison, error) {
+	if info, err := os.Stat(target); err == nil && info.IsDir() && !isBareRepo(target) {
+		return &Comparison{Directory: target, Commit: gitHeadCommit(target), Name: filepath.Base(filepath.Clean(target))}, nil
+	}
+	repoURL, local := localRepoURL(target)
+	if !local {
+		if !validateGitHubURL(target) {
+			return nil, fmt.Errorf("-compare %s is neither a directory nor a repository", target)
+		}
+		repoURL = target
+	}
+	directory, err := cloneRepo(repoURL, cacheDir, clone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %w", target, err)
+	}
+	name := strings.TrimSuffix(path.Base(strings.TrimSuffix(repoURL, "/")), ".git")
+	return &Comparison{Repo: repoURL, Directory: directory, Commit: gitHeadCommit(directory), Name: name}, nil
+}
+
+// comparePrompt introduces the two code bases of a comparison, with the
+// prefixes that address them, and asks for a comparative analysis rather
+// than a description of either one
+func comparePrompt(directoryA, nameA string, comparison *Comparison) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Compare two code bases rather than documenting one:\n")
+	fmt.Fprintf(&b, "- A, %s: %s\n", nameA, directoryA)
+	fmt.Fprintf(&b, "- B, %s: %s\n", comparison.Name, comparison.Directory)
+	fmt.Fprintf(&b, "Every tool takes paths in either code base, absolute or starting with %q or %q for the root of A or B, e.g. %q. ", COMPARE_LABEL_A+":", COMPARE_LABEL_B+":", COMPARE_LABEL_B+":README.md")
+	b.WriteString("Explore both to the same depth, reading the corresponding files side by side. ")
+	b.WriteString("Cover the concepts they share and what each calls them, their architectural differences (structure, control flow, dependencies, error handling), and feature parity: what each one supports that the other lacks. ")
+	b.WriteString("Name the code base and cite its files for every observation, and follow the instructions below for the focus and format.\n")
+	return b.String()
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Limits of measure_complexity
+const (
+	COMPLEXITY_DEFAULT_MAX_RESULTS = 25
+	COMPLEXITY_MAX_RESULTS         = 200
+	COMPLEXITY_MAX_FILES           = 5000 // measured per call
+	COMPLEXITY_MAX_ERRORS          = 20   // parse failures reported
+)
+
+// FunctionComplexity is the cyclomatic complexity of one function: 1 plus
+// one for each branch (if, loop, case, catch, conditional expression) and
+// each && or || (and the like) in it. Nested named functions are measured
+// on their own; closures and lambdas count towards the function they're in.
+type FunctionComplexity struct {
+	Name       string `json:"name"` // Type.method for methods
+	File       string `json:"file"`
+	Line       int    `json:"line"`
+	Lines      int    `json:"lines"`
+	Complexity int    `json:"complexity"`
+}
+
+// FileComplexity summarises the functions of one file
+type FileComplexity struct {
+	File          string `json:"file"`
+	Language      string `json:"language"`
+	Lines         int    `json:"lines"`
+	Functions     int    `json:"functions"`
+	Complexity    int    `json:"complexity"` // the sum over its functions
+	MaxComplexity int    `json:"max_complexity"`
+}
+
+// ComplexityResult represents the complexity measured in a file or directory
+type ComplexityResult struct {
+	Functions         []FunctionComplexity `json:"functions"` // the most complex first
+	Files             []FileComplexity     `json:"files"`     // the highest total complexity first
+	FileCount         int                  `json:"file_count"`
+	FunctionCount     int                  `json:"function_count"`
+	AverageComplexity float64              `json:"average_complexity"`  // per function
+	Truncated         bool                 `json:"truncated,omitempty"` // more functions or files than max_results, or more than COMPLEXITY_MAX_FILES files
+	Errors            []string             `json:"errors,omitempty"`    // files that failed to parse
+}
+
+// measureComplexity implements the measure_complexity tool: per-function
+// cyclomatic complexity and per-file totals for a source file or the
+// supported files under a directory, so claims about the most complex parts
+// of a codebase rest on measurements
+func measureComplexity(args map[string]interface{}) (interface{}, error) {
+	path, ok := args["path"].(string)
+	if !ok || path == "" {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	maxResults := COMPLEXITY_DEFAULT_MAX_RESULTS
+	if val, ok := intArg(args, "max_results"); ok && val > 0 {
+		maxResults = min(val, COMPLEXITY_MAX_RESULTS)
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("Path not found: %s", path)}, nil
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading path: %s", err)}, nil
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		opts := DefaultWalkOptions()
+		if val, ok := args["pattern"].(string); ok && val != "" {
+			opts.Pattern = val
+		}
+		files, err = listFiles(path, opts)
+		if err != nil {
+			return nil, err
+		}
+	} else if complexityLanguage(path) == "" {
+		return map[string]string{"error": fmt.Sprintf("No complexity support for %s; supported languages: %s", path, strings.Join(append([]string{"Go"}, outlineLanguages()...), ", "))}, nil
+	}
+
+	result := ComplexityResult{Functions: []FunctionComplexity{}, Files: []FileComplexity{}}
+	total := 0
+	for _, file := range files {
+		language := complexityLanguage(file)
+		if language == "" {
+			continue
+		}
+		if result.FileCount == COMPLEXITY_MAX_FILES {
+			result.Truncated = true
+			break
+		}
+		if info, err := os.Stat(file); err != nil || info.Size() > OUTLINE_MAX_FILE_BYTES {
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var functions []FunctionComplexity
+		if language == "Go" {
+			functions, err = goComplexity(file, source)
+		} else {
+			functions, err = treeSitterComplexity(language, source)
+		}
+		if err != nil {
+			if len(result.Errors) < COMPLEXITY_MAX_ERRORS {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", file, err))
+			}
+			continue
+		}
+
+		summary := FileComplexity{File: file, Language: language, Lines: bytes.Count(source, []byte("\n")) + 1, Functions: len(functions)}
+		for i := range functions {
+			functions[i].File = file
+			summary.Complexity += functions[i].Complexity
+			summary.MaxComplexity = max(summary.MaxComplexity, functions[i].Complexity)
+		}
+		result.FileCount++
+		result.FunctionCount += len(functions)
+		total += summary.Complexity
+		result.Files = append(result.Files, summary)
+		result.Functions = append(result.Functions, functions...)
+	}
+	if result.FunctionCount > 0 {
+		result.AverageComplexity = math.Round(float64(total)/float64(result.FunctionCount)*10) / 10
+	}
+
+	sort.SliceStable(result.Functions, func(i, j int) bool {
+		return result.Functions[i].Complexity > result.Functions[j].Complexity
+	})
+	sort.SliceStable(result.Files, func(i, j int) bool {
+		return result.Files[i].Complexity > result.Files[j].Complexity
+	})
+	if len(result.Functions) > maxResults {
+		result.Functions = result.Functions[:maxResults]
+		result.Truncated = true
+	}
+	if len(result.Files) > maxResults {
+		result.Files = result.Files[:maxResults]
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// complexityLanguage returns the language of a file measure_complexity can
+// measure, or ""
+func complexityLanguage(path string) string {
+	if detectLanguage(path) == "Go" {
+		return "Go"
+	}
+	return outlineLanguage(path)
+}
+
+// goComplexity measures the functions and methods of a Go file
+func goComplexity(path string, source []byte) ([]FunctionComplexity, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, source, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	var functions []FunctionComplexity
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Body == nil {
+			continue
+		}
+		name := fn.Name.Name
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			name = receiverTypeName(fn.Recv.List[0].Type) + "." + name
+		}
+		start, end := fset.Position(fn.Pos()).Line, fset.Position(fn.End()).Line
+		functions = append(functions, FunctionComplexity{Name: name, Line: start, Lines: end - start + 1, Complexity: goCyclomatic(fn.Body)})
+	}
+	return functions, nil
+}
+
+// goCyclomatic is the cyclomatic complexity of a Go function body
+func goCyclomatic(body *ast.BlockStmt) int {
+	complexity := 1
+	ast.Inspect(body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.IfStmt, *ast.ForStmt, *ast.RangeStmt:
+			complexity++
+		case *ast.CaseClause:
+			if node.List != nil { // not default
+				complexity++
+			}
+		case *ast.CommClause:
+			if node.Comm != nil { // not default
+				complexity++
+			}
+		case *ast.BinaryExpr:
+			if node.Op == token.LAND || node.Op == token.LOR {
+				complexity++
+			}
+		}
+		return true
+	})
+	return complexity
+}
+
+// receiverTypeName returns the type of a method receiver without pointer
+// or type parameters
+func receiverTypeName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(expr.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(expr.X)
+	case *ast.IndexListExpr:
+		return receiverTypeName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
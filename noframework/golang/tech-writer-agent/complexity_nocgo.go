@@ -0,0 +1,12 @@
+//go:build !cgo
+
+package main
+
+import "fmt"
+
+// Without cgo there are no tree-sitter grammars (see outline_nocgo.go), so
+// only Go files are measured
+
+func treeSitterComplexity(language string, source []byte) ([]FunctionComplexity, error) {
+	return nil, fmt.Errorf("measuring %s needs a build with cgo", language)
+}
@@ -0,0 +1,180 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+// complexityNodes are the tree-sitter node types that measure_complexity
+// counts in a language
+type complexityNodes struct {
+	functions map[string]bool // measured on their own
+	branches  map[string]bool // each adds a path
+	cases     map[string]bool // each adds a path, unless it's the default
+	logical   map[string]bool // add a path if their operator is &&, ||, ??, and or or
+}
+
+// nodeTypeSet makes a lookup table of node types
+func nodeTypeSet(nodeTypes ...string) map[string]bool {
+	table := make(map[string]bool, len(nodeTypes))
+	for _, nodeType := range nodeTypes {
+		table[nodeType] = true
+	}
+	return table
+}
+
+var javascriptComplexity = complexityNodes{
+	functions: nodeTypeSet("function_declaration", "generator_function_declaration", "method_definition"),
+	branches:  nodeTypeSet("if_statement", "for_statement", "for_in_statement", "while_statement", "do_statement", "catch_clause", "ternary_expression"),
+	cases:     nodeTypeSet("switch_case"),
+	logical:   nodeTypeSet("binary_expression"),
+}
+
+var cComplexity = complexityNodes{
+	functions: nodeTypeSet("function_definition"),
+	branches:  nodeTypeSet("if_statement", "for_statement", "while_statement", "do_statement", "conditional_expression"),
+	cases:     nodeTypeSet("case_statement"),
+	logical:   nodeTypeSet("binary_expression"),
+}
+
+// complexityGrammars are the node types by language, for the languages of
+// outlineGrammars
+var complexityGrammars = map[string]complexityNodes{
+	"Python": {
+		functions: nodeTypeSet("function_definition"),
+		branches:  nodeTypeSet("if_statement", "elif_clause", "for_statement", "while_statement", "except_clause", "conditional_expression", "for_in_clause", "if_clause"),
+		cases:     nodeTypeSet("case_clause"),
+		logical:   nodeTypeSet("boolean_operator"),
+	},
+	"JavaScript": javascriptComplexity,
+	"TypeScript": javascriptComplexity,
+	"TSX":        javascriptComplexity,
+	"Java": {
+		functions: nodeTypeSet("method_declaration", "constructor_declaration"),
+		branches:  nodeTypeSet("if_statement", "for_statement", "enhanced_for_statement", "while_statement", "do_statement", "catch_clause", "ternary_expression"),
+		cases:     nodeTypeSet("switch_label"),
+		logical:   nodeTypeSet("binary_expression"),
+	},
+	"C#": {
+		functions: nodeTypeSet("method_declaration", "constructor_declaration", "local_function_statement"),
+		branches:  nodeTypeSet("if_statement", "for_statement", "foreach_statement", "while_statement", "do_statement", "catch_clause", "conditional_expression"),
+		cases:     nodeTypeSet("switch_section"),
+		logical:   nodeTypeSet("binary_expression"),
+	},
+	"Rust": {
+		functions: nodeTypeSet("function_item"),
+		branches:  nodeTypeSet("if_expression", "for_expression", "while_expression"),
+		cases:     nodeTypeSet("match_arm"),
+		logical:   nodeTypeSet("binary_expression"),
+	},
+	"C": cComplexity,
+	"C++": {
+		functions: cComplexity.functions,
+		branches:  nodeTypeSet("if_statement", "for_statement", "for_range_loop", "while_statement", "do_statement", "conditional_expression", "catch_clause"),
+		cases:     cComplexity.cases,
+		logical:   cComplexity.logical,
+	},
+	"Ruby": {
+		functions: nodeTypeSet("method", "singleton_method"),
+		branches:  nodeTypeSet("if", "elsif", "unless", "while", "until", "for", "rescue", "conditional", "if_modifier", "unless_modifier", "while_modifier", "until_modifier"),
+		cases:     nodeTypeSet("when"),
+		logical:   nodeTypeSet("binary"),
+	},
+	"PHP": {
+		functions: nodeTypeSet("function_definition", "method_declaration"),
+		branches:  nodeTypeSet("if_statement", "else_if_clause", "for_statement", "foreach_statement", "while_statement", "do_statement", "catch_clause", "conditional_expression"),
+		cases:     nodeTypeSet("case_statement"),
+		logical:   nodeTypeSet("binary_expression"),
+	},
+}
+
+// logicalOperators are the operators of the logical nodes that add a path
+var logicalOperators = nodeTypeSet("&&", "||", "??", "and", "or")
+
+// treeSitterComplexity parses source with the grammar of language and
+// measures its functions
+func treeSitterComplexity(language string, source []byte) ([]FunctionComplexity, error) {
+	parser := sitter.NewParser()
+	defer parser.Close()
+	parser.SetLanguage(outlineGrammars[language].language())
+	tree, err := parser.ParseCtx(context.Background(), nil, source)
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Close()
+	m := complexityMeasurer{source: source, nodes: complexityGrammars[language], containers: outlineGrammars[language].nodes}
+	m.visit(tree.RootNode(), "", nil)
+	return m.functions, nil
+}
+
+// complexityMeasurer walks a syntax tree, adding each branch to the
+// function it's in
+type complexityMeasurer struct {
+	source     []byte
+	nodes      complexityNodes
+	containers map[string]outlineNode // classes and the like, which qualify method names
+	functions  []FunctionComplexity
+}
+
+// visit measures node and its descendants. prefix qualifies function names
+// (e.g. "Parser."), and current is the index of the enclosing function in
+// m.functions, if any.
+func (m *complexityMeasurer) visit(node *sitter.Node, prefix string, current *int) {
+	nodeType := node.Type()
+	switch {
+	case m.nodes.functions[nodeType] || m.isFunctionValue(node):
+		name := definitionName(node, m.source)
+		if name == "" {
+			name = definitionName(node.Parent(), m.source)
+		}
+		m.functions = append(m.functions, FunctionComplexity{
+			Name:       prefix + name,
+			Line:       int(node.StartPoint().Row) + 1,
+			Lines:      int(node.EndPoint().Row-node.StartPoint().Row) + 1,
+			Complexity: 1,
+		})
+		index := len(m.functions) - 1
+		current = &index
+	case m.containers[nodeType].container && m.containers[nodeType].kind != "namespace" && m.containers[nodeType].kind != "module":
+		if name := definitionName(node, m.source); name != "" {
+			prefix += name + "."
+		}
+	case current == nil:
+	case m.nodes.branches[nodeType]:
+		m.functions[*current].Complexity++
+	case m.nodes.cases[nodeType]:
+		if !isDefaultCase(node.Content(m.source)) {
+			m.functions[*current].Complexity++
+		}
+	case m.nodes.logical[nodeType]:
+		if operator := node.ChildByFieldName("operator"); operator != nil && logicalOperators[operator.Content(m.source)] {
+			m.functions[*current].Complexity++
+		}
+	}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		m.visit(node.NamedChild(i), prefix, current)
+	}
+}
+
+// isFunctionValue reports whether node is a JavaScript function or arrow
+// function assigned to a variable, e.g. const handler = () => {...}, which
+// is measured as a function of that name
+func (m *complexityMeasurer) isFunctionValue(node *sitter.Node) bool {
+	switch node.Type() {
+	case "arrow_function", "function", "function_expression":
+		parent := node.Parent()
+		return parent != nil && parent.Type() == "variable_declarator"
+	}
+	return false
+}
+
+// isDefaultCase reports whether a case clause is the default one, which
+// adds no path: default in C-like languages, _ in Python and Rust
+func isDefaultCase(clause string) bool {
+	clause = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(clause), "case "))
+	return strings.HasPrefix(clause, "default") || clause == "_" || strings.HasPrefix(clause, "_ ") || strings.HasPrefix(clause, "_:") || strings.HasPrefix(clause, "_=>")
+}
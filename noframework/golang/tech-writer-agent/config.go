@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Config is the JSON configuration file given with --config (or
+// TECH_WRITER_CONFIG). It declares what the command line can't express
+// comfortably, such as the external tools to offer the agent.
+type Config struct {
+	Plugins     []PluginConfig             `json:"plugins"`
+	Tools       []CommandToolConfig        `json:"tools"`        // tools that run a shell command
+	ToolLimits  map[string]ToolLimitConfig `json:"tool_limits"`  // by tool name
+	FrontMatter *FrontMatterConfig         `json:"front_matter"` // front matter of Markdown results, see --front-matter
+}
+
+// PluginConfig declares an external tool plugin: an executable that speaks
+// the plugin protocol (see plugin.go) on its standard input and output
+type PluginConfig struct {
+	Name    string            `json:"name"`    // for log messages; defaults to the command's base name
+	Command string            `json:"command"` // a path relative to the configuration file, or a command on PATH
+	Args    []string          `json:"args"`
+	Env     map[string]string `json:"env"`     // added to the agent's environment
+	Timeout string            `json:"timeout"` // per call, e.g. "30s"; PLUGIN_DEFAULT_TIMEOUT if empty
+}
+
+// loadConfig reads a configuration file. Unknown fields are errors, so a
+// misspelt setting isn't silently ignored.
+func loadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var config Config
+	if err := decoder.Decode(&config); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", path, err)
+	}
+
+	base := filepath.Dir(path)
+	for i := range config.Plugins {
+		plugin := &config.Plugins[i]
+		if plugin.Command == "" {
+			return nil, fmt.Errorf("config %s: plugin %d has no command", path, i+1)
+		}
+		// Paths are relative to the configuration file; bare names are looked up on PATH
+		if strings.ContainsRune(plugin.Command, filepath.Separator) && !filepath.IsAbs(plugin.Command) {
+			plugin.Command = filepath.Join(base, plugin.Command)
+		}
+		if plugin.Name == "" {
+			plugin.Name = filepath.Base(plugin.Command)
+		}
+		if _, err := plugin.timeout(); err != nil {
+			return nil, fmt.Errorf("config %s: plugin %s: %w", path, plugin.Name, err)
+		}
+	}
+	for _, tool := range config.Tools {
+		if err := tool.validate(); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	for name, limits := range config.ToolLimits {
+		if _, err := limits.limits(); err != nil {
+			return nil, fmt.Errorf("config %s: tool_limits of %s: %w", path, name, err)
+		}
+	}
+	if config.FrontMatter != nil {
+		if err := config.FrontMatter.validate(); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	}
+	return &config, nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Longest thought or observation summary printed by the console view
+const CONSOLE_SUMMARY_CHARS = 160
+
+// ConsoleSink renders the agent's progress for a person watching the
+// terminal: each iteration's thought, the tool it calls with its arguments,
+// a one-line summary of the observation, and how long each step took.
+type ConsoleSink struct {
+	out      io.Writer
+	color    bool
+	started  time.Time
+	maxIters int
+}
+
+// NewConsoleSink creates a console view writing to out. Colours are used when
+// out is a terminal.
+func NewConsoleSink(out io.Writer) *ConsoleSink {
+	return &ConsoleSink{out: out, color: isTerminal(out), started: time.Now()}
+}
+
+// isTerminal reports whether w is a character device such as a terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ANSI styles used when colour is enabled
+const (
+	styleDim   = "\033[2m"
+	styleBold  = "\033[1m"
+	styleRed   = "\033[31m"
+	styleGreen = "\033[32m"
+	styleCyan  = "\033[36m"
+	styleReset = "\033[0m"
+)
+
+func (s *ConsoleSink) style(style, text string) string {
+	if !s.color {
+		return text
+	}
+	return style + text + styleReset
+}
+
+func (s *ConsoleSink) OnIteration(event IterationEvent) {
+	s.maxIters = event.MaxIterations
+}
+
+func (s *ConsoleSink) OnLLMCall(event LLMCallEvent) {
+	prefix := s.style(styleBold, fmt.Sprintf("[%d/%d]", event.Iteration, s.maxIters))
+	if s.maxIters == 0 {
+		prefix = s.style(styleBold, "[--]")
+	}
+	timing := s.style(styleDim, "("+formatDuration(event.Duration)+")")
+	switch {
+	case errors.Is(event.Err, errTimeout):
+		fmt.Fprintf(s.out, "%s %s %s\n", prefix, s.style(styleRed, "LLM call timed out"), timing)
+	case event.Err != nil:
+		fmt.Fprintf(s.out, "%s %s %s\n", prefix, s.style(styleRed, "LLM call failed: "+event.Err.Error()), timing)
+	default:
+		thought := extractThought(event.Response)
+		if thought == "" {
+			thought = "(no thought given)"
+		}
+		fmt.Fprintf(s.out, "%s %s %s\n", prefix, thought, timing)
+	}
+}
+
+func (s *ConsoleSink) OnToolCall(event ToolCallEvent) {
+	call := fmt.Sprintf("%s %s", event.Tool, formatToolArgs(event.Args))
+	fmt.Fprintf(s.out, "       %s %s\n", s.style(styleCyan, "→"), strings.TrimSpace(call))
+	switch {
+	case event.Cached:
+		fmt.Fprintf(s.out, "       %s %s\n", s.style(styleDim, "↺"), "repeated call; the model was pointed at the earlier result")
+	case event.Err != nil:
+		fmt.Fprintf(s.out, "       %s %s %s\n", s.style(styleRed, "✗"), truncateLine(event.Observation), s.style(styleDim, "("+formatDuration(event.Duration)+")"))
+	default:
+		fmt.Fprintf(s.out, "       %s %s %s\n", s.style(styleCyan, "←"), summarizeObservation(event.Observation), s.style(styleDim, "("+formatDuration(event.Duration)+")"))
+	}
+}
+
+func (s *ConsoleSink) OnFinal(event FinalEvent) {
+	message := fmt.Sprintf("✓ Final answer after %d iterations", event.Iteration)
+	if event.Truncated {
+		message = fmt.Sprintf("✓ Best-effort final answer after %d iterations", event.Iteration)
+	}
+	fmt.Fprintf(s.out, "%s %s\n", s.style(styleGreen, message), s.style(styleDim, "("+formatDuration(time.Since(s.started))+" total)"))
+}
+
+// extractThought returns the reasoning part of a ReAct response: the text
+// before its Action or Final Answer, flattened to one line
+func extractThought(response string) string {
+	thought := response
+	for _, marker := range []string{"Action:", "Final Answer:", "Step Result:", "Step Failed:"} {
+		if idx := strings.Index(thought, marker); idx >= 0 {
+			thought = thought[:idx]
+		}
+	}
+	thought = strings.TrimSpace(thought)
+	thought = strings.TrimSpace(strings.TrimPrefix(thought, "Thought:"))
+	return truncateLine(thought)
+}
+
+// summarizeObservation describes a tool result in one line: item counts for
+// listings, size for file contents, the message for errors
+func summarizeObservation(observation string) string {
+	var result map[string]interface{}
+	if json.Unmarshal([]byte(observation), &result) == nil {
+		if message, ok := result["error"].(string); ok {
+			return "error: " + truncateLine(message)
+		}
+		for _, key := range []string{"files", "matches", "commits"} {
+			if items, ok := result[key].([]interface{}); ok {
+				return fmt.Sprintf("%d %s", len(items), key)
+			}
+		}
+		if content, ok := result["content"].(string); ok {
+			return fmt.Sprintf("%d lines, %s", strings.Count(content, "\n")+1, formatBytes(len(content)))
+		}
+	}
+	return truncateLine(observation)
+}
+
+// formatToolArgs renders arguments as key=value pairs in key order
+func formatToolArgs(args map[string]interface{}) string {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, _ := json.Marshal(args[key])
+		if text, ok := args[key].(string); ok && !strings.ContainsAny(text, " \t\n\"") {
+			value = []byte(text)
+		}
+		parts = append(parts, key+"="+string(value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// truncateLine flattens whitespace and shortens text to CONSOLE_SUMMARY_CHARS
+func truncateLine(text string) string {
+	return truncateRunes(strings.Join(strings.Fields(text), " "), CONSOLE_SUMMARY_CHARS)
+}
+
+// formatDuration rounds d for display: milliseconds below a second, then
+// tenths of a second
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// formatBytes renders a size in B, KB, MB or GB
+func formatBytes(n int) string {
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%d B", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(n)/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1024*1024))
+	default:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1024*1024*1024))
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits of read_coverage
+const (
+	COVERAGE_MAX_REPORTS  = 10
+	COVERAGE_MAX_PACKAGES = 200 // listed per report
+)
+
+// Coverage report formats
+const (
+	CoverageGo        = "go"        // go test -coverprofile
+	CoverageLCOV      = "lcov"      // lcov.info, written by Jest, c8, lcov, cargo llvm-cov, ...
+	CoverageCobertura = "cobertura" // coverage.xml, written by coverage.py, coverlet, ...
+	CoverageJaCoCo    = "jacoco"    // jacoco.xml
+)
+
+// coverageLocations are where test tools conventionally write their
+// reports, relative to the project root
+var coverageLocations = []string{
+	"coverage.out", "cover.out", "c.out", "coverage.txt", "profile.cov", "*.coverprofile",
+	"lcov.info", "*.lcov", "coverage/lcov.info",
+	"coverage.xml", "cobertura.xml", "coverage/cobertura-coverage.xml", "coverage.cobertura.xml", "TestResults/*/coverage.cobertura.xml",
+	"jacoco.xml", "target/site/jacoco/jacoco.xml", "build/reports/jacoco/test/jacocoTestReport.xml",
+}
+
+// CoveragePackage is the coverage of one package or directory
+type CoveragePackage struct {
+	Name    string  `json:"name"`
+	Covered int     `json:"covered"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// CoverageReport is the coverage recorded in one report file
+type CoverageReport struct {
+	File      string            `json:"file"`
+	Format    string            `json:"format"`
+	Metric    string            `json:"metric"`   // what is counted: statements or lines
+	Modified  string            `json:"modified"` // when the report was written (RFC 3339); it may predate the code
+	Covered   int               `json:"covered"`
+	Total     int               `json:"total"`
+	Percent   float64           `json:"percent"`
+	Packages  []CoveragePackage `json:"packages"`            // the least covered first
+	Truncated bool              `json:"truncated,omitempty"` // more than COVERAGE_MAX_PACKAGES packages
+}
+
+// CoverageResult represents the coverage reports found
+type CoverageResult struct {
+	Reports []CoverageReport `json:"reports"`
+	Errors  []string         `json:"errors,omitempty"` // reports that could not be read
+	Note    string           `json:"note,omitempty"`
+}
+
+// readCoverage implements the read_coverage tool: it reads the test coverage
+// reports a project has (Go cover profiles, LCOV, Cobertura and JaCoCo XML)
+// and reports the coverage per package. Reports are only read, never
+// produced, so they reflect the last test run that wrote them.
+func readCoverage(args map[string]interface{}) (interface{}, error) {
+	root, ok := args["path"].(string)
+	if !ok || root == "" {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("Path not found: %s", root)}, nil
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading path: %s", err)}, nil
+	}
+
+	files := []string{root}
+	base := filepath.Dir(root)
+	if info.IsDir() {
+		files = nil
+		base = root
+		seen := make(map[string]bool)
+		for _, location := range coverageLocations {
+			matches, _ := filepath.Glob(filepath.Join(root, filepath.FromSlash(location)))
+			for _, match := range matches {
+				if !seen[match] && len(files) < COVERAGE_MAX_REPORTS {
+					seen[match] = true
+					files = append(files, match)
+				}
+			}
+		}
+	}
+
+	result := CoverageResult{Reports: []CoverageReport{}}
+	for _, file := range files {
+		report, err := readCoverageReport(file, base)
+		if err != nil {
+			// Files found by name may hold something else, e.g. a coverage.txt summary
+			if info.IsDir() && err == errNotCoverage {
+				continue
+			}
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", file, err))
+			continue
+		}
+		result.Reports = append(result.Reports, report)
+	}
+	if len(result.Reports) == 0 && len(result.Errors) == 0 {
+		result.Note = "No coverage reports found. Reports are usually not committed; they exist only where the tests were run with coverage (e.g. go test -coverprofile=coverage.out, jest --coverage, pytest --cov --cov-report=xml)"
+	}
+	return result, nil
+}
+
+// errNotCoverage is returned for a file that is not a coverage report in a
+// supported format
+var errNotCoverage = fmt.Errorf("not a Go cover profile, LCOV, Cobertura or JaCoCo report")
+
+// coverageCount is the covered and total statements or lines of a package
+type coverageCount struct{ covered, total int }
+
+// readCoverageReport reads a report, recognising its format from its
+// content. File paths in it are shown relative to base.
+func readCoverageReport(file, base string) (CoverageReport, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return CoverageReport{}, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return CoverageReport{}, err
+	}
+	report := CoverageReport{File: file, Modified: info.ModTime().UTC().Format(time.RFC3339)}
+	var packages map[string]*coverageCount
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("mode:")):
+		report.Format, report.Metric = CoverageGo, "statements"
+		packages, err = parseGoCoverage(bytes.NewReader(data))
+	case bytes.HasPrefix(trimmed, []byte("TN:")) || bytes.HasPrefix(trimmed, []byte("SF:")):
+		report.Format, report.Metric = CoverageLCOV, "lines"
+		packages, err = parseLCOV(bytes.NewReader(data), base)
+	case bytes.HasPrefix(trimmed, []byte("<")) && bytes.Contains(data, []byte("<report")):
+		report.Format, report.Metric = CoverageJaCoCo, "lines"
+		packages, err = parseJaCoCo(data)
+	case bytes.HasPrefix(trimmed, []byte("<")) && bytes.Contains(data, []byte("<coverage")):
+		report.Format, report.Metric = CoverageCobertura, "lines"
+		packages, err = parseCobertura(data)
+	default:
+		return CoverageReport{}, errNotCoverage
+	}
+	if err != nil {
+		return CoverageReport{}, err
+	}
+
+	report.Packages = []CoveragePackage{}
+	for name, count := range packages {
+		report.Covered += count.covered
+		report.Total += count.total
+		report.Packages = append(report.Packages, CoveragePackage{Name: name, Covered: count.covered, Total: count.total, Percent: coveragePercent(count.covered, count.total)})
+	}
+	report.Percent = coveragePercent(report.Covered, report.Total)
+	sort.Slice(report.Packages, func(i, j int) bool {
+		a, b := report.Packages[i], report.Packages[j]
+		if a.Percent != b.Percent {
+			return a.Percent < b.Percent
+		}
+		return a.Name < b.Name
+	})
+	if len(report.Packages) > COVERAGE_MAX_PACKAGES {
+		report.Packages = report.Packages[:COVERAGE_MAX_PACKAGES]
+		report.Truncated = true
+	}
+	return report, nil
+}
+
+// coveragePercent rounds covered/total to one decimal place
+func coveragePercent(covered, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(covered)/float64(total)*1000) / 10
+}
+
+// parseGoCoverage counts the statements of a Go cover profile by package
+// (the directory of each file's import path). A block listed more than once,
+// as in profiles merged from several test binaries, is covered if any run
+// covered it.
+func parseGoCoverage(reader io.Reader) (map[string]*coverageCount, error) {
+	type block struct {
+		statements int
+		covered    bool
+	}
+	blocks := make(map[string]*block)
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "mode:") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		// file.go:12.34,15.2 3 1
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		statements, err1 := strconv.Atoi(fields[1])
+		count, err2 := strconv.Atoi(fields[2])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("malformed line %q", line)
+		}
+		b, ok := blocks[fields[0]]
+		if !ok {
+			b = &block{statements: statements}
+			blocks[fields[0]] = b
+		}
+		b.covered = b.covered || count > 0
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	packages := make(map[string]*coverageCount)
+	for position, b := range blocks {
+		file, _, _ := strings.Cut(position, ":")
+		count := packageCount(packages, path.Dir(file))
+		count.total += b.statements
+		if b.covered {
+			count.covered += b.statements
+		}
+	}
+	return packages, nil
+}
+
+// parseLCOV counts the lines of an LCOV report by directory, from each
+// file's LH (lines hit) and LF (lines found) records
+func parseLCOV(reader io.Reader, base string) (map[string]*coverageCount, error) {
+	packages := make(map[string]*coverageCount)
+	var dir string
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		switch key {
+		case "SF":
+			file := value
+			if rel, err := filepath.Rel(base, value); err == nil && filepath.IsAbs(value) && !strings.HasPrefix(rel, "..") {
+				file = rel
+			}
+			dir = path.Dir(filepath.ToSlash(file))
+		case "LF":
+			found, _ := strconv.Atoi(value)
+			packageCount(packages, dir).total += found
+		case "LH":
+			hit, _ := strconv.Atoi(value)
+			packageCount(packages, dir).covered += hit
+		}
+	}
+	return packages, scanner.Err()
+}
+
+// parseCobertura counts the lines of a Cobertura report by package. A line
+// that appears in several classes of a file is counted once.
+func parseCobertura(data []byte) (map[string]*coverageCount, error) {
+	var report struct {
+		Packages []struct {
+			Name    string `xml:"name,attr"`
+			Classes []struct {
+				Filename string `xml:"filename,attr"`
+				Lines    []struct {
+					Number int `xml:"number,attr"`
+					Hits   int `xml:"hits,attr"`
+				} `xml:"lines>line"`
+			} `xml:"classes>class"`
+		} `xml:"packages>package"`
+	}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	packages := make(map[string]*coverageCount)
+	for _, pkg := range report.Packages {
+		name := pkg.Name
+		if name == "" {
+			name = "."
+		}
+		count := packageCount(packages, name)
+		hits := make(map[string]bool)
+		for _, class := range pkg.Classes {
+			for _, line := range class.Lines {
+				key := fmt.Sprintf("%s:%d", class.Filename, line.Number)
+				covered, seen := hits[key]
+				hits[key] = covered || line.Hits > 0
+				if !seen {
+					count.total++
+				}
+			}
+		}
+		for _, covered := range hits {
+			if covered {
+				count.covered++
+			}
+		}
+	}
+	return packages, nil
+}
+
+// parseJaCoCo counts the lines of a JaCoCo report by package, from each
+// package's LINE counter
+func parseJaCoCo(data []byte) (map[string]*coverageCount, error) {
+	var report struct {
+		Packages []struct {
+			Name     string `xml:"name,attr"`
+			Counters []struct {
+				Type    string `xml:"type,attr"`
+				Missed  int    `xml:"missed,attr"`
+				Covered int    `xml:"covered,attr"`
+			} `xml:"counter"`
+		} `xml:"package"`
+	}
+	// JaCoCo reports declare a DTD that needn't (and can't) be fetched
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	if err := decoder.Decode(&report); err != nil {
+		return nil, err
+	}
+	packages := make(map[string]*coverageCount)
+	for _, pkg := range report.Packages {
+		for _, counter := range pkg.Counters {
+			if counter.Type == "LINE" {
+				count := packageCount(packages, strings.ReplaceAll(pkg.Name, "/", "."))
+				count.covered += counter.Covered
+				count.total += counter.Missed + counter.Covered
+			}
+		}
+	}
+	return packages, nil
+}
+
+// packageCount returns the count of a package, adding it if needed
+func packageCount(packages map[string]*coverageCount, name string) *coverageCount {
+	count, ok := packages[name]
+	if !ok {
+		count = &coverageCount{}
+		packages[name] = count
+	}
+	return count
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// MERMAID_FIX_ATTEMPTS is how often the model is asked to fix a diagram that
+// doesn't parse before it is left as it is
+const MERMAID_FIX_ATTEMPTS = 2
+
+// DIAGRAMS_PROMPT asks for the --diagrams, in the Mermaid syntax the check
+// accepts
+const DIAGRAMS_PROMPT = `Include two Mermaid diagrams in the answer, each in a fenced ` + "```mermaid" + ` block placed in the section it illustrates:
+- a component diagram: a flowchart of the main components (services, packages, layers, data stores) and how they call or feed each other;
+- a dependency diagram: a flowchart of the internal modules and the external libraries or services they depend on.
+Derive both from the files you read, naming real modules. Keep them to about 20 nodes and group related nodes with subgraphs. Use "flowchart LR" or "flowchart TD", node ids of letters, digits and underscores, and quote labels with spaces or punctuation, e.g. api["HTTP API (Go)"] --> db[("Postgres")]. Use arrows such as -->, -.-> and ==>, with labels as -->|reads| or -- reads -->.
+`
+
+// DIAGRAM_FIX_PROMPT asks the model to repair a diagram that doesn't parse
+const DIAGRAM_FIX_PROMPT = `This %s diagram from a technical document fails to parse:
+
+%s
+
+Error: %s
+
+Fix its syntax without changing what it shows: keep its nodes, edges, labels and diagram type. Quote labels that contain punctuation. Return only the corrected source, without a code fence or explanation.`
+
+// DiagramCheck is the outcome of checking one diagram of the result
+type DiagramCheck struct {
+	Line  int    `json:"line"` // of its opening fence, in the checked document
+	Type  string `json:"type"` // the Mermaid diagram type, or "workspace" for Structurizr DSL
+	Valid bool   `json:"valid"`
+	Fixed bool   `json:"fixed,omitempty"` // the model fixed it
+	Error string `json:"error,omitempty"` // why it still doesn't parse
+}
+
+// diagramSyntax is a diagram language checkDiagrams validates
+type diagramSyntax struct {
+	name     string
+	validate func(source string) (string, error) // returns the diagram type
+}
+
+// diagramSyntaxes are the diagram languages checkDiagrams validates, by the
+// language of their fenced blocks
+var diagramSyntaxes = map[string]diagramSyntax{
+	"mermaid":     {"Mermaid", validateMermaid},
+	"structurizr": {"Structurizr DSL", validateStructurizr},
+}
+
+// mermaidDiagramTypes are the diagram declarations Mermaid knows
+var mermaidDiagramTypes = map[string]bool{
+	"graph": true, "flowchart": true, "sequenceDiagram": true, "classDiagram": true, "classDiagram-v2": true,
+	"stateDiagram": true, "stateDiagram-v2": true, "erDiagram": true, "journey": true, "gantt": true, "pie": true,
+	"gitGraph": true, "mindmap": true, "timeline": true, "quadrantChart": true, "requirementDiagram": true,
+	"C4Context": true, "C4Container": true, "C4Component": true, "C4Dynamic": true, "C4Deployment": true,
+	"sankey-beta": true, "xychart-beta": true, "block-beta": true, "packet-beta": true, "architecture-beta": true,
+}
+
+var (
+	flowchartDirection = regexp.MustCompile(`^(?:TB|TD|BT|RL|LR)$`)
+	flowchartNodeID    = regexp.MustCompile(`^[\p{L}\p{N}_]+(?:[.-][\p{L}\p{N}_]+)*`)
+	// Arrows, each with an optional |label|, or an arrow with its label inline
+	flowchartArrow      = regexp.MustCompile(`^[<ox]?(?:-{2,}|={2,}|-\.+-|~{3,})[>ox]?(?:\|[^|]*\|)?`)
+	flowchartTextArrow  = regexp.MustCompile(`^(?:<?--|<?==|<?-\.)\s+[^|>]+?\s+(?:-{2,}[>ox]?|={2,}[>ox]?|\.-+[>ox]?)`)
+	sequenceMessage     = regexp.MustCompile(`^[^:]+?\s*(?:<<-->>|<<->>|-->>|->>|-->|->|--x|-x|--\)|-\))[+-]?\s*[^:]+?\s*:`)
+	sequenceParticipant = regexp.MustCompile(`^(?:participant|actor)\s+\S`)
+	sequenceNote        = regexp.MustCompile(`^(?i:note)\s+(?:left of|right of|over)\s+[^:]+:`)
+	sequenceKeyword     = regexp.MustCompile(`^(?:activate|deactivate|autonumber|title|create|destroy|link|links)\b`)
+)
+
+// flowchartShapes are the openers of node shapes, longest first, with their
+// closers
+var flowchartShapes = [][2]string{
+	{"(((", ")))"}, {"([", "])"}, {"[[", "]]"}, {"[(", ")]"}, {"((", "))"}, {"{{", "}}"},
+	{"[/", "/]"}, {"[/", `\]`}, {`[\`, `\]`}, {`[\`, "/]"}, {"[", "]"}, {"(", ")"}, {"{", "}"}, {">", "]"},
+}
+
+// sequenceBlocks open blocks of a sequence diagram that "end" closes
+var sequenceBlocks = map[string]bool{"loop": true, "alt": true, "opt": true, "par": true, "critical": true, "break": true, "rect": true, "box": true}
+
+// validateMermaid checks the syntax of a Mermaid diagram: its declaration
+// for every type, and for flowcharts and sequence diagrams, the most common
+// types, and C4 diagrams, each statement. Other types are checked for closed quotes, and the
+// braces of class and state diagrams. It is a static check of the mistakes models make, such as
+// unquoted labels with brackets or single-dash arrows, not a full parser.
+func validateMermaid(source string) (string, error) {
+	lines := mermaidStatements(source)
+	if len(lines) == 0 {
+		return "", fmt.Errorf("the diagram is empty")
+	}
+	header := strings.Fields(lines[0].text)
+	kind := header[0]
+	if !mermaidDiagramTypes[kind] {
+		return kind, fmt.Errorf("line %d: unknown diagram type %q", lines[0].number, kind)
+	}
+	switch kind {
+	case "graph", "flowchart":
+		if len(header) > 1 && !flowchartDirection.MatchString(header[1]) {
+			return kind, fmt.Errorf("line %d: unknown direction %q", lines[0].number, header[1])
+		}
+		return kind, validateFlowchart(lines[1:])
+	case "sequenceDiagram":
+		return kind, validateSequence(lines[1:])
+	case "C4Context", "C4Container", "C4Component", "C4Dynamic", "C4Deployment":
+		return kind, validateC4(lines[1:])
+	}
+	// Class and state bodies span lines between braces
+	braces := strings.HasPrefix(kind, "classDiagram") || strings.HasPrefix(kind, "stateDiagram")
+	depth := 0
+	for _, line := range lines[1:] {
+		if strings.Count(line.text, `"`)%2 != 0 {
+			return kind, fmt.Errorf("line %d: unclosed quote", line.number)
+		}
+		if braces {
+			depth += strings.Count(line.text, "{") - strings.Count(line.text, "}")
+			if depth < 0 {
+				return kind, fmt.Errorf("line %d: unbalanced \"}\"", line.number)
+			}
+		}
+	}
+	if depth > 0 {
+		return kind, fmt.Errorf("%d unclosed \"{\"", depth)
+	}
+	return kind, nil
+}
+
+// mermaidStatement is a line of a diagram, numbered from 1
+type mermaidStatement struct {
+	number int
+	text   string
+}
+
+// mermaidStatements returns the non-blank lines of a diagram, without its
+// front matter, %% comments and directives, split at semicolons
+func mermaidStatements(source string) []mermaidStatement {
+	var statements []mermaidStatement
+	lines := strings.Split(source, "\n")
+	start := 0
+	if strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				start = i + 1
+				break
+			}
+		}
+	}
+	for i := start; i < len(lines); i++ {
+		text := strings.TrimSpace(lines[i])
+		if text == "" || strings.HasPrefix(text, "%%") {
+			continue
+		}
+		for _, part := range splitOutsideQuotes(text, ';') {
+			if part = strings.TrimSpace(part); part != "" {
+				statements = append(statements, mermaidStatement{number: i + 1, text: part})
+			}
+		}
+	}
+	return statements
+}
+
+// splitOutsideQuotes splits text at sep outside double quotes
+func splitOutsideQuotes(text string, sep byte) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, text[start:])
+}
+
+// balanced checks that text's quotes are closed and its brackets nest
+func balanced(text string) error {
+	var stack []byte
+	closers := map[byte]byte{')': '(', ']': '[', '}': '{'}
+	quoted := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, c)
+		case closers[c] != 0:
+			if len(stack) == 0 || stack[len(stack)-1] != closers[c] {
+				return fmt.Errorf("unbalanced %q", string(c))
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if quoted {
+		return fmt.Errorf("unclosed quote")
+	}
+	if len(stack) > 0 {
+		return fmt.Errorf("unclosed %q", string(stack[len(stack)-1]))
+	}
+	return nil
+}
+
+// validateFlowchart checks the statements of a flowchart after its
+// declaration
+func validateFlowchart(lines []mermaidStatement) error {
+	depth := 0
+	for _, line := range lines {
+		word, rest, _ := strings.Cut(line.text, " ")
+		switch word {
+		case "subgraph":
+			depth++
+			if strings.TrimSpace(rest) == "" {
+				return fmt.Errorf("line %d: subgraph without an id", line.number)
+			}
+			if err := balanced(rest); err != nil {
+				return fmt.Errorf("line %d: %v", line.number, err)
+			}
+			continue
+		case "end":
+			if depth == 0 {
+				return fmt.Errorf("line %d: end without a subgraph", line.number)
+			}
+			depth--
+			continue
+		case "classDef", "class", "style", "linkStyle", "click", "direction":
+			if strings.TrimSpace(rest) == "" {
+				return fmt.Errorf("line %d: %s without arguments", line.number, word)
+			}
+			continue
+		}
+		if err := validateFlowchartChain(line.text); err != nil {
+			return fmt.Errorf("line %d: %v", line.number, err)
+		}
+	}
+	if depth > 0 {
+		return fmt.Errorf("%d subgraph(s) without an end", depth)
+	}
+	return nil
+}
+
+// validateFlowchartChain checks a statement of nodes joined by arrows, such
+// as A[Label] --> B & C -->|text| D
+func validateFlowchartChain(text string) error {
+	rest := strings.TrimSpace(text)
+	for {
+		// A node: its id, shape and class
+		id := flowchartNodeID.FindString(rest)
+		if id == "" {
+			return fmt.Errorf("expected a node id at %q", truncateRunes(rest, 30))
+		}
+		rest = rest[len(id):]
+		if shape, length, err := flowchartShape(rest); err != nil {
+			return fmt.Errorf("node %s: %v", id, err)
+		} else if shape {
+			rest = rest[length:]
+		}
+		if strings.HasPrefix(rest, ":::") {
+			class := flowchartNodeID.FindString(rest[3:])
+			if class == "" {
+				return fmt.Errorf("node %s: ::: without a class", id)
+			}
+			rest = rest[3+len(class):]
+		}
+		rest = strings.TrimSpace(rest)
+		if rest == "" {
+			return nil
+		}
+		if strings.HasPrefix(rest, "&") {
+			rest = strings.TrimSpace(rest[1:])
+			continue
+		}
+		// An arrow
+		arrow := flowchartTextArrow.FindString(rest)
+		if arrow == "" {
+			arrow = flowchartArrow.FindString(rest)
+		}
+		if arrow == "" {
+			return fmt.Errorf("expected an arrow such as --> after %s, found %q", id, truncateRunes(rest, 30))
+		}
+		if err := balanced(arrow); err != nil {
+			return fmt.Errorf("arrow %q: %v", arrow, err)
+		}
+		rest = strings.TrimSpace(rest[len(arrow):])
+		if rest == "" {
+			return fmt.Errorf("arrow %q leads nowhere", arrow)
+		}
+	}
+}
+
+// flowchartShape reads the shape starting text, if any, and returns its
+// length. A label with brackets, quotes or other shapes' delimiters must be
+// quoted.
+func flowchartShape(text string) (bool, int, error) {
+	for _, shape := range flowchartShapes {
+		if !strings.HasPrefix(text, shape[0]) {
+			continue
+		}
+		label := text[len(shape[0]):]
+		if strings.HasPrefix(label, `"`) {
+			end := strings.Index(label[1:], `"`)
+			if end < 0 {
+				return false, 0, fmt.Errorf("unclosed quote in its label")
+			}
+			after := label[1+end+1:]
+			if !strings.HasPrefix(after, shape[1]) {
+				return false, 0, fmt.Errorf("expected %q after its quoted label", shape[1])
+			}
+			return true, len(shape[0]) + 1 + end + 1 + len(shape[1]), nil
+		}
+		end := strings.Index(label, shape[1])
+		if end < 0 {
+			// A longer opener may have matched a different shorter shape
+			continue
+		}
+		if strings.ContainsAny(label[:end], `()[]{}"|`) {
+			return false, 0, fmt.Errorf("label %q needs quotes: %s\"...\"%s", label[:end], shape[0], shape[1])
+		}
+		return true, len(shape[0]) + end + len(shape[1]), nil
+	}
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "(") || strings.HasPrefix(text, "{") {
+		return false, 0, fmt.Errorf("unclosed shape %q", truncateRunes(text, 30))
+	}
+	return false, 0, nil
+}
+
+// validateSequence checks the statements of a sequence diagram after its
+// declaration
+func validateSequence(lines []mermaidStatement) error {
+	depth := 0
+	for _, line := range lines {
+		word := strings.Fields(line.text)[0]
+		switch {
+		case sequenceBlocks[word]:
+			depth++
+		case word == "else" || word == "and" || word == "option":
+			if depth == 0 {
+				return fmt.Errorf("line %d: %s outside a block", line.number, word)
+			}
+		case word == "end":
+			if depth == 0 {
+				return fmt.Errorf("line %d: end without a block", line.number)
+			}
+			depth--
+		case sequenceParticipant.MatchString(line.text), sequenceNote.MatchString(line.text), sequenceKeyword.MatchString(line.text):
+		case sequenceMessage.MatchString(line.text):
+		default:
+			return fmt.Errorf("line %d: expected a message such as A->>B: text, found %q", line.number, truncateRunes(line.text, 40))
+		}
+	}
+	if depth > 0 {
+		return fmt.Errorf("%d block(s) without an end", depth)
+	}
+	return nil
+}
+
+// checkDiagrams validates the Mermaid and Structurizr DSL blocks of document,
+// see diagramSyntaxes. With a fixer, each
+// that doesn't parse is sent to it up to MERMAID_FIX_ATTEMPTS times and
+// replaced by its first answer that does. It returns the document and the
+// outcome for every diagram.
+func checkDiagrams(document string, fixer LLMClient) (string, []DiagramCheck) {
+	lines := strings.Split(document, "\n")
+	var checks []DiagramCheck
+	for i := 0; i < len(lines); i++ {
+		m := fencePattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		start := i
+		for i++; i < len(lines) && !closesFence(lines[i], m[1]); i++ {
+		}
+		syntax, ok := diagramSyntaxes[strings.ToLower(m[2])]
+		if !ok {
+			continue
+		}
+		end := min(i, len(lines))
+		source := strings.Join(lines[start+1:end], "\n")
+		kind, err := syntax.validate(source)
+		check := DiagramCheck{Line: start + 1, Type: kind, Valid: err == nil}
+		for attempt := 1; err != nil && fixer != nil && attempt <= MERMAID_FIX_ATTEMPTS; attempt++ {
+			log.Printf("%s diagram at line %d doesn't parse (%v); asking for a fix, attempt %d", syntax.name, check.Line, err, attempt)
+			fixed, fixErr := fixer.Complete(fmt.Sprintf(DIAGRAM_FIX_PROMPT, syntax.name, source, err), fmt.Sprintf("You fix %s diagram syntax.", syntax.name), 0.0)
+			if fixErr != nil {
+				log.Printf("%s fix failed: %v", syntax.name, fixErr)
+				break
+			}
+			fixed = unfenceDiagram(fixed)
+			if kind, err = syntax.validate(fixed); err == nil {
+				source = fixed
+				check.Type, check.Fixed = kind, true
+			}
+		}
+		if err != nil {
+			check.Error = err.Error()
+			log.Printf("%s diagram at line %d doesn't parse: %v", syntax.name, check.Line, err)
+		}
+		checks = append(checks, check)
+		if check.Fixed {
+			// Splice the fix in, and carry on after it
+			fixedLines := strings.Split(source, "\n")
+			rest := append(fixedLines, lines[end:]...)
+			lines = append(lines[:start+1], rest...)
+			i = start + len(fixedLines) + 1
+		}
+	}
+	return strings.Join(lines, "\n"), checks
+}
+
+// unfenceDiagram returns the diagram in a model's answer, which may be
+// fenced despite being asked not to be
+func unfenceDiagram(answer string) string {
+	answer = strings.TrimSpace(answer)
+	lines := strings.Split(answer, "\n")
+	if len(lines) >= 2 && fencePattern.MatchString(lines[0]) && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "```") {
+		return strings.Join(lines[1:len(lines)-1], "\n")
+	}
+	return answer
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateMermaid(t *testing.T) {
+	tests := []struct {
+		name    string
+		diagram string
+		wantErr string // "" for valid
+	}{
+		{"flowchart", "flowchart LR\n  api[\"HTTP API (Go)\"] --> db[(\"Postgres\")]\n  subgraph core [Core]\n    a-->b\n    api-gateway -.-> b:::hot\n  end\n  a -- reads --> c & d\n  x ==>|yes| y{Decide}\n  classDef hot fill:#f00", ""},
+		{"shapes and directives", "%%{init: {}}%%\ngraph\n  A((circle)) --- B>flag] --o C o--o D;E", ""},
+		{"unquoted brackets", "graph TD\n  A[foo(bar)] --> B", `line 2: node A: label "foo(bar)" needs quotes`},
+		{"single-dash arrow", "graph TD\n  A -> B", "line 2: expected an arrow such as --> after A"},
+		{"dangling arrow", "graph TD\n  A -->", `arrow "-->" leads nowhere`},
+		{"subgraph without end", "graph TD\n  subgraph x\n  A --> B", "1 subgraph(s) without an end"},
+		{"unknown direction", "graph XY\n  A-->B", `unknown direction "XY"`},
+		{"sequence", "sequenceDiagram\n  participant web-app\n  web-app->>db: query\n  alt ok\n    db-->>web-app: rows\n  else\n    Note over db: fails\n  end", ""},
+		{"sequence without text", "sequenceDiagram\n  A to B", "line 2: expected a message"},
+		{"class body", "classDiagram\n  class A {\n    +int x\n  }", ""},
+		{"unclosed class body", "classDiagram\n  class A {\n    +int x", `1 unclosed "{"`},
+		{"er cardinality", "erDiagram\n  A ||--o{ B : has\n  B }|..|{ C : uses", ""},
+		{"c4 container", "C4Container\n  title Containers of Shop\n  Person(customer, \"Customer\", \"Buys, browses\")\n  System_Boundary(shop, \"Shop\") {\n    Container(web, \"Web app\", \"React\")\n    ContainerDb(db, \"Database\", \"PostgreSQL\")\n  }\n  Rel(customer, web, \"Browses\", \"HTTPS\")\n  Rel_D(web, db, \"Reads (SQL)\")\n  UpdateLayoutConfig($c4ShapeInRow=\"3\")", ""},
+		{"c4 undeclared element", "C4Context\n  Person(user, \"User\")\n  Rel(user, api, \"Calls\")", `line 3: relationship with undeclared element "api"`},
+		{"c4 unknown macro", "C4Context\n  Service(api, \"API\")", `line 2: unknown C4 macro "Service"`},
+		{"c4 arrow", "C4Context\n  user --> api", "line 2: expected a C4 statement"},
+		{"c4 unclosed boundary", "C4Container\n  System_Boundary(s, \"S\") {\n  Container(a, \"A\")", `1 unclosed "{"`},
+		{"unknown type", "notADiagram\n  x", `unknown diagram type "notADiagram"`},
+		{"empty", "%% nothing", "the diagram is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateMermaid(tt.diagram)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validateMermaid() = %v, want no error", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("validateMermaid() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fixedDiagram answers every fix request with the same diagram
+type fixedDiagram struct {
+	answer string
+	calls  int
+}
+
+func (f *fixedDiagram) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
+	f.calls++
+	return f.answer, nil
+}
+
+func TestCheckDiagrams(t *testing.T) {
+	document := "# Doc\n\n```mermaid\ngraph TD\n  A[foo(bar)] --> B\n```\n\n```go\nx := 1\n```\n\n```mermaid\nflowchart LR\n  C --> D\n```\n"
+
+	fixer := &fixedDiagram{answer: "```mermaid\ngraph TD\n  A[\"foo(bar)\"] --> B\n  B --> E\n```"}
+	fixed, checks := checkDiagrams(document, fixer)
+	if want := "```mermaid\ngraph TD\n  A[\"foo(bar)\"] --> B\n  B --> E\n```\n\n```go\nx := 1\n```\n\n```mermaid\nflowchart LR\n  C --> D\n```\n"; !strings.HasSuffix(fixed, want) {
+		t.Errorf("checkDiagrams() document =\n%s", fixed)
+	}
+	if len(checks) != 2 || !checks[0].Fixed || checks[0].Valid || checks[0].Line != 3 || !checks[1].Valid || checks[1].Line != 13 || fixer.calls != 1 {
+		t.Errorf("checkDiagrams() checks = %+v after %d calls", checks, fixer.calls)
+	}
+
+	// A fix that still doesn't parse is retried, then the diagram is left alone
+	fixer = &fixedDiagram{answer: "graph TD\n  A -> B"}
+	unfixed, checks := checkDiagrams(document, fixer)
+	if unfixed != document || fixer.calls != MERMAID_FIX_ATTEMPTS || checks[0].Fixed || !strings.Contains(checks[0].Error, "expected an arrow") {
+		t.Errorf("checkDiagrams() with a bad fix = %+v after %d calls", checks, fixer.calls)
+	}
+
+	// Without a fixer the diagrams are only checked
+	if unchecked, checks := checkDiagrams(document, nil); unchecked != document || checks[0].Valid {
+		t.Errorf("checkDiagrams() without a fixer = %+v", checks)
+	}
+}
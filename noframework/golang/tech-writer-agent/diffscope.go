@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DIFF_PROMPT_MAX_FILES caps the changed files listed in a diff-scoped
+// prompt; the diff itself is cut at GIT_DIFF_MAX_BYTES like git_diff's
+const DIFF_PROMPT_MAX_FILES = 500
+
+// DiffRange is the pair of refs a diff-scoped analysis (--from-ref,
+// --to-ref) documents the changes between, with the commits they resolved to
+type DiffRange struct {
+	From       string `json:"from"`
+	To         string `json:"to"`
+	FromCommit string `json:"from_commit"`
+	ToCommit   string `json:"to_commit"`
+	Files      int    `json:"files"` // files changed
+}
+
+// resolveDiffRange resolves the refs of a diff-scoped analysis in directory.
+// A cloned repository only has the commit it checked out, so refs it lacks
+// are fetched from its origin (at depth 1: git diff needs the two trees, not
+// the history between them).
+func resolveDiffRange(directory string, cloned bool, from, to string) (*DiffRange, error) {
+	if to == "" {
+		to = "HEAD"
+	}
+	diffRange := &DiffRange{From: from, To: to}
+	for _, side := range []struct {
+		ref    string
+		commit *string
+	}{{from, &diffRange.FromCommit}, {to, &diffRange.ToCommit}} {
+		commit, err := resolveCommit(directory, cloned, side.ref)
+		if err != nil {
+			return nil, err
+		}
+		*side.commit = commit
+	}
+	return diffRange, nil
+}
+
+// resolveCommit returns the commit ref names in directory, fetching it from
+// origin if the directory is a clone without it
+func resolveCommit(directory string, cloned bool, ref string) (string, error) {
+	if output, err := runGit(directory, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err == nil {
+		return strings.TrimSpace(output), nil
+	}
+	if !cloned {
+		return "", fmt.Errorf("unknown ref %q in %s", ref, directory)
+	}
+	if _, err := runGit(directory, "fetch", "--quiet", "--depth", "1", "origin", ref); err != nil {
+		return "", fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	output, err := runGit(directory, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// diffPrompt describes the changes of diffRange for the prompt of a
+// diff-scoped analysis, asking for upgrade and migration notes rather than a
+// description of the whole code base
+func diffPrompt(directory string, diffRange *DiffRange) (string, error) {
+	changes, err := describeChanges(directory, diffRange)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Document the changes from %s (commit %s) to %s (commit %s), not the whole code base. ", diffRange.From, diffRange.FromCommit, diffRange.To, diffRange.ToCommit)
+	b.WriteString("Write upgrade and migration notes for the project's users: what changed and why it matters, breaking changes and the actions they require, new features, deprecations and removals, and behaviour changes worth knowing. ")
+	b.WriteString("Read the changed files for context and use git_diff with these commits and a path for diffs cut short below. ")
+	b.WriteString(changes)
+	return b.String(), nil
+}
+
+// describeChanges lists the files changed in diffRange with their line
+// counts and gives the diff, saying whether the files on disk are those of
+// its second commit. It records the number of changed files in diffRange.
+// The file list and diff go through the secret scan (--scan-secrets), as
+// they would as the result of a git_diff call.
+func describeChanges(directory string, diffRange *DiffRange) (string, error) {
+	output, err := gitDiff(map[string]interface{}{"directory": directory, "from": diffRange.FromCommit, "to": diffRange.ToCommit})
+	if err != nil {
+		return "", err
+	}
+	diff, ok := output.(GitDiffResult)
+	if !ok {
+		return "", fmt.Errorf("error diffing %s and %s: %v", diffRange.From, diffRange.To, output)
+	}
+	diffRange.Files = len(diff.Files)
+
+	var b strings.Builder
+	if head := gitHeadCommit(directory); head == diffRange.ToCommit {
+		b.WriteString("The files on disk are those of the second commit.\n\n")
+	} else {
+		fmt.Fprintf(&b, "The files on disk are those of commit %s, not the second one; rely on the diff for what changed.\n\n", head)
+	}
+	fmt.Fprintf(&b, "Changed files (%d, +%d -%d lines):\n", len(diff.Files), diff.Added, diff.Deleted)
+	var files strings.Builder
+	for i, file := range diff.Files {
+		if i == DIFF_PROMPT_MAX_FILES {
+			fmt.Fprintf(&files, "  ... and %d more\n", len(diff.Files)-i)
+			break
+		}
+		if file.Binary {
+			fmt.Fprintf(&files, "  %s (binary)\n", file.Path)
+		} else {
+			fmt.Fprintf(&files, "  %s (+%d -%d)\n", file.Path, file.Added, file.Deleted)
+		}
+	}
+	b.WriteString(scanPromptText(files.String()))
+	b.WriteString("\nDiff")
+	if diff.Truncated {
+		fmt.Fprintf(&b, " (cut at %s)", formatBytes(GIT_DIFF_MAX_BYTES))
+	}
+	fmt.Fprintf(&b, ":\n%s\n", scanPromptText(diff.Diff))
+	return b.String(), nil
+}
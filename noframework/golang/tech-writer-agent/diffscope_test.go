@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDescribeChangesScansSecrets(t *testing.T) {
+	repo := t.TempDir()
+	gitFixture(t, repo, []string{"init", "-q"})
+	commit := func(text string) {
+		if err := os.WriteFile(filepath.Join(repo, "config.py"), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitFixture(t, repo, []string{"add", "-A"}, []string{"commit", "-q", "-m", "update"})
+	}
+	commit("DEBUG = True\n")
+	commit("DEBUG = True\npassword = \"hunter22hunter\"\n")
+
+	diffRange, err := resolveDiffRange(repo, false, "HEAD~1", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enableSecretScan(true)
+	defer enableSecretScan(false)
+	changes, err := describeChanges(repo, diffRange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(changes, "hunter22hunter") || !strings.Contains(changes, `password = "`+REDACTED+`"`) {
+		t.Errorf("describeChanges() didn't scan the diff:\n%s", changes)
+	}
+	if !strings.Contains(changes, "config.py (+1 -0)") {
+		t.Errorf("describeChanges() lost the file list:\n%s", changes)
+	}
+}
+
+func TestIncrementalPromptScansSecrets(t *testing.T) {
+	repo := t.TempDir()
+	gitFixture(t, repo, []string{"init", "-q"})
+	write := func(text string) {
+		if err := os.WriteFile(filepath.Join(repo, "config.py"), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+		gitFixture(t, repo, []string{"add", "-A"}, []string{"commit", "-q", "-m", "update"})
+	}
+	write("DEBUG = True\n")
+	write("DEBUG = True\napi_key = \"abcdefgh12345678\"\n")
+	previous := filepath.Join(t.TempDir(), "previous.md")
+	if err := os.WriteFile(previous, []byte("# Config\n\nConnect with password = \"hunter22hunter\".\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diffRange, err := resolveDiffRange(repo, false, "HEAD~1", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enableSecretScan(true)
+	defer enableSecretScan(false)
+	prompt, err := incrementalPrompt(repo, &UpdatePlan{Previous: LastRun{Document: previous}, Changes: *diffRange})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"hunter22hunter", "abcdefgh12345678"} {
+		if strings.Contains(prompt, secret) {
+			t.Errorf("incrementalPrompt() didn't scan %q:\n%s", secret, prompt)
+		}
+	}
+	if !strings.Contains(prompt, "# Config") {
+		t.Errorf("incrementalPrompt() lost the previous document:\n%s", prompt)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatJSON saves the result as a StructuredDocument (--format json)
+const FormatJSON = "json"
+
+// DOCUMENT_SCHEMA identifies the structured documents --format json writes,
+// changing with incompatible changes to their layout
+const DOCUMENT_SCHEMA = "tech-writer-agent/document/v1"
+
+// structuredAnswerPrompt asks for an answer that structures well: sections,
+// citable paths and diagrams in fenced blocks
+const structuredAnswerPrompt = "Your answer will be converted into a structured document, so organise it under Markdown headings (## for the main sections, ### within them), cite files by their repository-relative paths in backquotes, with line numbers as `path:12` or `path:12-30` where they help, and put diagrams in fenced blocks with their language, such as ```mermaid.\n"
+
+// diagramLanguages are the languages of fenced blocks that are diagrams
+var diagramLanguages = map[string]bool{
+	"mermaid": true, "plantuml": true, "puml": true, "dot": true, "graphviz": true, "d2": true, "structurizr": true,
+}
+
+// citationPattern matches what may be a file path in a document, with line
+// numbers as path:12, path:12-30 or path#L12-L30
+var citationPattern = regexp.MustCompile(`(?:[\w.-]+/)*[\w-][\w.-]*\.[A-Za-z0-9]+(?::(\d+)(?:-(\d+))?|#L(\d+)(?:-L(\d+))?)?`)
+
+// StructuredDocument is the result of a --format json run: the document's
+// sections, with the files they cite and their diagrams, for other tools to
+// diff and render
+type StructuredDocument struct {
+	Schema   string            `json:"schema"`
+	Title    string            `json:"title,omitempty"`
+	Intro    string            `json:"intro,omitempty"` // Markdown before the first section
+	Sections []DocumentSection `json:"sections"`
+	Metadata DocumentMetadata  `json:"metadata"`
+}
+
+// DocumentSection is a section of a StructuredDocument, under a heading
+type DocumentSection struct {
+	ID        string            `json:"id"` // the heading's anchor, as GitHub and --format html make it
+	Title     string            `json:"title"`
+	Level     int               `json:"level"`
+	Markdown  string            `json:"markdown"` // its text up to the next heading
+	Citations []Citation        `json:"citations,omitempty"`
+	Diagrams  []Diagram         `json:"diagrams,omitempty"`
+	Sections  []DocumentSection `json:"sections,omitempty"`
+}
+
+// Citation is a file of the repository a section refers to
+type Citation struct {
+	Path      string `json:"path"` // relative to the analysed directory, slash-separated
+	StartLine int    `json:"start_line,omitempty"`
+	EndLine   int    `json:"end_line,omitempty"`
+}
+
+// Diagram is a fenced diagram of a section
+type Diagram struct {
+	Language string `json:"language"`
+	Source   string `json:"source"`
+}
+
+// DocumentMetadata records how a StructuredDocument was made
+type DocumentMetadata struct {
+	Generator   string `json:"generator"`
+	Version     string `json:"version"`
+	Model       string `json:"model"`
+	Repo        string `json:"repo,omitempty"`
+	Commit      string `json:"commit,omitempty"`
+	GeneratedAt string `json:"generated_at"`
+}
+
+// renderDocumentJSON captures document as an indented StructuredDocument,
+// citing the files of directory
+func renderDocumentJSON(document, directory string, metadata DocumentMetadata) (string, error) {
+	data, err := json.MarshalIndent(structureDocument(document, directory, metadata), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error encoding the structured document: %w", err)
+	}
+	return string(data) + "\n", nil
+}
+
+// structureDocument splits document into nested sections at its headings,
+// outside code blocks. Its first level-1 heading is the title. A section's
+// citations are the paths in its text that name files of directory, in full
+// or by a suffix only one file has, such as a unique base name.
+func structureDocument(document, directory string, metadata DocumentMetadata) StructuredDocument {
+	metadata.Generator = "tech-writer-agent"
+	metadata.Version = Version
+	if metadata.GeneratedAt == "" {
+		metadata.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	structured := StructuredDocument{Schema: DOCUMENT_SCHEMA, Sections: []DocumentSection{}, Metadata: metadata}
+	files := citableFiles(directory)
+	ids := make(map[string]int)
+
+	// The sections in order, each with the lines of its text
+	type flatSection struct {
+		section DocumentSection
+		lines   []string
+	}
+	var flat []flatSection
+	var intro []string
+	inFence := ""
+	for _, line := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		if inFence != "" {
+			if closesFence(line, inFence) {
+				inFence = ""
+			}
+		} else if m := fencePattern.FindStringSubmatch(line); m != nil {
+			inFence = m[1]
+		} else if m := headingPattern.FindStringSubmatch(line); m != nil {
+			if len(m[1]) == 1 && structured.Title == "" && len(flat) == 0 {
+				structured.Title = m[2]
+				continue
+			}
+			flat = append(flat, flatSection{section: DocumentSection{ID: uniqueID(ids, m[2]), Title: m[2], Level: len(m[1])}})
+			continue
+		}
+		if len(flat) == 0 {
+			intro = append(intro, line)
+		} else {
+			flat[len(flat)-1].lines = append(flat[len(flat)-1].lines, line)
+		}
+	}
+	structured.Intro = strings.TrimSpace(strings.Join(intro, "\n"))
+
+	for i := range flat {
+		section := &flat[i].section
+		section.Markdown = strings.TrimSpace(strings.Join(flat[i].lines, "\n"))
+		section.Citations = findCitations(section.Markdown, files)
+		section.Diagrams = findDiagrams(flat[i].lines)
+	}
+
+	// Nest each section under the closest one before it of a lower level
+	var nest func(start, level int) ([]DocumentSection, int)
+	nest = func(start, level int) ([]DocumentSection, int) {
+		var sections []DocumentSection
+		i := start
+		for i < len(flat) && flat[i].section.Level > level {
+			section := flat[i].section
+			section.Sections, i = nest(i+1, section.Level)
+			sections = append(sections, section)
+		}
+		return sections, i
+	}
+	if sections, _ := nest(0, 0); sections != nil {
+		structured.Sections = sections
+	}
+	return structured
+}
+
+// citableFiles returns the visible files of directory by their relative,
+// slash-separated paths, or nil if they can't be listed
+func citableFiles(directory string) []string {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return nil
+	}
+	files, err := listFiles(absDir, DefaultWalkOptions())
+	if err != nil {
+		return nil
+	}
+	var rels []string
+	for _, file := range files {
+		if rel, err := filepath.Rel(absDir, file); err == nil {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+	}
+	return rels
+}
+
+// findCitations returns the files text refers to, in the order it first
+// refers to them, each path and line range once
+func findCitations(text string, files []string) []Citation {
+	var citations []Citation
+	seen := make(map[Citation]bool)
+	for _, m := range citationPattern.FindAllStringSubmatch(text, -1) {
+		candidate := m[0]
+		if i := strings.IndexAny(candidate, ":#"); i >= 0 {
+			candidate = candidate[:i]
+		}
+		file, ok := resolveCitation(path.Clean(candidate), files)
+		if !ok {
+			continue
+		}
+		citation := Citation{Path: file}
+		citation.StartLine, _ = strconv.Atoi(m[1] + m[3])
+		citation.EndLine, _ = strconv.Atoi(m[2] + m[4])
+		if !seen[citation] {
+			seen[citation] = true
+			citations = append(citations, citation)
+		}
+	}
+	return citations
+}
+
+// resolveCitation returns the file that candidate names: the file at that
+// path, or else the only one whose path ends with it
+func resolveCitation(candidate string, files []string) (string, bool) {
+	candidate = strings.TrimPrefix(candidate, "/")
+	match := ""
+	for _, file := range files {
+		if file == candidate {
+			return file, true
+		}
+		if strings.HasSuffix(file, "/"+candidate) {
+			if match != "" {
+				return "", false
+			}
+			match = file
+		}
+	}
+	return match, match != ""
+}
+
+// findDiagrams returns the fenced blocks of lines in diagramLanguages
+func findDiagrams(lines []string) []Diagram {
+	var diagrams []Diagram
+	for i := 0; i < len(lines); i++ {
+		m := fencePattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			continue
+		}
+		fence, language := m[1], strings.ToLower(m[2])
+		var source []string
+		for i++; i < len(lines); i++ {
+			if closesFence(lines[i], fence) {
+				break
+			}
+			source = append(source, lines[i])
+		}
+		if diagramLanguages[language] {
+			diagrams = append(diagrams, Diagram{Language: language, Source: strings.Join(source, "\n")})
+		}
+	}
+	return diagrams
+}
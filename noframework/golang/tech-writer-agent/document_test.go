@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStructureDocument(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"main.go":            "package main",
+		"internal/server.go": "package internal",
+		"cmd/a/util.go":      "package main",
+		"cmd/b/util.go":      "package main",
+	})
+	document := "# Widget `Server`\n\nAn overview.\n\n" +
+		"## Architecture\n\nStarts in `main.go:10-20`, serving from internal/server.go#L5 and server.go.\nNot util.go, which two files share, nor missing.go.\n\n" +
+		"```mermaid\ngraph TD\n  A --> B\n```\n\n" +
+		"### Server *internals*\n\n```go\n// ## not a heading\n```\n\n" +
+		"## Architecture\n\nSee ./cmd/a/util.go.\n"
+	got := structureDocument(document, dir, DocumentMetadata{Model: "openai/gpt-4o"})
+
+	if got.Schema != DOCUMENT_SCHEMA || got.Title != "Widget `Server`" || got.Intro != "An overview." {
+		t.Errorf("structureDocument() schema, title, intro = %q, %q, %q", got.Schema, got.Title, got.Intro)
+	}
+	if got.Metadata.Generator != "tech-writer-agent" || got.Metadata.Model != "openai/gpt-4o" || got.Metadata.GeneratedAt == "" {
+		t.Errorf("structureDocument() metadata = %+v", got.Metadata)
+	}
+	if len(got.Sections) != 2 {
+		t.Fatalf("structureDocument() has %d top-level sections, want 2", len(got.Sections))
+	}
+
+	architecture := got.Sections[0]
+	if architecture.ID != "architecture" || architecture.Level != 2 || len(architecture.Sections) != 1 {
+		t.Errorf("first section = %q level %d with %d subsections", architecture.ID, architecture.Level, len(architecture.Sections))
+	}
+	wantCitations := []Citation{
+		{Path: "main.go", StartLine: 10, EndLine: 20},
+		{Path: "internal/server.go", StartLine: 5},
+		{Path: "internal/server.go"},
+	}
+	if !reflect.DeepEqual(architecture.Citations, wantCitations) {
+		t.Errorf("citations = %+v, want %+v", architecture.Citations, wantCitations)
+	}
+	if want := []Diagram{{Language: "mermaid", Source: "graph TD\n  A --> B"}}; !reflect.DeepEqual(architecture.Diagrams, want) {
+		t.Errorf("diagrams = %+v, want %+v", architecture.Diagrams, want)
+	}
+
+	internals := architecture.Sections[0]
+	if internals.ID != "server-internals" || internals.Level != 3 || internals.Markdown != "```go\n// ## not a heading\n```" {
+		t.Errorf("subsection = %q level %d: %q", internals.ID, internals.Level, internals.Markdown)
+	}
+
+	second := got.Sections[1]
+	if second.ID != "architecture-1" || !reflect.DeepEqual(second.Citations, []Citation{{Path: "cmd/a/util.go"}}) {
+		t.Errorf("second section = %q citing %+v", second.ID, second.Citations)
+	}
+}
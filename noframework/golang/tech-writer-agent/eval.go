@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// evalJob is a result in the output directory awaiting evaluation
+type evalJob struct {
+	resultFile   string
+	metadataFile string
+	metadata     Metadata
+}
+
+// runEval implements the eval command. Its only mode, "eval batch DIR",
+// evaluates every result in DIR whose metadata has no evaluation yet.
+func runEval(argv []string) error {
+	if len(argv) == 0 || argv[0] != "batch" {
+		return fmt.Errorf("usage: %s eval batch [flags] OUTPUT_DIR", filepath.Base(os.Args[0]))
+	}
+
+	fs := flag.NewFlagSet("eval batch", flag.ExitOnError)
+	evalPromptFile := fs.String("eval-prompt", "", "Path to file containing prompt to evaluate the tech writer results (required)")
+	model := fs.String("model", "", "Judge model (format: vendor/model); defaults to the model recorded in each result's metadata")
+	baseURL := fs.String("base-url", "", "Base URL for the judge model's API")
+	concurrency := fs.Int("concurrency", 4, "Number of evaluations run at once")
+	rpm := fs.Int("rpm", 60, "Maximum evaluation requests started per minute (0 disables the limit)")
+	force := fs.Bool("force", false, "Re-evaluate results that already have an evaluation")
+	auditLogFile := fs.String("audit-log", os.Getenv("TECH_WRITER_AUDIT_LOG"), "Append a JSON line per LLM request to this file (no content)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s eval batch [flags] OUTPUT_DIR\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv[1:])
+
+	outputDir := "output"
+	if fs.NArg() > 0 {
+		outputDir = fs.Arg(0)
+	}
+	if *evalPromptFile == "" {
+		return fmt.Errorf("-eval-prompt is required")
+	}
+	if *concurrency < 1 {
+		*concurrency = 1
+	}
+	evalPrompt, err := readPromptFile(*evalPromptFile)
+	if err != nil {
+		return err
+	}
+	if *auditLogFile != "" {
+		if err := openAuditLog(*auditLogFile); err != nil {
+			return err
+		}
+		defer auditLog.Close()
+	}
+
+	jobs, err := findEvalJobs(outputDir, *force)
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 {
+		log.Printf("No results in %s need evaluating", outputDir)
+		return nil
+	}
+	log.Printf("Evaluating %d results with %d workers", len(jobs), *concurrency)
+
+	// Clients are shared between workers, one per judge model
+	var clientsMu sync.Mutex
+	clients := make(map[string]LLMClient)
+	judgeFor := func(metadata Metadata) (LLMClient, error) {
+		judgeModel := *model
+		if judgeModel == "" {
+			judgeModel = metadata.Model
+		}
+		clientsMu.Lock()
+		defer clientsMu.Unlock()
+		if client, ok := clients[judgeModel]; ok {
+			return client, nil
+		}
+		client, err := NewLLMClient(judgeModel, *baseURL, LLMOptions{Seed: metadata.Seed})
+		if err != nil {
+			return nil, err
+		}
+		clients[judgeModel] = client
+		return client, nil
+	}
+
+	// Each request waits for a tick, spacing request starts evenly
+	var limiter <-chan time.Time
+	if *rpm > 0 {
+		ticker := time.NewTicker(time.Minute / time.Duration(*rpm))
+		defer ticker.Stop()
+		limiter = ticker.C
+	}
+
+	queue := make(chan evalJob)
+	var failedMu sync.Mutex
+	failed := 0
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if err := evaluateJob(job, evalPrompt, judgeFor, limiter); err != nil {
+					log.Printf("Evaluation of %s failed: %v", job.resultFile, err)
+					failedMu.Lock()
+					failed++
+					failedMu.Unlock()
+				} else {
+					log.Printf("Evaluated %s", job.resultFile)
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d evaluations failed", failed, len(jobs))
+	}
+	return nil
+}
+
+// evaluateJob judges one result and records the outcome in its metadata
+func evaluateJob(job evalJob, evalPrompt string, judgeFor func(Metadata) (LLMClient, error), limiter <-chan time.Time) error {
+	result, err := os.ReadFile(job.resultFile)
+	if err != nil {
+		return err
+	}
+	judge, err := judgeFor(job.metadata)
+	if err != nil {
+		return err
+	}
+	if limiter != nil {
+		<-limiter
+	}
+
+	metadata := job.metadata
+	metadata.EvalOutput, metadata.EvalError = evaluateResult(judge, evalPrompt, string(result))
+	if err := writeMetadata(job.metadataFile, metadata); err != nil {
+		return err
+	}
+	if metadata.EvalError != "" {
+		return fmt.Errorf("%s", metadata.EvalError)
+	}
+	return nil
+}
+
+// findEvalJobs pairs each metadata file in outputDir with its result and
+// keeps those without an evaluation (or all of them when force is set).
+// A previous failed evaluation counts as missing.
+func findEvalJobs(outputDir string, force bool) ([]evalJob, error) {
+	metadataFiles, err := filepath.Glob(filepath.Join(outputDir, "*.metadata.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var jobs []evalJob
+	for _, metadataFile := range metadataFiles {
+		data, err := os.ReadFile(metadataFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", metadataFile, err)
+		}
+		var metadata Metadata
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			log.Printf("Skipping %s: %v", metadataFile, err)
+			continue
+		}
+		if metadata.EvalOutput != "" && !force {
+			continue
+		}
+		resultFile := resultForMetadata(metadataFile)
+		if resultFile == "" {
+			log.Printf("Skipping %s: no matching result file", metadataFile)
+			continue
+		}
+		jobs = append(jobs, evalJob{resultFile: resultFile, metadataFile: metadataFile, metadata: metadata})
+	}
+	return jobs, nil
+}
+
+// Markers in the names of the extra copies saved next to a result
+var sidecarMarkers = []string{".before-style", ".before-review", ".attempt-"}
+
+// isSidecarFile reports whether path is an extra copy rather than a result
+func isSidecarFile(path string) bool {
+	for _, marker := range sidecarMarkers {
+		if strings.Contains(filepath.Base(path), marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// resultForMetadata finds the result file that metadataFile describes: the
+// file with the same base name whose own metadata path is metadataFile,
+// ignoring pre-style and pre-review copies and superseded attempts
+func resultForMetadata(metadataFile string) string {
+	base := strings.TrimSuffix(metadataFile, ".metadata.json")
+	candidates, _ := filepath.Glob(base + ".*")
+	candidates = append(candidates, base)
+	for _, candidate := range candidates {
+		if candidate == metadataFile || isSidecarFile(candidate) {
+			continue
+		}
+		if info, err := os.Stat(candidate); err != nil || info.IsDir() {
+			continue
+		}
+		if metadataPath(candidate) == metadataFile {
+			return candidate
+		}
+	}
+	return ""
+}
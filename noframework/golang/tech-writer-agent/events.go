@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// EventSink receives progress events from the agent loop. The CLI logger, the
+// trace recorder and tests all subscribe through this interface.
+type EventSink interface {
+	OnIteration(event IterationEvent)
+	OnLLMCall(event LLMCallEvent)
+	OnToolCall(event ToolCallEvent)
+	OnFinal(event FinalEvent)
+}
+
+// IterationEvent is emitted at the start of each agent iteration
+type IterationEvent struct {
+	Iteration     int
+	MaxIterations int
+}
+
+// LLMCallEvent is emitted after each LLM call. Err is errTimeout when the call
+// was abandoned at the time limit.
+type LLMCallEvent struct {
+	Iteration int
+	Response  string
+	Err       error
+	Duration  time.Duration
+}
+
+// ToolCallEvent is emitted after each tool call
+type ToolCallEvent struct {
+	Iteration   int
+	Tool        string
+	Args        map[string]interface{}
+	Observation string
+	Err         error
+	Cached      bool // a repeated call answered with a reminder instead of running the tool
+	Duration    time.Duration
+}
+
+// FinalEvent is emitted when the agent produces its final answer
+type FinalEvent struct {
+	Iteration int
+	Answer    string
+	Truncated bool
+}
+
+// NopSink ignores all events. Embed it to implement only some of EventSink.
+type NopSink struct{}
+
+func (NopSink) OnIteration(IterationEvent) {}
+func (NopSink) OnLLMCall(LLMCallEvent)     {}
+func (NopSink) OnToolCall(ToolCallEvent)   {}
+func (NopSink) OnFinal(FinalEvent)         {}
+
+// MultiSink forwards every event to each of its sinks in order
+type MultiSink []EventSink
+
+func (m MultiSink) OnIteration(event IterationEvent) {
+	for _, sink := range m {
+		sink.OnIteration(event)
+	}
+}
+
+func (m MultiSink) OnLLMCall(event LLMCallEvent) {
+	for _, sink := range m {
+		sink.OnLLMCall(event)
+	}
+}
+
+func (m MultiSink) OnToolCall(event ToolCallEvent) {
+	for _, sink := range m {
+		sink.OnToolCall(event)
+	}
+}
+
+func (m MultiSink) OnFinal(event FinalEvent) {
+	for _, sink := range m {
+		sink.OnFinal(event)
+	}
+}
+
+// LogSink writes progress to the standard logger. Verbose adds iteration
+// markers, raw LLM responses and full observations.
+type LogSink struct {
+	Verbose bool
+}
+
+func (s LogSink) OnIteration(event IterationEvent) {
+	if s.Verbose {
+		log.Printf("Iteration %d/%d", event.Iteration, event.MaxIterations)
+	}
+}
+
+func (s LogSink) OnLLMCall(event LLMCallEvent) {
+	switch {
+	case errors.Is(event.Err, errTimeout):
+		log.Printf("LLM call in iteration %d timed out", event.Iteration)
+	case event.Err != nil:
+		log.Printf("LLM call in iteration %d failed: %v", event.Iteration, event.Err)
+	case s.Verbose:
+		log.Printf("LLM Response:\n%s", event.Response)
+	}
+}
+
+func (s LogSink) OnToolCall(event ToolCallEvent) {
+	args, _ := json.Marshal(event.Args)
+	if event.Cached {
+		log.Printf("Tool call repeated: %s(%s); pointing the model at the earlier result", event.Tool, args)
+		return
+	}
+	log.Printf("Tool invoked: %s(%s) [%s]", event.Tool, args, event.Duration.Round(time.Millisecond))
+	if event.Err != nil {
+		log.Printf("Tool %s failed: %v", event.Tool, event.Err)
+	}
+	if s.Verbose {
+		log.Printf("Observation: %s", event.Observation)
+	}
+}
+
+func (s LogSink) OnFinal(event FinalEvent) {
+	if event.Truncated {
+		log.Printf("Best-effort final answer produced after %d iterations", event.Iteration)
+	} else {
+		log.Printf("Final answer produced after %d iterations", event.Iteration)
+	}
+}
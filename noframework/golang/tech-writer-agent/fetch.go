@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Limits of fetch_url
+const (
+	FETCH_MAX_BYTES = 2 * 1024 * 1024 // downloaded, before text extraction
+	FETCH_MAX_CHARS = 32 * 1024       // of extracted text in the observation
+	FETCH_TIMEOUT   = 30 * time.Second
+	FETCH_MAX_HOPS  = 5
+)
+
+// FetchResult represents the text of a fetched web page
+type FetchResult struct {
+	URL         string `json:"url"` // after redirects
+	ContentType string `json:"content_type"`
+	Title       string `json:"title,omitempty"`
+	Text        string `json:"text"`
+	Truncated   bool   `json:"truncated,omitempty"` // the page or its text exceeded the size limits
+}
+
+// parseDomains splits a comma-separated --fetch-domains value
+func parseDomains(value string) []string {
+	var domains []string
+	for _, domain := range strings.Split(value, ",") {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" {
+			domains = append(domains, domain)
+		}
+	}
+	return domains
+}
+
+// domainAllowed reports whether host is one of domains or a subdomain of one
+func domainAllowed(host string, domains []string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFetchURL returns why the agent may not fetch u, or "" if it may
+func checkFetchURL(u *url.URL, domains []string) string {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Sprintf("Only http and https URLs can be fetched, not %q", u.Scheme)
+	}
+	if !domainAllowed(u.Hostname(), domains) {
+		return fmt.Sprintf("Domain %s is not allowed; allowed domains: %s", u.Hostname(), strings.Join(domains, ", "))
+	}
+	return ""
+}
+
+// newFetchURLTool creates the fetch_url tool, which is registered only when
+// --fetch-domains allows some domains. Redirects must stay on those domains.
+func newFetchURLTool(domains []string) Tool {
+	client := &http.Client{
+		Timeout: FETCH_TIMEOUT,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= FETCH_MAX_HOPS {
+				return fmt.Errorf("too many redirects")
+			}
+			if reason := checkFetchURL(req.URL, domains); reason != "" {
+				return fmt.Errorf("redirected to %s: %s", req.URL, reason)
+			}
+			return nil
+		},
+	}
+	return Tool{
+		Name:        "fetch_url",
+		Description: fmt.Sprintf("Fetch a web page, e.g. documentation or an RFC linked from the code, and return its text with the HTML markup removed. Only these domains (and their subdomains) are allowed: %s", strings.Join(domains, ", ")),
+		Arguments: []ToolArgument{
+			{Name: "url", Type: "string", Required: true, Description: "The http or https URL to fetch"},
+		},
+		Function: func(args map[string]interface{}) (interface{}, error) {
+			rawURL, ok := args["url"].(string)
+			if !ok || rawURL == "" {
+				return nil, fmt.Errorf("url parameter is required")
+			}
+			return fetchURL(client, rawURL, domains), nil
+		},
+	}
+}
+
+// fetchURL downloads a page and extracts its text. Problems are reported as
+// {"error": ...} results like the file tools do.
+func fetchURL(client *http.Client, rawURL string, domains []string) interface{} {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Invalid URL: %s", err)}
+	}
+	if reason := checkFetchURL(u, domains); reason != "" {
+		return map[string]string{"error": reason}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Invalid URL: %s", err)}
+	}
+	req.Header.Set("User-Agent", "tech-writer-agent/"+Version)
+	req.Header.Set("Accept", "text/html, text/plain, text/markdown, application/json, */*;q=0.1")
+	resp, err := client.Do(req)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error fetching %s: %s", rawURL, err)}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return map[string]string{"error": fmt.Sprintf("Error fetching %s: %s", rawURL, resp.Status)}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !isTextMediaType(mediaType) {
+		return map[string]string{"error": fmt.Sprintf("%s is %s, not a text document", rawURL, mediaType)}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, FETCH_MAX_BYTES+1))
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading %s: %s", rawURL, err)}
+	}
+
+	result := FetchResult{URL: resp.Request.URL.String(), ContentType: mediaType}
+	if len(body) > FETCH_MAX_BYTES {
+		body = body[:FETCH_MAX_BYTES]
+		result.Truncated = true
+	}
+	text := strings.ToValidUTF8(string(body), "")
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		result.Title, text = htmlText(text)
+	}
+	if len([]rune(text)) > FETCH_MAX_CHARS {
+		result.Truncated = true
+	}
+	result.Text = truncateRunes(text, FETCH_MAX_CHARS)
+	return result
+}
+
+// isTextMediaType reports whether fetch_url can return a document of the
+// given media type as text
+func isTextMediaType(mediaType string) bool {
+	if mediaType == "" || strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/xml", "application/xhtml+xml", "application/x-yaml", "application/yaml":
+		return true
+	}
+	return strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml")
+}
+
+var (
+	htmlTitle     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlHidden    = regexp.MustCompile(`(?is)<(script|style|noscript|svg|template|head)\b.*?</(script|style|noscript|svg|template|head)>|<!--.*?-->`)
+	htmlBlock     = regexp.MustCompile(`(?i)</?(p|div|br|hr|h[1-6]|li|ul|ol|tr|table|pre|section|article|header|footer|blockquote|dt|dd)\b[^>]*>`)
+	htmlTag       = regexp.MustCompile(`<[^>]*>`)
+	blankRuns     = regexp.MustCompile(`[ \t\r\f\v]+`)
+	emptyLineRuns = regexp.MustCompile(`\n\s*\n\s*(\n\s*)*`)
+)
+
+// htmlText returns the title and readable text of an HTML page: scripts,
+// styles and markup are removed, block elements become line breaks and
+// entities are decoded
+func htmlText(page string) (string, string) {
+	var title string
+	if match := htmlTitle.FindStringSubmatch(page); match != nil {
+		title = strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(match[1], "")))
+	}
+	text := htmlHidden.ReplaceAllString(page, "")
+	text = htmlBlock.ReplaceAllString(text, "\n")
+	text = htmlTag.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankRuns.ReplaceAllString(text, " ")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = emptyLineRuns.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return title, strings.TrimSpace(text)
+}
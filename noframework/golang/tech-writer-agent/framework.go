@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// The framework of this package's own agents
+const BUILTIN_FRAMEWORK = "noframework"
+
+// Framework is an agent implementation the CLI can run: this package's own
+// agents, or an adapter around another Go agent framework or engine. The
+// CLI does everything around the run (cloning, prompt, post-processing,
+// saving, metadata and evaluation) the same way whichever framework is
+// selected with --framework, so their results can be compared directly.
+type Framework interface {
+	// Run analyses repo as prompt asks. The result's Agent must be set when
+	// Run succeeds, and should be when it fails, to report how far it got.
+	Run(prompt string, repo FrameworkRepo) (FrameworkResult, error)
+}
+
+// FrameworkRepo is what a Framework is given besides the prompt
+type FrameworkRepo struct {
+	Directory     string // local checkout to analyse
+	RepoURL       string // where it was cloned from, if anywhere
+	LLM           LLMClient
+	SystemPrompt  string
+	MaxIterations int
+	Verbose       bool
+	// Options carry the time limits, Ctrl-C and the event sinks. The trace,
+	// --progress and the run metrics are built from the events, so an
+	// adapter should report its LLM and tool calls through Options.Events.
+	Options AgentOptions
+	Args    *Args
+}
+
+// FrameworkResult is the outcome of a Framework run
+type FrameworkResult struct {
+	Output string
+	// Agent reports iterations, truncation, and the files and tool results
+	// the run saw, for the metadata, --provenance and follow-up chat
+	Agent Agent
+}
+
+// frameworks are the registered frameworks by name
+var frameworks = map[string]Framework{
+	BUILTIN_FRAMEWORK: builtinFramework{},
+}
+
+// RegisterFramework makes an adapter selectable with --framework
+func RegisterFramework(name string, framework Framework) {
+	frameworks[name] = framework
+}
+
+// frameworkNames lists the registered frameworks, sorted
+func frameworkNames() string {
+	names := make([]string, 0, len(frameworks))
+	for name := range frameworks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// builtinFramework runs the agent strategy chosen with --agent-type
+type builtinFramework struct{}
+
+func (builtinFramework) Run(prompt string, repo FrameworkRepo) (FrameworkResult, error) {
+	args, verbose := repo.Args, repo.Verbose
+	var agent Agent
+	switch args.AgentType {
+	case "react":
+		agent = NewReActAgent(repo.LLM, repo.SystemPrompt, repo.MaxIterations, verbose, repo.Options)
+	case "plan-execute":
+		agent = NewPlanExecuteAgent(repo.LLM, repo.SystemPrompt, repo.MaxIterations, verbose, repo.Options)
+	case "hierarchical":
+		// Module budgets are scaled within these bounds, or all fixed by --max-iterations
+		minIters, maxIters := args.MinIterations, args.MaxIterCeiling
+		if args.MaxIterations > 0 {
+			minIters, maxIters = args.MaxIterations, args.MaxIterations
+		}
+		agent = NewHierarchicalAgent(repo.LLM, repo.SystemPrompt, repo.Directory, minIters, maxIters, verbose, repo.Options)
+	default:
+		return FrameworkResult{}, fmt.Errorf("unknown agent type %q (expected react, plan-execute or hierarchical)", args.AgentType)
+	}
+	output, err := agent.Run(prompt)
+	return FrameworkResult{Output: output, Agent: agent}, err
+}
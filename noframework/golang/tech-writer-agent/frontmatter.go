@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// frontMatterPattern matches YAML front matter at the start of a document
+var frontMatterPattern = regexp.MustCompile(`\A---\r?\n(?s:.*?)\r?\n---[ \t]*(?:\r?\n|\z)`)
+
+// FrontMatterConfig is the front_matter block of the --config file, which
+// turns front matter on like --front-matter and adds to it
+type FrontMatterConfig struct {
+	Tags   []string               `json:"tags"`   // before the GitHub topics of the --repo
+	Fields map[string]interface{} `json:"fields"` // further keys, such as "layout", "draft" or "categories"
+}
+
+// frontMatter is the YAML front matter of a Markdown result, for Hugo and
+// Jekyll content directories
+type frontMatter struct {
+	Title  string                 `yaml:"title"`
+	Date   string                 `yaml:"date"`
+	Repo   string                 `yaml:"repo,omitempty"`
+	Model  string                 `yaml:"model"`
+	Tags   []string               `yaml:"tags,omitempty"`
+	Weight int                    `yaml:"weight,omitempty"` // the order of a split page
+	Fields map[string]interface{} `yaml:",inline"`
+}
+
+// frontMatterKeys are the keys frontMatter sets, which the configured fields
+// can't
+var frontMatterKeys = []string{"title", "date", "repo", "model", "tags", "weight"}
+
+// validate checks that the configured fields don't clash with the standard ones
+func (c *FrontMatterConfig) validate() error {
+	for _, key := range frontMatterKeys {
+		if _, ok := c.Fields[key]; ok {
+			return fmt.Errorf("front_matter field %q is set by the tool", key)
+		}
+	}
+	return nil
+}
+
+// newFrontMatter returns the front matter of a result made by model at
+// generatedAt, with config's tags and fields and topics as further tags
+func newFrontMatter(config *FrontMatterConfig, repoURL, model string, generatedAt time.Time, topics []string) frontMatter {
+	matter := frontMatter{Date: generatedAt.Format(time.RFC3339), Repo: repoURL, Model: model}
+	if config != nil {
+		matter.Fields = config.Fields
+		matter.Tags = append(matter.Tags, config.Tags...)
+	}
+	for _, topic := range topics {
+		if !containsString(matter.Tags, topic) {
+			matter.Tags = append(matter.Tags, topic)
+		}
+	}
+	return matter
+}
+
+// addFrontMatter starts document with matter, titled after the document's
+// first level-1 heading or else title
+func addFrontMatter(document, title string, matter frontMatter) (string, error) {
+	matter.Title = documentTitle(document, title)
+	header, err := encodeYAML(matter)
+	if err != nil {
+		return "", fmt.Errorf("error encoding front matter: %w", err)
+	}
+	return "---\n" + header + "---\n\n" + document, nil
+}
+
+// stripFrontMatter returns document without the front matter it starts with
+func stripFrontMatter(document string) string {
+	return strings.TrimLeft(frontMatterPattern.ReplaceAllString(document, ""), "\r\n")
+}
+
+// documentTitle returns the text of document's first level-1 heading outside
+// code blocks, or fallback if it has none
+func documentTitle(document, fallback string) string {
+	inFence := ""
+	for _, line := range strings.Split(document, "\n") {
+		if inFence != "" {
+			if closesFence(line, inFence) {
+				inFence = ""
+			}
+		} else if m := fencePattern.FindStringSubmatch(line); m != nil {
+			inFence = m[1]
+		} else if m := headingPattern.FindStringSubmatch(line); m != nil && m[1] == "#" {
+			return plainText((&htmlRenderer{}).inline(m[2]))
+		}
+	}
+	return fallback
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Limits of git_log and git_diff
+const (
+	GIT_LOG_DEFAULT_COUNT   = 20
+	GIT_LOG_MAX_COUNT       = 200
+	GIT_LOG_FILES_PER_ENTRY = 20
+	GIT_DIFF_MAX_BYTES      = 64 * 1024
+)
+
+// GitCommit is one commit reported by git_log
+type GitCommit struct {
+	Hash      string   `json:"hash"`
+	Author    string   `json:"author"`
+	Date      string   `json:"date"` // RFC 3339
+	Subject   string   `json:"subject"`
+	Files     []string `json:"files,omitempty"`      // relative to the repository root
+	MoreFiles int      `json:"more_files,omitempty"` // files touched beyond those listed
+}
+
+// GitLogResult represents recent commit history
+type GitLogResult struct {
+	Commits []GitCommit `json:"commits"`
+	Count   int         `json:"count"`
+	// Shallow clones (the agent clones with --depth 1) only have the latest
+	// commits, so the history may end early
+	Shallow bool `json:"shallow,omitempty"`
+}
+
+// runGit runs git in directory and returns its output. Errors include what
+// git printed.
+func runGit(directory string, args ...string) (string, error) {
+	output, err := exec.Command("git", append([]string{"-C", directory}, args...)...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(output), nil
+}
+
+// gitLog implements the git_log tool: recent commits with their author, date,
+// subject and the files they touched
+func gitLog(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	count := GIT_LOG_DEFAULT_COUNT
+	if val, ok := intArg(args, "count"); ok && val > 0 {
+		count = min(val, GIT_LOG_MAX_COUNT)
+	}
+	includeFiles := true
+	if val, ok := args["include_files"].(bool); ok {
+		includeFiles = val
+	}
+
+	// Each commit starts with a record separator; fields are unit-separated
+	gitArgs := []string{"log", "-n", fmt.Sprint(count), "--date=iso-strict", "--format=%x1e%h%x1f%an%x1f%ad%x1f%s"}
+	if includeFiles {
+		gitArgs = append(gitArgs, "--name-only")
+	}
+	if path, ok := args["path"].(string); ok && path != "" {
+		gitArgs = append(gitArgs, "--", path)
+	}
+	output, err := runGit(directory, gitArgs...)
+	if err != nil {
+		return map[string]string{"error": err.Error()}, nil
+	}
+
+	result := GitLogResult{Commits: []GitCommit{}}
+	for _, record := range strings.Split(output, "\x1e") {
+		lines := strings.Split(strings.TrimSpace(record), "\n")
+		fields := strings.Split(lines[0], "\x1f")
+		if len(fields) != 4 {
+			continue
+		}
+		commit := GitCommit{Hash: fields[0], Author: fields[1], Date: fields[2], Subject: fields[3]}
+		for _, file := range lines[1:] {
+			if file = strings.TrimSpace(file); file == "" {
+				continue
+			}
+			if len(commit.Files) < GIT_LOG_FILES_PER_ENTRY {
+				commit.Files = append(commit.Files, file)
+			} else {
+				commit.MoreFiles++
+			}
+		}
+		result.Commits = append(result.Commits, commit)
+	}
+	result.Count = len(result.Commits)
+	if shallow, err := runGit(directory, "rev-parse", "--is-shallow-repository"); err == nil {
+		result.Shallow = strings.TrimSpace(shallow) == "true"
+	}
+	return result, nil
+}
+
+// GitDiffFile is the change to one file between two refs
+type GitDiffFile struct {
+	Path    string `json:"path"` // "old => new" for renames
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+// GitDiffResult represents the changes between two refs
+type GitDiffResult struct {
+	From      string        `json:"from"`
+	To        string        `json:"to"`
+	Files     []GitDiffFile `json:"files"`
+	Added     int           `json:"added"`
+	Deleted   int           `json:"deleted"`
+	Diff      string        `json:"diff,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"` // the diff was cut at GIT_DIFF_MAX_BYTES
+}
+
+// gitDiff implements the git_diff tool: the files changed between two refs
+// with line counts, and unless stat_only the diff itself
+func gitDiff(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	from, ok := args["from"].(string)
+	if !ok || from == "" {
+		return nil, fmt.Errorf("from parameter is required")
+	}
+	to := "HEAD"
+	if val, ok := args["to"].(string); ok && val != "" {
+		to = val
+	}
+	statOnly, _ := args["stat_only"].(bool)
+	var paths []string
+	if path, ok := args["path"].(string); ok && path != "" {
+		paths = []string{"--", path}
+	}
+
+	for _, ref := range []string{from, to} {
+		if _, err := runGit(directory, "rev-parse", "--verify", "--quiet", ref+"^{commit}"); err != nil {
+			message := fmt.Sprintf("Unknown ref %q", ref)
+			if shallow, err := runGit(directory, "rev-parse", "--is-shallow-repository"); err == nil && strings.TrimSpace(shallow) == "true" {
+				message += "; the repository is a shallow clone, so older commits and tags may be missing"
+			}
+			return map[string]string{"error": message}, nil
+		}
+	}
+
+	numstat, err := runGit(directory, append([]string{"diff", "--numstat", "-M", from, to}, paths...)...)
+	if err != nil {
+		return map[string]string{"error": err.Error()}, nil
+	}
+	result := GitDiffResult{From: from, To: to, Files: []GitDiffFile{}}
+	for _, line := range strings.Split(strings.TrimSpace(numstat), "\n") {
+		fields := strings.SplitN(line, "\t", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		file := GitDiffFile{Path: fields[2]}
+		// Binary files have "-" for both counts
+		if fields[0] == "-" {
+			file.Binary = true
+		} else {
+			fmt.Sscan(fields[0], &file.Added)
+			fmt.Sscan(fields[1], &file.Deleted)
+		}
+		result.Added += file.Added
+		result.Deleted += file.Deleted
+		result.Files = append(result.Files, file)
+	}
+
+	if !statOnly {
+		diff, err := runGit(directory, append([]string{"diff", "-M", from, to}, paths...)...)
+		if err != nil {
+			return map[string]string{"error": err.Error()}, nil
+		}
+		if len(diff) > GIT_DIFF_MAX_BYTES {
+			diff = strings.ToValidUTF8(diff[:GIT_DIFF_MAX_BYTES], "")
+			result.Truncated = true
+		}
+		result.Diff = diff
+	}
+	return result, nil
+}
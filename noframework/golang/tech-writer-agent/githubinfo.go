@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// GITHUB_API_TIMEOUT bounds each GitHub API request
+const GITHUB_API_TIMEOUT = 15 * time.Second
+
+// githubAPIBaseURL is where the GitHub REST API is served
+var githubAPIBaseURL = "https://api.github.com"
+
+// GitHubInfo describes a --repo as the GitHub API reports it
+type GitHubInfo struct {
+	URL           string         `json:"url"`
+	Description   string         `json:"description,omitempty"`
+	Stars         int            `json:"stars"`
+	Topics        []string       `json:"topics,omitempty"`
+	DefaultBranch string         `json:"default_branch"`
+	LatestRelease *GitHubRelease `json:"latest_release,omitempty"`
+}
+
+// GitHubRelease is a repository's latest published release
+type GitHubRelease struct {
+	Tag         string `json:"tag"`
+	Name        string `json:"name,omitempty"`
+	URL         string `json:"url"`
+	PublishedAt string `json:"published_at"`
+}
+
+// githubToken returns the token for the GitHub API, from GITHUB_TOKEN or
+// else GH_TOKEN (as the gh CLI uses), or "" if there is none
+func githubToken() string {
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		return token
+	}
+	return os.Getenv("GH_TOKEN")
+}
+
+// fetchGitHubInfo asks the GitHub API about the repository owner/repo
+// and its latest release; a repository without releases has none
+func fetchGitHubInfo(repoName, token string) (*GitHubInfo, error) {
+	client := &http.Client{Timeout: GITHUB_API_TIMEOUT}
+	var repo struct {
+		HTMLURL       string   `json:"html_url"`
+		Description   string   `json:"description"`
+		Stars         int      `json:"stargazers_count"`
+		Topics        []string `json:"topics"`
+		DefaultBranch string   `json:"default_branch"`
+	}
+	if found, err := getGitHub(client, "/repos/"+repoName, token, &repo); err != nil {
+		return nil, err
+	} else if !found {
+		return nil, fmt.Errorf("GitHub repository %s not found", repoName)
+	}
+	info := &GitHubInfo{
+		URL:           repo.HTMLURL,
+		Description:   repo.Description,
+		Stars:         repo.Stars,
+		Topics:        repo.Topics,
+		DefaultBranch: repo.DefaultBranch,
+	}
+
+	var release struct {
+		TagName     string `json:"tag_name"`
+		Name        string `json:"name"`
+		HTMLURL     string `json:"html_url"`
+		PublishedAt string `json:"published_at"`
+	}
+	found, err := getGitHub(client, "/repos/"+repoName+"/releases/latest", token, &release)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		info.LatestRelease = &GitHubRelease{Tag: release.TagName, Name: release.Name, URL: release.HTMLURL, PublishedAt: release.PublishedAt}
+	}
+	return info, nil
+}
+
+// getGitHub decodes the GitHub API's response to a GET of apiPath into out,
+// reporting false for a 404
+func getGitHub(client *http.Client, apiPath, token string, out interface{}) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, githubAPIBaseURL+apiPath, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("error calling the GitHub API: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GitHub API %s: %s", apiPath, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("error decoding the GitHub API's response to %s: %w", apiPath, err)
+	}
+	return true, nil
+}
+
+// addRepoInfoHeader starts document with a quoted header describing the
+// repository, e.g.
+//
+//	> **[owner/repo](https://github.com/owner/repo)**: A fast widget server
+//	>
+//	> 1234 stars · topics: go, http · default branch: main · latest release: [v1.2.0](...) (2024-05-01)
+func addRepoInfoHeader(document, repoName string, info *GitHubInfo) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "> **[%s](%s)**", repoName, info.URL)
+	if info.Description != "" {
+		fmt.Fprintf(&b, ": %s", strings.TrimSpace(info.Description))
+	}
+	facts := []string{fmt.Sprintf("%d stars", info.Stars)}
+	if len(info.Topics) > 0 {
+		facts = append(facts, "topics: "+strings.Join(info.Topics, ", "))
+	}
+	if info.DefaultBranch != "" {
+		facts = append(facts, "default branch: "+info.DefaultBranch)
+	}
+	if release := info.LatestRelease; release != nil {
+		fact := fmt.Sprintf("latest release: [%s](%s)", release.Tag, release.URL)
+		if published, err := time.Parse(time.RFC3339, release.PublishedAt); err == nil {
+			fact += published.Format(" (2006-01-02)")
+		}
+		facts = append(facts, fact)
+	}
+	fmt.Fprintf(&b, "\n>\n> %s\n\n", strings.Join(facts, " · "))
+	b.WriteString(document)
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"strings"
+)
+
+// gitignorePattern is one pattern of an ignore file, parsed as git does
+// (see gitignore(5))
+type gitignorePattern struct {
+	Text     string // as written, for explanations
+	Line     int
+	Negate   bool // "!pattern" re-includes what earlier patterns excluded
+	dirOnly  bool // "pattern/" matches only directories
+	anchored bool // a pattern with a slash matches the whole relative path, not only the name
+	segments []string
+}
+
+// parseGitignore reads the patterns of an ignore file: blank lines and
+// comments are skipped, unescaped trailing spaces dropped, and "\#", "\!"
+// and "\ " stand for the characters themselves
+func parseGitignore(r io.Reader) []gitignorePattern {
+	var patterns []gitignorePattern
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		for strings.HasSuffix(text, " ") && !strings.HasSuffix(text, "\\ ") {
+			text = text[:len(text)-1]
+		}
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if pattern, ok := parseGitignorePattern(text, line); ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// parseGitignorePattern parses one pattern, reporting false for one that
+// can match nothing
+func parseGitignorePattern(text string, line int) (gitignorePattern, bool) {
+	pattern := gitignorePattern{Text: text, Line: line}
+	body := text
+	if strings.HasPrefix(body, "!") {
+		pattern.Negate = true
+		body = body[1:]
+	} else if strings.HasPrefix(body, `\!`) || strings.HasPrefix(body, `\#`) {
+		body = body[1:]
+	}
+	if strings.HasSuffix(body, "/") {
+		pattern.dirOnly = true
+		body = strings.TrimRight(body, "/")
+	}
+	if body == "" {
+		return pattern, false
+	}
+	pattern.anchored = strings.Contains(body, "/")
+	body = strings.TrimPrefix(body, "/")
+	for _, segment := range strings.Split(body, "/") {
+		if segment != "**" {
+			segment = gitignoreClasses(segment)
+		}
+		pattern.segments = append(pattern.segments, segment)
+	}
+	return pattern, true
+}
+
+// gitignoreClasses rewrites git's negated character classes, "[!a-z]", in
+// the "[^a-z]" form path.Match takes
+func gitignoreClasses(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		b.WriteByte(segment[i])
+		switch {
+		case segment[i] == '\\' && i+1 < len(segment):
+			i++
+			b.WriteByte(segment[i])
+		case segment[i] == '[' && i+1 < len(segment) && segment[i+1] == '!':
+			b.WriteByte('^')
+			i++
+		}
+	}
+	return b.String()
+}
+
+// match reports whether the pattern matches the slash-separated path
+// relPath, relative to the ignore file's base. Wildcards don't match a
+// slash; "**" matches any number of directories, and a trailing "/**"
+// everything inside a directory but not the directory itself.
+func (p *gitignorePattern) match(relPath string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		matched, _ := path.Match(p.segments[0], path.Base(relPath))
+		return matched
+	}
+	parts := strings.Split(relPath, "/")
+	if last := len(p.segments) - 1; p.segments[last] == "**" {
+		if len(parts) < 2 {
+			return false
+		}
+		return matchSegments(p.segments, parts[:len(parts)-1])
+	}
+	return matchSegments(p.segments, parts)
+}
+
+// matchGitignore returns the last of patterns matching relPath, which
+// decides whether it is ignored, or nil if none does
+func matchGitignore(patterns []gitignorePattern, relPath string, isDir bool) *gitignorePattern {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].match(relPath, isDir) {
+			return &patterns[i]
+		}
+	}
+	return nil
+}
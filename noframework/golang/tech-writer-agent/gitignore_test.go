@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchGitignore(t *testing.T) {
+	tests := []struct {
+		patterns string
+		path     string
+		isDir    bool
+		ignored  bool
+	}{
+		{"*.log\n!important.log\n", "debug.log", false, true},
+		{"*.log\n!important.log\n", "important.log", false, false},
+		{"*.log\n!important.log\n", "logs/important.log", false, false},
+		{"*.log\n!/important.log\n", "logs/important.log", false, true},
+		{"!keep.txt\n*.txt\n", "keep.txt", false, true}, // the last match wins
+		{"/*\n!/src/\n", "src/main.go", false, false},
+		{"/*\n!/src/\n", "lib/util.go", false, true},
+		{"/*\n!/src/\n", "README.md", false, true},
+		{"build/*\n!build/keep/\n", "build/keep/a.txt", false, false},
+		{"build/*\n!build/keep/\n", "build/out.js", false, true},
+		{"build/\n!build/keep.js\n", "build/keep.js", false, true}, // its directory is excluded
+		{"docs/**\n!docs/**/*.md\n", "docs/guide.md", false, false},
+		{"docs/**\n!docs/**/*.md\n", "docs/api/index.md", false, true}, // docs/api is excluded
+		{"docs/**\n", "docs", true, false},
+		{"**/fixtures\n", "a/b/fixtures/x.json", false, true},
+		{"foo/**/bar\n", "foo/bar", false, true},
+		{"foo/**/bar\n", "foo/a/b/bar", false, true},
+		{"src/*.go\n", "src/pkg/main.go", false, false}, // * doesn't match a slash
+		{"tmp/\n", "tmp", false, false},
+		{"tmp/\n", "tmp/x", false, true},
+		{"\\!important\n", "!important", false, true},
+		{"\\#notes\n", "#notes", false, true},
+		{"# comment\n", "# comment", false, false},
+		{"trailing.txt   \n", "trailing.txt", false, true},
+		{"file[!0-9].txt\n", "filea.txt", false, true},
+		{"file[!0-9].txt\n", "file1.txt", false, false},
+	}
+	for _, tt := range tests {
+		rules := ignoreRules{{Kind: IgnoreGitignore, patterns: parseGitignore(strings.NewReader(tt.patterns))}}
+		match, _ := ignoreMatch(tt.path, tt.isDir, rules)
+		if (match != nil) != tt.ignored {
+			t.Errorf("patterns %q: ignored(%q) = %v, want %v", tt.patterns, tt.path, match != nil, tt.ignored)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// File patterns given to the file-walking tools are globs in one of two
+// forms. A pattern without a slash, such as "*.ts", matches the file's base
+// name at any depth. A pattern with a slash, such as "src/**/*.ts", matches
+// the path relative to the searched directory, where "**" stands for any
+// number of directories, including none.
+
+// validateGlob reports a malformed pattern, which would otherwise match
+// nothing without explanation
+func validateGlob(pattern string) error {
+	for _, segment := range strings.Split(normalizeGlob(pattern), "/") {
+		if segment == "**" {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether the slash-separated relative path relPath matches
+// pattern
+func matchGlob(pattern, relPath string) bool {
+	pattern = normalizeGlob(pattern)
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(relPath))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+// normalizeGlob drops the "./" or "/" prefix a pattern may be written with,
+// since patterns are always relative to the searched directory
+func normalizeGlob(pattern string) string {
+	pattern = strings.TrimPrefix(pattern, "./")
+	return strings.TrimPrefix(pattern, "/")
+}
+
+// matchSegments matches path segments against pattern segments, where a "**"
+// segment consumes any number of path segments
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 1 && pattern[1] == "**" {
+				pattern = pattern[1:]
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], parts[0]); !matched {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.ts", "index.ts", true},
+		{"*.ts", "src/deep/index.ts", true},
+		{"*.ts", "src/index.tsx", false},
+		{"src/*.ts", "src/index.ts", true},
+		{"src/*.ts", "src/lib/index.ts", false},
+		{"src/**/*.ts", "src/index.ts", true},
+		{"src/**/*.ts", "src/lib/deep/index.ts", true},
+		{"src/**/*.ts", "test/src/index.ts", false},
+		{"**/test/*.go", "test/a.go", true},
+		{"**/test/*.go", "pkg/x/test/a.go", true},
+		{"**/test/*.go", "pkg/x/test/y/a.go", false},
+		{"src/**", "src/a/b.c", true},
+		{"./src/*.ts", "src/index.ts", true},
+		{"/src/*.ts", "src/index.ts", true},
+		{"src/**/**/x", "src/x", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestListFilesGlob(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"index.ts":            "",
+		"src/app.ts":          "",
+		"src/lib/util.ts":     "",
+		"src/lib/util.js":     "",
+		"test/src/app.ts":     "",
+		"node_modules/x/y.ts": "",
+		".gitignore":          "node_modules/\n",
+	})
+	opts := DefaultWalkOptions()
+	opts.Pattern = "src/**/*.ts"
+	want := []string{"src/app.ts", "src/lib/util.ts"}
+	if got := listRelative(t, dir, opts); !slices.Equal(got, want) {
+		t.Errorf("listFiles(%q) = %v, want %v", opts.Pattern, got, want)
+	}
+
+	opts.Pattern = "src/[a-"
+	if _, err := listFiles(dir, opts); err == nil {
+		t.Errorf("listFiles(%q) succeeded, want an invalid pattern error", opts.Pattern)
+	}
+}
@@ -2,6 +2,7 @@ module github.com/awesome-agent-showcase/tech-writer-agent
 
 go 1.23.0
 
-require github.com/denormal/go-gitignore v0.0.0-20180930084346-ae8ad1d07817
-
-require github.com/danwakefield/fnmatch v0.0.0-20160403171240-cbb64ac3d964 // indirect
+require (
+	github.com/smacker/go-tree-sitter v0.0.0-20240827094217-dd81d9e9be82
+	gopkg.in/yaml.v3 v3.0.1
+)
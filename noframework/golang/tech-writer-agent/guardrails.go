@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Output guardrail modes (--guardrails)
+const (
+	GuardrailsOff      = "off"
+	GuardrailsRedact   = "redact"   // secrets and private absolute paths
+	GuardrailsRelative = "relative" // also repository paths made repo-relative
+)
+
+// Replacement for redacted secrets
+const REDACTED = "[REDACTED]"
+
+// secretPatterns recognise credentials that must never be published, by kind
+var secretPatterns = []struct {
+	kind    string
+	pattern *regexp.Regexp
+}{
+	{"private_key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`)},
+	{"openai_key", regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`)},
+	{"google_api_key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"github_token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+	{"aws_access_key", regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"slack_token", regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{"jwt", regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`)},
+}
+
+// homePathPattern matches the home directory part of an absolute path on
+// macOS, Linux and Windows, which names the local user
+var homePathPattern = regexp.MustCompile(`(?:/Users|/home)/[A-Za-z0-9._-]+|[A-Za-z]:\\Users\\[A-Za-z0-9._ -]+`)
+
+// applyGuardrails removes from document what must not leave the machine:
+// credentials (including the provider keys in the environment), and absolute
+// paths that reveal the local layout. Paths into the analysed directory keep
+// the repository name (e.g. repo/src/main.go), or in relative mode become
+// repo-relative (src/main.go); other home directory paths start with ~. The
+// counts of replacements by kind are added to redactions.
+func applyGuardrails(document, baseDir, mode string, redactions map[string]int) string {
+	if mode == GuardrailsOff {
+		return document
+	}
+
+	document = redactSecrets(document, redactions)
+
+	if absDir, err := filepath.Abs(baseDir); err == nil && absDir != string(filepath.Separator) {
+		replacement := filepath.Base(absDir) + string(filepath.Separator)
+		if mode == GuardrailsRelative {
+			replacement = ""
+		}
+		prefix := absDir + string(filepath.Separator)
+		if count := strings.Count(document, prefix); count > 0 {
+			redactions["path:repository"] += count
+			document = strings.ReplaceAll(document, prefix, replacement)
+		}
+		// The directory itself, e.g. "Base directory: /home/me/.cache/github/owner/repo"
+		if count := strings.Count(document, absDir); count > 0 {
+			redactions["path:repository"] += count
+			document = strings.ReplaceAll(document, absDir, filepath.Base(absDir))
+		}
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		prefix := home + string(filepath.Separator)
+		if count := strings.Count(document, prefix); count > 0 {
+			redactions["path:home"] += count
+			document = strings.ReplaceAll(document, prefix, "~"+string(filepath.Separator))
+		}
+	}
+	document = homePathPattern.ReplaceAllStringFunc(document, func(string) string {
+		redactions["path:home"]++
+		return "~"
+	})
+	return document
+}
+
+// redactSecrets replaces the credentials secretPatterns recognise, and the
+// provider keys in the environment, with REDACTED, counting them by kind in
+// redactions
+func redactSecrets(text string, redactions map[string]int) string {
+	for _, secret := range secretPatterns {
+		text = secret.pattern.ReplaceAllStringFunc(text, func(string) string {
+			redactions["secret:"+secret.kind]++
+			return REDACTED
+		})
+	}
+	return redactProviderKeys(text, redactions)
+}
+
+// redactProviderKeys replaces the provider keys in the environment with
+// REDACTED, counting them in redactions
+func redactProviderKeys(text string, redactions map[string]int) string {
+	for _, name := range []string{"OPENAI_API_KEY", "GEMINI_API_KEY"} {
+		if key := os.Getenv(name); len(key) >= 8 && strings.Contains(text, key) {
+			redactions["secret:env_"+strings.ToLower(name)] += strings.Count(text, key)
+			text = strings.ReplaceAll(text, key, REDACTED)
+		}
+	}
+	return text
+}
+
+// describeRedactions lists redaction counts for the log, e.g.
+// "2 path:home, 1 secret:openai_key"
+func describeRedactions(redactions map[string]int) string {
+	kinds := make([]string, 0, len(redactions))
+	for kind := range redactions {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = fmt.Sprintf("%d %s", redactions[kind], kind)
+	}
+	return strings.Join(parts, ", ")
+}
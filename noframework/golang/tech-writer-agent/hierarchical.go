@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// Maximum number of modules given their own sub-analysis; smaller modules
+	// beyond this are only listed in the synthesis prompt
+	HIERARCHY_MAX_MODULES = 40
+	// Name of the pseudo-module holding the files at the repository root
+	ROOT_MODULE_NAME = "(top level)"
+)
+
+// HierarchicalAgent analyses very large repositories by decomposition: each
+// top-level module gets a bounded ReAct sub-analysis with its own iteration
+// budget, and a final synthesis turn merges the module summaries into one
+// document.
+type HierarchicalAgent struct {
+	agentCore
+	directory string
+	minIters  int
+}
+
+// repoModule is a workspace package, a top-level directory (or the root
+// files) of the repository
+type repoModule struct {
+	name   string
+	dir    string
+	files  int
+	nested []string // directories inside dir that are modules of their own
+}
+
+// moduleSummary is the outcome of one module's sub-analysis
+type moduleSummary struct {
+	module  repoModule
+	summary string
+}
+
+// NewHierarchicalAgent creates a hierarchical agent for the repository at
+// directory. Each module's iteration budget is scaled from its file count like
+// the whole-repo cap, clamped to [minIters, maxIters].
+func NewHierarchicalAgent(llmClient LLMClient, systemPrompt, directory string, minIters, maxIters int, verbose bool, opts AgentOptions) *HierarchicalAgent {
+	return &HierarchicalAgent{
+		agentCore: newAgentCore(llmClient, systemPrompt, maxIters, verbose, opts),
+		directory: directory,
+		minIters:  minIters,
+	}
+}
+
+// Run analyses each module in turn, then synthesises the final document
+func (a *HierarchicalAgent) Run(userPrompt string) (string, error) {
+	a.startClock()
+
+	modules, err := repoModules(a.directory)
+	if err != nil {
+		return "", fmt.Errorf("error enumerating modules: %w", err)
+	}
+	if len(modules) == 0 {
+		return "", fmt.Errorf("no files to analyse in %s", a.directory)
+	}
+	var skipped []repoModule
+	if len(modules) > HIERARCHY_MAX_MODULES {
+		modules, skipped = modules[:HIERARCHY_MAX_MODULES], modules[HIERARCHY_MAX_MODULES:]
+		log.Printf("Analysing the %d largest of %d modules; the rest are only listed", HIERARCHY_MAX_MODULES, len(modules)+len(skipped))
+	}
+
+	var summaries []moduleSummary
+	for i, module := range modules {
+		if a.interruptRequested() || a.outOfTime() {
+			log.Printf("Stopping with %d modules left; writing a best-effort answer", len(modules)-i)
+			a.truncated = true
+			skipped = append(append([]repoModule(nil), modules[i:]...), skipped...)
+			break
+		}
+
+		budget := iterationsForFileCount(module.files, a.minIters, a.maxIters)
+		if module.name == ROOT_MODULE_NAME {
+			budget = a.minIters
+		}
+		log.Printf("Analysing module %d/%d: %s (%d files, up to %d iterations)", i+1, len(modules), module.name, module.files, budget)
+
+		summary, err := a.analyseModule(userPrompt, module, budget, len(modules)-i)
+		if err != nil {
+			log.Printf("Analysis of module %s failed: %v", module.name, err)
+			summary = fmt.Sprintf("(The analysis of this module failed: %v)", err)
+		}
+		summaries = append(summaries, moduleSummary{module: module, summary: summary})
+	}
+
+	return a.synthesize(userPrompt, summaries, skipped)
+}
+
+// analyseModule runs a bounded ReAct sub-analysis of one module. The time left
+// in the run is shared evenly between the modules not yet analysed.
+func (a *HierarchicalAgent) analyseModule(userPrompt string, module repoModule, budget, modulesLeft int) (string, error) {
+	opts := a.opts
+	if !a.runDeadline.IsZero() {
+		// Never zero, which would mean no limit
+		opts.MaxDuration = max(time.Until(a.runDeadline)/time.Duration(modulesLeft), time.Millisecond)
+	}
+	sub := NewReActAgent(a.llmClient, a.systemPrompt, budget, a.verbose, opts)
+
+	scope := "Analyse only the files in this directory and its subdirectories."
+	if module.name == ROOT_MODULE_NAME {
+		scope = "Analyse only the files directly in this directory (build files, configuration, READMEs); its subdirectories are analysed separately."
+	} else if len(module.nested) > 0 {
+		scope = fmt.Sprintf("Analyse only the files in this directory and its subdirectories, except %s, which are analysed separately.", strings.Join(module.nested, ", "))
+	}
+	prompt := fmt.Sprintf(`Base directory: %s
+
+This is the module %q of a larger repository rooted at %s. Another pass will merge your summary with those of the other modules into one document answering this request:
+
+%s
+
+%s Write a summary covering the module's purpose, main components and key files, its interfaces and dependencies on other modules, and anything else the request asks about. Cite file paths relative to the repository root.`,
+		module.dir, module.name, a.directory, userPrompt, scope)
+
+	summary, err := sub.Run(prompt)
+
+	// Fold the sub-analysis into this run's bookkeeping
+	for _, source := range sub.Sources() {
+		a.addSource(source)
+	}
+	a.observations = append(a.observations, sub.Observations()...)
+	a.iterations += sub.Iterations()
+	if sub.Truncated() {
+		a.truncated = true
+	}
+	if sub.Interrupted() {
+		a.interrupted = true
+	}
+	return summary, err
+}
+
+// synthesize merges the module summaries into the final answer
+func (a *HierarchicalAgent) synthesize(userPrompt string, summaries []moduleSummary, skipped []repoModule) (string, error) {
+	var b strings.Builder
+	for _, s := range summaries {
+		fmt.Fprintf(&b, "### Module: %s (%d files)\n\n%s\n\n", s.module.name, s.module.files, strings.TrimSpace(s.summary))
+	}
+	if len(skipped) > 0 {
+		names := make([]string, len(skipped))
+		for i, module := range skipped {
+			names[i] = fmt.Sprintf("%s (%d files)", module.name, module.files)
+		}
+		fmt.Fprintf(&b, "Modules not analysed: %s\n\n", strings.Join(names, ", "))
+	}
+
+	prompt := fmt.Sprintf(`You have analysed a large repository one module at a time. Merge the module summaries below into one well-structured document answering the user request. Describe the overall architecture and how the modules relate to each other rather than concatenating the summaries, and note any modules that were not analysed.
+
+User Request: %s
+
+Module summaries:
+
+%s
+Final Answer:`, userPrompt, b.String())
+
+	iteration := len(summaries) + 1
+	a.iterations++
+	response, err := a.complete(prompt, iteration, time.Time{})
+	if err != nil {
+		return "", fmt.Errorf("LLM error while merging module summaries: %w", err)
+	}
+
+	finalAnswer, ok := extractFinalAnswer(response)
+	if !ok {
+		finalAnswer = strings.TrimSpace(response)
+	}
+	a.opts.Events.OnFinal(FinalEvent{Iteration: iteration, Answer: finalAnswer, Truncated: a.truncated})
+	return finalAnswer, nil
+}
+
+// repoModules returns the modules of the repository: its workspace packages
+// if its manifests list any (see discoverPackages), with the files outside
+// them grouped by top-level directory, or else just the top-level
+// directories. Largest first.
+func repoModules(directory string) ([]repoModule, error) {
+	packages, err := discoverPackages(directory)
+	if err != nil {
+		log.Printf("Grouping modules by directory: %v", err)
+	}
+	if len(packages) == 0 {
+		return topLevelModules(directory)
+	}
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving directory path: %w", err)
+	}
+	files, err := listFiles(absDir, DefaultWalkOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	// Each file belongs to the innermost package holding it
+	sort.Slice(packages, func(i, j int) bool { return len(packages[i].Dir) > len(packages[j].Dir) })
+	counts := make(map[string]int)
+	names := make(map[string]string)
+	for _, pkg := range packages {
+		names[pkg.Dir] = pkg.Name
+		if pkg.Name != path.Base(pkg.Dir) {
+			names[pkg.Dir] = fmt.Sprintf("%s (%s)", pkg.Name, pkg.Dir)
+		}
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(absDir, file)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		module := ROOT_MODULE_NAME
+		if top, _, nested := strings.Cut(rel, "/"); nested {
+			module = top
+		}
+		for _, pkg := range packages {
+			if strings.HasPrefix(rel, pkg.Dir+"/") {
+				module = pkg.Dir
+				break
+			}
+		}
+		counts[module]++
+	}
+
+	modules := make([]repoModule, 0, len(counts))
+	for dir, count := range counts {
+		module := repoModule{name: dir, dir: filepath.Join(absDir, filepath.FromSlash(dir)), files: count}
+		if dir == ROOT_MODULE_NAME {
+			module.dir = absDir
+		} else if name, ok := names[dir]; ok {
+			module.name = name
+		}
+		if dir != ROOT_MODULE_NAME {
+			for _, pkg := range packages {
+				if strings.HasPrefix(pkg.Dir, dir+"/") {
+					module.nested = append(module.nested, pkg.Dir)
+				}
+			}
+			sort.Strings(module.nested)
+		}
+		modules = append(modules, module)
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].files != modules[j].files {
+			return modules[i].files > modules[j].files
+		}
+		return modules[i].name < modules[j].name
+	})
+	return modules, nil
+}
+
+// topLevelModules groups the repository's visible files by top-level
+// directory, largest first. Files at the root form the ROOT_MODULE_NAME module.
+func topLevelModules(directory string) ([]repoModule, error) {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving directory path: %w", err)
+	}
+	files, err := listFiles(absDir, DefaultWalkOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, path := range files {
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil {
+			continue
+		}
+		top := ROOT_MODULE_NAME
+		if parts := strings.SplitN(filepath.ToSlash(rel), "/", 2); len(parts) == 2 {
+			top = parts[0]
+		}
+		counts[top]++
+	}
+
+	modules := make([]repoModule, 0, len(counts))
+	for name, count := range counts {
+		dir := filepath.Join(absDir, name)
+		if name == ROOT_MODULE_NAME {
+			dir = absDir
+		}
+		modules = append(modules, repoModule{name: name, dir: dir, files: count})
+	}
+	sort.Slice(modules, func(i, j int) bool {
+		if modules[i].files != modules[j].files {
+			return modules[i].files > modules[j].files
+		}
+		return modules[i].name < modules[j].name
+	})
+	return modules, nil
+}
@@ -0,0 +1,768 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Formats of the saved result (--format)
+const (
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html" // a standalone page rendered from the Markdown
+)
+
+var (
+	fencePattern      = regexp.MustCompile("^ {0,3}(```+|~~~+)[ \t]*([^\\s`]*)")
+	headingPattern    = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	rulePattern       = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	listItemPattern   = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])(?:[ \t]+(.*))?$`)
+	tableDelimPattern = regexp.MustCompile(`^ *\|? *:?-+:? *(?:\| *:?-+:? *)*\|? *$`)
+	htmlBlockPattern  = regexp.MustCompile(`^ {0,3}<(!--|/?([A-Za-z][A-Za-z0-9-]*)(?:[ \t/>]|$))`)
+	unsafeHTMLPattern = regexp.MustCompile(`(?i)\son[a-z]+\s*=|javascript:|<\s*/?\s*(?:script|style|iframe|object|embed|form)`)
+	placeholder       = regexp.MustCompile("\x00(\\d+)\x00")
+	autolinkPattern   = regexp.MustCompile(`&lt;(https?://[^\s&]+)&gt;`)
+	linkPattern       = regexp.MustCompile(`(!?)\[([^\]]*)\]\(([^()\s]+)(?:\s+&#34;[^&]*&#34;)?\)`)
+	bareURLPattern    = regexp.MustCompile(`https?://[^\s<>\x00]*[^\s<>\x00.,;:!?)&]`)
+	tagPattern        = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlBlockTags are the tags that may start a raw HTML block; others, and
+// blocks that could run script, are escaped like text
+var htmlBlockTags = map[string]bool{
+	"details": true, "summary": true, "div": true, "p": true, "br": true, "hr": true, "img": true,
+	"picture": true, "source": true, "table": true, "thead": true, "tbody": true, "tr": true, "th": true,
+	"td": true, "a": true, "sup": true, "sub": true, "kbd": true, "span": true, "center": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "ul": true, "ol": true,
+	"li": true, "dl": true, "dt": true, "dd": true, "figure": true, "figcaption": true,
+}
+
+// startsHTMLBlock reports whether line starts a raw HTML block: a comment or
+// one of htmlBlockTags
+func startsHTMLBlock(line string) bool {
+	m := htmlBlockPattern.FindStringSubmatch(line)
+	return m != nil && (m[1] == "!--" || htmlBlockTags[strings.ToLower(m[2])])
+}
+
+// emphasisPatterns render Markdown emphasis in text that is already escaped
+var emphasisPatterns = []struct {
+	pattern *regexp.Regexp
+	replace string
+}{
+	{regexp.MustCompile(`\*\*([^*\s](?:.*?[^*\s])?)\*\*`), "<strong>$1</strong>"},
+	{regexp.MustCompile(`\b__([^_\s](?:.*?[^_\s])?)__\b`), "<strong>$1</strong>"},
+	{regexp.MustCompile(`~~([^~\s](?:.*?[^~\s])?)~~`), "<del>$1</del>"},
+	{regexp.MustCompile(`\*([^*\s](?:[^*]*?[^*\s])?)\*`), "<em>$1</em>"},
+	{regexp.MustCompile(`\b_([^_\s](?:[^_]*?[^_\s])?)_\b`), "<em>$1</em>"},
+}
+
+// documentHeading is a heading of a rendered document, for its table of
+// contents
+type documentHeading struct {
+	level int
+	id    string
+	text  string // without markup
+}
+
+// htmlRenderer turns the Markdown the agents write into HTML: the common
+// blocks (ATX headings, fenced code, lists, block quotes, rules and GitHub
+// tables) and inline spans. Raw HTML blocks, such as the attribution
+// comment, are kept as they are; raw HTML inside paragraphs is escaped.
+type htmlRenderer struct {
+	headings []documentHeading
+	ids      map[string]int
+	spans    []string // rendered inline spans, replaced by placeholders until the end
+}
+
+// renderHTML renders document as a standalone HTML page: a table of contents
+// of its level-2 and level-3 headings, an anchor on every heading and
+// highlighted code blocks, with the styles inline so it needs nothing else.
+// The page is titled after the document's first level-1 heading, or title.
+func renderHTML(document, title string) string {
+	r := &htmlRenderer{ids: make(map[string]int)}
+	lines := strings.Split(strings.ReplaceAll(strings.ReplaceAll(document, "\r\n", "\n"), "\x00", ""), "\n")
+	for i, line := range lines {
+		lines[i] = expandLeadingTabs(line)
+	}
+	body := r.blocks(lines)
+	for _, heading := range r.headings {
+		if heading.level == 1 {
+			title = heading.text
+			break
+		}
+	}
+	return fmt.Sprintf(htmlPage, html.EscapeString(title), r.tableOfContents(), body)
+}
+
+// markdownSourcePath returns where the Markdown a rendered result was made
+// from is saved: next to it, with the .md extension
+func markdownSourcePath(outputFile string) string {
+	source := strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + ".md"
+	if source == outputFile {
+		source = outputFile + ".md"
+	}
+	return source
+}
+
+// expandLeadingTabs replaces the tabs indenting line with four spaces each
+func expandLeadingTabs(line string) string {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	return strings.ReplaceAll(line[:indent], "\t", "    ") + line[indent:]
+}
+
+// leadingSpaces returns how far line is indented
+func leadingSpaces(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// startsBlock reports whether line begins a block other than a paragraph,
+// ending a paragraph before it
+func startsBlock(line string) bool {
+	if fencePattern.MatchString(line) || headingPattern.MatchString(line) || rulePattern.MatchString(line) || startsHTMLBlock(line) {
+		return true
+	}
+	if strings.HasPrefix(strings.TrimSpace(line), ">") {
+		return true
+	}
+	m := listItemPattern.FindStringSubmatch(line)
+	return m != nil && m[3] != "" && (strings.ContainsAny(m[2], "-*+") || strings.HasPrefix(m[2], "1"))
+}
+
+// blocks renders lines as a sequence of blocks
+func (r *htmlRenderer) blocks(lines []string) string {
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case fencePattern.MatchString(line):
+			i = r.codeBlock(&b, lines, i)
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			r.heading(&b, len(m[1]), m[2])
+			i++
+		case rulePattern.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				inner := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(inner, " "))
+			}
+			fmt.Fprintf(&b, "<blockquote>\n%s</blockquote>\n", r.blocks(quoted))
+		case listItemPattern.MatchString(line):
+			i = r.list(&b, lines, i)
+		case i+1 < len(lines) && strings.Contains(line, "|") && tableDelimPattern.MatchString(lines[i+1]) && strings.Contains(lines[i+1], "-"):
+			i = r.table(&b, lines, i)
+		case startsHTMLBlock(line) && !unsafeHTMLPattern.MatchString(strings.Join(lines[i:blockEnd(lines, i)], "\n")):
+			for end := blockEnd(lines, i); i < end; i++ {
+				b.WriteString(lines[i] + "\n")
+			}
+		default:
+			var paragraph []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != ""; i++ {
+				if len(paragraph) > 0 && startsBlock(lines[i]) {
+					break
+				}
+				paragraph = append(paragraph, lines[i])
+			}
+			fmt.Fprintf(&b, "<p>%s</p>\n", r.paragraph(paragraph))
+		}
+	}
+	return b.String()
+}
+
+// blockEnd returns the index of the blank line, or the end, after lines[start]
+func blockEnd(lines []string, start int) int {
+	end := start
+	for end < len(lines) && strings.TrimSpace(lines[end]) != "" {
+		end++
+	}
+	return end
+}
+
+// paragraph renders the lines of a paragraph, with a line break where a line
+// ends in two spaces or a backslash
+func (r *htmlRenderer) paragraph(lines []string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		text := strings.TrimLeft(line, " ")
+		hardBreak := i < len(lines)-1 && (strings.HasSuffix(text, "  ") || strings.HasSuffix(text, "\\"))
+		text = strings.TrimRight(text, " ")
+		if hardBreak {
+			text = strings.TrimSuffix(text, "\\")
+		}
+		rendered[i] = r.inline(text)
+		if hardBreak {
+			rendered[i] += "<br>"
+		}
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// heading renders a heading with an id unique in the document and an anchor
+// linking to it
+func (r *htmlRenderer) heading(b *strings.Builder, level int, text string) {
+	rendered := r.inline(text)
+	plain := plainText(rendered)
+	id := headingID(plain)
+	if n := r.ids[id]; n > 0 {
+		r.ids[id]++
+		id = fmt.Sprintf("%s-%d", id, n)
+	} else {
+		r.ids[id] = 1
+	}
+	r.headings = append(r.headings, documentHeading{level: level, id: id, text: plain})
+	fmt.Fprintf(b, "<h%d id=\"%s\"><a class=\"anchor\" href=\"#%s\" aria-hidden=\"true\">#</a>%s</h%d>\n", level, id, id, rendered, level)
+}
+
+// plainText returns rendered inline HTML as the text it shows
+func plainText(rendered string) string {
+	return html.UnescapeString(tagPattern.ReplaceAllString(rendered, ""))
+}
+
+// headingID derives a heading's id as GitHub does: lower case, letters,
+// digits, '-' and '_' kept and spaces made hyphens
+func headingID(text string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(text)) {
+		switch {
+		case unicode.IsLetter(c) || unicode.IsDigit(c) || c == '-' || c == '_':
+			b.WriteRune(c)
+		case c == ' ':
+			b.WriteRune('-')
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// codeBlock renders the fenced code block starting at lines[start] and
+// returns the index of the line after it
+func (r *htmlRenderer) codeBlock(b *strings.Builder, lines []string, start int) int {
+	m := fencePattern.FindStringSubmatch(lines[start])
+	fence, language := m[1], strings.ToLower(m[2])
+	var code []string
+	i := start + 1
+	for ; i < len(lines); i++ {
+		if closesFence(lines[i], fence) {
+			i++
+			break
+		}
+		code = append(code, lines[i])
+	}
+	class := ""
+	if language != "" {
+		class = fmt.Sprintf(" class=\"language-%s\"", html.EscapeString(language))
+	}
+	fmt.Fprintf(b, "<pre><code%s>%s</code></pre>\n", class, highlightCode(strings.Join(code, "\n"), language))
+	return i
+}
+
+// closesFence reports whether line closes a code block opened with fence: the
+// same characters, at least as many
+func closesFence(line, fence string) bool {
+	closing := strings.TrimSpace(line)
+	return strings.HasPrefix(closing, fence) && strings.Trim(closing, fence[:1]) == ""
+}
+
+// list renders the list starting at lines[start], with its nested blocks,
+// and returns the index of the line after it. A list with blank lines
+// between its items is loose, and its items' text goes in paragraphs.
+func (r *htmlRenderer) list(b *strings.Builder, lines []string, start int) int {
+	first := listItemPattern.FindStringSubmatch(lines[start])
+	indent := len(first[1])
+	ordered := !strings.ContainsAny(first[2], "-*+")
+	sameList := func(line string) []string {
+		m := listItemPattern.FindStringSubmatch(line)
+		if m == nil || len(m[1]) < indent || len(m[1]) > indent+1 || strings.ContainsAny(m[2], "-*+") == ordered {
+			return nil
+		}
+		return m
+	}
+
+	var items [][]string
+	contentIndent := 0
+	loose := false
+	i := start
+	for i < len(lines) {
+		line := lines[i]
+		if m := sameList(line); m != nil {
+			items = append(items, []string{m[3]})
+			contentIndent = len(m[1]) + len(m[2]) + 1
+			i++
+			continue
+		}
+		last := len(items) - 1
+		if strings.TrimSpace(line) == "" {
+			// A blank line continues the list if more of it follows
+			next := i + 1
+			for next < len(lines) && strings.TrimSpace(lines[next]) == "" {
+				next++
+			}
+			if next == len(lines) || (leadingSpaces(lines[next]) <= indent && sameList(lines[next]) == nil) {
+				break
+			}
+			if sameList(lines[next]) != nil {
+				loose = true
+			}
+			items[last] = append(items[last], "")
+			i++
+			continue
+		}
+		if leadingSpaces(line) > indent {
+			items[last] = append(items[last], line[min(leadingSpaces(line), contentIndent):])
+			i++
+			continue
+		}
+		// A paragraph's lazy continuation line
+		if previous := items[last][len(items[last])-1]; strings.TrimSpace(previous) != "" && !startsBlock(line) {
+			items[last] = append(items[last], strings.TrimSpace(line))
+			i++
+			continue
+		}
+		break
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+	}
+	b.WriteString("<" + tag)
+	if number, err := strconv.Atoi(strings.TrimRight(first[2], ".)")); ordered && err == nil && number != 1 {
+		fmt.Fprintf(b, " start=\"%d\"", number)
+	}
+	b.WriteString(">\n")
+	for _, item := range items {
+		body := r.blocks(item)
+		if !loose && strings.HasPrefix(body, "<p>") {
+			end := strings.Index(body, "</p>\n")
+			body = body[len("<p>"):end] + "\n" + body[end+len("</p>\n"):]
+		}
+		fmt.Fprintf(b, "<li>%s</li>\n", strings.TrimSuffix(body, "\n"))
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// table renders the GitHub table starting at lines[start], its header row,
+// and returns the index of the line after it
+func (r *htmlRenderer) table(b *strings.Builder, lines []string, start int) int {
+	header := splitTableRow(lines[start])
+	var aligns []string
+	for _, cell := range splitTableRow(lines[start+1]) {
+		cell = strings.TrimSpace(cell)
+		switch {
+		case strings.HasPrefix(cell, ":") && strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "center")
+		case strings.HasSuffix(cell, ":"):
+			aligns = append(aligns, "right")
+		case strings.HasPrefix(cell, ":"):
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+	row := func(cells []string, tag string) {
+		b.WriteString("<tr>")
+		for i := range header {
+			cell := ""
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			style := ""
+			if i < len(aligns) && aligns[i] != "" {
+				style = fmt.Sprintf(" style=\"text-align: %s\"", aligns[i])
+			}
+			fmt.Fprintf(b, "<%s%s>%s</%s>", tag, style, r.inline(strings.TrimSpace(cell)), tag)
+		}
+		b.WriteString("</tr>\n")
+	}
+
+	b.WriteString("<table>\n<thead>\n")
+	row(header, "th")
+	b.WriteString("</thead>\n<tbody>\n")
+	i := start + 2
+	for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && strings.Contains(lines[i], "|"); i++ {
+		row(splitTableRow(lines[i]), "td")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+// splitTableRow splits a table row into its cells, at the pipes outside
+// code spans that aren't escaped
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, "\\|") {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	inCode := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			inCode = !inCode
+			cell.WriteByte(c)
+		case c == '|' && !inCode:
+			cells = append(cells, cell.String())
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(cells, cell.String())
+}
+
+// inline renders the spans of a line of text: code, links, images,
+// autolinks and emphasis, escaping everything else
+func (r *htmlRenderer) inline(text string) string {
+	var b strings.Builder
+	for i := 0; i < len(text); {
+		switch c := text[i]; {
+		case c == '\\' && i+1 < len(text) && strings.IndexByte("\\`*_{}[]()#+-.!|~<>", text[i+1]) >= 0:
+			b.WriteString(r.span(html.EscapeString(text[i+1 : i+2])))
+			i += 2
+		case c == '`':
+			n := len(text[i:]) - len(strings.TrimLeft(text[i:], "`"))
+			fence := text[i : i+n]
+			end := strings.Index(text[i+n:], fence)
+			if end < 0 {
+				b.WriteString(fence)
+				i += n
+				continue
+			}
+			code := text[i+n : i+n+end]
+			if len(code) > 1 && strings.HasPrefix(code, " ") && strings.HasSuffix(code, " ") {
+				code = code[1 : len(code)-1]
+			}
+			b.WriteString(r.span("<code>" + html.EscapeString(code) + "</code>"))
+			i += n + end + n
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	out := html.EscapeString(b.String())
+	out = autolinkPattern.ReplaceAllStringFunc(out, func(match string) string {
+		url := autolinkPattern.FindStringSubmatch(match)[1]
+		return r.span(fmt.Sprintf("<a href=\"%s\">%s</a>", url, url))
+	})
+	out = linkPattern.ReplaceAllStringFunc(out, func(match string) string {
+		m := linkPattern.FindStringSubmatch(match)
+		href := safeHref(m[3])
+		if m[1] == "!" {
+			return r.span(fmt.Sprintf("<img src=\"%s\" alt=\"%s\">", href, m[2]))
+		}
+		return r.span(fmt.Sprintf("<a href=\"%s\">%s</a>", href, emphasize(m[2])))
+	})
+	out = bareURLPattern.ReplaceAllStringFunc(out, func(url string) string {
+		return r.span(fmt.Sprintf("<a href=\"%s\">%s</a>", url, url))
+	})
+	out = emphasize(out)
+	// Spans may hold other spans, such as a link's code
+	for strings.Contains(out, "\x00") {
+		out = placeholder.ReplaceAllStringFunc(out, func(match string) string {
+			n, _ := strconv.Atoi(strings.Trim(match, "\x00"))
+			return r.spans[n]
+		})
+	}
+	return out
+}
+
+// span keeps rendered HTML out of further inline processing, returning the
+// placeholder that stands for it
+func (r *htmlRenderer) span(rendered string) string {
+	r.spans = append(r.spans, rendered)
+	return fmt.Sprintf("\x00%d\x00", len(r.spans)-1)
+}
+
+// emphasize renders the emphasis in escaped text
+func emphasize(text string) string {
+	for _, emphasis := range emphasisPatterns {
+		text = emphasis.pattern.ReplaceAllString(text, emphasis.replace)
+	}
+	return text
+}
+
+// safeHref drops link targets that would run script
+func safeHref(href string) string {
+	lower := strings.ToLower(html.UnescapeString(href))
+	for _, scheme := range []string{"javascript:", "vbscript:", "data:"} {
+		if strings.HasPrefix(lower, scheme) {
+			return "#"
+		}
+	}
+	return href
+}
+
+// tableOfContents lists the level-2 and level-3 headings, nested, or is empty
+// for a document without them
+func (r *htmlRenderer) tableOfContents() string {
+	var b strings.Builder
+	depth := 0
+	for _, heading := range r.headings {
+		level := heading.level - 1
+		if level < 1 || level > 2 {
+			continue
+		}
+		if level > depth {
+			for ; depth < level; depth++ {
+				b.WriteString("<ul><li>")
+			}
+		} else {
+			b.WriteString("</li>")
+			for ; depth > level; depth-- {
+				b.WriteString("</ul></li>")
+			}
+			b.WriteString("<li>")
+		}
+		fmt.Fprintf(&b, "<a href=\"#%s\">%s</a>", heading.id, html.EscapeString(heading.text))
+	}
+	if depth == 0 {
+		return ""
+	}
+	b.WriteString("</li>")
+	for ; depth > 1; depth-- {
+		b.WriteString("</ul></li>")
+	}
+	b.WriteString("</ul>")
+	return "<nav class=\"toc\">\n<p class=\"toc-title\">Contents</p>\n" + b.String() + "\n</nav>"
+}
+
+// codeLanguage is how highlightCode tokenizes a language
+type codeLanguage struct {
+	lineComments []string
+	blockComment []string // opening and closing
+	quotes       string   // characters that start a string
+	tripleQuotes bool     // strings may be """...""" or '''...'''
+	keywords     map[string]bool
+}
+
+func newCodeLanguage(lineComments, blockComment []string, quotes string, keywords string) codeLanguage {
+	language := codeLanguage{lineComments: lineComments, blockComment: blockComment, quotes: quotes, keywords: make(map[string]bool)}
+	for _, keyword := range strings.Fields(keywords) {
+		language.keywords[keyword] = true
+	}
+	return language
+}
+
+// withTripleQuotes lets language's strings be triple-quoted, as Python's are
+func withTripleQuotes(language codeLanguage) codeLanguage {
+	language.tripleQuotes = true
+	return language
+}
+
+var (
+	cLike       = []string{"/*", "*/"}
+	slashes     = []string{"//"}
+	hashes      = []string{"#"}
+	jsKeywords  = "async await break case catch class const continue default delete do else export extends false finally for from function if import in instanceof let new null of return static super switch this throw true try typeof undefined var void while yield"
+	tsKeywords  = jsKeywords + " as enum implements interface keyof namespace private protected public readonly type"
+	cKeywords   = "auto break case char const continue default do double else enum extern float for goto if inline int long register return short signed sizeof static struct switch typedef union unsigned void volatile while NULL true false"
+	cppKeywords = cKeywords + " bool catch class constexpr delete explicit friend namespace new noexcept nullptr operator override private protected public template this throw try typename using virtual"
+	shKeywords  = "case do done elif else esac export fi for function if in local return then until while"
+)
+
+// codeLanguages maps the languages of code fences, and their usual aliases,
+// to how they are highlighted; other languages are shown plain
+var codeLanguages = map[string]codeLanguage{
+	"go":         newCodeLanguage(slashes, cLike, "\"'`", "break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota"),
+	"python":     withTripleQuotes(newCodeLanguage(hashes, nil, "\"'", "and as assert async await break class continue def del elif else except False finally for from global if import in is lambda None nonlocal not or pass raise return self True try while with yield")),
+	"javascript": newCodeLanguage(slashes, cLike, "\"'`", jsKeywords),
+	"typescript": newCodeLanguage(slashes, cLike, "\"'`", tsKeywords),
+	"java":       newCodeLanguage(slashes, cLike, "\"'", "abstract boolean break byte case catch char class continue default do double else enum extends final finally float for if implements import instanceof int interface long new null package private protected public return short static super switch synchronized this throw throws true false try void volatile while var record"),
+	"c":          newCodeLanguage(slashes, cLike, "\"'", cKeywords),
+	"cpp":        newCodeLanguage(slashes, cLike, "\"'", cppKeywords),
+	"csharp":     newCodeLanguage(slashes, cLike, "\"'", "abstract as async await base bool break case catch class const continue decimal default delegate do double else enum event false finally float for foreach if in int interface internal is long namespace new null object out override private protected public readonly record ref return sealed static string struct switch this throw true try typeof using var virtual void while"),
+	"rust":       newCodeLanguage(slashes, cLike, "\"", "as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while None Some Ok Err"),
+	"ruby":       newCodeLanguage(hashes, nil, "\"'", "alias and begin break case class def defined? do else elsif end ensure false for if in module next nil not or redo rescue retry return self super then true undef unless until when while yield"),
+	"shell":      newCodeLanguage(hashes, nil, "\"'", shKeywords),
+	"sql":        newCodeLanguage([]string{"--"}, cLike, "'\"", "select from where and or not insert into values update set delete create table index view drop alter add primary key foreign references join left right inner outer on group by order having limit offset as distinct null is in like between union all case when then else end SELECT FROM WHERE AND OR NOT INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE INDEX VIEW DROP ALTER ADD PRIMARY KEY FOREIGN REFERENCES JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AS DISTINCT NULL IS IN LIKE BETWEEN UNION ALL CASE WHEN THEN ELSE END"),
+	"yaml":       newCodeLanguage(hashes, nil, "\"'", "true false null yes no on off"),
+	"json":       newCodeLanguage(nil, nil, "\"", "true false null"),
+	"toml":       newCodeLanguage(hashes, nil, "\"'", "true false"),
+}
+
+// codeLanguageAliases are other names code fences use for codeLanguages
+var codeLanguageAliases = map[string]string{
+	"golang": "go", "py": "python", "js": "javascript", "jsx": "javascript", "mjs": "javascript",
+	"ts": "typescript", "tsx": "typescript", "h": "c", "c++": "cpp", "cc": "cpp", "hpp": "cpp",
+	"cs": "csharp", "c#": "csharp", "rs": "rust", "rb": "ruby", "sh": "shell", "bash": "shell",
+	"zsh": "shell", "console": "shell", "yml": "yaml", "jsonc": "json", "kotlin": "java", "kt": "java",
+}
+
+// highlightCode escapes code, wrapping its keywords, strings, comments and
+// numbers in spans the page's styles color
+func highlightCode(code, language string) string {
+	if alias, ok := codeLanguageAliases[language]; ok {
+		language = alias
+	}
+	spec, ok := codeLanguages[language]
+	if !ok {
+		return html.EscapeString(code)
+	}
+	var b strings.Builder
+	token := func(class, text string) {
+		fmt.Fprintf(&b, "<span class=\"tok-%s\">%s</span>", class, html.EscapeString(text))
+	}
+	isWord := func(c byte) bool {
+		return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+	}
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		if end := spec.commentEnd(rest); end > 0 {
+			token("c", rest[:end])
+			i += end
+			continue
+		}
+		if c := rest[0]; strings.IndexByte(spec.quotes, c) >= 0 {
+			end := stringEnd(rest, spec.tripleQuotes)
+			token("s", rest[:end])
+			i += end
+			continue
+		}
+		if c := rest[0]; c >= '0' && c <= '9' && (i == 0 || !isWord(code[i-1])) {
+			end := 1
+			for end < len(rest) && (isWord(rest[end]) || rest[end] == '.') {
+				end++
+			}
+			token("n", rest[:end])
+			i += end
+			continue
+		}
+		if isWord(rest[0]) {
+			end := 1
+			for end < len(rest) && (isWord(rest[end]) || rest[end] == '?' && language == "ruby") {
+				end++
+			}
+			if spec.keywords[rest[:end]] {
+				token("k", rest[:end])
+			} else {
+				b.WriteString(rest[:end])
+			}
+			i += end
+			continue
+		}
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return b.String()
+}
+
+// commentEnd returns the length of the comment code starts with, or 0
+func (l codeLanguage) commentEnd(code string) int {
+	for _, marker := range l.lineComments {
+		if strings.HasPrefix(code, marker) {
+			if end := strings.IndexByte(code, '\n'); end >= 0 {
+				return end
+			}
+			return len(code)
+		}
+	}
+	if len(l.blockComment) == 2 && strings.HasPrefix(code, l.blockComment[0]) {
+		if end := strings.Index(code[len(l.blockComment[0]):], l.blockComment[1]); end >= 0 {
+			return len(l.blockComment[0]) + end + len(l.blockComment[1])
+		}
+		return len(code)
+	}
+	return 0
+}
+
+// stringEnd returns the length of the string literal code starts with: up to
+// its unescaped closing quote, or the end of the line if it has none. Only
+// backquoted and triple-quoted strings span lines.
+func stringEnd(code string, tripleQuotes bool) int {
+	quote := code[:1]
+	if tripleQuotes && len(code) >= 3 && code[:3] == strings.Repeat(quote, 3) {
+		if end := strings.Index(code[3:], code[:3]); end >= 0 {
+			return 3 + end + 3
+		}
+		return len(code)
+	}
+	for i := 1; i < len(code); i++ {
+		switch code[i] {
+		case '\\':
+			if quote != "`" {
+				i++
+			}
+		case '\n':
+			if quote != "`" {
+				return i
+			}
+		case quote[0]:
+			return i + 1
+		}
+	}
+	return len(code)
+}
+
+// htmlPage is the standalone page: the title, the table of contents and the
+// rendered document
+const htmlPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+:root { --fg: #1f2328; --muted: #59636e; --bg: #ffffff; --subtle: #f6f8fa; --border: #d1d9e0; --link: #0969da;
+  --k: #cf222e; --s: #0a3069; --c: #6e7781; --n: #0550ae; }
+@media (prefers-color-scheme: dark) {
+  :root { --fg: #e6edf3; --muted: #9198a1; --bg: #0d1117; --subtle: #151b23; --border: #3d444d; --link: #4493f8;
+    --k: #ff7b72; --s: #a5d6ff; --c: #9198a1; --n: #79c0ff; }
+}
+body { margin: 0; color: var(--fg); background: var(--bg); font: 16px/1.6 -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; }
+.layout { display: flex; gap: 2rem; max-width: 75rem; margin: 0 auto; padding: 2rem 1rem; }
+.toc { flex: 0 0 16rem; position: sticky; top: 1rem; align-self: flex-start; max-height: calc(100vh - 2rem); overflow-y: auto; font-size: 0.875rem; }
+.toc-title { font-weight: 600; margin: 0 0 0.5rem; }
+.toc ul { list-style: none; margin: 0; padding-left: 0; }
+.toc ul ul { padding-left: 1rem; }
+.toc a { display: block; padding: 0.15rem 0; color: var(--muted); text-decoration: none; }
+.toc a:hover { color: var(--link); }
+main { flex: 1; min-width: 0; }
+a { color: var(--link); }
+h1, h2, h3, h4, h5, h6 { position: relative; line-height: 1.25; margin: 1.5em 0 0.75em; }
+h1, h2 { padding-bottom: 0.3em; border-bottom: 1px solid var(--border); }
+.anchor { position: absolute; left: -1.2em; padding-right: 0.4em; color: var(--muted); text-decoration: none; visibility: hidden; }
+h1:hover .anchor, h2:hover .anchor, h3:hover .anchor, h4:hover .anchor, h5:hover .anchor, h6:hover .anchor { visibility: visible; }
+code { font: 0.875em ui-monospace, SFMono-Regular, Menlo, Consolas, monospace; background: var(--subtle); padding: 0.15em 0.35em; border-radius: 4px; }
+pre { background: var(--subtle); border: 1px solid var(--border); border-radius: 6px; padding: 1rem; overflow-x: auto; line-height: 1.45; }
+pre code { padding: 0; background: none; }
+blockquote { margin: 0; padding: 0 1em; color: var(--muted); border-left: 0.25em solid var(--border); }
+table { border-collapse: collapse; display: block; overflow-x: auto; }
+th, td { border: 1px solid var(--border); padding: 0.4em 0.8em; }
+th { background: var(--subtle); }
+img { max-width: 100%%; }
+hr { border: 0; border-top: 1px solid var(--border); }
+.tok-k { color: var(--k); }
+.tok-s { color: var(--s); }
+.tok-c { color: var(--c); font-style: italic; }
+.tok-n { color: var(--n); }
+@media (max-width: 50rem) { .layout { display: block; } .toc { position: static; max-height: none; margin-bottom: 2rem; } }
+</style>
+</head>
+<body>
+<div class="layout">
+%s
+<main>
+%s</main>
+</div>
+</body>
+</html>
+`
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderHTML(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     []string
+		notWant  []string
+	}{
+		{
+			name:     "headings, anchors and contents",
+			markdown: "# Widget *Server*\n\n## Setup & Use\n\n### Build\n\n## Setup & Use\n",
+			want: []string{
+				"<title>Widget Server</title>",
+				`<h1 id="widget-server"><a class="anchor" href="#widget-server" aria-hidden="true">#</a>Widget <em>Server</em></h1>`,
+				`<h2 id="setup--use">`,
+				`<h2 id="setup--use-1">`,
+				`<ul><li><a href="#setup--use">Setup &amp; Use</a><ul><li><a href="#build">Build</a></li></ul></li><li><a href="#setup--use-1">Setup &amp; Use</a></li></ul>`,
+			},
+		},
+		{
+			name:     "inline spans",
+			markdown: "Use `a <b>` and **bold**, *em* or snake_case_name with [the docs](https://x.io/a_b_c) or <https://y.io>.\nNot [this](javascript:alert)  \nnext <i>line</i>",
+			want: []string{
+				"<code>a &lt;b&gt;</code>",
+				"<strong>bold</strong>, <em>em</em> or snake_case_name",
+				`<a href="https://x.io/a_b_c">the docs</a>`,
+				`<a href="https://y.io">https://y.io</a>.`,
+				`<a href="#">this</a><br>`,
+				"next &lt;i&gt;line&lt;/i&gt;",
+			},
+		},
+		{
+			name:     "highlighted code",
+			markdown: "```go\n// main\nfunc main() { s := \"a<b\"; n := 42 }\n```\n\n~~~\nplain <text>\n~~~\n",
+			want: []string{
+				`<pre><code class="language-go"><span class="tok-c">// main</span>`,
+				`<span class="tok-k">func</span> main() { s := <span class="tok-s">&#34;a&lt;b&#34;</span>; n := <span class="tok-n">42</span> }</code></pre>`,
+				"<pre><code>plain &lt;text&gt;</code></pre>",
+			},
+		},
+		{
+			name:     "lists",
+			markdown: "- one\n- two\n  - nested\n- three\n\n3. c\n4. d\n\n- loose\n\n- items\n",
+			want: []string{
+				"<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul></li>\n<li>three</li>\n</ul>",
+				"<ol start=\"3\">\n<li>c</li>\n<li>d</li>\n</ol>",
+				"<li><p>loose</p></li>",
+			},
+		},
+		{
+			name:     "tables, quotes and rules",
+			markdown: "| Name | Size |\n|:-----|-----:|\n| `a\\|b` | 2 |\n\n> quoted **text**\n\n---\n",
+			want: []string{
+				`<tr><th style="text-align: left">Name</th><th style="text-align: right">Size</th></tr>`,
+				`<tr><td style="text-align: left"><code>a|b</code></td><td style="text-align: right">2</td></tr>`,
+				"<blockquote>\n<p>quoted <strong>text</strong></p>\n</blockquote>",
+				"<hr>",
+			},
+		},
+		{
+			name:     "raw HTML",
+			markdown: "<!-- tech-writer-agent:attribution {} -->\n\n<details>\n<summary>More</summary>\n</details>\n\n<script>alert(1)</script>\n\n<img src=x onerror=alert(1)>\n",
+			want: []string{
+				"<!-- tech-writer-agent:attribution {} -->",
+				"<details>\n<summary>More</summary>\n</details>",
+				"<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+				"<p>&lt;img src=x onerror=alert(1)&gt;</p>",
+			},
+			notWant: []string{`<nav class="toc">`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderHTML(tt.markdown, "fallback")
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("renderHTML() lacks %q in:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("renderHTML() has %q in:\n%s", notWant, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Kinds of ignore file, in their order of precedence: the agent's own, then
+// git's
+const (
+	IgnoreTechWriter    = ".techwriterignore"
+	IgnoreGitignore     = ".gitignore"
+	IgnoreInfoExclude   = ".git/info/exclude"
+	IgnoreGlobalExclude = "core.excludesFile" // the user's global excludes file
+	IgnoreDefault       = "built-in default"  // build output and dependency directories
+)
+
+// defaultIgnorePatterns are skipped even without a .gitignore, since a fresh
+// clone that has been built or had its dependencies installed is full of
+// them. Any ignore file can re-include one, e.g. "!build/" in a
+// .techwriterignore, and --no-default-ignores drops them all.
+var defaultIgnorePatterns = parseGitignore(strings.NewReader(`
+# Dependencies
+node_modules/
+bower_components/
+jspm_packages/
+.venv/
+venv/
+.tox/
+.nox/
+# Build output, only at the repository root: go/build and the like are
+# source code
+/dist/
+/build/
+/target/
+.next/
+.nuxt/
+.svelte-kit/
+.gradle/
+.terraform/
+# Caches
+__pycache__/
+*.pyc
+.pytest_cache/
+.mypy_cache/
+.ruff_cache/
+coverage/
+.nyc_output/
+`))
+
+// defaultIgnores says whether the walks skip defaultIgnorePatterns
+var defaultIgnores = struct {
+	sync.RWMutex
+	disabled bool
+}{}
+
+// setDefaultIgnores turns the built-in default ignore set on or off
+func setDefaultIgnores(enabled bool) {
+	defaultIgnores.Lock()
+	defer defaultIgnores.Unlock()
+	defaultIgnores.disabled = !enabled
+}
+
+// ignoreFile is a file of gitignore patterns that applies to a walked
+// directory
+type ignoreFile struct {
+	Kind     string
+	Path     string
+	prefix   string // of the walked directory relative to the patterns' base, "" or ending in "/"
+	patterns []gitignorePattern
+}
+
+// ignoreRules are the ignore files of a walked directory in their order of
+// precedence: the repository's .techwriterignore and the user's, then git's
+// (the directory's .gitignore, the repository's .git/info/exclude and the
+// user's global excludes file), and last the built-in defaults. As in git,
+// the first file with a pattern matching a path decides about it, so a
+// .techwriterignore can re-include files git ignores.
+type ignoreRules []ignoreFile
+
+// match returns the pattern deciding about relPath (slash-separated,
+// relative to the walked directory) and the file it is in, or nil
+func (r ignoreRules) match(relPath string, isDir bool) (*gitignorePattern, *ignoreFile) {
+	for i := range r {
+		if match := matchGitignore(r[i].patterns, r[i].prefix+relPath, isDir); match != nil {
+			return match, &r[i]
+		}
+	}
+	return nil, nil
+}
+
+// loadIgnoreRules loads the ignore files that apply to absDir: always the
+// .techwriterignore files, and git's and the built-in defaults if gitRules
+// is set. Except for its
+// .gitignore, their patterns are relative to the repository root, which may
+// be above absDir; outside a repository they are relative to absDir.
+func loadIgnoreRules(absDir string, gitRules bool) ignoreRules {
+	var rules ignoreRules
+	prefixOf := func(base string) (string, bool) {
+		if base == absDir {
+			return "", true
+		}
+		rel, err := filepath.Rel(base, absDir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			return "", false
+		}
+		return filepath.ToSlash(rel) + "/", true
+	}
+	add := func(kind, path, base string) {
+		prefix, ok := prefixOf(base)
+		if !ok {
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			if kind == IgnoreGitignore {
+				log.Printf("No .gitignore found: %v", err)
+			}
+			return
+		}
+		defer file.Close()
+		rules = append(rules, ignoreFile{Kind: kind, Path: path, prefix: prefix, patterns: parseGitignore(file)})
+		log.Printf("Loaded %s patterns from %s", kind, path)
+	}
+
+	root, gitDir := findGitDir(absDir)
+	if gitDir == "" {
+		root = absDir
+	}
+	add(IgnoreTechWriter, filepath.Join(root, ".techwriterignore"), root)
+	if user := userIgnoreFile(); user != "" {
+		add(IgnoreTechWriter, user, root)
+	}
+	if !gitRules {
+		return rules
+	}
+	add(IgnoreGitignore, filepath.Join(absDir, ".gitignore"), absDir)
+	if gitDir != "" {
+		add(IgnoreInfoExclude, filepath.Join(gitDir, "info", "exclude"), root)
+	}
+	if global := globalExcludesFile(absDir); global != "" {
+		add(IgnoreGlobalExclude, global, root)
+	}
+	defaultIgnores.RLock()
+	defer defaultIgnores.RUnlock()
+	if prefix, ok := prefixOf(root); ok && !defaultIgnores.disabled {
+		rules = append(rules, ignoreFile{Kind: IgnoreDefault, Path: "built-in defaults", prefix: prefix, patterns: defaultIgnorePatterns})
+	}
+	return rules
+}
+
+// userIgnoreFile returns the user's .techwriterignore, which applies to every
+// repository: tech-writer-agent/ignore in the user configuration directory
+// (~/.config on Linux)
+func userIgnoreFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "tech-writer-agent", "ignore")
+}
+
+// findGitDir returns the root of the git work tree holding dir and its git
+// directory (the common one, for a linked worktree), or "" if dir is not in
+// one
+func findGitDir(dir string) (root, gitDir string) {
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if info.IsDir() {
+				return dir, dotGit
+			}
+			// A worktree or submodule has a .git file pointing at its git
+			// directory, and a worktree's has a commondir file
+			data, err := os.ReadFile(dotGit)
+			path, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+			if err != nil || !ok {
+				return "", ""
+			}
+			gitDir = resolvePath(dir, strings.TrimSpace(path))
+			if common, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+				gitDir = resolvePath(gitDir, strings.TrimSpace(string(common)))
+			}
+			return dir, gitDir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ""
+		}
+		dir = parent
+	}
+}
+
+// resolvePath resolves path against dir unless it is absolute
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+// globalExcludesFile returns the user's global excludes file: core.excludesFile
+// as git sees it from dir, else git's default of $XDG_CONFIG_HOME/git/ignore
+// or ~/.config/git/ignore
+func globalExcludesFile(dir string) string {
+	if output, err := runGit(dir, "config", "--path", "--get", "core.excludesFile"); err == nil && strings.TrimSpace(output) != "" {
+		return resolvePath(dir, strings.TrimSpace(output))
+	}
+	if config := os.Getenv("XDG_CONFIG_HOME"); config != "" {
+		return filepath.Join(config, "git", "ignore")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".config", "git", "ignore")
+	}
+	return ""
+}
+
+// IgnoreExplanation reports whether the file-walking tools see a path and, if
+// not, which rule excludes it
+type IgnoreExplanation struct {
+	Path     string `json:"path"`
+	Excluded bool   `json:"excluded"`
+	Reason   string `json:"reason"`
+	Pattern  string `json:"pattern,omitempty"` // the ignore pattern that matched
+	Source   string `json:"source,omitempty"`  // where the pattern is defined (file:line)
+}
+
+// explainIgnore applies the default rules of find_all_matching_files (see
+// listFiles) to path under directory, in the same order, and reports the
+// first rule that excludes it. path may be absolute or relative to directory.
+func explainIgnore(directory, path string) (IgnoreExplanation, error) {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return IgnoreExplanation{}, fmt.Errorf("error resolving directory path: %w", err)
+	}
+	absPath := path
+	if !filepath.IsAbs(path) {
+		absPath = filepath.Join(absDir, path)
+	}
+	explanation := IgnoreExplanation{Path: path}
+
+	relPath, err := filepath.Rel(absDir, absPath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		explanation.Excluded = true
+		explanation.Reason = fmt.Sprintf("outside the base directory %s", absDir)
+		return explanation, nil
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		explanation.Excluded = true
+		explanation.Reason = "does not exist"
+		return explanation, nil
+	}
+
+	parts := strings.Split(relPath, string(filepath.Separator))
+	for i, part := range parts {
+		if part == ".git" && (i < len(parts)-1 || info.IsDir()) {
+			explanation.Excluded = true
+			explanation.Reason = "inside a .git directory, which is always skipped"
+			return explanation, nil
+		}
+	}
+
+	// Hidden files are only skipped inside hidden directories
+	if !info.IsDir() && strings.HasPrefix(filepath.Base(absPath), ".") {
+		for _, part := range parts[:len(parts)-1] {
+			if strings.HasPrefix(part, ".") {
+				explanation.Excluded = true
+				explanation.Reason = fmt.Sprintf("hidden file inside the hidden directory %s (include_hidden is false)", part)
+				return explanation, nil
+			}
+		}
+	}
+
+	if match, file := ignoreMatch(relPath, info.IsDir(), loadIgnoreRules(absDir, true)); match != nil {
+		explanation.Excluded = true
+		explanation.Reason = fmt.Sprintf("matched by a %s pattern", file.Kind)
+		explanation.Pattern = match.Text
+		explanation.Source = fmt.Sprintf("%s:%d", file.Path, match.Line)
+		if file.Kind == IgnoreDefault {
+			explanation.Source = "built-in defaults (--no-default-ignores turns them off)"
+		}
+		return explanation, nil
+	}
+
+	if reason := newScopeFilter(absDir).excludes(relPath); reason != "" {
+		explanation.Excluded = true
+		explanation.Reason = reason
+		return explanation, nil
+	}
+
+	if hideGenerated() && !info.IsDir() {
+		if attr, file, rule := loadLinguistAttributes(absDir).marked(relPath); attr != "" {
+			explanation.Excluded = true
+			explanation.Reason = fmt.Sprintf("marked %s in .gitattributes (--include-generated shows it)", attr)
+			explanation.Pattern = rule.pattern.Text
+			explanation.Source = fmt.Sprintf("%s:%d", file.Path, rule.pattern.Line)
+			return explanation, nil
+		}
+	}
+
+	explanation.Reason = "not excluded by any rule"
+	if _, err := os.Stat(filepath.Join(absDir, ".gitignore")); err != nil {
+		explanation.Reason += " (no .gitignore in the base directory)"
+	}
+	return explanation, nil
+}
+
+// explainIgnoreTool implements the explain_ignore tool
+func explainIgnoreTool(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	path, ok := args["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	return explainIgnore(directory, path)
+}
+
+// runExplainIgnore implements the explain-ignore command: for each path it
+// prints whether the agent's file tools see it and which rule excludes it
+func runExplainIgnore(argv []string) error {
+	fs := flag.NewFlagSet("explain-ignore", flag.ExitOnError)
+	directory := fs.String("directory", ".", "Base directory the agent would analyse (where its .gitignore is read)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s explain-ignore [--directory DIR] PATH...\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no paths given")
+	}
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "STATUS\tPATH\tREASON")
+	for _, path := range fs.Args() {
+		explanation, err := explainIgnore(*directory, path)
+		if err != nil {
+			return err
+		}
+		status := "included"
+		if explanation.Excluded {
+			status = "excluded"
+		}
+		reason := explanation.Reason
+		if explanation.Pattern != "" {
+			reason = fmt.Sprintf("%s %q at %s", reason, explanation.Pattern, explanation.Source)
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\n", status, path, reason)
+	}
+	return out.Flush()
+}
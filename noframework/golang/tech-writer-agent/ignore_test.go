@@ -0,0 +1,439 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeFixture creates a repository under a temporary directory with the
+// given files (slash-separated paths) and returns its path
+func writeFixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// listRelative runs listFiles and returns the results relative to dir, sorted
+func listRelative(t *testing.T, dir string, opts WalkOptions) []string {
+	t.Helper()
+	files, err := listFiles(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel := make([]string, len(files))
+	for i, file := range files {
+		path, err := filepath.Rel(dir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel[i] = filepath.ToSlash(path)
+	}
+	slices.Sort(rel)
+	return rel
+}
+
+// The layout of the axios checkout the original ad-hoc programs were run
+// against: .DS_Store files at several depths, dependency and coverage
+// directories, and dot-files at the root
+var axiosFixture = map[string]string{
+	".gitignore":                        "*.iml\n.idea\n.tscache\n.DS_Store\nnode_modules/\ntypings/\ncoverage/\ntest/typescript/axios.js*\nsauce_connect.log\ntest/module/**/package-lock.json\nbackup/\n/.husky/\n",
+	".npmignore":                        "test/\n",
+	".DS_Store":                         "",
+	"bin/.DS_Store":                     "",
+	"lib/.DS_Store":                     "",
+	".github/.DS_Store":                 "",
+	".github/workflows/ci":              "on: push\n",
+	".git/config":                       "[core]\n",
+	"node_modules/a/a.js":               "module.exports = 1\n",
+	"coverage/index.html":               "<html></html>\n",
+	"lib/axios.js":                      "export default {}\n",
+	"lib/helpers/bind.js":               "export default function bind() {}\n",
+	"test/unit/axios.js":                "test()\n",
+	"test/typescript/axios.js":          "compiled\n",
+	"test/typescript/axios.js.map":      "{}\n",
+	"test/typescript/axios.ts":          "source\n",
+	"test/module/cjs/package-lock.json": "{}\n",
+	"test/module/cjs/package.json":      "{}\n",
+	"sauce_connect.log":                 "log\n",
+}
+
+func TestListFilesGitignore(t *testing.T) {
+	everything := WalkOptions{Pattern: "*", RespectGitignore: true, IncludeSubdirs: true}
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		opts  WalkOptions
+		want  []string
+	}{
+		{
+			name:  "axios layout",
+			files: axiosFixture,
+			opts:  everything,
+			want: []string{
+				".github/workflows/ci",
+				".gitignore",
+				".npmignore",
+				"lib/axios.js",
+				"lib/helpers/bind.js",
+				"test/module/cjs/package.json",
+				"test/typescript/axios.ts",
+				"test/unit/axios.js",
+			},
+		},
+		{
+			name: "directory patterns",
+			files: map[string]string{
+				".gitignore":              "node_modules/\n/build\ntmp/\n",
+				"node_modules/x/index.js": "",
+				"web/node_modules/y.js":   "",
+				"build/out.js":            "",
+				"src/build/keep.js":       "",
+				"tmp":                     "a file, not a directory\n",
+				"src/main.go":             "",
+			},
+			opts: everything,
+			want: []string{".gitignore", "src/build/keep.js", "src/main.go", "tmp"},
+		},
+		{
+			name: "negations",
+			files: map[string]string{
+				".gitignore":     "*.log\n!keep.log\ndist/\n!dist/keep.js\n",
+				"debug.log":      "",
+				"keep.log":       "",
+				"logs/error.log": "",
+				"logs/keep.log":  "",
+				"dist/bundle.js": "",
+				"dist/keep.js":   "",
+				"main.go":        "",
+			},
+			opts: everything,
+			// Files in an excluded directory cannot be re-included, as in git
+			want: []string{".gitignore", "keep.log", "logs/keep.log", "main.go"},
+		},
+		{
+			name: "hidden files",
+			files: map[string]string{
+				".env":                     "",
+				"src/.eslintrc":            "",
+				".github/workflows/ci.yml": "",
+				".github/.DS_Store":        "",
+				".git/HEAD":                "",
+				"main.go":                  "",
+			},
+			opts: everything,
+			// Only hidden files inside hidden directories are skipped by default
+			want: []string{".env", ".github/workflows/ci.yml", "main.go", "src/.eslintrc"},
+		},
+		{
+			name: "include hidden",
+			files: map[string]string{
+				".github/.DS_Store": "",
+				".git/HEAD":         "",
+				"main.go":           "",
+			},
+			opts: WalkOptions{Pattern: "*", RespectGitignore: true, IncludeHidden: true, IncludeSubdirs: true},
+			want: []string{".github/.DS_Store", "main.go"},
+		},
+		{
+			name: "gitignore not respected",
+			files: map[string]string{
+				".gitignore":    "*.log\nvendor/\n",
+				"app.log":       "",
+				"vendor/lib.go": "",
+				"main.go":       "",
+			},
+			opts: WalkOptions{Pattern: "*", IncludeSubdirs: true},
+			want: []string{".gitignore", "app.log", "main.go", "vendor/lib.go"},
+		},
+		{
+			name: "pattern and no subdirectories",
+			files: map[string]string{
+				".gitignore":  "gen_*.go\n",
+				"main.go":     "",
+				"gen_api.go":  "",
+				"README.md":   "",
+				"pkg/util.go": "",
+			},
+			opts: WalkOptions{Pattern: "*.go", RespectGitignore: true},
+			want: []string{"main.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFixture(t, tt.files)
+			got := listRelative(t, dir, tt.opts)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("listFiles() =\n  %s\nwant\n  %s", strings.Join(got, "\n  "), strings.Join(tt.want, "\n  "))
+			}
+		})
+	}
+}
+
+func TestExplainIgnore(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		".gitignore":          "# build output\nnode_modules/\n*.log\n!keep.log\n",
+		"node_modules/a/a.js": "",
+		"debug.log":           "",
+		"keep.log":            "",
+		".github/.DS_Store":   "",
+		".git/config":         "",
+		"main.go":             "",
+	})
+
+	tests := []struct {
+		path     string
+		excluded bool
+		reason   string // prefix of the reason
+		pattern  string
+		line     int
+	}{
+		{path: "main.go", reason: "not excluded"},
+		{path: "keep.log", reason: "not excluded"},
+		{path: "debug.log", excluded: true, reason: "matched by a .gitignore pattern", pattern: "*.log", line: 3},
+		{path: "node_modules/a/a.js", excluded: true, reason: "matched by a .gitignore pattern", pattern: "node_modules/", line: 2},
+		{path: "node_modules", excluded: true, reason: "matched by a .gitignore pattern", pattern: "node_modules/", line: 2},
+		{path: filepath.Join(dir, "debug.log"), excluded: true, reason: "matched by a .gitignore pattern", pattern: "*.log", line: 3},
+		{path: ".github/.DS_Store", excluded: true, reason: "hidden file inside the hidden directory .github"},
+		{path: ".git/config", excluded: true, reason: "inside a .git directory"},
+		{path: "missing.go", excluded: true, reason: "does not exist"},
+		{path: "../elsewhere.go", excluded: true, reason: "outside the base directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := explainIgnore(dir, tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Excluded != tt.excluded || !strings.HasPrefix(got.Reason, tt.reason) || got.Pattern != tt.pattern {
+				t.Errorf("explainIgnore(%q) = %+v, want excluded=%v reason %q... pattern %q", tt.path, got, tt.excluded, tt.reason, tt.pattern)
+			}
+			if tt.pattern != "" {
+				wantSource := fmt.Sprintf("%s:%d", filepath.Join(dir, ".gitignore"), tt.line)
+				if got.Source != wantSource {
+					t.Errorf("explainIgnore(%q).Source = %q, want %q", tt.path, got.Source, wantSource)
+				}
+			}
+		})
+	}
+}
+
+func TestListFilesExcludeFiles(t *testing.T) {
+	global := filepath.Join(t.TempDir(), "ignore")
+	if err := os.WriteFile(global, []byte("scratch/\n*.orig\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := filepath.Join(t.TempDir(), "gitconfig")
+	if err := os.WriteFile(config, []byte("[core]\n\texcludesFile = "+global+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GIT_CONFIG_GLOBAL", config)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	dir := writeFixture(t, map[string]string{
+		".gitignore":        "!keep.orig\n",
+		".git/info/exclude": "*.swp\n/src/generated.go\n",
+		"main.go":           "",
+		"main.go.swp":       "",
+		"merge.orig":        "",
+		"keep.orig":         "",
+		"scratch/notes.md":  "",
+		"src/app.go":        "",
+		"src/generated.go":  "",
+		"src/app.go.orig":   "",
+	})
+	everything := WalkOptions{Pattern: "*", RespectGitignore: true, IncludeSubdirs: true}
+
+	// .gitignore takes precedence over the global excludes file
+	want := []string{".gitignore", "keep.orig", "main.go", "src/app.go"}
+	if got := listRelative(t, dir, everything); !slices.Equal(got, want) {
+		t.Errorf("listFiles() = %v, want %v", got, want)
+	}
+	// The exclude files' patterns are relative to the repository root
+	if got := listRelative(t, filepath.Join(dir, "src"), everything); !slices.Equal(got, []string{"app.go"}) {
+		t.Errorf("listFiles(src) = %v, want [app.go]", got)
+	}
+
+	got, err := explainIgnore(dir, "main.go.swp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantSource := filepath.Join(dir, ".git", "info", "exclude") + ":1"; !got.Excluded || got.Reason != "matched by a .git/info/exclude pattern" || got.Source != wantSource {
+		t.Errorf("explainIgnore(main.go.swp) = %+v, want a match at %s", got, wantSource)
+	}
+	got, err = explainIgnore(dir, "scratch/notes.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Excluded || got.Reason != "matched by a core.excludesFile pattern" || got.Source != global+":1" {
+		t.Errorf("explainIgnore(scratch/notes.md) = %+v, want a match at %s:1", got, global)
+	}
+}
+
+func TestListFilesTechWriterIgnore(t *testing.T) {
+	config := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(config, "tech-writer-agent"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config, "tech-writer-agent", "ignore"), []byte("*.snap\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	dir := writeFixture(t, map[string]string{
+		".techwriterignore":         "testdata/\nthird_party/\n!api.gen.go\n",
+		".gitignore":                "*.gen.go\n",
+		"main.go":                   "",
+		"api.gen.go":                "",
+		"db.gen.go":                 "",
+		"testdata/fixture.json":     "",
+		"pkg/testdata/golden.txt":   "",
+		"third_party/lib/lib.go":    "",
+		"ui/__snapshots__/app.snap": "",
+	})
+
+	// A negation in .techwriterignore re-includes a file .gitignore ignores
+	want := []string{".gitignore", ".techwriterignore", "api.gen.go", "main.go"}
+	if got := listRelative(t, dir, WalkOptions{Pattern: "*", RespectGitignore: true, IncludeSubdirs: true}); !slices.Equal(got, want) {
+		t.Errorf("listFiles() = %v, want %v", got, want)
+	}
+	// .techwriterignore applies even when .gitignore isn't respected
+	want = []string{".gitignore", ".techwriterignore", "api.gen.go", "db.gen.go", "main.go"}
+	if got := listRelative(t, dir, WalkOptions{Pattern: "*", IncludeSubdirs: true}); !slices.Equal(got, want) {
+		t.Errorf("listFiles() without gitignore = %v, want %v", got, want)
+	}
+
+	got, err := explainIgnore(dir, "pkg/testdata/golden.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wantSource := filepath.Join(dir, ".techwriterignore") + ":1"; !got.Excluded || got.Reason != "matched by a .techwriterignore pattern" || got.Source != wantSource {
+		t.Errorf("explainIgnore(pkg/testdata/golden.txt) = %+v, want a match at %s", got, wantSource)
+	}
+}
+
+func TestListFilesScope(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		".gitignore":                  "*.log\n",
+		"README.md":                   "",
+		"src/main.go":                 "",
+		"src/debug.log":               "",
+		"src/api/handler.go":          "",
+		"src/api/testdata/req.json":   "",
+		"src/vendor/lib/lib.go":       "",
+		"docs/guide.md":               "",
+		"tools/testdata/fixture.json": "",
+	})
+	if err := setWalkScope(dir, []string{"src/**", "*.md"}, []string{"**/testdata/**", "vendor"}, false); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { setWalkScope("", nil, nil, false) })
+	everything := WalkOptions{Pattern: "*", RespectGitignore: true, IncludeSubdirs: true}
+
+	want := []string{"README.md", "docs/guide.md", "src/api/handler.go", "src/main.go"}
+	if got := listRelative(t, dir, everything); !slices.Equal(got, want) {
+		t.Errorf("listFiles() = %v, want %v", got, want)
+	}
+	// The patterns stay relative to the analysed directory
+	if got := listRelative(t, filepath.Join(dir, "src", "api"), everything); !slices.Equal(got, []string{"handler.go"}) {
+		t.Errorf("listFiles(src/api) = %v, want [handler.go]", got)
+	}
+
+	got, err := explainIgnore(dir, "src/vendor/lib/lib.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Excluded || got.Reason != `matched by the --exclude pattern "vendor"` {
+		t.Errorf("explainIgnore(src/vendor/lib/lib.go) = %+v, want excluded by --exclude", got)
+	}
+}
+
+func TestListFilesLinguistAttributes(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		".gitattributes":    "vendor/** linguist-vendored\n*.pb.go linguist-generated=true\nassets/*.min.js linguist-generated\nvendor/ours/** -linguist-vendored\napi.pb.go linguist-generated=false\n*.go text eol=lf\n",
+		"main.go":           "",
+		"x.pb.go":           "",
+		"api.pb.go":         "",
+		"assets/app.min.js": "",
+		"assets/app.js":     "",
+		"vendor/lib/a.go":   "",
+		"vendor/ours/b.go":  "",
+	})
+	everything := WalkOptions{Pattern: "*", RespectGitignore: true, IncludeSubdirs: true}
+
+	want := []string{".gitattributes", "api.pb.go", "assets/app.js", "main.go", "vendor/ours/b.go"}
+	if got := listRelative(t, dir, everything); !slices.Equal(got, want) {
+		t.Errorf("listFiles() = %v, want %v", got, want)
+	}
+	got, err := explainIgnore(dir, "x.pb.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Excluded || !strings.HasPrefix(got.Reason, "marked linguist-generated") || got.Source != filepath.Join(dir, ".gitattributes")+":2" {
+		t.Errorf("explainIgnore(x.pb.go) = %+v, want marked linguist-generated at line 2", got)
+	}
+
+	// --include-generated shows them
+	if err := setWalkScope(dir, nil, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { setWalkScope("", nil, nil, false) })
+	if got := listRelative(t, dir, everything); len(got) != 8 {
+		t.Errorf("listFiles() with --include-generated = %v, want all 8 files", got)
+	}
+}
+
+func TestListFilesDefaultIgnores(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		".git/HEAD":                   "ref: refs/heads/main\n",
+		".techwriterignore":           "!/target/\n",
+		"main.py":                     "",
+		"pkg/__pycache__/main.pyc":    "",
+		"pkg/util.pyc":                "",
+		"web/node_modules/a/index.js": "",
+		".venv/lib/site.py":           "",
+		"build/out.o":                 "",
+		"src/go/build/build.go":       "",
+		"target/release.txt":          "",
+	})
+	everything := WalkOptions{Pattern: "*", RespectGitignore: true, IncludeSubdirs: true}
+
+	// Without a .gitignore, only the root build directory is skipped, and the
+	// .techwriterignore re-includes target
+	want := []string{".techwriterignore", "main.py", "src/go/build/build.go", "target/release.txt"}
+	if got := listRelative(t, dir, everything); !slices.Equal(got, want) {
+		t.Errorf("listFiles() = %v, want %v", got, want)
+	}
+	if got := listRelative(t, filepath.Join(dir, "src", "go"), everything); !slices.Equal(got, []string{"build/build.go"}) {
+		t.Errorf("listFiles(src/go) = %v, want [build/build.go]", got)
+	}
+	got, err := explainIgnore(dir, "web/node_modules/a/index.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Excluded || got.Reason != "matched by a built-in default pattern" || got.Pattern != "node_modules/" {
+		t.Errorf("explainIgnore(web/node_modules/a/index.js) = %+v, want excluded by the default node_modules/", got)
+	}
+
+	// --no-default-ignores shows them all
+	setDefaultIgnores(false)
+	t.Cleanup(func() { setDefaultIgnores(true) })
+	if got := listRelative(t, dir, everything); len(got) != 9 {
+		t.Errorf("listFiles() with --no-default-ignores = %v, want all 9 files", got)
+	}
+}
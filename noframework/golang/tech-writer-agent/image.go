@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Limits of describe_image
+const (
+	IMAGE_MAX_BYTES     = 8 * 1024 * 1024 // of a PNG, JPEG, GIF or WebP image sent to the model
+	IMAGE_MAX_SVG_CHARS = 100000          // of SVG markup sent to the model
+)
+
+// IMAGE_DESCRIPTION_PROMPT asks for a description that can go into the docs
+const IMAGE_DESCRIPTION_PROMPT = `This image is from a software repository, most likely an architecture or flow diagram, a screenshot or a logo. Describe it for a technical writer documenting the codebase: what kind of image it is, the components, labels and text it shows, and how they are connected (the direction and meaning of arrows). Report only what the image shows; don't guess beyond it.`
+
+// ImageDescription represents an image described by the model
+type ImageDescription struct {
+	File        string `json:"file"`
+	Format      string `json:"format"` // MIME type
+	Description string `json:"description"`
+}
+
+// newDescribeImageTool returns the describe_image tool, which asks client to
+// describe an image. Raster images are sent as images, which needs a
+// vision-capable model; SVG is sent as its markup, which any model can read.
+func newDescribeImageTool(client LLMClient, describer ImageDescriber) Tool {
+	return Tool{
+		Name:        "describe_image",
+		Description: "Describe an image in the repository, such as an architecture diagram, by showing it to a vision-capable model. Supports PNG, JPEG, GIF, WebP and SVG",
+		Arguments: []ToolArgument{
+			{Name: "file_path", Type: "string", Required: true, Description: "Path to the image"},
+			{Name: "focus", Type: "string", Description: "What to pay particular attention to, e.g. the data flow between services"},
+		},
+		Function: func(args map[string]interface{}) (interface{}, error) {
+			filePath, ok := args["file_path"].(string)
+			if !ok || filePath == "" {
+				return nil, fmt.Errorf("file_path parameter is required")
+			}
+			prompt := IMAGE_DESCRIPTION_PROMPT
+			if focus, ok := args["focus"].(string); ok && strings.TrimSpace(focus) != "" {
+				prompt += "\n\nPay particular attention to: " + strings.TrimSpace(focus)
+			}
+			return describeImage(client, describer, filePath, prompt), nil
+		},
+	}
+}
+
+// describeImage reads an image and has the model describe it. Problems are
+// reported as {"error": ...} results like the file tools do.
+func describeImage(client LLMClient, describer ImageDescriber, filePath, prompt string) interface{} {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("File not found: %s", filePath)}
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}
+	}
+	if info.Size() > IMAGE_MAX_BYTES {
+		return map[string]string{"error": fmt.Sprintf("%s is %s; describe_image accepts images up to %s", filePath, formatBytes(int(info.Size())), formatBytes(IMAGE_MAX_BYTES))}
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}
+	}
+
+	format := imageFormat(filePath, data)
+	var description string
+	switch format {
+	case "":
+		return map[string]string{"error": fmt.Sprintf("%s is not a PNG, JPEG, GIF, WebP or SVG image", filePath)}
+	case "image/svg+xml":
+		markup := scanPromptText(string(data))
+		if len(markup) > IMAGE_MAX_SVG_CHARS {
+			markup = markup[:IMAGE_MAX_SVG_CHARS] + "\n<!-- [... truncated ...] -->"
+		}
+		description, err = client.Complete(fmt.Sprintf("%s\n\nThe image is this SVG:\n\n%s", prompt, markup), "You describe images for technical documentation.", 0)
+	default:
+		description, err = describer.DescribeImage(prompt, format, data)
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("The model could not describe %s: %s", filePath, err)}
+	}
+	return ImageDescription{File: filePath, Format: format, Description: strings.TrimSpace(description)}
+}
+
+// imageFormat returns the MIME type of an image the tool can describe, from
+// its content (or, for SVG, its extension or root element), or "" for
+// anything else
+func imageFormat(filePath string, data []byte) string {
+	switch mimeType := http.DetectContentType(data); mimeType {
+	case "image/png", "image/jpeg", "image/gif", "image/webp":
+		return mimeType
+	}
+	head := data[:min(len(data), 1024)]
+	if strings.EqualFold(filepath.Ext(filePath), ".svg") || bytes.Contains(head, []byte("<svg")) {
+		if !isBinaryContent(head) {
+			return "image/svg+xml"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory under the cache dir holding the last successful run of each
+// repository and prompt, for --incremental
+const RUNS_DIR_NAME = ".tech-writer-runs"
+
+// LastRun is the last successful run documenting a repository with a prompt
+type LastRun struct {
+	Repo      string `json:"repo"`
+	Subdir    string `json:"subdir,omitempty"`
+	Preset    string `json:"preset,omitempty"` // the --preset, if any
+	Prompt    string `json:"prompt"`           // absolute path of the prompt file, if any
+	Commit    string `json:"commit"`           // git HEAD of the documented tree
+	Document  string `json:"document"`         // absolute path of the document written
+	Model     string `json:"model"`
+	CreatedAt string `json:"created_at"`
+}
+
+// UpdatePlan is an --incremental run's starting point: the last run's
+// document and the changes since its commit
+type UpdatePlan struct {
+	Previous LastRun   `json:"previous"`
+	Changes  DiffRange `json:"changes"`
+}
+
+// lastRunPath returns the file recording the last run of repo (and subdir)
+// with preset and promptFile, either of which may be ""
+func lastRunPath(cacheDir, repo, subdir, preset, promptFile string) string {
+	absPrompt := promptFile
+	if promptFile != "" {
+		if abs, err := filepath.Abs(promptFile); err == nil {
+			absPrompt = abs
+		}
+	}
+	parts := []string{repo, subdir, absPrompt}
+	if preset != "" {
+		// Runs without a preset keep the key they had before presets
+		parts = append(parts, preset)
+	}
+	key := strings.Join(parts, "\x00")
+	return filepath.Join(expandHome(cacheDir), RUNS_DIR_NAME, shortHash(key)+".json")
+}
+
+// loadLastRun returns the last successful run of repo with preset and
+// promptFile, or nil if there is none or its document is gone
+func loadLastRun(cacheDir, repo, subdir, preset, promptFile string) (*LastRun, error) {
+	data, err := os.ReadFile(lastRunPath(cacheDir, repo, subdir, preset, promptFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var run LastRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("error parsing the last run of %s: %w", repo, err)
+	}
+	if _, err := os.Stat(run.Document); err != nil {
+		return nil, nil
+	}
+	return &run, nil
+}
+
+// saveLastRun records a successful run as the starting point of the next
+// --incremental run of the same repository and prompt
+func saveLastRun(cacheDir string, run LastRun) (string, error) {
+	run.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	path := lastRunPath(cacheDir, run.Repo, run.Subdir, run.Preset, run.Prompt)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("error creating runs directory: %w", err)
+	}
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling the last run: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("error writing the last run: %w", err)
+	}
+	return path, nil
+}
+
+// planIncrementalUpdate finds where an --incremental run starts: the last
+// run's document and the changes since its commit, fetched into a clone that
+// lacks it. It returns nil for a full analysis when there is no usable last
+// run, and one without a FromCommit when HEAD is the documented commit.
+func planIncrementalUpdate(cacheDir, repo, subdir, preset, promptFile, directory string, cloned bool) (*UpdatePlan, error) {
+	previous, err := loadLastRun(cacheDir, repo, subdir, preset, promptFile)
+	if err != nil || previous == nil {
+		return nil, err
+	}
+	head := gitHeadCommit(directory)
+	if head == "" {
+		return nil, fmt.Errorf("--incremental needs a git repository")
+	}
+	update := &UpdatePlan{Previous: *previous, Changes: DiffRange{From: "last run", To: "HEAD", ToCommit: head}}
+	if previous.Commit == head {
+		return update, nil
+	}
+	if update.Changes.FromCommit, err = resolveCommit(directory, cloned, previous.Commit); err != nil {
+		return nil, fmt.Errorf("the commit of the last run is unavailable: %w", err)
+	}
+	return update, nil
+}
+
+// incrementalPrompt asks the agent to update the last run's document for the
+// changes since, rather than to document the code base from scratch. The
+// previous document goes through the secret scan (--scan-secrets) like the
+// diff: it may have been written without --guardrails.
+func incrementalPrompt(directory string, update *UpdatePlan) (string, error) {
+	previous, err := os.ReadFile(update.Previous.Document)
+	if err != nil {
+		return "", fmt.Errorf("error reading the previous document: %w", err)
+	}
+	changes, err := describeChanges(directory, &update.Changes)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "An earlier run documented this code base at commit %s (%s). Update that document for the changes since, given below, instead of exploring the whole code base again. ", update.Previous.Commit, update.Previous.CreatedAt)
+	b.WriteString("Revise the sections the changes affect, document new functionality, remove what no longer exists, and keep the rest as it is. Read the changed files for context and use git_diff with these commits and a path for diffs cut short below. ")
+	b.WriteString("Give the complete updated document as your final answer, following the instructions after the changes.\n\n")
+	fmt.Fprintf(&b, "Previous document:\n<<<\n%s\n>>>\n\n", scanPromptText(strings.TrimSpace(stripFrontMatter(string(previous)))))
+	b.WriteString(changes)
+	return b.String(), nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// languageByExtension maps lower-case file extensions to language names
+var languageByExtension = map[string]string{
+	".go":     "Go",
+	".py":     "Python",
+	".pyi":    "Python",
+	".js":     "JavaScript",
+	".mjs":    "JavaScript",
+	".cjs":    "JavaScript",
+	".jsx":    "JavaScript",
+	".ts":     "TypeScript",
+	".mts":    "TypeScript",
+	".cts":    "TypeScript",
+	".tsx":    "TypeScript",
+	".java":   "Java",
+	".kt":     "Kotlin",
+	".kts":    "Kotlin",
+	".scala":  "Scala",
+	".rs":     "Rust",
+	".c":      "C",
+	".h":      "C",
+	".cc":     "C++",
+	".cpp":    "C++",
+	".cxx":    "C++",
+	".hpp":    "C++",
+	".hh":     "C++",
+	".cs":     "C#",
+	".fs":     "F#",
+	".swift":  "Swift",
+	".m":      "Objective-C",
+	".rb":     "Ruby",
+	".php":    "PHP",
+	".pl":     "Perl",
+	".lua":    "Lua",
+	".r":      "R",
+	".dart":   "Dart",
+	".ex":     "Elixir",
+	".exs":    "Elixir",
+	".erl":    "Erlang",
+	".hrl":    "Erlang",
+	".hs":     "Haskell",
+	".clj":    "Clojure",
+	".ml":     "OCaml",
+	".zig":    "Zig",
+	".nim":    "Nim",
+	".jl":     "Julia",
+	".sh":     "Shell",
+	".bash":   "Shell",
+	".zsh":    "Shell",
+	".ps1":    "PowerShell",
+	".bat":    "Batch",
+	".sql":    "SQL",
+	".proto":  "Protocol Buffers",
+	".html":   "HTML",
+	".htm":    "HTML",
+	".css":    "CSS",
+	".scss":   "SCSS",
+	".less":   "Less",
+	".vue":    "Vue",
+	".svelte": "Svelte",
+	".md":     "Markdown",
+	".mdx":    "Markdown",
+	".rst":    "reStructuredText",
+	".txt":    "Text",
+	".json":   "JSON",
+	".yaml":   "YAML",
+	".yml":    "YAML",
+	".toml":   "TOML",
+	".xml":    "XML",
+	".ini":    "INI",
+	".cfg":    "INI",
+	".tf":     "HCL",
+	".hcl":    "HCL",
+	".gradle": "Gradle",
+	".cmake":  "CMake",
+}
+
+// languageByName maps file names without a telling extension
+var languageByName = map[string]string{
+	"Makefile":       "Makefile",
+	"GNUmakefile":    "Makefile",
+	"Dockerfile":     "Dockerfile",
+	"CMakeLists.txt": "CMake",
+	"Gemfile":        "Ruby",
+	"Rakefile":       "Ruby",
+	"Jenkinsfile":    "Groovy",
+	"go.mod":         "Go Module",
+	"go.sum":         "Go Module",
+}
+
+// languageByInterpreter maps shebang interpreters to languages
+var languageByInterpreter = map[string]string{
+	"python":  "Python",
+	"python3": "Python",
+	"node":    "JavaScript",
+	"sh":      "Shell",
+	"bash":    "Shell",
+	"zsh":     "Shell",
+	"ruby":    "Ruby",
+	"perl":    "Perl",
+	"php":     "PHP",
+}
+
+// detectLanguage names the language of the file at path from its name, or
+// for scripts without an extension from its shebang line. It returns "" if
+// the language is unknown.
+func detectLanguage(path string) string {
+	name := filepath.Base(path)
+	if language, ok := languageByName[name]; ok {
+		return language
+	}
+	if strings.HasPrefix(name, "Dockerfile.") {
+		return "Dockerfile"
+	}
+	if ext := strings.ToLower(filepath.Ext(name)); ext != "" {
+		return languageByExtension[ext]
+	}
+	return shebangLanguage(path)
+}
+
+// shebangLanguage reads the interpreter from a "#!" first line
+func shebangLanguage(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	line, _ := bufio.NewReader(file).ReadString('\n')
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return ""
+	}
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" && len(fields) > 1 {
+		interpreter = fields[1]
+	}
+	return languageByInterpreter[interpreter]
+}
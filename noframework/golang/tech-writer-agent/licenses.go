@@ -0,0 +1,502 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Limits of detect_licenses
+const (
+	LICENSE_MAX_FILE_BYTES   = 256 * 1024 // read of a license file
+	LICENSE_HEAD_CHARS       = 600        // of the normalized text searched for a license's title
+	LICENSE_MAX_DEPENDENCIES = 1000       // looked up per ecosystem
+	LICENSE_MAX_NOTABLE      = 50         // notable dependencies listed
+)
+
+// LicenseUnknown is reported for license texts that match no known license
+const LicenseUnknown = "unknown"
+
+// licenseRule recognises a license text by its title, which must appear at
+// the start of the text, and phrases that must appear anywhere, all in
+// normalized form (see normalizeLicenseText). The texts of the SPDX license
+// list are matched by their title and operative sentences rather than word
+// for word, so copyright lines and reflowed text don't matter.
+type licenseRule struct {
+	ID      string // SPDX identifier
+	Title   string
+	Phrases []string
+}
+
+// licenseRules are tried in order, so a rule whose phrases are a subset of
+// another's (BSD-2-Clause of BSD-3-Clause, 0BSD of ISC) comes after it
+var licenseRules = []licenseRule{
+	{ID: "AGPL-3.0", Title: "gnu affero general public license version 3"},
+	{ID: "LGPL-3.0", Title: "gnu lesser general public license version 3"},
+	{ID: "LGPL-2.1", Title: "gnu lesser general public license version 2 1"},
+	{ID: "LGPL-2.0", Title: "gnu library general public license version 2"},
+	{ID: "GPL-3.0", Title: "gnu general public license version 3"},
+	{ID: "GPL-2.0", Title: "gnu general public license version 2"},
+	{ID: "MPL-2.0", Title: "mozilla public license version 2 0"},
+	{ID: "EPL-2.0", Title: "eclipse public license v 2 0"},
+	{ID: "EPL-1.0", Title: "eclipse public license v 1 0"},
+	{ID: "Apache-2.0", Title: "apache license version 2 0"},
+	{ID: "Apache-2.0", Phrases: []string{"licensed under the apache license version 2 0"}},
+	{ID: "BSL-1.0", Title: "boost software license version 1 0"},
+	{ID: "CC0-1.0", Title: "cc0 1 0 universal"},
+	{ID: "Unlicense", Phrases: []string{"this is free and unencumbered software released into the public domain"}},
+	{ID: "MIT", Phrases: []string{
+		"permission is hereby granted free of charge to any person obtaining a copy",
+		"the above copyright notice and this permission notice shall be included",
+	}},
+	{ID: "ISC", Phrases: []string{
+		"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted",
+		"provided that the above copyright notice and this permission notice appear in all copies",
+	}},
+	{ID: "0BSD", Phrases: []string{"permission to use copy modify and or distribute this software for any purpose with or without fee is hereby granted"}},
+	{ID: "BSD-3-Clause", Phrases: []string{
+		"redistribution and use in source and binary forms with or without modification are permitted",
+		"neither the name",
+	}},
+	{ID: "BSD-2-Clause", Phrases: []string{"redistribution and use in source and binary forms with or without modification are permitted"}},
+	{ID: "Zlib", Phrases: []string{
+		"altered source versions must be plainly marked as such",
+		"this notice may not be removed or altered from any source distribution",
+	}},
+}
+
+// spdxIdentifierPattern matches the SPDX-License-Identifier tag that takes
+// precedence over the text
+var spdxIdentifierPattern = regexp.MustCompile(`SPDX-License-Identifier:\s*([^\n*]+?)\s*(?:\*/|-->)?\s*(?:\n|$)`)
+
+// LicenseFinding is a license the project declares, in a license file or a
+// package manifest
+type LicenseFinding struct {
+	File     string `json:"file"`
+	License  string `json:"license"` // SPDX identifier or expression, or "unknown"
+	Basis    string `json:"basis"`   // how it was identified
+	Copyleft bool   `json:"copyleft,omitempty"`
+}
+
+// DependencyLicense is the license of one dependency
+type DependencyLicense struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	License  string `json:"license"`
+	Source   string `json:"source"` // where the license was read: go module, node_modules, python environment
+	Copyleft bool   `json:"copyleft,omitempty"`
+}
+
+// LicensesResult represents the licenses of a project and its dependencies
+type LicensesResult struct {
+	Project            []LicenseFinding    `json:"project"`
+	DependencyCount    int                 `json:"dependency_count"`               // dependencies whose license could be read
+	DependencyLicenses map[string]int      `json:"dependency_licenses,omitempty"`  // dependencies per license
+	Notable            []DependencyLicense `json:"notable_dependencies,omitempty"` // copyleft or unidentified licenses, at most LICENSE_MAX_NOTABLE
+	Note               string              `json:"note,omitempty"`
+}
+
+// detectLicenses implements the detect_licenses tool: the project's license
+// from its license files and manifests, and the licenses of its dependencies
+// where they are installed locally (the Go module cache or vendor directory,
+// node_modules, a Python virtual environment). Nothing is downloaded.
+func detectLicenses(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading directory: %s", err)}, nil
+	}
+
+	result := LicensesResult{Project: []LicenseFinding{}, DependencyLicenses: map[string]int{}}
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && isLicenseFile(entry.Name()) {
+			path := filepath.Join(directory, entry.Name())
+			license, basis := identifyLicenseFile(path)
+			result.Project = append(result.Project, LicenseFinding{File: path, License: license, Basis: basis, Copyleft: isCopyleft(license)})
+		}
+	}
+	result.Project = append(result.Project, manifestLicenses(directory)...)
+
+	var dependencies []DependencyLicense
+	dependencies = append(dependencies, goDependencyLicenses(directory)...)
+	dependencies = append(dependencies, nodeDependencyLicenses(directory)...)
+	dependencies = append(dependencies, pythonDependencyLicenses(directory)...)
+	for _, dependency := range dependencies {
+		result.DependencyLicenses[dependency.License]++
+		if (dependency.Copyleft || dependency.License == LicenseUnknown) && len(result.Notable) < LICENSE_MAX_NOTABLE {
+			result.Notable = append(result.Notable, dependency)
+		}
+	}
+	result.DependencyCount = len(dependencies)
+
+	switch {
+	case len(result.Project) == 0 && len(dependencies) == 0:
+		result.Note = "No license file, manifest license or installed dependencies found"
+	case len(dependencies) == 0:
+		result.Note = "No installed dependencies found (Go module cache or vendor directory, node_modules, .venv); dependency licenses are only read locally"
+	}
+	return result, nil
+}
+
+// isLicenseFile reports whether name is a conventional license file name:
+// LICENSE, LICENCE, COPYING or UNLICENSE, with an extension or a suffix
+// such as LICENSE-MIT
+func isLicenseFile(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, base := range []string{"LICENSE", "LICENCE", "COPYING", "UNLICENSE"} {
+		if upper == base || strings.HasPrefix(upper, base+".") || strings.HasPrefix(upper, base+"-") || strings.HasPrefix(upper, base+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// identifyLicenseFile identifies the license in a file, returning its SPDX
+// identifier and how it was identified
+func identifyLicenseFile(path string) (string, string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return LicenseUnknown, "unreadable"
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, LICENSE_MAX_FILE_BYTES))
+	if err != nil {
+		return LicenseUnknown, "unreadable"
+	}
+	return identifyLicense(string(data))
+}
+
+// identifyLicense identifies a license text by its SPDX-License-Identifier
+// tag, or else by licenseRules
+func identifyLicense(text string) (string, string) {
+	if match := spdxIdentifierPattern.FindStringSubmatch(text); match != nil {
+		return match[1], "SPDX-License-Identifier"
+	}
+	normalized := normalizeLicenseText(text)
+	head := normalized[:min(len(normalized), LICENSE_HEAD_CHARS)]
+	for _, rule := range licenseRules {
+		if rule.Title != "" && !strings.Contains(head, rule.Title) {
+			continue
+		}
+		matched := true
+		for _, phrase := range rule.Phrases {
+			if !strings.Contains(normalized, phrase) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return rule.ID, "license text"
+		}
+	}
+	return LicenseUnknown, "license text"
+}
+
+// normalizeLicenseText lower-cases text and reduces everything but letters
+// and digits to single spaces, so punctuation, quotes and line wrapping
+// don't affect matching
+func normalizeLicenseText(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(fields, " ")
+}
+
+// isCopyleft reports whether an SPDX identifier or expression includes a
+// copyleft license, whose terms reach the code that uses it
+func isCopyleft(license string) bool {
+	upper := strings.ToUpper(license)
+	for _, family := range []string{"GPL", "MPL-", "EPL-", "CDDL", "EUPL", "OSL-", "-SA"} {
+		if strings.Contains(upper, family) {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestLicenses returns the licenses declared in the project's package
+// manifests
+func manifestLicenses(directory string) []LicenseFinding {
+	var findings []LicenseFinding
+	for _, name := range []string{"package.json", "composer.json"} {
+		path := filepath.Join(directory, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if license := jsonLicense(data); license != "" {
+			findings = append(findings, LicenseFinding{File: path, License: license, Basis: name + " license field", Copyleft: isCopyleft(license)})
+		}
+	}
+	for _, name := range []string{"Cargo.toml", "pyproject.toml"} {
+		path := filepath.Join(directory, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if license := tomlLicense(string(data)); license != "" {
+			findings = append(findings, LicenseFinding{File: path, License: license, Basis: name + " license field", Copyleft: isCopyleft(license)})
+		}
+	}
+	return findings
+}
+
+// jsonLicense returns the license field of a package.json or composer.json:
+// a string, a list of strings, or npm's legacy {"type": ...} object
+func jsonLicense(data []byte) string {
+	var manifest struct {
+		License json.RawMessage `json:"license"`
+	}
+	if json.Unmarshal(data, &manifest) != nil || manifest.License == nil {
+		return ""
+	}
+	var license string
+	if json.Unmarshal(manifest.License, &license) == nil {
+		return license
+	}
+	var licenses []string
+	if json.Unmarshal(manifest.License, &licenses) == nil {
+		return strings.Join(licenses, " OR ")
+	}
+	var legacy struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(manifest.License, &legacy)
+	return legacy.Type
+}
+
+// tomlLicensePattern matches a license = "..." line, or PEP 621's
+// license = {text = "..."}
+var tomlLicensePattern = regexp.MustCompile(`(?m)^license\s*=\s*(?:\{\s*text\s*=\s*)?"([^"]+)"`)
+
+// tomlLicense returns the license declared in a Cargo.toml or pyproject.toml
+func tomlLicense(text string) string {
+	if match := tomlLicensePattern.FindStringSubmatch(text); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// goRequirePattern matches a requirement in go.mod, inside or outside a
+// require block
+var goRequirePattern = regexp.MustCompile(`^(?:require\s+)?([^\s()]+)\s+(v\S+)`)
+
+// GoRequirement is a module go.mod requires
+type GoRequirement struct {
+	Module  string
+	Version string
+}
+
+// goRequirements returns the requirements of a go.mod file, inside or
+// outside require blocks
+func goRequirements(data []byte) []GoRequirement {
+	var requirements []GoRequirement
+	inRequire := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "require ("), strings.HasPrefix(line, "require("):
+			inRequire = true
+			continue
+		case inRequire && strings.HasPrefix(line, ")"):
+			inRequire = false
+			continue
+		case !inRequire && !strings.HasPrefix(line, "require "):
+			continue
+		}
+		if match := goRequirePattern.FindStringSubmatch(line); match != nil {
+			requirements = append(requirements, GoRequirement{Module: match[1], Version: match[2]})
+		}
+	}
+	return requirements
+}
+
+// goDependencyLicenses reads the license files of the modules go.mod
+// requires, from the vendor directory if there is one and otherwise from the
+// module cache
+func goDependencyLicenses(directory string) []DependencyLicense {
+	data, err := os.ReadFile(filepath.Join(directory, "go.mod"))
+	if err != nil {
+		return nil
+	}
+	vendor := filepath.Join(directory, "vendor")
+	if info, err := os.Stat(vendor); err != nil || !info.IsDir() {
+		vendor = ""
+	}
+	cache := goModCache()
+
+	var dependencies []DependencyLicense
+	for _, requirement := range goRequirements(data) {
+		if len(dependencies) >= LICENSE_MAX_DEPENDENCIES {
+			break
+		}
+		dir := filepath.Join(vendor, filepath.FromSlash(requirement.Module))
+		if vendor == "" {
+			if cache == "" {
+				break
+			}
+			dir = filepath.Join(cache, filepath.FromSlash(escapeModulePath(requirement.Module))+"@"+requirement.Version)
+		}
+		if license, ok := dirLicense(dir); ok {
+			dependencies = append(dependencies, DependencyLicense{Name: requirement.Module, Version: requirement.Version, License: license, Source: "go module", Copyleft: isCopyleft(license)})
+		}
+	}
+	return dependencies
+}
+
+// goModCache returns the Go module cache directory as the go command would
+// find it, without running it
+func goModCache() string {
+	if cache := os.Getenv("GOMODCACHE"); cache != "" {
+		return cache
+	}
+	if gopath := os.Getenv("GOPATH"); gopath != "" {
+		return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, "go", "pkg", "mod")
+	}
+	return ""
+}
+
+// escapeModulePath escapes a module path as the module cache does on
+// case-insensitive file systems: each upper-case letter becomes "!" and the
+// lower-case letter
+func escapeModulePath(module string) string {
+	var b strings.Builder
+	for _, r := range module {
+		if unicode.IsUpper(r) {
+			b.WriteRune('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// dirLicense identifies the license of the first license file in dir,
+// returning false if dir has none
+func dirLicense(dir string) (string, bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && isLicenseFile(entry.Name()) {
+			license, _ := identifyLicenseFile(filepath.Join(dir, entry.Name()))
+			return license, true
+		}
+	}
+	return "", false
+}
+
+// nodeDependencyLicenses reads the licenses of the packages package.json
+// depends on (not its devDependencies) from node_modules
+func nodeDependencyLicenses(directory string) []DependencyLicense {
+	data, err := os.ReadFile(filepath.Join(directory, "package.json"))
+	if err != nil {
+		return nil
+	}
+	var manifest struct {
+		Dependencies map[string]string `json:"dependencies"`
+	}
+	if json.Unmarshal(data, &manifest) != nil {
+		return nil
+	}
+	names := make([]string, 0, len(manifest.Dependencies))
+	for name := range manifest.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var dependencies []DependencyLicense
+	for _, name := range names[:min(len(names), LICENSE_MAX_DEPENDENCIES)] {
+		dir := filepath.Join(directory, "node_modules", filepath.FromSlash(name))
+		data, err := os.ReadFile(filepath.Join(dir, "package.json"))
+		if err != nil {
+			continue
+		}
+		var pkg struct {
+			Version string `json:"version"`
+		}
+		json.Unmarshal(data, &pkg)
+		license := jsonLicense(data)
+		if license == "" {
+			if license, _ = dirLicense(dir); license == "" {
+				license = LicenseUnknown
+			}
+		}
+		dependencies = append(dependencies, DependencyLicense{Name: name, Version: pkg.Version, License: license, Source: "node_modules", Copyleft: isCopyleft(license)})
+	}
+	return dependencies
+}
+
+// pythonDependencyLicenses reads the licenses of the packages installed in
+// the project's virtual environment (.venv or venv) from their metadata:
+// License-Expression, else a short License field, else the license
+// classifier
+func pythonDependencyLicenses(directory string) []DependencyLicense {
+	var metadataFiles []string
+	for _, venv := range []string{".venv", "venv"} {
+		matches, _ := filepath.Glob(filepath.Join(directory, venv, "lib", "python*", "site-packages", "*.dist-info", "METADATA"))
+		metadataFiles = append(metadataFiles, matches...)
+		windows, _ := filepath.Glob(filepath.Join(directory, venv, "Lib", "site-packages", "*.dist-info", "METADATA"))
+		metadataFiles = append(metadataFiles, windows...)
+	}
+
+	var dependencies []DependencyLicense
+	for _, path := range metadataFiles[:min(len(metadataFiles), LICENSE_MAX_DEPENDENCIES)] {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		dependency := DependencyLicense{Source: "python environment"}
+		var expression, field, classifier string
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				break // the description follows the headers
+			}
+			key, value, _ := strings.Cut(line, ": ")
+			switch key {
+			case "Name":
+				dependency.Name = value
+			case "Version":
+				dependency.Version = value
+			case "License-Expression":
+				expression = value
+			case "License":
+				field = value
+			case "Classifier":
+				if strings.HasPrefix(value, "License :: ") {
+					classifier = value[strings.LastIndex(value, " :: ")+4:]
+				}
+			}
+		}
+		file.Close()
+		switch {
+		case expression != "":
+			dependency.License = expression
+		case field != "" && len(field) <= 60 && !strings.EqualFold(field, "UNKNOWN"):
+			dependency.License = field
+		case classifier != "":
+			dependency.License = classifier
+		default:
+			dependency.License = LicenseUnknown
+		}
+		dependency.Copyleft = isCopyleft(dependency.License) || strings.Contains(dependency.License, "General Public License")
+		dependencies = append(dependencies, dependency)
+	}
+	return dependencies
+}
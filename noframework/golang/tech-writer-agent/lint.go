@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Files scanned when building the allow-list of repository identifiers
+	LINT_VOCAB_MAX_FILES = 2000
+	// Bytes read from each file when building the allow-list
+	LINT_VOCAB_MAX_BYTES = 256 * 1024
+)
+
+// Finding kinds reported by lintDocument
+const (
+	LintSpelling    = "spelling"    // known misspelling, fixable
+	LintTerminology = "terminology" // wrong capitalisation of a product or standard, fixable
+	LintUnknown     = "unknown"     // not in the dictionary or the repo; reported only
+)
+
+// LintFinding is one spelling or terminology problem in the generated document
+type LintFinding struct {
+	Line       int    `json:"line"`   // 1-based
+	Column     int    `json:"column"` // 1-based byte offset
+	Word       string `json:"word"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Kind       string `json:"kind"`
+}
+
+// commonMisspellings maps frequent misspellings in technical prose to their
+// correct spelling
+var commonMisspellings = map[string]string{
+	"accomodate":    "accommodate",
+	"acheive":       "achieve",
+	"adress":        "address",
+	"aquire":        "acquire",
+	"arguement":     "argument",
+	"asynchonous":   "asynchronous",
+	"begining":      "beginning",
+	"calender":      "calendar",
+	"commited":      "committed",
+	"compatability": "compatibility",
+	"compatable":    "compatible",
+	"concurent":     "concurrent",
+	"definately":    "definitely",
+	"dependancy":    "dependency",
+	"dependancies":  "dependencies",
+	"enviroment":    "environment",
+	"existant":      "existent",
+	"explicitely":   "explicitly",
+	"follwing":      "following",
+	"funtion":       "function",
+	"funtionality":  "functionality",
+	"implmentation": "implementation",
+	"independant":   "independent",
+	"initalize":     "initialize",
+	"intialize":     "initialize",
+	"lenght":        "length",
+	"occured":       "occurred",
+	"occurence":     "occurrence",
+	"paramater":     "parameter",
+	"paramter":      "parameter",
+	"persistant":    "persistent",
+	"posible":       "possible",
+	"prefered":      "preferred",
+	"proccess":      "process",
+	"recieve":       "receive",
+	"recieved":      "received",
+	"reponse":       "response",
+	"retreive":      "retrieve",
+	"seperate":      "separate",
+	"seperately":    "separately",
+	"sucessful":     "successful",
+	"succesful":     "successful",
+	"successfull":   "successful",
+	"teh":           "the",
+	"transfered":    "transferred",
+	"untill":        "until",
+	"usefull":       "useful",
+	"wich":          "which",
+	"writen":        "written",
+}
+
+// terminology maps the lower-case form of product and standard names to their
+// canonical spelling
+var terminology = map[string]string{
+	"apis":        "APIs",
+	"css":         "CSS",
+	"github":      "GitHub",
+	"gitlab":      "GitLab",
+	"graphql":     "GraphQL",
+	"html":        "HTML",
+	"javascript":  "JavaScript",
+	"json":        "JSON",
+	"macos":       "macOS",
+	"mongodb":     "MongoDB",
+	"mysql":       "MySQL",
+	"npm":         "npm",
+	"oauth":       "OAuth",
+	"openai":      "OpenAI",
+	"postgresql":  "PostgreSQL",
+	"pypi":        "PyPI",
+	"sql":         "SQL",
+	"typescript":  "TypeScript",
+	"urls":        "URLs",
+	"webassembly": "WebAssembly",
+	"websocket":   "WebSocket",
+	"websockets":  "WebSockets",
+	"yaml":        "YAML",
+}
+
+var (
+	// Prose that must not be linted: inline code, URLs and link targets
+	lintMaskPattern = regexp.MustCompile("`[^`]*`|https?://\\S+|\\]\\([^)]*\\)")
+	// Candidate tokens, including path and identifier characters so that
+	// file names and identifiers can be recognised and skipped
+	lintTokenPattern = regexp.MustCompile(`[A-Za-z0-9_'./-]+`)
+	lintWordPattern  = regexp.MustCompile(`^[A-Za-z]+('[A-Za-z]+)?$`)
+	identPattern     = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+	// Boundaries between the parts of camelCase and snake_case identifiers
+	identPartPattern = regexp.MustCompile(`[A-Z]+[a-z]*|[a-z]+`)
+)
+
+// repoVocabulary builds the lint allow-list from the repository: file and
+// directory names plus every identifier (and its camelCase/snake_case parts)
+// found in its text files
+func repoVocabulary(directory string) (map[string]bool, error) {
+	files, err := listFiles(directory, DefaultWalkOptions())
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > LINT_VOCAB_MAX_FILES {
+		files = files[:LINT_VOCAB_MAX_FILES]
+	}
+
+	vocab := make(map[string]bool)
+	add := func(ident string) {
+		vocab[ident] = true
+		for _, part := range identPartPattern.FindAllString(ident, -1) {
+			vocab[strings.ToLower(part)] = true
+		}
+	}
+	absDir, _ := filepath.Abs(directory)
+	for _, path := range files {
+		if rel, err := filepath.Rel(absDir, path); err == nil {
+			for _, name := range strings.Split(filepath.ToSlash(rel), "/") {
+				for _, ident := range identPattern.FindAllString(name, -1) {
+					add(ident)
+				}
+			}
+		}
+		if isBinary(path) {
+			continue
+		}
+		content, err := readPrefix(path, LINT_VOCAB_MAX_BYTES)
+		if err != nil {
+			continue
+		}
+		for _, ident := range identPattern.FindAllString(content, -1) {
+			add(ident)
+		}
+	}
+	return vocab, nil
+}
+
+// readPrefix returns at most limit bytes from the start of the file at path
+func readPrefix(path string, limit int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, limit)
+	n, err := file.Read(buf)
+	if err != nil && n == 0 {
+		return "", err
+	}
+	return string(buf[:n]), nil
+}
+
+// loadWordList reads a dictionary with one word per line, such as
+// /usr/share/dict/words
+func loadWordList(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening dictionary: %w", err)
+	}
+	defer file.Close()
+
+	words := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if word := strings.TrimSpace(scanner.Text()); word != "" {
+			words[strings.ToLower(word)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading dictionary: %w", err)
+	}
+	return words, nil
+}
+
+// lintDocument reports misspellings and terminology problems in the prose of
+// a Markdown document. Code blocks, inline code, URLs, file names and
+// identifiers are skipped, as is any word in allow. When dictionary is
+// non-nil, words found in neither it nor allow are reported as unknown.
+func lintDocument(document string, allow, dictionary map[string]bool) []LintFinding {
+	var findings []LintFinding
+	inFence := false
+	for i, line := range strings.Split(document, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		// Blank out unlintable spans without moving the remaining text
+		masked := lintMaskPattern.ReplaceAllStringFunc(line, func(span string) string {
+			return strings.Repeat(" ", len(span))
+		})
+		for _, loc := range lintTokenPattern.FindAllStringIndex(masked, -1) {
+			word := strings.TrimRight(masked[loc[0]:loc[1]], ".'-")
+			word = strings.TrimLeft(word, "'")
+			if !lintWordPattern.MatchString(word) {
+				continue // a path, identifier, number or version
+			}
+			column := strings.Index(masked[loc[0]:], word) + loc[0] + 1
+			if finding, ok := lintWord(word, allow, dictionary); ok {
+				finding.Line = i + 1
+				finding.Column = column
+				findings = append(findings, finding)
+			}
+		}
+	}
+	return findings
+}
+
+// lintWord checks a single prose word
+func lintWord(word string, allow, dictionary map[string]bool) (LintFinding, bool) {
+	if allow[word] {
+		return LintFinding{}, false
+	}
+	lower := strings.ToLower(word)
+	if canonical, ok := terminology[lower]; ok {
+		if word == canonical {
+			return LintFinding{}, false
+		}
+		return LintFinding{Word: word, Suggestion: canonical, Kind: LintTerminology}, true
+	}
+	if allow[lower] {
+		return LintFinding{}, false
+	}
+	if correct, ok := commonMisspellings[lower]; ok {
+		return LintFinding{Word: word, Suggestion: matchCase(word, correct), Kind: LintSpelling}, true
+	}
+	// Acronyms and very short words are too often legitimate to report
+	if dictionary != nil && len(word) > 2 && word != strings.ToUpper(word) && !dictionary[lower] {
+		return LintFinding{Word: word, Kind: LintUnknown}, true
+	}
+	return LintFinding{}, false
+}
+
+// matchCase capitalises replacement when word starts with a capital letter
+func matchCase(word, replacement string) string {
+	if word == "" || replacement == "" || !unicode.IsUpper(rune(word[0])) {
+		return replacement
+	}
+	return strings.ToUpper(replacement[:1]) + replacement[1:]
+}
+
+// applyLintFixes replaces every finding that has a suggestion and returns the
+// corrected document and the number of fixes made
+func applyLintFixes(document string, findings []LintFinding) (string, int) {
+	lines := strings.Split(document, "\n")
+	// Apply right to left so earlier columns on the same line stay valid
+	sorted := append([]LintFinding(nil), findings...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Line != sorted[j].Line {
+			return sorted[i].Line < sorted[j].Line
+		}
+		return sorted[i].Column > sorted[j].Column
+	})
+
+	fixed := 0
+	for _, finding := range sorted {
+		if finding.Suggestion == "" || finding.Line < 1 || finding.Line > len(lines) {
+			continue
+		}
+		line := lines[finding.Line-1]
+		start := finding.Column - 1
+		end := start + len(finding.Word)
+		if start < 0 || end > len(line) || line[start:end] != finding.Word {
+			continue
+		}
+		lines[finding.Line-1] = line[:start] + finding.Suggestion + line[end:]
+		fixed++
+	}
+	return strings.Join(lines, "\n"), fixed
+}
@@ -2,25 +2,40 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"strings"
 	"time"
 )
 
+// Timeout for a single provider request
+const LLM_REQUEST_TIMEOUT = 300 * time.Second
+
 // LLMClient interface for different LLM providers
 type LLMClient interface {
 	Complete(prompt string, systemPrompt string, temperature float32) (string, error)
 }
 
+// LLMOptions holds provider-independent request settings
+type LLMOptions struct {
+	// Seed requests deterministic sampling from providers that support it
+	Seed *int
+}
+
 // OpenAIClient implements LLMClient for OpenAI API
 type OpenAIClient struct {
 	apiKey  string
 	model   string
 	baseURL string
+	opts    LLMOptions
+	http    *http.Client
 }
 
 // GeminiClient implements LLMClient for Google Gemini API
@@ -28,10 +43,12 @@ type GeminiClient struct {
 	apiKey  string
 	model   string
 	baseURL string
+	opts    LLMOptions
+	http    *http.Client
 }
 
 // NewLLMClient creates an appropriate LLM client based on the model name
-func NewLLMClient(modelName string, baseURL string) (LLMClient, error) {
+func NewLLMClient(modelName string, baseURL string, opts LLMOptions) (LLMClient, error) {
 	// Parse vendor/model format
 	parts := strings.Split(modelName, "/")
 	if len(parts) != 2 {
@@ -50,10 +67,16 @@ func NewLLMClient(modelName string, baseURL string) (LLMClient, error) {
 		if baseURL == "" {
 			baseURL = "https://api.openai.com/v1"
 		}
+		httpClient, err := providerHTTPClient("OPENAI")
+		if err != nil {
+			return nil, err
+		}
 		return &OpenAIClient{
 			apiKey:  apiKey,
 			model:   model,
 			baseURL: baseURL,
+			opts:    opts,
+			http:    httpClient,
 		}, nil
 		
 	case "google":
@@ -64,10 +87,20 @@ func NewLLMClient(modelName string, baseURL string) (LLMClient, error) {
 		if baseURL == "" {
 			baseURL = "https://generativelanguage.googleapis.com/v1beta/openai"
 		}
+		if opts.Seed != nil {
+			log.Printf("Seed is not sent to Gemini's OpenAI-compatible endpoint and will be ignored")
+			opts.Seed = nil
+		}
+		httpClient, err := providerHTTPClient("GEMINI")
+		if err != nil {
+			return nil, err
+		}
 		return &GeminiClient{
 			apiKey:  apiKey,
 			model:   model,
 			baseURL: baseURL,
+			opts:    opts,
+			http:    httpClient,
 		}, nil
 		
 	default:
@@ -80,6 +113,7 @@ type OpenAIRequest struct {
 	Model       string                 `json:"model"`
 	Messages    []OpenAIMessage        `json:"messages"`
 	Temperature float32                `json:"temperature"`
+	Seed        *int                   `json:"seed,omitempty"`
 }
 
 type OpenAIMessage struct {
@@ -91,6 +125,7 @@ type OpenAIResponse struct {
 	Choices []struct {
 		Message OpenAIMessage `json:"message"`
 	} `json:"choices"`
+	Usage *TokenUsage `json:"usage,omitempty"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
@@ -99,109 +134,261 @@ type OpenAIResponse struct {
 
 // Complete implements the LLMClient interface for OpenAI
 func (c *OpenAIClient) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
+	return chatCompletion(c.http, c.baseURL, c.apiKey, c.model, c.opts, prompt, systemPrompt, temperature)
+}
+
+// Complete implements the LLMClient interface for Gemini
+func (c *GeminiClient) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
+	// Gemini uses the same OpenAI-compatible API through the compatibility endpoint
+	return chatCompletion(c.http, c.baseURL, c.apiKey, c.model, c.opts, prompt, systemPrompt, temperature)
+}
+
+// chatCompletion sends a single-turn request to an OpenAI-compatible
+// /chat/completions endpoint and returns the first choice's content
+func chatCompletion(client *http.Client, baseURL, apiKey, model string, opts LLMOptions, prompt string, systemPrompt string, temperature float32) (string, error) {
 	messages := []OpenAIMessage{
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: prompt},
 	}
 	
 	reqBody := OpenAIRequest{
-		Model:       c.model,
+		Model:       model,
 		Messages:    messages,
 		Temperature: temperature,
+		Seed:        opts.Seed,
 	}
 	
-	jsonData, err := json.Marshal(reqBody)
+	var openAIResp OpenAIResponse
+	if err := postJSON(client, baseURL+"/chat/completions", apiKey, reqBody, &openAIResp); err != nil {
+		return "", err
+	}
+	recordUsage(openAIResp.Usage)
+	
+	if openAIResp.Error != nil {
+		return "", fmt.Errorf("API error: %s", openAIResp.Error.Message)
+	}
+	
+	if len(openAIResp.Choices) == 0 {
+		return "", fmt.Errorf("no response choices returned")
+	}
+	
+	return openAIResp.Choices[0].Message.Content, nil
+}
+
+// postJSON POSTs payload as JSON to url with bearer authentication and decodes
+// the response body into out
+func postJSON(client *http.Client, url, apiKey string, payload interface{}, out interface{}) error {
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %w", err)
+		return fmt.Errorf("error marshaling request: %w", err)
 	}
 	
-	req, err := http.NewRequest("POST", c.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+		return fmt.Errorf("error creating request: %w", err)
 	}
 	
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	req.Header.Set("Authorization", "Bearer "+apiKey)
 	
-	client := &http.Client{Timeout: 300 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error making request: %w", err)
+		return fmt.Errorf("error making request: %w", err)
 	}
 	defer resp.Body.Close()
 	
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("error reading response: %w", err)
+		return fmt.Errorf("error reading response: %w", err)
 	}
 	
-	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return "", fmt.Errorf("error parsing response: %w", err)
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
 	}
-	
-	if openAIResp.Error != nil {
-		return "", fmt.Errorf("API error: %s", openAIResp.Error.Message)
+	return nil
+}
+
+// providerHTTPClient returns the HTTP client for a provider, configured from
+// <PREFIX>_CA_CERT (PEM bundle trusted in addition to the system roots) and
+// <PREFIX>_CLIENT_CERT / <PREFIX>_CLIENT_KEY (PEM client certificate and key
+// for mutual TLS), for traffic routed through an internal gateway. Requests
+// are recorded in the audit log when one is open.
+func providerHTTPClient(prefix string) (*http.Client, error) {
+	transport, err := providerTransport(prefix)
+	if err != nil {
+		return nil, err
 	}
-	
-	if len(openAIResp.Choices) == 0 {
-		return "", fmt.Errorf("no response choices returned")
+	if auditLog != nil {
+		transport = &auditTransport{base: transport, provider: strings.ToLower(prefix), log: auditLog}
 	}
-	
-	return openAIResp.Choices[0].Message.Content, nil
+	return &http.Client{Timeout: LLM_REQUEST_TIMEOUT, Transport: transport}, nil
 }
 
-// Complete implements the LLMClient interface for Gemini
-func (c *GeminiClient) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
-	// Gemini uses the same OpenAI-compatible API through the compatibility endpoint
-	messages := []OpenAIMessage{
-		{Role: "system", Content: systemPrompt},
-		{Role: "user", Content: prompt},
+// providerTransport returns the TLS transport configured by the provider's
+// certificate variables (see providerHTTPClient)
+func providerTransport(prefix string) (http.RoundTripper, error) {
+	caFile := os.Getenv(prefix + "_CA_CERT")
+	certFile := os.Getenv(prefix + "_CLIENT_CERT")
+	keyFile := os.Getenv(prefix + "_CLIENT_KEY")
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return http.DefaultTransport, nil
 	}
 	
-	reqBody := OpenAIRequest{
-		Model:       c.model,
-		Messages:    messages,
-		Temperature: temperature,
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s_CA_CERT: %w", prefix, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s_CA_CERT %s contains no PEM certificates", prefix, caFile)
+		}
+		tlsConfig.RootCAs = pool
 	}
-	
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("error marshaling request: %w", err)
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("%s_CLIENT_CERT and %s_CLIENT_KEY must be set together", prefix, prefix)
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading %s client certificate: %w", prefix, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 	
-	req, err := http.NewRequest("POST", c.baseURL+"/chat/completions", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// Embedder is implemented by clients whose provider offers an embeddings endpoint
+type Embedder interface {
+	Embed(texts []string) ([][]float64, error)
+}
+
+// OpenAI embeddings API structures
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type EmbeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Usage *TokenUsage `json:"usage,omitempty"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Embed implements the Embedder interface for OpenAI
+func (c *OpenAIClient) Embed(texts []string) ([][]float64, error) {
+	return embeddings(c.http, c.baseURL, c.apiKey, c.model, texts)
+}
+
+// Embed implements the Embedder interface for Gemini
+func (c *GeminiClient) Embed(texts []string) ([][]float64, error) {
+	return embeddings(c.http, c.baseURL, c.apiKey, c.model, texts)
+}
+
+// embeddings calls an OpenAI-compatible /embeddings endpoint, returning one
+// vector per input text in input order
+func embeddings(client *http.Client, baseURL, apiKey, model string, texts []string) ([][]float64, error) {
+	var resp EmbeddingResponse
+	if err := postJSON(client, baseURL+"/embeddings", apiKey, EmbeddingRequest{Model: model, Input: texts}, &resp); err != nil {
+		return nil, err
 	}
-	
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	
-	client := &http.Client{Timeout: 300 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error making request: %w", err)
+	recordUsage(resp.Usage)
+	if resp.Error != nil {
+		return nil, fmt.Errorf("API error: %s", resp.Error.Message)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
 	}
-	defer resp.Body.Close()
 	
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("error reading response: %w", err)
+	vectors := make([][]float64, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding index %d out of range", item.Index)
+		}
+		vectors[item.Index] = item.Embedding
+	}
+	return vectors, nil
+}
+
+// ImageDescriber is implemented by clients whose provider accepts images in
+// chat requests
+type ImageDescriber interface {
+	DescribeImage(prompt string, mimeType string, image []byte) (string, error)
+}
+
+// OpenAI vision request structures: the user message's content is a list of
+// text and image parts
+type VisionRequest struct {
+	Model       string          `json:"model"`
+	Messages    []VisionMessage `json:"messages"`
+	Temperature float32         `json:"temperature"`
+	Seed        *int            `json:"seed,omitempty"`
+}
+
+type VisionMessage struct {
+	Role    string          `json:"role"`
+	Content []VisionContent `json:"content"`
+}
+
+type VisionContent struct {
+	Type     string `json:"type"` // text or image_url
+	Text     string `json:"text,omitempty"`
+	ImageURL *VisionImageURL `json:"image_url,omitempty"`
+}
+
+type VisionImageURL struct {
+	URL string `json:"url"` // a data: URL
+}
+
+// DescribeImage implements the ImageDescriber interface for OpenAI
+func (c *OpenAIClient) DescribeImage(prompt string, mimeType string, image []byte) (string, error) {
+	return visionCompletion(c.http, c.baseURL, c.apiKey, c.model, c.opts, prompt, mimeType, image)
+}
+
+// DescribeImage implements the ImageDescriber interface for Gemini
+func (c *GeminiClient) DescribeImage(prompt string, mimeType string, image []byte) (string, error) {
+	return visionCompletion(c.http, c.baseURL, c.apiKey, c.model, c.opts, prompt, mimeType, image)
+}
+
+// visionCompletion sends prompt and an image, inlined as a data URL, to an
+// OpenAI-compatible /chat/completions endpoint and returns the first choice's
+// content. Models without vision support answer with an API error.
+func visionCompletion(client *http.Client, baseURL, apiKey, model string, opts LLMOptions, prompt string, mimeType string, image []byte) (string, error) {
+	dataURL := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(image)
+	reqBody := VisionRequest{
+		Model: model,
+		Messages: []VisionMessage{
+			{Role: "user", Content: []VisionContent{
+				{Type: "text", Text: prompt},
+				{Type: "image_url", ImageURL: &VisionImageURL{URL: dataURL}},
+			}},
+		},
+		Seed: opts.Seed,
 	}
 	
 	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return "", fmt.Errorf("error parsing response: %w", err)
+	if err := postJSON(client, baseURL+"/chat/completions", apiKey, reqBody, &openAIResp); err != nil {
+		return "", err
 	}
+	recordUsage(openAIResp.Usage)
 	
 	if openAIResp.Error != nil {
 		return "", fmt.Errorf("API error: %s", openAIResp.Error.Message)
 	}
-	
 	if len(openAIResp.Choices) == 0 {
 		return "", fmt.Errorf("no response choices returned")
 	}
-	
 	return openAIResp.Choices[0].Message.Content, nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// LanguageStats counts the files and lines of one language
+type LanguageStats struct {
+	Language   string   `json:"language"`
+	Files      int      `json:"files"`
+	Lines      int      `json:"lines"`
+	BlankLines int      `json:"blank_lines"`
+	Extensions []string `json:"extensions,omitempty"`
+}
+
+// LOCResult represents the size of a codebase by language
+type LOCResult struct {
+	Files       int             `json:"files"`
+	Lines       int             `json:"lines"`
+	BinaryFiles int             `json:"binary_files"` // counted in files, not in any language
+	Languages   []LanguageStats `json:"languages"`    // largest first
+}
+
+// countLOC implements the count_loc tool: it counts files and lines per
+// language over the files find_all_matching_files would list
+func countLOC(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	opts := DefaultWalkOptions()
+	if val, ok := args["pattern"].(string); ok && val != "" {
+		opts.Pattern = val
+	}
+
+	files, err := listFiles(directory, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := LOCResult{Languages: []LanguageStats{}}
+	byLanguage := make(map[string]*LanguageStats)
+	for _, file := range files {
+		result.Files++
+		if isBinary(file) {
+			result.BinaryFiles++
+			continue
+		}
+		lines, blank, err := countFileLines(file)
+		if err != nil {
+			continue // Skip files we can't read, as listFiles does
+		}
+
+		ext := strings.ToLower(filepath.Ext(file))
+		language := detectLanguage(file)
+		if language == "" {
+			language = "Other"
+		}
+		stats, ok := byLanguage[language]
+		if !ok {
+			stats = &LanguageStats{Language: language}
+			byLanguage[language] = stats
+		}
+		stats.Files++
+		stats.Lines += lines
+		stats.BlankLines += blank
+		if ext != "" && !slices.Contains(stats.Extensions, ext) {
+			stats.Extensions = append(stats.Extensions, ext)
+		}
+		result.Lines += lines
+	}
+
+	for _, stats := range byLanguage {
+		sort.Strings(stats.Extensions)
+		result.Languages = append(result.Languages, *stats)
+	}
+	sort.Slice(result.Languages, func(i, j int) bool {
+		a, b := result.Languages[i], result.Languages[j]
+		if a.Lines != b.Lines {
+			return a.Lines > b.Lines
+		}
+		return a.Language < b.Language
+	})
+	return result, nil
+}
+
+// countFileLines counts the lines of a file and how many of them are blank
+func countFileLines(path string) (lines, blank int, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			lines++
+			if strings.TrimSpace(line) == "" {
+				blank++
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	return lines, blank, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LOCAL_REPO_OWNER is the cache directory holding clones of repositories on
+// disk, in place of a GitHub owner
+const LOCAL_REPO_OWNER = "local"
+
+// localRepoURL returns the file:// URL of the git repository on disk that
+// repo names, as a file:// URL or a path to a bare repository or a work
+// tree, or false if it names none. Cloning from the URL rather than the path
+// keeps the clone shallow, as it is from GitHub.
+func localRepoURL(repo string) (string, bool) {
+	dir := expandHome(repo)
+	if strings.HasPrefix(repo, "file://") {
+		parsed, err := url.Parse(repo)
+		if err != nil || (parsed.Host != "" && parsed.Host != "localhost") {
+			return "", false
+		}
+		dir = filepath.FromSlash(parsed.Path)
+	} else if strings.Contains(repo, "://") {
+		return "", false
+	}
+	if !isBareRepo(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+			return "", false
+		}
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", false
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absDir)}).String(), true
+}
+
+// isBareRepo reports whether dir is a bare git repository, such as a mirror
+// made with git clone --mirror
+func isBareRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// localRepoName returns the cache name of the repository at a file:// URL:
+// local/ and its directory's name, with a hash of its path telling apart
+// mirrors of the same name
+func localRepoName(fileURL string) string {
+	repoPath := strings.TrimSuffix(strings.TrimPrefix(fileURL, "file://"), "/")
+	return LOCAL_REPO_OWNER + "/" + strings.TrimSuffix(path.Base(repoPath), ".git") + "-" + shortHash(repoPath)[:8]
+}
@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,53 +18,824 @@ type Args struct {
 	Directory  string
 	Repo       string
 	PromptFile string
+	Preset     string // a built-in task, see presets; PromptFile is then optional
+	C4Syntax   string // C4Mermaid or C4Structurizr, the diagrams of PresetC4
 	Model      string
 	BaseURL    string
 	CacheDir   string
 	OutputDir  string
 	Extension  string
 	FileName   string
+	Format     string // FormatMarkdown, FormatHTML to render the result as a page, or FormatJSON
 	EvalPrompt string
+
+	Ref          string        // branch, tag or commit of Repo to analyse; "" is the default branch
+	Refresh      bool          // update a cached clone before analysing it
+	NoCache      bool          // clone into a temporary directory, removed afterwards
+	Quiet        bool          // don't show clone progress
+	CloneTimeout time.Duration // limit on cloning or refreshing Repo; 0 is none
+	Subdir       string        // directory of Repo to analyse
+	Sparse       bool          // check out and download only the directories the analysis needs
+	CacheMaxAge  time.Duration // evict clones unused for longer; 0 keeps them
+	CacheMaxSize int64         // evict the least recently used clones above this size; 0 keeps them
+	FromRef      string        // document the changes since this ref rather than the whole code base
+	ToRef        string        // ...up to this ref; "" is the analysed commit
+	DiffRange    *DiffRange    // FromRef and ToRef resolved
+	Incremental  bool          // update the last run's document for the changes since
+	Update       *UpdatePlan   // the last run and the changes, if there is one to update
+	Compare      string        // second code base to compare with: a directory or GitHub repository
+	Comparison   *Comparison   // Compare resolved
+	Roots        []Root        // the labeled directories of a --compare run or of several positional ones
+	Package      string        // workspace package to analyse, by name or directory
+
+	IterationTimeout time.Duration
+	MaxIterations    int // fixed iteration cap; 0 derives it from repository size
+	MinIterations    int
+	MaxIterCeiling   int
+	TraceFile        string
+	ReplayFile       string
+	Interactive      bool
+	Seed             *int
+	Provenance       bool
+	MaxDuration      time.Duration
+	EmbedSynthesis   bool
+	EmbeddingModel   string
+	AgentType        string
+	Framework        string
+	Chat             bool
+	Style            string
+	StyleModel       string
+	Lint             string
+	LintDictionary   string
+	Attribution      string
+	Progress         bool
+	AuditLog         string
+	ReviewModel      string
+	PostErrors       string
+	RepoMap          bool
+	AutoRetry        bool
+	RetryModel       string
+	Memory           bool
+	RepoInfoHeader   bool
+	Diagrams         bool
+	SplitOutput      bool
+	Site             string        // SiteMkDocs or SiteDocusaurus to also write a site project
+	Publish          string        // PublishWiki to push the pages to the repository's wiki
+	FrontMatter      bool
+	ReadmeMerge      bool          // merge the --preset readme result into the analysed README
+	Guardrails       string
+	FetchDomains     []string      // domains the fetch_url tool may fetch; none disables it
+	OSV              bool          // offer check_vulnerabilities, which sends dependency versions to OSV.dev
+	Include          []string      // globs the file tools are limited to; none means all files
+	Exclude          []string      // globs the file tools skip
+	IncludeGenerated bool          // show files .gitattributes marks linguist-vendored or linguist-generated
+	NoDefaultIgnores bool          // don't skip node_modules, build output and caches without a .gitignore
+	TextExtensions   []string      // always read as text
+	BinaryExtensions []string      // never read
+	MaxFileBytes     int64         // read_file returns the head and tail of larger files; 0 reads them in chunks
+	ScanSecrets      bool          // redact credentials in tool results before they reach the model
+	ConfigFile       string        // JSON configuration, e.g. of tool plugins
+	ToolTimeout      time.Duration // default limit of a tool call; 0 for none
+	ToolMaxOutput    int           // default limit of a tool's observation in bytes; 0 for none
+}
+
+// RunInfo describes how an analysis run went, for the metadata
+type RunInfo struct {
+	Iterations    int    // LLM turns used
+	MaxIterations int    // the iteration cap the run was given
+	Truncated     bool
+	Partial       bool   // the user stopped the run with Ctrl-C
+	Agent         Agent  // the agent that ran, for follow-up questions
+	Draft         string // the writer's document before --review-model corrected it
+}
+
+// subcommands run instead of an analysis when named by the first argument
+var subcommands = map[string]func(args []string) error{
+	"stale-check":    runStaleCheck,
+	"eval":           runEval,
+	"explain-ignore": runExplainIgnore,
+	"cache":          runCache,
+	"normalize":      runNormalize,
+	"packages":       runPackages,
 }
 
 func main() {
 	// Configure logging
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			return
+		}
+	}
+
+	// run returns rather than exits, so that its deferred cleanups run
+	os.Exit(run())
+}
+
+// run analyses the code base the command line names and returns the exit
+// status. It logs errors and returns 1 rather than calling log.Fatalf, which
+// would skip the deferred removal of temporary clones and the closing of the
+// audit log, plugins and trace.
+func run() int {
 	// Parse command line arguments
 	args, err := getCommandLineArgs()
 	if err != nil {
-		log.Fatalf("Error parsing arguments: %v", err)
+		log.Printf("Error parsing arguments: %v", err)
+		return 1
+	}
+
+	if args.AuditLog != "" {
+		if err := openAuditLog(args.AuditLog); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		defer auditLog.Close()
 	}
+	enableSecretScan(args.ScanSecrets)
+	setFileClassLists(args.TextExtensions, args.BinaryExtensions)
 
 	// Configure code base source
-	repoURL, directoryPath, err := configureCodeBaseSource(args.Repo, args.Directory, args.CacheDir)
+	clone := CloneOptions{Ref: args.Ref, Refresh: args.Refresh, NoCache: args.NoCache, Timeout: args.CloneTimeout}
+	if !args.Quiet {
+		clone.Progress = os.Stderr
+	}
+	if args.Sparse {
+		if clone.Sparse = sparseDirs(args.Subdir, args.Include); clone.Sparse == nil {
+			log.Printf("Error: -sparse needs -subdir or -include patterns starting with a directory, such as \"services/api/**\"")
+			return 1
+		}
+		log.Printf("Sparse checkout of %s", strings.Join(clone.Sparse, ", "))
+	}
+	repoURL, directoryPath, err := configureCodeBaseSource(args.Repo, args.Directory, args.CacheDir, args.Subdir, clone)
 	if err != nil {
-		log.Fatalf("Error configuring code base source: %v", err)
+		log.Printf("Error configuring code base source: %v", err)
+		return 1
+	}
+	if args.NoCache && repoURL != "" {
+		// The whole temporary clone, not just the directory analysed
+		cloneDir := directoryPath
+		if args.Subdir != "" {
+			cloneDir = strings.TrimSuffix(cloneDir, string(filepath.Separator)+filepath.Clean(args.Subdir))
+		}
+		defer removeCachedRepo(cloneDir)
+	}
+	if args.Package != "" {
+		packages, err := discoverPackages(directoryPath)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		pkg, ok := findPackage(packages, args.Package)
+		if !ok {
+			log.Printf("Error: no workspace package %q in %s; the packages command lists them", args.Package, directoryPath)
+			return 1
+		}
+		directoryPath = filepath.Join(directoryPath, filepath.FromSlash(pkg.Dir))
+		args.Subdir = pkg.Dir
+		log.Printf("Analysing the package %s in %s", pkg.Name, pkg.Dir)
+	}
+	// A changelog starts, by default, at the tag before the release
+	if args.Preset == PresetChangelog && args.FromRef == "" {
+		to := args.ToRef
+		if to == "" {
+			to = "HEAD"
+		}
+		tag, err := previousTag(directoryPath, to, repoURL != "")
+		if err != nil {
+			log.Printf("Error: no tag before %s to start the changelog at (%v); give -from-ref", to, err)
+			return 1
+		}
+		args.FromRef = tag
+	}
+	if args.FromRef != "" {
+		if args.DiffRange, err = resolveDiffRange(directoryPath, repoURL != "", args.FromRef, args.ToRef); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		log.Printf("Documenting the changes from %s (%s) to %s (%s)", args.DiffRange.From, args.DiffRange.FromCommit, args.DiffRange.To, args.DiffRange.ToCommit)
+	}
+	if args.Incremental {
+		update, err := planIncrementalUpdate(args.CacheDir, repoIdentity(repoURL, directoryPath), args.Subdir, args.Preset, args.PromptFile, directoryPath, repoURL != "")
+		switch {
+		case err != nil:
+			log.Printf("Error: %v", err)
+			return 1
+		case update == nil:
+			log.Printf("No earlier run to update; analysing the whole code base")
+		case update.Changes.FromCommit == "":
+			log.Printf("Nothing changed since the last run at %s; its document is current: %s", update.Previous.Commit, update.Previous.Document)
+			return 0
+		default:
+			args.Update = update
+			log.Printf("Updating %s for the changes since %s", update.Previous.Document, update.Previous.Commit)
+		}
+	}
+	if repoURL != "" && !args.NoCache && (args.CacheMaxAge > 0 || args.CacheMaxSize > 0) {
+		removed, err := pruneCache(args.CacheDir, args.CacheMaxAge, args.CacheMaxSize, directoryPath)
+		for _, repo := range removed {
+			log.Printf("Evicted %s (%s) from the cache", repo.Name, formatBytes(int(repo.Size)))
+		}
+		if err != nil {
+			log.Printf("Warning: pruning the cache: %v", err)
+		}
+	}
+	if err := setWalkScope(directoryPath, args.Include, args.Exclude, args.IncludeGenerated); err != nil {
+		log.Printf("Error: %v", err)
+		return 1
+	}
+	if args.Compare != "" {
+		compareClone := CloneOptions{Refresh: args.Refresh, NoCache: args.NoCache, Progress: clone.Progress, Timeout: clone.Timeout}
+		if args.Comparison, err = configureComparison(args.Compare, args.CacheDir, compareClone); err != nil {
+			log.Printf("Error configuring the code base to compare: %v", err)
+			return 1
+		}
+		if args.NoCache && args.Comparison.Repo != "" {
+			defer removeCachedRepo(args.Comparison.Directory)
+		}
+		args.Roots = []Root{
+			{Label: COMPARE_LABEL_A, Directory: directoryPath, Commit: gitHeadCommit(directoryPath)},
+			{Label: COMPARE_LABEL_B, Directory: args.Comparison.Directory, Commit: args.Comparison.Commit},
+		}
+		log.Printf("Comparing with %s (%s)", args.Compare, args.Comparison.Directory)
+	}
+	if len(args.Roots) > 0 {
+		for _, root := range args.Roots[1:] {
+			if err := addWalkScopeRoot(root.Directory); err != nil {
+				log.Printf("Error: %v", err)
+				return 1
+			}
+		}
+		if err := setRoots(args.Roots); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+	}
+	setDefaultIgnores(!args.NoDefaultIgnores)
+
+	// Add the tools and plugins declared in the configuration, and set the
+	// limits of tool calls
+	defaultLimits := ToolLimits{Timeout: args.ToolTimeout, MaxOutputBytes: args.ToolMaxOutput}
+	if defaultLimits.Timeout == 0 {
+		defaultLimits.Timeout = -1
+	}
+	if defaultLimits.MaxOutputBytes == 0 {
+		defaultLimits.MaxOutputBytes = -1
+	}
+	perToolLimits := make(map[string]ToolLimits)
+	var frontMatterConfig *FrontMatterConfig
+	if args.ConfigFile != "" {
+		config, err := loadConfig(args.ConfigFile)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		frontMatterConfig = config.FrontMatter
+		plugins, err := startPlugins(config.Plugins, directoryPath)
+		if err != nil {
+			log.Printf("Error starting plugins: %v", err)
+			return 1
+		}
+		for _, plugin := range plugins {
+			defer plugin.Close()
+		}
+		for _, tool := range config.Tools {
+			if _, exists := Tools[tool.Name]; exists {
+				log.Printf("Error: config tool %s already exists", tool.Name)
+				return 1
+			}
+			RegisterTool(newCommandTool(tool, directoryPath))
+		}
+		for name, limits := range config.ToolLimits {
+			perToolLimits[name], _ = limits.limits() // checked by loadConfig
+		}
+	}
+	setToolLimits(defaultLimits, perToolLimits)
+
+	var trace *TraceRecorder
+	if args.TraceFile != "" {
+		trace, err = NewTraceRecorder(args.TraceFile)
+		if err != nil {
+			log.Printf("Error creating trace: %v", err)
+			return 1
+		}
+		defer trace.Close()
 	}
 
 	// Analyze the codebase
-	analysisResult, repoName, _, err := analyzeCodebase(directoryPath, args.PromptFile, args.Model, args.BaseURL, repoURL)
+	interrupt := notifyInterrupt()
+	metrics := NewMetricsSink()
+	analysisResult, repoName, runInfo, err := analyzeCodebase(directoryPath, repoURL, args, trace, metrics, interrupt)
+	
+	// Retry a failed analysis once with more room
+	var attempts []RunAttempt
+	supersededResult := ""
+	if args.AutoRetry && needsRetry(runInfo, err) {
+		retry := retryArgs(args, runInfo)
+		log.Printf("Attempt 1 failed (%s); retrying with %s, up to %d iterations and a repository map", describeFailure(runInfo, err), retry.Model, retry.MaxIterations)
+		retryResult, retryRepoName, retryInfo, retryErr := analyzeCodebase(directoryPath, repoURL, retry, trace, metrics, interrupt)
+		attempts = []RunAttempt{newRunAttempt(args, runInfo, err), newRunAttempt(retry, retryInfo, retryErr)}
+		if retryErr == nil {
+			supersededResult = analysisResult
+			analysisResult, repoName, runInfo, err = retryResult, retryRepoName, retryInfo, nil
+		} else if err == nil {
+			log.Printf("Attempt 2 failed too, keeping the result of attempt 1: %v", retryErr)
+		}
+	}
 	if err != nil {
-		log.Fatalf("Error analyzing codebase: %v", err)
+		log.Printf("Error analyzing codebase: %v", err)
+		return 1
+	}
+	// After Ctrl-C, save what we have without further provider calls
+	stopping := isClosed(interrupt)
+
+	// Post-processing failures are recorded and never discard the result;
+	// --post-process-errors decides whether they fail the run at the end
+	var failures []string
+	postProcessFailed := func(step string, err error) {
+		log.Printf("Post-processing step %q failed: %v", step, err)
+		failures = append(failures, fmt.Sprintf("%s: %v", step, err))
+	}
+
+	// Check the diagrams, asking the model to fix those that don't parse
+	var diagramChecks []DiagramCheck
+	if args.Diagrams || args.Preset == PresetC4 {
+		var fixer LLMClient
+		if args.ReplayFile == "" && !stopping {
+			if fixer, err = NewLLMClient(args.Model, args.BaseURL, LLMOptions{Seed: args.Seed}); err != nil {
+				postProcessFailed("diagrams", err)
+			}
+		}
+		analysisResult, diagramChecks = checkDiagrams(analysisResult, fixer)
+	}
+
+	// Apply the style guide, keeping the original for review
+	unstyled := ""
+	if args.Style != "" && stopping {
+		log.Printf("Skipping the style rewrite after interrupt")
+	} else if args.Style != "" {
+		styled, err := styleResult(analysisResult, args)
+		if err != nil {
+			postProcessFailed("style", fmt.Errorf("keeping the unstyled result: %w", err))
+		} else {
+			unstyled, analysisResult = analysisResult, styled
+		}
+	}
+
+	// Check spelling and terminology
+	var lintFindings []LintFinding
+	if args.Lint != "" {
+		analysisResult, lintFindings = lintResult(analysisResult, directoryPath, args)
+	}
+
+	// Add to the repository's README rather than replace it
+	var readmeMerge *ReadmeMerge
+	if args.ReadmeMerge {
+		if name := findReadme(directoryPath); name == "" {
+			log.Printf("No README to merge with, keeping the generated one")
+		} else if existing, err := os.ReadFile(filepath.Join(directoryPath, name)); err != nil {
+			postProcessFailed("readme-merge", err)
+		} else {
+			var added []string
+			analysisResult, added = mergeReadme(string(existing), analysisResult)
+			readmeMerge = &ReadmeMerge{Existing: name, Added: added}
+			log.Printf("Merged with %s, adding %d sections", name, len(added))
+		}
+	}
+
+	// Keep secrets and local paths out of everything that is saved
+	redactions := make(map[string]int)
+	analysisResult = applyGuardrails(analysisResult, directoryPath, args.Guardrails, redactions)
+	unstyled = applyGuardrails(unstyled, directoryPath, args.Guardrails, redactions)
+	runInfo.Draft = applyGuardrails(runInfo.Draft, directoryPath, args.Guardrails, redactions)
+	supersededResult = applyGuardrails(supersededResult, directoryPath, args.Guardrails, redactions)
+	for _, root := range args.Roots {
+		analysisResult = applyGuardrails(analysisResult, root.Directory, args.Guardrails, redactions)
+		unstyled = applyGuardrails(unstyled, root.Directory, args.Guardrails, redactions)
+		runInfo.Draft = applyGuardrails(runInfo.Draft, root.Directory, args.Guardrails, redactions)
+		supersededResult = applyGuardrails(supersededResult, root.Directory, args.Guardrails, redactions)
+	}
+	if len(redactions) > 0 {
+		log.Printf("Guardrails replaced %s", describeRedactions(redactions))
+	}
+	withheld := secretScanRedactions()
+	if len(withheld) > 0 {
+		log.Printf("Secret scan kept %s from the model", describeRedactions(withheld))
+	}
+
+	// Describe the GitHub repository, when a token allows asking the API
+	var githubInfo *GitHubInfo
+	if name, ok := githubRepoName(repoURL); ok && githubToken() != "" {
+		if githubInfo, err = fetchGitHubInfo(name, githubToken()); err != nil {
+			postProcessFailed("github info", err)
+		} else if args.RepoInfoHeader {
+			analysisResult = addRepoInfoHeader(analysisResult, name, githubInfo)
+		}
+	} else if args.RepoInfoHeader {
+		log.Printf("Skipping the repository header: set GITHUB_TOKEN or GH_TOKEN to ask the GitHub API")
 	}
 
-	// Save results
-	outputFile, err := saveResults(analysisResult, args.Model, repoName, args.OutputDir, args.Extension, args.FileName)
+	// Attribute the document to this tool and model
+	generatedAt := time.Now()
+	unattributed := analysisResult
+	attribution := Attribution{Model: args.Model, Commit: gitHeadCommit(directoryPath), GeneratedAt: generatedAt}
+	if strings.HasPrefix(repoURL, "https://") || strings.HasPrefix(repoURL, "http://") {
+		attribution.Repo = repoURL // a repository on disk would put a local path back into the document
+	}
+	if prompt, err := taskPrompt(args); err == nil {
+		attribution.PromptHash = promptHash(prompt)
+	}
+	if attributed, err := addAttribution(analysisResult, args.Attribution, attribution); err != nil {
+		postProcessFailed("attribution", err)
+	} else {
+		analysisResult = attributed
+	}
+
+	// Front matter for static site generators goes on the Markdown files written
+	var matter *frontMatter
+	if args.FrontMatter || frontMatterConfig != nil {
+		var topics []string
+		if githubInfo != nil {
+			topics = githubInfo.Topics
+		}
+		created := newFrontMatter(frontMatterConfig, repoURL, args.Model, generatedAt, topics)
+		matter = &created
+	}
+
+	// Save results, rendered in the --format asked for
+	rendered := analysisResult
+	switch args.Format {
+	case FormatMarkdown:
+		if matter != nil {
+			if withMatter, err := addFrontMatter(analysisResult, repoName, *matter); err != nil {
+				postProcessFailed("front matter", err)
+			} else {
+				rendered = withMatter
+			}
+		}
+	case FormatHTML:
+		rendered = renderHTML(analysisResult, repoName)
+	case FormatJSON:
+		documentInfo := DocumentMetadata{Model: args.Model, Repo: repoURL, Commit: gitHeadCommit(directoryPath), GeneratedAt: generatedAt.UTC().Format(time.RFC3339)}
+		if rendered, err = renderDocumentJSON(analysisResult, directoryPath, documentInfo); err != nil {
+			log.Printf("Error saving results: %v", err)
+			return 1
+		}
+	}
+	fileName := args.FileName
+	if args.Preset == PresetChangelog && fileName == "" && args.DiffRange != nil {
+		fileName = changelogFileName(repoName, args.DiffRange, args.Extension)
+	}
+	outputFile, err := saveResults(rendered, args.Model, repoName, args.OutputDir, args.Extension, fileName)
 	if err != nil {
-		log.Fatalf("Error saving results: %v", err)
+		log.Printf("Error saving results: %v", err)
+		return 1
 	}
 	log.Printf("Analysis complete. Results saved to: %s", outputFile)
+	// The Markdown a rendered result came from is kept next to it, for the
+	// copies below and for --incremental to update
+	markdownFile := outputFile
+	if args.Format != FormatMarkdown {
+		markdownFile = markdownSourcePath(outputFile)
+		if err := os.WriteFile(markdownFile, []byte(analysisResult), 0644); err != nil {
+			postProcessFailed("save markdown", err)
+		} else {
+			log.Printf("Markdown saved to: %s", markdownFile)
+		}
+	}
+	// The C4 preset's Structurizr workspace goes next to the result, to load
+	// into Structurizr as it is
+	var workspaceFile string
+	if args.Preset == PresetC4 && args.C4Syntax == C4Structurizr {
+		if workspace := c4Workspace(analysisResult); workspace == "" {
+			postProcessFailed("c4 workspace", fmt.Errorf("the result has no structurizr block"))
+		} else if err := os.WriteFile(c4WorkspacePath(outputFile), []byte(workspace), 0644); err != nil {
+			postProcessFailed("c4 workspace", err)
+		} else {
+			workspaceFile = c4WorkspacePath(outputFile)
+			log.Printf("Structurizr workspace saved to: %s", workspaceFile)
+		}
+	}
+	attributePages := func(pages []SplitPage) {
+		for i := range pages {
+			if attributed, err := addAttribution(pages[i].Markdown, args.Attribution, attribution); err == nil {
+				pages[i].Markdown = attributed
+			}
+		}
+	}
+	var splitDir string
+	if args.SplitOutput {
+		extension := ".md"
+		if args.Format == FormatHTML {
+			extension = ".html"
+		}
+		pages := splitDocument(unattributed, repoName, extension)
+		addPageNavigation(pages)
+		attributePages(pages)
+		for i := 0; matter != nil && args.Format == FormatMarkdown && i < len(pages); i++ {
+			pageMatter := *matter
+			pageMatter.Weight = i + 1
+			if withMatter, err := addFrontMatter(pages[i].Markdown, pages[i].Title, pageMatter); err == nil {
+				pages[i].Markdown = withMatter
+			}
+		}
+		if err := writeSplitOutput(splitOutputDir(outputFile), pages, args.Format); err != nil {
+			postProcessFailed("split output", err)
+		} else {
+			splitDir = splitOutputDir(outputFile)
+			log.Printf("Split into %d pages in: %s", len(pages), splitDir)
+		}
+	}
+	// The same pages as a project for a documentation site generator, which
+	// has its own navigation
+	var siteDir string
+	if args.Site != "" {
+		pages := splitDocument(unattributed, repoName, ".md")
+		attributePages(pages)
+		if err := writeSite(siteOutputDir(outputFile, args.Site), args.Site, pages, repoName, repoURL); err != nil {
+			postProcessFailed("site", err)
+		} else {
+			siteDir = siteOutputDir(outputFile, args.Site)
+			log.Printf("%s site of %d pages written to: %s", args.Site, len(pages), siteDir)
+		}
+	}
+	// Publish the pages where the repository's developers look
+	var publishedURL string
+	if args.Publish == PublishWiki && (args.ReplayFile != "" || runInfo.Partial) {
+		log.Printf("Not publishing to the wiki in replay mode or after interrupt")
+	} else if args.Publish == PublishWiki {
+		name, _ := githubRepoName(repoURL)
+		pages := splitDocument(unattributed, repoName, "")
+		addPageNavigation(pages)
+		attributePages(pages)
+		message := fmt.Sprintf("Update the documentation (tech-writer-agent %s, %s)", Version, args.Model)
+		if wikiURL, changed, err := publishWiki(name, pages, message, githubToken()); err != nil {
+			postProcessFailed("publish wiki", err)
+		} else if !changed {
+			log.Printf("The wiki is already up to date: %s", wikiURL)
+		} else {
+			publishedURL = wikiURL
+			log.Printf("Published %d pages to: %s", len(pages), wikiURL)
+		}
+	}
+	if supersededResult != "" {
+		attemptFile := attemptPath(markdownFile, 1)
+		if err := os.WriteFile(attemptFile, []byte(supersededResult), 0644); err != nil {
+			postProcessFailed("save first attempt", err)
+		} else {
+			attempts[0].ResultFile = filepath.Base(attemptFile)
+			log.Printf("First attempt saved to: %s", attemptFile)
+		}
+	}
+	if args.Memory && runInfo.Partial {
+		log.Printf("Not updating the repository memory after interrupt")
+	} else if args.Memory && args.ReplayFile == "" {
+		memoryFile, err := saveRepoMemory(args.CacheDir, repoIdentity(repoURL, directoryPath), directoryPath, analysisResult, runInfo.Agent.Sources(), args.Model)
+		if err != nil {
+			postProcessFailed("memory", err)
+		} else {
+			log.Printf("Repository memory saved to: %s", memoryFile)
+		}
+	}
+	if args.Incremental && !runInfo.Partial && args.ReplayFile == "" {
+		absOutput, _ := filepath.Abs(markdownFile)
+		run := LastRun{Repo: repoIdentity(repoURL, directoryPath), Subdir: args.Subdir, Preset: args.Preset, Commit: gitHeadCommit(directoryPath), Document: absOutput, Model: args.Model}
+		if args.PromptFile != "" {
+			run.Prompt, _ = filepath.Abs(args.PromptFile)
+		}
+		if path, err := saveLastRun(args.CacheDir, run); err != nil {
+			postProcessFailed("last run", err)
+		} else {
+			log.Printf("Last run recorded in: %s", path)
+		}
+	}
+	if runInfo.Draft != "" {
+		beforePath := beforeReviewPath(markdownFile)
+		if err := os.WriteFile(beforePath, []byte(runInfo.Draft), 0644); err != nil {
+			postProcessFailed("save pre-review version", err)
+		} else {
+			log.Printf("Pre-review version saved to: %s", beforePath)
+		}
+	}
+	if unstyled != "" {
+		beforePath := beforeStylePath(markdownFile)
+		if err := os.WriteFile(beforePath, []byte(unstyled), 0644); err != nil {
+			postProcessFailed("save pre-style version", err)
+		} else {
+			log.Printf("Pre-style version saved to: %s", beforePath)
+		}
+	}
+
+	// Create metadata. A replayed run must not reach the provider, so evaluation is skipped.
+	evalPrompt := args.EvalPrompt
+	if args.ReplayFile != "" && evalPrompt != "" {
+		log.Printf("Skipping evaluation in replay mode")
+		evalPrompt = ""
+	}
+	if stopping && evalPrompt != "" {
+		log.Printf("Skipping evaluation after interrupt")
+		evalPrompt = ""
+	}
+	metadata := Metadata{
+		Model:         args.Model,
+		Framework:     args.Framework,
+		GitHubURL:     repoURL,
+		GitHub:        githubInfo,
+		RepoName:      repoName,
+		Ref:           args.Ref,
+		Subdir:        args.Subdir,
+		Diff:          args.DiffRange,
+		Incremental:   args.Update,
+		Compare:       args.Comparison,
+		Roots:         args.Roots,
+		Timestamp:     generatedAt.Format(time.RFC3339),
+		PromptHash:    attribution.PromptHash,
+		Seed:          args.Seed,
+		Iterations:    runInfo.Iterations,
+		MaxIterations: runInfo.MaxIterations,
+		Truncated:     runInfo.Truncated,
+		Partial:       runInfo.Partial,
+		LintFindings:  lintFindings,
+		Diagrams:      diagramChecks,
+		Split:         splitDir,
+		Site:          siteDir,
+		Published:     publishedURL,
+		Readme:        readmeMerge,
+		Workspace:     workspaceFile,
+		Attempts:      attempts,
+		Redactions:    redactions,
+		Withheld:      withheld,
+	}
+	// Measured before the evaluation, which judges the run rather than being part of it
+	runMetrics := metrics.Snapshot()
+	metadata.Metrics = &runMetrics
+	log.Print(runMetrics.Summary())
+	if fingerprint, err := repoFingerprint(directoryPath); err != nil {
+		postProcessFailed("fingerprint", err)
+	} else {
+		metadata.Directory, _ = filepath.Abs(directoryPath)
+		metadata.Fingerprint = fingerprint
+	}
+	metadata.Commit = gitHeadCommit(directoryPath)
+	if runInfo.Draft != "" {
+		metadata.ReviewModel = args.ReviewModel
+	}
+	if unstyled != "" {
+		metadata.StyleGuide = args.Style
+		metadata.StyleModel = args.StyleModel
+	}
+	metadata.PostErrors = failures
+	metadata, err = createMetadata(outputFile, metadata, analysisResult, evalPrompt)
+	if err != nil {
+		postProcessFailed("metadata", err)
+	}
+	if metadata.EvalError != "" {
+		failures = append(failures, "evaluation: "+metadata.EvalError)
+	}
 
-	// Create metadata
-	if err := createMetadata(outputFile, args.Model, repoURL, repoName, analysisResult, args.EvalPrompt); err != nil {
-		log.Fatalf("Error creating metadata: %v", err)
+	// Keep the session alive for follow-up questions
+	if args.Chat && !stopping {
+		if followUp, ok := runInfo.Agent.(FollowUpAgent); !ok {
+			log.Printf("Follow-up chat is not supported by the %s agent", args.AgentType)
+		} else if err := runFollowUpChat(followUp, os.Stdin, os.Stdout); err != nil {
+			log.Printf("Error reading follow-up questions: %v", err)
+		}
 	}
+
+	if len(failures) > 0 && args.PostErrors == PostProcessFail {
+		log.Printf("%d post-processing steps failed; the result was kept in %s", len(failures), outputFile)
+		return 1
+	}
+	return 0
+}
+
+// notifyInterrupt returns a channel that is closed on the first Ctrl-C so the
+// agent can wrap up and the partial results can be saved. A second Ctrl-C
+// terminates the process as usual.
+func notifyInterrupt() <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+	interrupt := make(chan struct{})
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		log.Printf("Interrupt received; finishing the current iteration and saving partial results (press Ctrl-C again to abort)")
+		close(interrupt)
+	}()
+	return interrupt
 }
 
 func getCommandLineArgs() (*Args, error) {
 	args := &Args{}
 
+	// Define flags
+	flag.StringVar(&args.Repo, "repo", "", "Repository to clone: a GitHub URL (e.g. https://github.com/owner/repo), or a git repository on disk such as a bare mirror, as a path or file:// URL")
+	flag.StringVar(&args.Ref, "ref", "", "Branch, tag or full commit SHA of --repo to analyse instead of the default branch (e.g. v1.2.0)")
+	flag.BoolVar(&args.Refresh, "refresh", false, "Fetch --repo again and reset the cached clone to the current commit of --ref or the default branch")
+	flag.BoolVar(&args.NoCache, "no-cache", false, "Clone --repo into a temporary directory, removed after the run, instead of using --cache-dir")
+	flag.BoolVar(&args.Quiet, "quiet", false, "Don't show the progress of cloning --repo")
+	flag.DurationVar(&args.CloneTimeout, "clone-timeout", DEFAULT_CLONE_TIMEOUT, "Give up cloning or refreshing --repo after this long, e.g. 1h (0 means no limit)")
+	flag.StringVar(&args.Subdir, "subdir", "", "Directory of --repo to analyse, e.g. services/api, instead of the whole repository")
+	flag.BoolVar(&args.Sparse, "sparse", false, "Sparse, partial clone of --repo: check out and download only --subdir, or the directories the --include patterns start with")
+	flag.StringVar(&args.FromRef, "from-ref", "", "Document the changes since this branch, tag or commit (upgrade and migration notes) rather than the whole code base")
+	flag.StringVar(&args.ToRef, "to-ref", "", "End of the changes --from-ref documents (default: the analysed commit; with --repo it is checked out)")
+	flag.BoolVar(&args.Incremental, "incremental", false, "Update the document of the last successful run with the same repository, preset and prompt for the changes since its commit, instead of analysing the whole code base")
+	flag.StringVar(&args.Package, "package", "", "Analyse only this package of a monorepo, by name or directory, as its workspace manifest lists it (see the packages command)")
+	flag.StringVar(&args.Compare, "compare", "", "Compare the code base with this second one, a directory or GitHub repository, instead of documenting it alone (tools address them as a: and b:)")
+	flag.StringVar(&args.PromptFile, "prompt", "", "Path to a file containing the analysis prompt (required without --preset; with it, further instructions)")
+	flag.StringVar(&args.Preset, "preset", "", "Built-in documentation task: api-reference (a reference of the exported symbols, endpoints and command-line flags, from the symbol tools), c4 (C4 model context, container and component views, see --c4-syntax), changelog (the changes from --from-ref, by default the latest tag before --to-ref, to --to-ref, grouped into breaking changes, features and fixes), onboarding (a guide for new engineers: setup, key flows, a reading order and a glossary) or readme (a conventional README: overview, installation, usage, configuration and contributing)")
+	flag.StringVar(&args.C4Syntax, "c4-syntax", C4Mermaid, "Diagrams of --preset c4: mermaid (a C4Context, C4Container or C4Component diagram per view) or structurizr (one Structurizr DSL workspace with the views, also saved as a .dsl file next to the result)")
+	flag.BoolVar(&args.ReadmeMerge, "readme-merge", false, "With --preset readme, keep the repository's README as written and add only the generated sections it lacks, instead of replacing it")
+	flag.StringVar(&args.Model, "model", "openai/gpt-4o-mini", "Model to use for analysis (format: vendor/model)")
+	flag.StringVar(&args.BaseURL, "base-url", "", "Base URL for the API (automatically set based on model if not provided)")
+	flag.StringVar(&args.CacheDir, "cache-dir", "~/.cache/github", "Directory to cache cloned repositories")
+	flag.Func("cache-max-age", "Remove cached repositories unused for longer than this after cloning, e.g. 30d or 72h (default: kept)", func(value string) (err error) {
+		args.CacheMaxAge, err = parseAge(value)
+		return err
+	})
+	flag.Func("cache-max-size", "Remove the least recently used cached repositories after cloning until the cache fits in this, e.g. 5GB (default: unlimited)", func(value string) (err error) {
+		args.CacheMaxSize, err = parseSize(value)
+		return err
+	})
+	flag.StringVar(&args.OutputDir, "output-dir", "output", "Directory to save results to")
+	flag.StringVar(&args.Extension, "extension", ".md", "File extension for output files")
+	flag.StringVar(&args.FileName, "file-name", "", "Specific file name for output (overrides --extension)")
+	flag.StringVar(&args.Format, "format", "", "Result format: markdown, html for a standalone page with a table of contents, section anchors and highlighted code, or json for a structured document of sections, file citations and diagrams (default: from --extension, else markdown)")
+	flag.StringVar(&args.EvalPrompt, "eval-prompt", "", "Path to file containing prompt to evaluate the tech writer results")
+	flag.IntVar(&args.MaxIterations, "max-iterations", 0, "Fixed iteration cap, overriding the cap derived from repository size (also TECH_WRITER_MAX_ITERATIONS; 0 means adaptive)")
+	flag.IntVar(&args.MinIterations, "min-iterations", MIN_ITERATIONS, "Lower bound for the iteration cap derived from repository size")
+	flag.IntVar(&args.MaxIterCeiling, "max-iterations-ceiling", MAX_ITERATIONS_CEILING, "Upper bound for the iteration cap derived from repository size")
+	flag.BoolVar(&args.RepoMap, "repo-map", false, "Include a map of the repository's files in the prompt")
+	flag.BoolVar(&args.Memory, "memory", false, "Start from the notes saved by earlier runs on this repository (under --cache-dir), and save this run's")
+	flag.BoolVar(&args.AutoRetry, "auto-retry", false, "If the analysis fails or hits its iteration or time limit, retry once with twice the iterations and a repository map")
+	flag.StringVar(&args.RetryModel, "retry-model", "", "Model for the --auto-retry attempt, e.g. a cheaper one for the longer exploration (default: --model)")
+	flag.StringVar(&args.AgentType, "agent-type", "react", "Agent strategy: react, plan-execute or hierarchical")
+	flag.StringVar(&args.Framework, "framework", BUILTIN_FRAMEWORK, "Agent implementation to run; adapters for other Go agent frameworks register under their own name")
+	flag.StringVar(&args.TraceFile, "trace", "", "Path to write a JSONL transcript of every LLM and tool call")
+	flag.StringVar(&args.ReplayFile, "replay", "", "Path to a transcript from a previous run; serves its recorded completions instead of calling the LLM")
+	flag.DurationVar(&args.MaxDuration, "max-duration", 0, "Wall-clock limit for the agent loop, e.g. 30m; when reached the model must answer with what it has (0 disables the limit)")
+	flag.DurationVar(&args.IterationTimeout, "iteration-timeout", 0, "Maximum time a single agent iteration may take, e.g. 2m (0 disables the limit)")
+	flag.StringVar(&args.Style, "style", "", "Rewrite the result to follow a style guide: google, microsoft, or a path to a custom guide")
+	flag.StringVar(&args.StyleModel, "style-model", "openai/gpt-4o-mini", "Model used for the --style rewrite (format: vendor/model)")
+	flag.StringVar(&args.ReviewModel, "review-model", "", "Model that checks the document's claims against the files and corrects it (format: vendor/model)")
+	flag.StringVar(&args.Lint, "lint", "", "Spell and terminology check the result before saving: report (log findings) or fix (also correct them)")
+	flag.StringVar(&args.LintDictionary, "lint-dictionary", "", "Word list (one per line) for --lint; words in neither it nor the repository are reported")
+	flag.StringVar(&args.Guardrails, "guardrails", GuardrailsRedact, "Scrub the saved documents: redact (secrets and local absolute paths), relative (also make repository file paths repo-relative) or off")
+	flag.StringVar(&args.Attribution, "attribution", AttributionNone, "Attribution appended to the result: none, footer (visible line plus HTML comment), comment (machine-readable HTML comment only) or provenance (tool version, model, repository, commit, time and prompt hash, plus the comment)")
+	flag.BoolVar(&args.Diagrams, "diagrams", false, "Ask for a Mermaid component diagram and dependency diagram, check the syntax of every Mermaid diagram in the result, and have the model fix those that don't parse")
+	flag.BoolVar(&args.SplitOutput, "split-output", false, "Also write the result as an index and a page per major section, in a directory named after the output file, with links between sections pointed at their pages")
+	flag.StringVar(&args.Site, "site", "", "Also write the result's pages, split as for --split-output, as a project ready to build with mkdocs or docusaurus: front matter, navigation and configuration")
+	flag.StringVar(&args.Publish, "publish", "", "Publish the result's pages, split as for --split-output: wiki (clone the --repo's GitHub wiki, replace the pages of the last run and push, with GITHUB_TOKEN or GH_TOKEN or git's credentials)")
+	flag.BoolVar(&args.FrontMatter, "front-matter", false, "Start Markdown results with YAML front matter (title, date, repo, model, tags) for Hugo and Jekyll content directories; the --config file's front_matter block adds tags and fields")
+	flag.BoolVar(&args.RepoInfoHeader, "repo-info-header", false, "Start the result with the --repo's description, stars, topics, default branch and latest release from the GitHub API (needs GITHUB_TOKEN or GH_TOKEN)")
+	flag.StringVar(&args.AuditLog, "audit-log", "", "Append a JSON line per LLM request (time, provider, model, token counts, payload hash; no content) to this file (also TECH_WRITER_AUDIT_LOG)")
+	flag.BoolVar(&args.Progress, "progress", false, "Show each step's thought, tool call, observation summary and timing on the terminal instead of log lines")
+	flag.StringVar(&args.PostErrors, "post-process-errors", PostProcessFail, "What failures after the analysis (style, attribution, metadata, evaluation) do to the exit status: fail (exit non-zero once everything is saved) or record (only record them in the metadata)")
+	flag.BoolVar(&args.Chat, "chat", false, "After saving the results, answer follow-up questions about the codebase on the terminal")
+	flag.BoolVar(&args.Interactive, "interactive", false, "Allow the agent to ask clarifying questions on the terminal")
+	flag.BoolVar(&args.Provenance, "provenance", false, "Append per-section footnotes listing the files the agent read whose path or file name the section mentions (a heuristic: files that informed a section without being named are not listed)")
+	flag.BoolVar(&args.EmbedSynthesis, "embedding-synthesis", false, "Revise each section of the answer using the observations most relevant to it, retrieved by embeddings")
+	flag.StringVar(&args.EmbeddingModel, "embedding-model", "openai/text-embedding-3-small", "Embedding model for --embedding-synthesis (format: vendor/model)")
+	flag.BoolVar(&args.ScanSecrets, "scan-secrets", true, "Redact credentials (known key and token formats, quoted values of password/secret/token/key settings, high-entropy strings) from file contents and other tool results before they are sent to the model")
+	flag.StringVar(&args.ConfigFile, "config", "", "JSON configuration file declaring tool plugins (also TECH_WRITER_CONFIG)")
+	flag.DurationVar(&args.ToolTimeout, "tool-timeout", TOOL_DEFAULT_TIMEOUT, "How long a tool call may run before the agent stops waiting and reports a timeout to the model (0 disables the limit; the --config file can set it per tool)")
+	flag.IntVar(&args.ToolMaxOutput, "tool-max-output", TOOL_DEFAULT_MAX_OUTPUT_BYTES, "Largest tool result in bytes passed to the model; longer ones are cut with a note saying so (0 disables the limit; the --config file can set it per tool)")
+	flag.Int64Var(&args.MaxFileBytes, "max-file-bytes", 0, "Largest file read_file returns whole; of larger files it returns the beginning and end with the number of lines omitted (0 returns them in 64 KB chunks)")
+	flag.Func("fetch-domains", "Comma-separated domains (and their subdomains) the agent may fetch linked documentation from with the fetch_url tool; without it the tool is unavailable", func(value string) error {
+		args.FetchDomains = append(args.FetchDomains, parseDomains(value)...)
+		return nil
+	})
+	flag.Func("include", "Glob of the files the agent may see, relative to the analysed directory, e.g. \"src/**\" (repeatable; a pattern without a slash matches file and directory names at any depth)", func(value string) error {
+		args.Include = append(args.Include, value)
+		return validateGlob(value)
+	})
+	flag.Func("exclude", "Glob of files and directories to hide from the agent on top of .gitignore, e.g. \"**/testdata/**\" (repeatable)", func(value string) error {
+		args.Exclude = append(args.Exclude, value)
+		return validateGlob(value)
+	})
+	flag.BoolVar(&args.IncludeGenerated, "include-generated", false, "Let the agent see files .gitattributes marks linguist-vendored or linguist-generated, such as vendored libraries, minified bundles and generated protobuf code, which are hidden by default")
+	flag.BoolVar(&args.NoDefaultIgnores, "no-default-ignores", false, "Let the agent see dependency directories, build output and caches (node_modules, .venv, dist, build, target, __pycache__, ...), which are skipped by default even without a .gitignore")
+	flag.Func("text-extensions", "Comma-separated extensions the file tools always read as text, e.g. .svg,.min.js, whatever their content looks like", func(value string) error {
+		args.TextExtensions = append(args.TextExtensions, parseExtensions(value)...)
+		return nil
+	})
+	flag.Func("binary-extensions", "Comma-separated extensions the file tools never read, as if binary, e.g. .csv,.snap", func(value string) error {
+		args.BinaryExtensions = append(args.BinaryExtensions, parseExtensions(value)...)
+		return nil
+	})
+	flag.BoolVar(&args.OSV, "osv", false, "Let the agent look up known vulnerabilities of the project's dependencies in the OSV.dev database with the check_vulnerabilities tool; the names and versions of the dependencies are sent to api.osv.dev")
+	flag.Func("seed", "Sampling seed passed to providers that support it, for reproducible runs", func(value string) error {
+		seed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("seed must be an integer: %w", err)
+		}
+		args.Seed = &seed
+		return nil
+	})
+
 	// Custom argument parsing to handle mixed positional and flag arguments
 	// This is needed because Go's flag package stops at the first non-flag argument
 	var positionalArgs []string
@@ -73,8 +847,9 @@ func getCommandLineArgs() (*Args, error) {
 		if strings.HasPrefix(arg, "-") {
 			// This is a flag, add it and its value (if any)
 			flagArgs = append(flagArgs, arg)
-			// Check if this flag has a value
-			if i+1 < len(os.Args) && !strings.HasPrefix(os.Args[i+1], "-") {
+			// Check if this flag has a value. Boolean flags and --name=value
+			// forms never consume the following argument.
+			if i+1 < len(os.Args) && !strings.HasPrefix(os.Args[i+1], "-") && !strings.Contains(arg, "=") && !isBoolFlag(arg) {
 				i++
 				flagArgs = append(flagArgs, os.Args[i])
 			}
@@ -83,24 +858,20 @@ func getCommandLineArgs() (*Args, error) {
 		}
 	}
 	
-	// Set os.Args to only contain program name and flags for flag.Parse()
-	os.Args = append([]string{os.Args[0]}, flagArgs...)
-
-	// Define flags
-	flag.StringVar(&args.Repo, "repo", "", "GitHub repository URL to clone (e.g. https://github.com/owner/repo)")
-	flag.StringVar(&args.PromptFile, "prompt", "", "Path to a file containing the analysis prompt (required)")
-	flag.StringVar(&args.Model, "model", "openai/gpt-4o-mini", "Model to use for analysis (format: vendor/model)")
-	flag.StringVar(&args.BaseURL, "base-url", "", "Base URL for the API (automatically set based on model if not provided)")
-	flag.StringVar(&args.CacheDir, "cache-dir", "~/.cache/github", "Directory to cache cloned repositories")
-	flag.StringVar(&args.OutputDir, "output-dir", "output", "Directory to save results to")
-	flag.StringVar(&args.Extension, "extension", ".md", "File extension for output files")
-	flag.StringVar(&args.FileName, "file-name", "", "Specific file name for output (overrides --extension)")
-	flag.StringVar(&args.EvalPrompt, "eval-prompt", "", "Path to file containing prompt to evaluate the tech writer results")
-
-	flag.Parse()
+	if err := flag.CommandLine.Parse(flagArgs); err != nil {
+		return nil, err
+	}
 
-	// Handle positional arguments
-	if len(positionalArgs) > 0 {
+	// Handle positional arguments; several directories are analysed together
+	// under labeled roots
+	if len(positionalArgs) > 1 {
+		roots, err := parseRoots(positionalArgs)
+		if err != nil {
+			return nil, err
+		}
+		args.Roots = roots
+		args.Directory = roots[0].Directory
+	} else if len(positionalArgs) > 0 {
 		args.Directory = positionalArgs[0]
 	}
 
@@ -108,34 +879,208 @@ func getCommandLineArgs() (*Args, error) {
 	// log.Printf("Parsed args: Directory=%q, Repo=%q, PromptFile=%q", args.Directory, args.Repo, args.PromptFile)
 
 	// Validate required arguments
-	if args.PromptFile == "" {
-		return nil, fmt.Errorf("-prompt is required")
+	if args.PromptFile == "" && args.Preset == "" {
+		return nil, fmt.Errorf("-prompt is required, unless -preset gives the task")
+	}
+	if _, ok := presets[args.Preset]; args.Preset != "" && !ok {
+		return nil, fmt.Errorf("unknown -preset %q (expected one of %s)", args.Preset, presetNames())
+	}
+	if args.C4Syntax != C4Mermaid && args.C4Syntax != C4Structurizr {
+		return nil, fmt.Errorf("-c4-syntax must be %s or %s", C4Mermaid, C4Structurizr)
+	}
+	if args.C4Syntax != C4Mermaid && args.Preset != PresetC4 {
+		return nil, fmt.Errorf("-c4-syntax requires -preset %s", PresetC4)
+	}
+	if args.Preset == PresetC4 && args.Diagrams {
+		return nil, fmt.Errorf("-preset %s draws its own diagrams and checks them; drop -diagrams", PresetC4)
+	}
+	if args.ReadmeMerge && args.Preset != PresetReadme {
+		return nil, fmt.Errorf("-readme-merge requires -preset %s", PresetReadme)
+	}
+	if args.Preset == PresetChangelog && (args.Incremental || args.Compare != "" || len(args.Roots) > 0) {
+		return nil, fmt.Errorf("-preset %s can't be combined with -incremental, -compare or several directories", PresetChangelog)
 	}
 
 	if args.Directory == "" && args.Repo == "" {
 		return nil, fmt.Errorf("either directory or -repo is required")
 	}
+	if (args.Ref != "" || args.Refresh || args.NoCache || args.Subdir != "" || args.Sparse) && args.Repo == "" {
+		return nil, fmt.Errorf("-ref, -refresh, -no-cache, -subdir and -sparse require -repo")
+	}
+	if args.Incremental && args.FromRef != "" {
+		return nil, fmt.Errorf("-incremental and -from-ref are mutually exclusive")
+	}
+	if args.ToRef != "" && args.FromRef == "" && args.Preset != PresetChangelog {
+		return nil, fmt.Errorf("-to-ref requires -from-ref")
+	}
+	if args.Compare != "" && (args.FromRef != "" || args.Incremental || args.Memory) {
+		return nil, fmt.Errorf("-compare can't be combined with -from-ref, -incremental or -memory, which document one code base")
+	}
+	if args.Compare != "" && args.AgentType == "hierarchical" {
+		return nil, fmt.Errorf("-compare needs -agent-type react or plan-execute")
+	}
+	if args.Package != "" && (args.Subdir != "" || args.Sparse || args.Compare != "" || len(args.Roots) > 0) {
+		return nil, fmt.Errorf("-package can't be combined with -subdir, -sparse, -compare or several directories")
+	}
+	if len(args.Roots) > 0 {
+		if args.Repo != "" || args.Compare != "" {
+			return nil, fmt.Errorf("several directories can't be combined with -repo or -compare")
+		}
+		if args.FromRef != "" || args.Incremental || args.Memory {
+			return nil, fmt.Errorf("several directories can't be combined with -from-ref, -incremental or -memory, which document one code base")
+		}
+		if args.AgentType == "hierarchical" {
+			return nil, fmt.Errorf("several directories need -agent-type react or plan-execute")
+		}
+	}
+	// The clone is checked out at the second ref
+	if args.ToRef != "" && args.Repo != "" {
+		if args.Ref != "" && args.Ref != args.ToRef {
+			return nil, fmt.Errorf("-ref and -to-ref name different commits; give one of them")
+		}
+		args.Ref = args.ToRef
+	}
+	if subdir := filepath.Clean(args.Subdir); filepath.IsAbs(subdir) || subdir == ".." || strings.HasPrefix(subdir, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("-subdir must be a directory inside the repository")
+	}
+
+	// The environment supplies the iteration cap unless the flag sets it
+	if args.MaxIterations == 0 {
+		if value := os.Getenv("TECH_WRITER_MAX_ITERATIONS"); value != "" {
+			maxIterations, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("TECH_WRITER_MAX_ITERATIONS must be an integer: %w", err)
+			}
+			args.MaxIterations = maxIterations
+		}
+	}
+	if args.MaxIterations < 0 {
+		return nil, fmt.Errorf("-max-iterations must not be negative")
+	}
+
+	if args.AuditLog == "" {
+		args.AuditLog = os.Getenv("TECH_WRITER_AUDIT_LOG")
+	}
+
+	if args.ConfigFile == "" {
+		args.ConfigFile = os.Getenv("TECH_WRITER_CONFIG")
+	}
+
+	if args.ToolTimeout < 0 || args.ToolMaxOutput < 0 {
+		return nil, fmt.Errorf("-tool-timeout and -tool-max-output must not be negative")
+	}
+
+	if args.MaxFileBytes < 0 {
+		return nil, fmt.Errorf("-max-file-bytes must not be negative")
+	}
+
+	if _, ok := frameworks[args.Framework]; !ok {
+		return nil, fmt.Errorf("-framework must be one of %s", frameworkNames())
+	}
+
+	if args.Lint != "" && args.Lint != "report" && args.Lint != "fix" {
+		return nil, fmt.Errorf("-lint must be report or fix")
+	}
 
-	// Check API keys
-	if os.Getenv("OPENAI_API_KEY") == "" && os.Getenv("GEMINI_API_KEY") == "" {
+	if args.PostErrors != PostProcessFail && args.PostErrors != PostProcessRecord {
+		return nil, fmt.Errorf("-post-process-errors must be %s or %s", PostProcessFail, PostProcessRecord)
+	}
+
+	switch args.Guardrails {
+	case GuardrailsOff, GuardrailsRedact, GuardrailsRelative:
+	default:
+		return nil, fmt.Errorf("-guardrails must be %s, %s or %s", GuardrailsRedact, GuardrailsRelative, GuardrailsOff)
+	}
+
+	switch args.Format {
+	case "":
+		args.Format = FormatMarkdown
+		switch strings.TrimPrefix(strings.ToLower(args.Extension), ".") {
+		case "html", "htm":
+			args.Format = FormatHTML
+		case "json":
+			args.Format = FormatJSON
+		}
+	case FormatHTML, FormatJSON:
+		if args.Extension == ".md" {
+			args.Extension = "." + args.Format
+		}
+	case FormatMarkdown:
+	default:
+		return nil, fmt.Errorf("-format must be %s, %s or %s", FormatMarkdown, FormatHTML, FormatJSON)
+	}
+
+	if args.SplitOutput && args.Format == FormatJSON {
+		return nil, fmt.Errorf("-split-output requires -format %s or %s", FormatMarkdown, FormatHTML)
+	}
+
+	switch args.Site {
+	case "", SiteMkDocs, SiteDocusaurus:
+	default:
+		return nil, fmt.Errorf("-site must be %s or %s", SiteMkDocs, SiteDocusaurus)
+	}
+
+	switch args.Publish {
+	case "":
+	case PublishWiki:
+		if _, ok := githubRepoName(args.Repo); !ok {
+			return nil, fmt.Errorf("-publish %s requires a GitHub -repo", PublishWiki)
+		}
+	default:
+		return nil, fmt.Errorf("-publish must be %s", PublishWiki)
+	}
+
+	if args.RepoInfoHeader && args.Repo == "" {
+		return nil, fmt.Errorf("-repo-info-header requires -repo")
+	}
+
+	switch args.Attribution {
+	case AttributionNone, AttributionFooter, AttributionComment, AttributionProvenance:
+	default:
+		return nil, fmt.Errorf("-attribution must be %s, %s, %s or %s", AttributionNone, AttributionFooter, AttributionComment, AttributionProvenance)
+	}
+
+	// Check API keys (a replayed run never contacts a provider)
+	if args.ReplayFile == "" && os.Getenv("OPENAI_API_KEY") == "" && os.Getenv("GEMINI_API_KEY") == "" {
 		return nil, fmt.Errorf("neither OPENAI_API_KEY nor GEMINI_API_KEY environment variables are set")
 	}
 
 	return args, nil
 }
 
-func configureCodeBaseSource(repoArg, directoryArg, cacheDir string) (repoURL, directoryPath string, err error) {
+// isBoolFlag reports whether a command line argument such as "--interactive"
+// names a boolean flag, which takes no separate value
+func isBoolFlag(arg string) bool {
+	f := flag.Lookup(strings.TrimLeft(arg, "-"))
+	if f == nil {
+		return false
+	}
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func configureCodeBaseSource(repoArg, directoryArg, cacheDir, subdir string, clone CloneOptions) (repoURL, directoryPath string, err error) {
 	if repoArg != "" {
-		// Validate GitHub URL
-		if !validateGitHubURL(repoArg) {
-			return "", "", fmt.Errorf("invalid GitHub repository URL format")
+		// A git repository on disk, such as a local mirror, is cloned from
+		// its file:// URL; anything else must be on GitHub
+		if fileURL, ok := localRepoURL(repoArg); ok {
+			repoArg = fileURL
+		} else if !validateGitHubURL(repoArg) {
+			return "", "", fmt.Errorf("invalid repository: %s is neither a GitHub repository URL nor a git repository on disk", repoArg)
 		}
 		// Clone repository
 		repoURL = repoArg
-		directoryPath, err = cloneRepo(repoArg, cacheDir)
+		directoryPath, err = cloneRepo(repoArg, cacheDir, clone)
 		if err != nil {
 			return "", "", fmt.Errorf("failed to clone repository: %w", err)
 		}
+		log.Printf("Analysing %s at commit %s", repoArg, gitHeadCommit(directoryPath))
+		if subdir != "" {
+			directoryPath = filepath.Join(directoryPath, subdir)
+			if info, err := os.Stat(directoryPath); err != nil || !info.IsDir() {
+				return "", "", fmt.Errorf("directory %s not found in %s", subdir, repoArg)
+			}
+		}
 	} else {
 		directoryPath = directoryArg
 		// Validate directory exists
@@ -146,45 +1091,338 @@ func configureCodeBaseSource(repoArg, directoryArg, cacheDir string) (repoURL, d
 	return repoURL, directoryPath, nil
 }
 
-func analyzeCodebase(directoryPath, promptFilePath, modelName, baseURL, repoURL string) (string, string, string, error) {
-	// Read the prompt file
-	prompt, err := readPromptFile(promptFilePath)
+func analyzeCodebase(directoryPath, repoURL string, args *Args, trace *TraceRecorder, metrics *MetricsSink, interrupt <-chan struct{}) (string, string, RunInfo, error) {
+	// Read the prompt file, after the preset's task
+	prompt, err := taskPrompt(args)
 	if err != nil {
-		return "", "", "", err
+		return "", "", RunInfo{}, err
+	}
+	
+	// Extract repo name
+	repoName := filepath.Base(directoryPath)
+	if repoURL != "" {
+		parts := strings.Split(repoURL, "/")
+		if len(parts) > 0 {
+			repoName = strings.TrimSuffix(parts[len(parts)-1], ".git")
+		}
+	}
+	
+	// A diff-scoped analysis is given the changes ahead of the prompt
+	if args.DiffRange != nil {
+		describe := diffPrompt
+		if args.Preset == PresetChangelog {
+			// A changelog lists the commits too
+			describe = func(directory string, diffRange *DiffRange) (string, error) {
+				return changelogChanges(directory, repoURL != "", diffRange)
+			}
+		}
+		changes, err := describe(directoryPath, args.DiffRange)
+		if err != nil {
+			return "", "", RunInfo{}, err
+		}
+		prompt = changes + "\n" + prompt
+	}
+	if args.Update != nil {
+		changes, err := incrementalPrompt(directoryPath, args.Update)
+		if err != nil {
+			return "", "", RunInfo{}, err
+		}
+		prompt = changes + "\n" + prompt
+	}
+	if args.Comparison != nil {
+		prompt = comparePrompt(directoryPath, repoName, args.Comparison) + "\n" + prompt
+	} else if len(args.Roots) > 0 {
+		prompt = rootsPrompt(args.Roots) + "\n" + prompt
+	}
+	if args.Diagrams {
+		prompt += "\n" + DIAGRAMS_PROMPT
+	}
+	if args.Format == FormatJSON {
+		prompt += "\n" + structuredAnswerPrompt
 	}
 	
 	// Prepare the full prompt with base directory
 	fullPrompt := fmt.Sprintf("Base directory: %s\n\n%s", directoryPath, prompt)
+	if args.RepoMap {
+		layout, err := repoMap(directoryPath)
+		if err != nil {
+			return "", "", RunInfo{}, fmt.Errorf("error building the repository map: %w", err)
+		}
+		// One map per root, under its label
+		if len(args.Roots) > 0 {
+			layout = ""
+			for _, root := range args.Roots {
+				rootLayout, err := repoMap(root.Directory)
+				if err != nil {
+					return "", "", RunInfo{}, fmt.Errorf("error building the repository map: %w", err)
+				}
+				layout += fmt.Sprintf("%s:\n%s\n", root.Label, rootLayout)
+			}
+		}
+		fullPrompt = fmt.Sprintf("Base directory: %s\n\nRepository map (the files the tools can see):\n%s\n%s", directoryPath, layout, prompt)
+	}
+	if args.Memory {
+		fullPrompt = withRepoMemory(fullPrompt, directoryPath, repoURL, args.CacheDir)
+	}
 	
 	// Create LLM client
-	llmClient, err := NewLLMClient(modelName, baseURL)
+	var llmClient LLMClient
+	if args.ReplayFile != "" {
+		llmClient, err = NewReplayClient(args.ReplayFile)
+		log.Printf("Replaying completions from %s", args.ReplayFile)
+	} else {
+		llmClient, err = NewLLMClient(args.Model, args.BaseURL, LLMOptions{Seed: args.Seed})
+	}
 	if err != nil {
-		return "", "", "", err
+		return "", "", RunInfo{}, err
+	}
+	
+	if args.Interactive {
+		RegisterTool(newAskUserTool(os.Stdin, os.Stderr, trace))
+	}
+	if args.MaxFileBytes > 0 {
+		RegisterTool(newReadFileTool(args.MaxFileBytes))
+	}
+	if len(args.FetchDomains) > 0 {
+		RegisterTool(newFetchURLTool(args.FetchDomains))
+	}
+	if args.OSV {
+		RegisterTool(newCheckVulnerabilitiesTool())
+	}
+	if describer, ok := llmClient.(ImageDescriber); ok {
+		RegisterTool(newDescribeImageTool(llmClient, describer))
 	}
 	
-	// Create ReAct agent
+	// Create the agent
 	systemPrompt := GetReActSystemPrompt()
+	if args.AgentType == "plan-execute" {
+		systemPrompt = GetTechWriterSystemPrompt()
+	}
 	// Enable verbose mode for debugging
 	verbose := os.Getenv("VERBOSE") == "true"
-	agent := NewReActAgent(llmClient, systemPrompt, MAX_ITERATIONS, verbose)
+	events := MultiSink{LogSink{Verbose: verbose}}
+	if args.Progress {
+		events = MultiSink{NewConsoleSink(os.Stderr)}
+	}
+	events = append(events, metrics)
+	if trace != nil {
+		events = append(events, trace)
+	}
+	maxIterations := args.MaxIterations
+	if maxIterations > 0 {
+		log.Printf("Using a fixed iteration cap of %d", maxIterations)
+	} else {
+		maxIterations = adaptiveMaxIterations(rootDirectories(directoryPath, args.Roots), args.MinIterations, args.MaxIterCeiling)
+	}
+	agentOpts := AgentOptions{
+		IterationTimeout: args.IterationTimeout,
+		MaxDuration:      args.MaxDuration,
+		Interrupt:        interrupt,
+		Events:           events,
+	}
+	framework, ok := frameworks[args.Framework]
+	if !ok {
+		return "", "", RunInfo{}, fmt.Errorf("unknown framework %q (expected one of %s)", args.Framework, frameworkNames())
+	}
 	
 	// Run the analysis
 	log.Printf("Starting analysis of %s", directoryPath)
-	analysisResult, err := agent.Run(fullPrompt)
+	result, err := framework.Run(fullPrompt, FrameworkRepo{
+		Directory:     directoryPath,
+		RepoURL:       repoURL,
+		LLM:           llmClient,
+		SystemPrompt:  systemPrompt,
+		MaxIterations: maxIterations,
+		Verbose:       verbose,
+		Options:       agentOpts,
+		Args:          args,
+	})
+	agent := result.Agent
 	if err != nil {
-		return "", "", "", fmt.Errorf("analysis failed: %w", err)
+		// How far the agent got, for --auto-retry
+		runInfo := RunInfo{MaxIterations: maxIterations}
+		if agent != nil {
+			runInfo.Iterations = agent.Iterations()
+			runInfo.Partial = agent.Interrupted()
+		}
+		return "", "", runInfo, fmt.Errorf("analysis failed: %w", err)
 	}
+	analysisResult := result.Output
 	
-	// Extract repo name
-	repoName := filepath.Base(directoryPath)
-	if repoURL != "" {
-		parts := strings.Split(repoURL, "/")
-		if len(parts) > 0 {
-			repoName = strings.TrimSuffix(parts[len(parts)-1], ".git")
+	if args.EmbedSynthesis && isClosed(interrupt) {
+		log.Printf("Skipping embedding synthesis after interrupt")
+	} else if args.EmbedSynthesis {
+		analysisResult = embeddingSynthesis(analysisResult, agent.Observations(), llmClient, systemPrompt, events, args)
+	}
+	
+	// Have the review model check the draft against the files
+	sources := agent.Sources()
+	draft := ""
+	if args.ReviewModel != "" && isClosed(interrupt) {
+		log.Printf("Skipping the review pass after interrupt")
+	} else if args.ReviewModel != "" {
+		reviewed, reviewSources, err := reviewResult(analysisResult, prompt, directoryPath, maxIterations, verbose, agentOpts, args)
+		if err != nil {
+			log.Printf("Keeping the unreviewed result: %v", err)
+		} else {
+			draft, analysisResult = analysisResult, reviewed
+			for _, source := range reviewSources {
+				if !slices.Contains(sources, source) {
+					sources = append(sources, source)
+				}
+			}
+		}
+	}
+	
+	if args.Provenance {
+		absDir, _ := filepath.Abs(directoryPath)
+		analysisResult = addProvenanceFootnotes(analysisResult, sources, absDir)
+	}
+	
+	if args.Comparison != nil {
+		repoName += "-vs-" + args.Comparison.Name
+	} else if len(args.Roots) > 0 {
+		labels := make([]string, len(args.Roots))
+		for i, root := range args.Roots {
+			labels[i] = root.Label
 		}
+		repoName = strings.Join(labels, "+")
 	}
 	
-	return analysisResult, repoName, repoURL, nil
+	return analysisResult, repoName, RunInfo{
+		Iterations:    agent.Iterations(),
+		MaxIterations: maxIterations,
+		Truncated:     agent.Truncated(),
+		Partial:       agent.Interrupted(),
+		Agent:         agent,
+		Draft:         draft,
+	}, nil
+}
+
+// withRepoMemory puts the notes of earlier runs on the repository, if any, at
+// the start of prompt. Memory problems only cost the head start.
+func withRepoMemory(prompt, directoryPath, repoURL, cacheDir string) string {
+	revision, err := repoRevision(directoryPath)
+	if err != nil {
+		log.Printf("Starting without repository memory: %v", err)
+		return prompt
+	}
+	memory, err := loadRepoMemory(cacheDir, repoIdentity(repoURL, directoryPath), revision)
+	if err != nil {
+		log.Printf("Starting without repository memory: %v", err)
+		return prompt
+	}
+	if memory == nil {
+		log.Printf("No repository memory yet; this run will create it")
+		return prompt
+	}
+	log.Printf("Starting from the repository memory of %s", memory.CreatedAt)
+	return memoryPrompt(memory, revision) + "\n" + prompt
+}
+
+// embeddingSynthesis runs the embedding-assisted rewrite of draft, falling back
+// to the draft if embeddings are unavailable
+func embeddingSynthesis(draft string, observations []Observation, llmClient LLMClient, systemPrompt string, events EventSink, args *Args) string {
+	if args.ReplayFile != "" {
+		log.Printf("Skipping embedding synthesis in replay mode")
+		return draft
+	}
+	
+	client, err := NewLLMClient(args.EmbeddingModel, secondaryBaseURL(args.EmbeddingModel, args), LLMOptions{})
+	if err != nil {
+		log.Printf("Skipping embedding synthesis: %v", err)
+		return draft
+	}
+	embedder, ok := client.(Embedder)
+	if !ok {
+		log.Printf("Skipping embedding synthesis: %s does not support embeddings", args.EmbeddingModel)
+		return draft
+	}
+	
+	revised, err := synthesizeWithEmbeddings(draft, observations, llmClient, embedder, systemPrompt, events)
+	if err != nil {
+		log.Printf("Embedding synthesis failed, keeping the draft: %v", err)
+		return draft
+	}
+	return revised
+}
+
+// reviewResult runs the --review-model pass over document, returning the
+// corrected document and the files the reviewer read
+func reviewResult(document, userPrompt, directoryPath string, maxIterations int, verbose bool, opts AgentOptions, args *Args) (string, []string, error) {
+	if args.ReplayFile != "" {
+		return "", nil, fmt.Errorf("the review pass is skipped in replay mode")
+	}
+	reviewer, err := NewLLMClient(args.ReviewModel, secondaryBaseURL(args.ReviewModel, args), LLMOptions{Seed: args.Seed})
+	if err != nil {
+		return "", nil, err
+	}
+	log.Printf("Reviewing the document with %s", args.ReviewModel)
+	reviewed, agent, err := reviewDocument(document, userPrompt, directoryPath, reviewer, maxIterations, verbose, opts)
+	if err != nil {
+		return "", nil, err
+	}
+	log.Printf("Review finished after %d iterations", agent.Iterations())
+	return reviewed, agent.Sources(), nil
+}
+
+// styleResult rewrites document according to the --style guide using the
+// --style-model
+func styleResult(document string, args *Args) (string, error) {
+	if args.ReplayFile != "" {
+		return "", fmt.Errorf("style rewrite is skipped in replay mode")
+	}
+	guide, err := loadStyleGuide(args.Style)
+	if err != nil {
+		return "", err
+	}
+	client, err := NewLLMClient(args.StyleModel, secondaryBaseURL(args.StyleModel, args), LLMOptions{Seed: args.Seed})
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Applying %s style guide with %s", args.Style, args.StyleModel)
+	return applyStyleGuide(document, guide, client)
+}
+
+// lintResult spell and terminology checks document, using the repository's
+// identifiers as the allow-list. In fix mode the fixable findings are applied.
+// Findings are logged and returned for the metadata.
+func lintResult(document, directoryPath string, args *Args) (string, []LintFinding) {
+	allow, err := repoVocabulary(directoryPath)
+	if err != nil {
+		log.Printf("Building the lint allow-list failed, linting without it: %v", err)
+		allow = map[string]bool{}
+	}
+	var dictionary map[string]bool
+	if args.LintDictionary != "" {
+		if dictionary, err = loadWordList(args.LintDictionary); err != nil {
+			log.Printf("Reporting known misspellings only: %v", err)
+		}
+	}
+
+	findings := lintDocument(document, allow, dictionary)
+	for _, finding := range findings {
+		if finding.Suggestion != "" {
+			log.Printf("Lint (%s) line %d: %q should be %q", finding.Kind, finding.Line, finding.Word, finding.Suggestion)
+		} else {
+			log.Printf("Lint (%s) line %d: %q", finding.Kind, finding.Line, finding.Word)
+		}
+	}
+	if args.Lint == "fix" {
+		var fixed int
+		document, fixed = applyLintFixes(document, findings)
+		log.Printf("Lint fixed %d of %d findings", fixed, len(findings))
+	}
+	return document, findings
+}
+
+// secondaryBaseURL returns the --base-url to use for an auxiliary model: the
+// custom endpoint is reused only when it belongs to the same vendor as --model
+func secondaryBaseURL(modelName string, args *Args) string {
+	if strings.SplitN(modelName, "/", 2)[0] == strings.SplitN(args.Model, "/", 2)[0] {
+		return args.BaseURL
+	}
+	return ""
 }
 
 func saveResults(analysisResult, modelName, repoName, outputDir, extension, fileName string) (string, error) {
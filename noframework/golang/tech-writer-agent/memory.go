@@ -0,0 +1,243 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Directory under the cache dir holding the per-repository memory files
+	MEMORY_DIR_NAME = ".tech-writer-memory"
+	// Limits that keep a memory file compact enough to put in a prompt
+	MEMORY_MAX_FINDINGS      = 20
+	MEMORY_MAX_KEY_FILES     = 50
+	MEMORY_MAX_FINDING_CHARS = 300
+)
+
+// RepoMemory is what a run remembers about a repository for later runs: its
+// module map, the files that mattered, and the key findings of the document
+type RepoMemory struct {
+	Repo      string   `json:"repo"`
+	Commit    string   `json:"commit"` // git HEAD, or the content fingerprint outside git
+	Model     string   `json:"model"`
+	CreatedAt string   `json:"created_at"`
+	Modules   []string `json:"modules,omitempty"`
+	KeyFiles  []string `json:"key_files,omitempty"`
+	Findings  []string `json:"findings,omitempty"`
+}
+
+// repoIdentity names a repository independently of where it is checked out:
+// owner/repo for GitHub sources, the absolute path for local directories
+func repoIdentity(repoURL, directory string) string {
+	if repoURL != "" {
+		return getRepoNameFromURL(repoURL)
+	}
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return directory
+	}
+	return absDir
+}
+
+// repoRevision identifies the state of the repository: its git HEAD, or the
+// content fingerprint when it is not a git work tree
+func repoRevision(directory string) (string, error) {
+	if commit := gitHeadCommit(directory); commit != "" {
+		return commit, nil
+	}
+	return repoFingerprint(directory)
+}
+
+// memoryPath returns the memory file for repo at revision. Files of the same
+// repo share a prefix so the latest one can be found when the revision changed.
+func memoryPath(cacheDir, repo, revision string) string {
+	return filepath.Join(memoryDir(cacheDir), memoryPrefix(repo)+shortHash(revision)+".json")
+}
+
+func memoryDir(cacheDir string) string {
+	return filepath.Join(expandHome(cacheDir), MEMORY_DIR_NAME)
+}
+
+func memoryPrefix(repo string) string {
+	return shortHash(repo) + "-"
+}
+
+// shortHash returns the first 16 hex digits of the SHA-256 of s
+func shortHash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:8])
+}
+
+// loadRepoMemory returns the memory saved for repo at revision, or failing
+// that the most recent memory of the repo at another revision. It returns nil
+// when the repo has none.
+func loadRepoMemory(cacheDir, repo, revision string) (*RepoMemory, error) {
+	if memory, err := readRepoMemory(memoryPath(cacheDir, repo, revision)); err == nil {
+		return memory, nil
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	candidates, err := filepath.Glob(filepath.Join(memoryDir(cacheDir), memoryPrefix(repo)+"*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var latest *RepoMemory
+	for _, path := range candidates {
+		memory, err := readRepoMemory(path)
+		if err != nil || memory.Repo != repo {
+			continue
+		}
+		if latest == nil || memory.CreatedAt > latest.CreatedAt {
+			latest = memory
+		}
+	}
+	return latest, nil
+}
+
+func readRepoMemory(path string) (*RepoMemory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var memory RepoMemory
+	if err := json.Unmarshal(data, &memory); err != nil {
+		return nil, fmt.Errorf("error parsing memory %s: %w", path, err)
+	}
+	return &memory, nil
+}
+
+// saveRepoMemory condenses a finished run into the memory for repo at its
+// current revision, replacing any memory of the same revision
+func saveRepoMemory(cacheDir, repo, directory, document string, sources []string, model string) (string, error) {
+	revision, err := repoRevision(directory)
+	if err != nil {
+		return "", err
+	}
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return "", fmt.Errorf("error resolving directory path: %w", err)
+	}
+
+	memory := RepoMemory{
+		Repo:      repo,
+		Commit:    revision,
+		Model:     model,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Findings:  keyFindings(document),
+	}
+	modules, err := repoModules(absDir)
+	if err != nil {
+		return "", err
+	}
+	for i, module := range modules {
+		if i == HIERARCHY_MAX_MODULES {
+			break
+		}
+		memory.Modules = append(memory.Modules, fmt.Sprintf("%s (%d files)", module.name, module.files))
+	}
+	for _, source := range sources {
+		if len(memory.KeyFiles) == MEMORY_MAX_KEY_FILES {
+			break
+		}
+		if rel, err := filepath.Rel(absDir, source); err == nil && !strings.HasPrefix(rel, "..") {
+			memory.KeyFiles = append(memory.KeyFiles, filepath.ToSlash(rel))
+		}
+	}
+
+	path := memoryPath(cacheDir, repo, revision)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("error creating memory directory: %w", err)
+	}
+	data, err := json.MarshalIndent(memory, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("error marshaling memory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("error writing memory: %w", err)
+	}
+	return path, nil
+}
+
+// keyFindings reduces a document to one line per level-2 section: the heading
+// and the start of its first paragraph
+func keyFindings(document string) []string {
+	lines := strings.Split(document, "\n")
+	var findings []string
+	for _, section := range splitSections(lines) {
+		if len(findings) == MEMORY_MAX_FINDINGS {
+			break
+		}
+		heading := ""
+		start := section.start
+		if section.heading >= 0 {
+			heading = strings.TrimSpace(strings.TrimPrefix(lines[section.heading], "## "))
+			start++
+		}
+		paragraph := firstParagraph(lines[start:section.end])
+		if paragraph == "" {
+			continue
+		}
+		finding := truncateRunes(paragraph, MEMORY_MAX_FINDING_CHARS)
+		if heading != "" {
+			finding = heading + ": " + finding
+		}
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+// firstParagraph returns the first run of prose lines, skipping headings,
+// code blocks, tables and blank lines, joined into one line
+func firstParagraph(lines []string) string {
+	var paragraph []string
+	inFence := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "|") {
+			continue
+		}
+		if trimmed == "" {
+			if len(paragraph) > 0 {
+				break
+			}
+			continue
+		}
+		paragraph = append(paragraph, trimmed)
+	}
+	return strings.Join(paragraph, " ")
+}
+
+// memoryPrompt renders memory for the start of a run's prompt. A memory of a
+// different revision comes with a warning that files may have changed.
+func memoryPrompt(memory *RepoMemory, revision string) string {
+	var b strings.Builder
+	if memory.Commit == revision {
+		fmt.Fprintf(&b, "Notes from an earlier analysis of this repository at the same revision (%s). Use them to plan your exploration, and read the files to confirm anything you rely on.\n", memory.CreatedAt)
+	} else {
+		fmt.Fprintf(&b, "Notes from an earlier analysis of this repository at a different revision (%s); files may have changed since. Use them to plan your exploration, and read the files to confirm anything you rely on.\n", memory.CreatedAt)
+	}
+	if len(memory.Modules) > 0 {
+		fmt.Fprintf(&b, "Modules: %s\n", strings.Join(memory.Modules, ", "))
+	}
+	if len(memory.KeyFiles) > 0 {
+		fmt.Fprintf(&b, "Key files: %s\n", strings.Join(memory.KeyFiles, ", "))
+	}
+	if len(memory.Findings) > 0 {
+		b.WriteString("Findings:\n")
+		for _, finding := range memory.Findings {
+			fmt.Fprintf(&b, "- %s\n", finding)
+		}
+	}
+	return b.String()
+}
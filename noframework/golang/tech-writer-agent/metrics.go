@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TokenUsage counts the tokens of provider requests, as reported by the
+// provider in each response's "usage" object
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// llmUsage totals the tokens of every provider request made by this process
+var llmUsage struct {
+	sync.Mutex
+	TokenUsage
+}
+
+// recordUsage adds the usage reported for one request to llmUsage
+func recordUsage(usage *TokenUsage) {
+	if usage == nil {
+		return
+	}
+	llmUsage.Lock()
+	defer llmUsage.Unlock()
+	llmUsage.PromptTokens += usage.PromptTokens
+	llmUsage.CompletionTokens += usage.CompletionTokens
+	llmUsage.TotalTokens += usage.TotalTokens
+}
+
+// totalUsage returns the tokens used so far
+func totalUsage() TokenUsage {
+	llmUsage.Lock()
+	defer llmUsage.Unlock()
+	return llmUsage.TokenUsage
+}
+
+// RunMetrics summarises a run for comparison with the other implementations
+// in the showcase. Times are in seconds.
+type RunMetrics struct {
+	Iterations    int            `json:"iterations"`
+	LLMCalls      int            `json:"llm_calls"`
+	LLMFailures   int            `json:"llm_failures"`
+	ToolCalls     map[string]int `json:"tool_calls"`
+	ToolFailures  int            `json:"tool_failures"`
+	RepeatedCalls int            `json:"repeated_tool_calls"`
+	Tokens        TokenUsage     `json:"tokens"`
+	TotalSeconds  float64        `json:"total_seconds"`
+	LLMSeconds    float64        `json:"llm_seconds"`
+	ToolSeconds   float64        `json:"tool_seconds"`
+}
+
+// MetricsSink gathers RunMetrics from the agent's events. One sink can observe
+// several agents, e.g. both attempts of an --auto-retry run and the reviewer.
+type MetricsSink struct {
+	mu           sync.Mutex
+	started      time.Time
+	iterations   int
+	llmCalls     int
+	llmFailures  int
+	llmTime      time.Duration
+	toolCalls    map[string]int
+	toolFailures int
+	repeated     int
+	toolTime     time.Duration
+}
+
+// NewMetricsSink starts measuring a run
+func NewMetricsSink() *MetricsSink {
+	return &MetricsSink{started: time.Now(), toolCalls: make(map[string]int)}
+}
+
+func (m *MetricsSink) OnIteration(event IterationEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.iterations++
+}
+
+func (m *MetricsSink) OnLLMCall(event LLMCallEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.llmCalls++
+	m.llmTime += event.Duration
+	if event.Err != nil {
+		m.llmFailures++
+	}
+}
+
+func (m *MetricsSink) OnToolCall(event ToolCallEvent) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.toolCalls[event.Tool]++
+	m.toolTime += event.Duration
+	if event.Cached {
+		m.repeated++
+	}
+	if event.Err != nil {
+		m.toolFailures++
+	}
+}
+
+func (m *MetricsSink) OnFinal(event FinalEvent) {}
+
+// Snapshot returns the metrics so far, with the tokens of every provider
+// request the process has made
+func (m *MetricsSink) Snapshot() RunMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	toolCalls := make(map[string]int, len(m.toolCalls))
+	for tool, count := range m.toolCalls {
+		toolCalls[tool] = count
+	}
+	return RunMetrics{
+		Iterations:    m.iterations,
+		LLMCalls:      m.llmCalls,
+		LLMFailures:   m.llmFailures,
+		ToolCalls:     toolCalls,
+		ToolFailures:  m.toolFailures,
+		RepeatedCalls: m.repeated,
+		Tokens:        totalUsage(),
+		TotalSeconds:  roundSeconds(time.Since(m.started)),
+		LLMSeconds:    roundSeconds(m.llmTime),
+		ToolSeconds:   roundSeconds(m.toolTime),
+	}
+}
+
+func roundSeconds(d time.Duration) float64 {
+	return float64(d.Round(10*time.Millisecond)) / float64(time.Second)
+}
+
+// Summary renders the metrics as a few lines for the end of the run
+func (r RunMetrics) Summary() string {
+	tools := make([]string, 0, len(r.ToolCalls))
+	calls := 0
+	for tool, count := range r.ToolCalls {
+		tools = append(tools, fmt.Sprintf("%s=%d", tool, count))
+		calls += count
+	}
+	sort.Strings(tools)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Run metrics:\n")
+	fmt.Fprintf(&b, "  iterations:  %d\n", r.Iterations)
+	fmt.Fprintf(&b, "  LLM calls:   %d (%d failed), %.1fs\n", r.LLMCalls, r.LLMFailures, r.LLMSeconds)
+	fmt.Fprintf(&b, "  tool calls:  %d (%d failed, %d repeated), %.1fs", calls, r.ToolFailures, r.RepeatedCalls, r.ToolSeconds)
+	if len(tools) > 0 {
+		fmt.Fprintf(&b, ": %s", strings.Join(tools, " "))
+	}
+	fmt.Fprintf(&b, "\n  tokens:      %d (%d prompt, %d completion)\n", r.Tokens.TotalTokens, r.Tokens.PromptTokens, r.Tokens.CompletionTokens)
+	fmt.Fprintf(&b, "  total time:  %.1fs", r.TotalSeconds)
+	return b.String()
+}
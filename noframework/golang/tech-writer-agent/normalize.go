@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// timestampLayouts are the timestamp formats written by the implementations
+// in the showcase: RFC 3339 (Go, TypeScript, PHP, bash) and local time
+// without a zone (Python's isoformat, C, Erlang). Zig writes Unix seconds.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// runNormalize implements the normalize command: it converts the metadata
+// written by the other implementations in the showcase (Python, TypeScript,
+// the framework comparisons, ...) to this package's schema and copies it with
+// its result into one directory, where eval batch and the comparison tooling
+// treat every implementation alike
+func runNormalize(argv []string) error {
+	flags := flag.NewFlagSet("normalize", flag.ExitOnError)
+	outputDir := flags.String("output-dir", "", "Directory to write the normalized results and metadata to (required)")
+	framework := flags.String("framework", "", "Implementation that produced results whose metadata doesn't record one (default: inferred from the path, e.g. noframework/python)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s normalize --output-dir DIR [--framework NAME] PATH...\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(flags.Output(), "PATH is a .metadata.json file or a directory searched for them.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(argv)
+	if *outputDir == "" || flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("-output-dir and at least one path are required")
+	}
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+
+	var metadataFiles []string
+	for _, path := range flags.Args() {
+		found, err := findMetadataFiles(path)
+		if err != nil {
+			return err
+		}
+		metadataFiles = append(metadataFiles, found...)
+	}
+
+	normalized := 0
+	written := make(map[string]bool)
+	for _, metadataFile := range metadataFiles {
+		if err := normalizeResult(metadataFile, *outputDir, *framework, written); err != nil {
+			log.Printf("Skipping %s: %v", metadataFile, err)
+			continue
+		}
+		normalized++
+	}
+	log.Printf("Normalized %d of %d results into %s", normalized, len(metadataFiles), *outputDir)
+	return nil
+}
+
+// findMetadataFiles returns path if it is a file, or the metadata files
+// anywhere under it if it is a directory
+func findMetadataFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	var files []string
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip what we can't access
+		}
+		if entry.IsDir() && (entry.Name() == ".git" || entry.Name() == "node_modules") {
+			return filepath.SkipDir
+		}
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".metadata.json") {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// normalizeResult converts metadataFile and copies it with its result (if
+// found) into outputDir, prefixing the names with the framework so results
+// of different implementations with the same name don't collide. written
+// holds the metadata files written so far, which are not overwritten.
+func normalizeResult(metadataFile, outputDir, framework string, written map[string]bool) error {
+	data, err := os.ReadFile(metadataFile)
+	if err != nil {
+		return err
+	}
+	metadata, err := normalizeMetadata(data)
+	if err != nil {
+		return err
+	}
+	if metadata.Framework == "" {
+		metadata.Framework = framework
+	}
+	if metadata.Framework == "" {
+		metadata.Framework = inferFramework(metadataFile)
+	}
+
+	prefix := ""
+	if metadata.Framework != "" {
+		prefix = sanitizeFilename(metadata.Framework) + "-"
+	}
+	target := filepath.Join(outputDir, prefix+filepath.Base(metadataFile))
+	if written[target] {
+		return fmt.Errorf("another result was already normalized to %s", target)
+	}
+	written[target] = true
+	if resultFile := resultForMetadata(metadataFile); resultFile != "" {
+		content, err := os.ReadFile(resultFile)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(outputDir, prefix+filepath.Base(resultFile)), content, 0644); err != nil {
+			return fmt.Errorf("error writing result: %w", err)
+		}
+	} else {
+		log.Printf("No result file found for %s; writing the metadata only", metadataFile)
+	}
+	return writeMetadata(target, metadata)
+}
+
+// normalizeMetadata parses metadata in any of the showcase's formats.
+// Fields this package doesn't know (e.g. word_count) are dropped.
+func normalizeMetadata(data []byte) (Metadata, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return Metadata{}, fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	if value, ok := fields["timestamp"]; ok {
+		timestamp, err := normalizeTimestamp(value)
+		if err != nil {
+			return Metadata{}, err
+		}
+		fields["timestamp"] = timestamp
+	}
+	// Erlang and Haskell record the --repo argument as "repository"
+	repository, _ := fields["repository"].(string)
+	delete(fields, "repository")
+
+	// Re-decode into the schema now that the field types agree
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return Metadata{}, err
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return Metadata{}, fmt.Errorf("invalid metadata: %w", err)
+	}
+
+	if metadata.GitHubURL == "" && repository != "" {
+		if validateGitHubURL(repository) {
+			metadata.GitHubURL = repository
+		} else {
+			metadata.Directory = repository
+		}
+	}
+	if metadata.RepoName == "" {
+		name := strings.TrimSuffix(strings.TrimSuffix(metadata.GitHubURL, "/"), ".git")
+		if name == "" {
+			name = metadata.Directory
+		}
+		if name != "" {
+			metadata.RepoName = filepath.Base(name)
+		}
+	}
+	metadata.Model = normalizeModel(metadata.Model)
+	return metadata, nil
+}
+
+// normalizeTimestamp returns value, a timestamp string or Unix seconds, in
+// RFC 3339. Timestamps without a zone are taken as local time.
+func normalizeTimestamp(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case float64:
+		return time.Unix(int64(value), 0).Format(time.RFC3339), nil
+	case string:
+		for _, layout := range timestampLayouts {
+			if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				return t.Format(time.RFC3339), nil
+			}
+		}
+		return "", fmt.Errorf("unrecognized timestamp %q", value)
+	}
+	return "", fmt.Errorf("unrecognized timestamp %v", value)
+}
+
+// normalizeModel adds the vendor to a bare model name, as the implementations
+// that take bare names assume: Gemini models are Google's, the rest OpenAI's
+func normalizeModel(model string) string {
+	if model == "" || strings.Contains(model, "/") {
+		return model
+	}
+	if strings.HasPrefix(model, "gemini") {
+		return "google/" + model
+	}
+	return "openai/" + model
+}
+
+// inferFramework names the implementation from where its results are in the
+// showcase: noframework/<language>/... or oss-agent-makers/<framework>/...
+func inferFramework(metadataFile string) string {
+	absPath, err := filepath.Abs(metadataFile)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(absPath), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		switch parts[i] {
+		case "noframework":
+			if parts[i+1] == "golang" {
+				return BUILTIN_FRAMEWORK
+			}
+			return "noframework/" + parts[i+1]
+		case "oss-agent-makers":
+			return parts[i+1]
+		}
+	}
+	return ""
+}
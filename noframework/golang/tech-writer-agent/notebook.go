@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Limits of notebook conversion
+const (
+	NOTEBOOK_MAX_BYTES        = 64 * 1024 * 1024 // larger notebooks are read raw, in chunks
+	NOTEBOOK_MAX_OUTPUT_CHARS = 1000             // of each cell's text output
+)
+
+// notebookText is a string that Jupyter may store as a list of lines
+type notebookText string
+
+func (t *notebookText) UnmarshalJSON(data []byte) error {
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err == nil {
+		*t = notebookText(strings.Join(lines, ""))
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*t = notebookText(text)
+	return nil
+}
+
+// notebook is the part of the Jupyter notebook format (nbformat 4) that
+// read_file shows
+type notebook struct {
+	Cells []struct {
+		CellType string       `json:"cell_type"` // code, markdown or raw
+		Source   notebookText `json:"source"`
+		Outputs  []struct {
+			OutputType string                  `json:"output_type"` // stream, execute_result, display_data or error
+			Text       notebookText            `json:"text"`
+			Data       map[string]notebookText `json:"data"`
+			Ename      string                  `json:"ename"`
+			Evalue     string                  `json:"evalue"`
+		} `json:"outputs"`
+	} `json:"cells"`
+	Metadata struct {
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+// readNotebook converts a Jupyter notebook into its cells as readable text:
+// markdown as is, code in fenced blocks followed by its text output, and
+// images and other rich output reduced to a placeholder. It returns false
+// if the file isn't a notebook it can convert, so it's read as is.
+func readNotebook(filePath string, size int64) (FileReadResult, bool) {
+	if size > NOTEBOOK_MAX_BYTES {
+		return FileReadResult{}, false
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return FileReadResult{}, false
+	}
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil || len(nb.Cells) == 0 {
+		return FileReadResult{}, false
+	}
+
+	language := nb.Metadata.LanguageInfo.Name
+	var b strings.Builder
+	counts := make(map[string]int)
+	for i, cell := range nb.Cells {
+		counts[cell.CellType]++
+		fmt.Fprintf(&b, "## Cell %d (%s)\n\n", i+1, cell.CellType)
+		source := strings.TrimRight(string(cell.Source), "\n")
+		if cell.CellType != "code" {
+			b.WriteString(source + "\n\n")
+			continue
+		}
+		fmt.Fprintf(&b, "```%s\n%s\n```\n\n", language, source)
+		for _, output := range cell.Outputs {
+			if text := notebookOutput(output.OutputType, string(output.Text), output.Data, output.Ename, output.Evalue); text != "" {
+				b.WriteString(text + "\n\n")
+			}
+		}
+	}
+
+	var parts []string
+	for _, cellType := range []string{"code", "markdown", "raw"} {
+		if counts[cellType] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[cellType], cellType))
+		}
+	}
+	return FileReadResult{
+		File:    filePath,
+		Content: b.String(),
+		Size:    size,
+		Note:    fmt.Sprintf("Converted from the notebook's JSON: %d cells (%s). Images and long outputs are omitted; pass raw=true for the JSON", len(nb.Cells), strings.Join(parts, ", ")),
+	}, true
+}
+
+// notebookOutput renders a code cell's output: text as is (truncated), an
+// error as its name and message, and anything else as a placeholder naming
+// its media types
+func notebookOutput(outputType, text string, data map[string]notebookText, ename, evalue string) string {
+	switch {
+	case outputType == "error":
+		return fmt.Sprintf("Error: %s: %s", ename, evalue)
+	case outputType == "stream":
+	case data["text/markdown"] != "":
+		text = string(data["text/markdown"])
+	case data["text/plain"] != "":
+		text = string(data["text/plain"])
+	}
+	if text = strings.TrimRight(text, "\n"); text != "" {
+		if len([]rune(text)) > NOTEBOOK_MAX_OUTPUT_CHARS {
+			text = truncateRunes(text, NOTEBOOK_MAX_OUTPUT_CHARS) + "\n[... output truncated ...]"
+		}
+		return "Output:\n```\n" + text + "\n```"
+	}
+	var mediaTypes []string
+	for mediaType := range data {
+		mediaTypes = append(mediaTypes, mediaType)
+	}
+	if len(mediaTypes) == 0 {
+		return ""
+	}
+	sort.Strings(mediaTypes)
+	return fmt.Sprintf("[%s output omitted]", strings.Join(mediaTypes, ", "))
+}
@@ -0,0 +1,21 @@
+package main
+
+// PresetOnboarding writes a guide for new engineers (--preset onboarding)
+const PresetOnboarding = "onboarding"
+
+// ONBOARDING_PROMPT is the task of --preset onboarding
+const ONBOARDING_PROMPT = `Write an onboarding guide for an engineer joining the team that works on this repository: what they need in their first week to get it running, understand how it works and find their way around the code. Assume they know the languages but not this code base or its domain.
+
+Start with a level-1 heading and a short paragraph on what the project does and who uses it. Then use these level-2 headings, in this order:
+## Setup
+Everything from a fresh machine to a working checkout: the tools and versions needed, the commands to install dependencies, build, run the tests and run it locally, and the services, environment variables or credentials it expects, taken from the manifests, Makefile, Dockerfiles, CI configuration and CONTRIBUTING files. Note the problems a newcomer is likely to hit.
+## The big picture
+A short map of the code: a table of the top-level directories and packages and what lives in each, and how the parts fit together.
+## Key flows
+The three to five most important paths through the code, such as handling a request, running a job or executing a command, each as a level-3 heading with numbered steps naming the file and function at each step, so the reader can follow along in an editor.
+## Where to start reading
+A numbered reading order of about ten files, from the entry points outwards, each with a sentence on why it matters and what to look for in it.
+## Glossary
+A table of the domain terms, project-specific names and abbreviations a newcomer will meet in the code and discussions, with what each means and where it is defined.
+
+Cite files and functions as path/to/file:line. Only describe what the files show: check commands and names against them rather than guessing, and say where something, such as how to get credentials, has to be asked of the team.`
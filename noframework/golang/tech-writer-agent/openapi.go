@@ -0,0 +1,501 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Limits of summarize_openapi
+const (
+	OPENAPI_MAX_SPECS       = 10               // summarised per call
+	OPENAPI_MAX_FILE_BYTES  = 20 * 1024 * 1024 // of a spec
+	OPENAPI_MAX_ENDPOINTS   = 500              // per spec
+	OPENAPI_MAX_SCHEMAS     = 300              // per spec
+	OPENAPI_MAX_PROPERTIES  = 40               // listed per schema
+	OPENAPI_MAX_TEXT_CHARS  = 200              // of a summary or description
+	OPENAPI_MAX_SCHEMA_SPAN = 4                // levels of inline schemas spelled out
+)
+
+// openAPIMethods are the operations of a path item, in the order they are listed
+var openAPIMethods = []string{"get", "put", "post", "patch", "delete", "head", "options", "trace"}
+
+// openAPIHeadPattern matches the top-level key that marks a YAML or JSON
+// file as an OpenAPI 3 or Swagger 2 spec
+var openAPIHeadPattern = regexp.MustCompile(`(?m)^\s*\{?\s*["']?(openapi|swagger)["']?\s*:`)
+
+// OpenAPIEndpoint is one operation of a spec. Types are compact: schema
+// names for references, T[] for arrays and {a, b} for inline objects.
+type OpenAPIEndpoint struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	OperationID string   `json:"operation_id,omitempty"`
+	Summary     string   `json:"summary,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Parameters  []string `json:"parameters,omitempty"` // in:name: type, with * when required
+	RequestBody string   `json:"request_body,omitempty"`
+	Responses   []string `json:"responses,omitempty"` // status: type
+	Deprecated  bool     `json:"deprecated,omitempty"`
+}
+
+// OpenAPISchema is one named schema (components/schemas, or definitions in
+// Swagger 2)
+type OpenAPISchema struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Properties  []string `json:"properties,omitempty"` // name: type, with * when required
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// OpenAPISpec summarises one spec
+type OpenAPISpec struct {
+	File        string            `json:"file"`
+	Version     string            `json:"version"` // of OpenAPI or Swagger
+	Title       string            `json:"title"`
+	APIVersion  string            `json:"api_version,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Servers     []string          `json:"servers,omitempty"`
+	Security    []string          `json:"security,omitempty"` // scheme: type
+	Endpoints   []OpenAPIEndpoint `json:"endpoints"`
+	Schemas     []OpenAPISchema   `json:"schemas"`
+	Truncated   bool              `json:"truncated,omitempty"` // more than OPENAPI_MAX_ENDPOINTS endpoints or OPENAPI_MAX_SCHEMAS schemas
+}
+
+// OpenAPIResult represents the specs summarised
+type OpenAPIResult struct {
+	Specs  []OpenAPISpec `json:"specs"`
+	Errors []string      `json:"errors,omitempty"` // specs that could not be parsed
+	Note   string        `json:"note,omitempty"`
+}
+
+// summarizeOpenAPI implements the summarize_openapi tool: the endpoints,
+// parameters and schemas of OpenAPI 3 and Swagger 2 specs in a compact form,
+// rather than the agent reading a spec of thousands of lines
+func summarizeOpenAPI(args map[string]interface{}) (interface{}, error) {
+	root, ok := args["path"].(string)
+	if !ok || root == "" {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	tag, _ := args["tag"].(string)
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("Path not found: %s", root)}, nil
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading path: %s", err)}, nil
+	}
+
+	files := []string{root}
+	if info.IsDir() {
+		files, err = findOpenAPISpecs(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := OpenAPIResult{Specs: []OpenAPISpec{}}
+	for _, file := range files {
+		spec, err := readOpenAPISpec(file, tag)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", file, err))
+			continue
+		}
+		result.Specs = append(result.Specs, spec)
+	}
+	if len(files) == OPENAPI_MAX_SPECS && info.IsDir() {
+		result.Note = fmt.Sprintf("Only the first %d specs were summarised; pass a spec's path to summarise another", OPENAPI_MAX_SPECS)
+	}
+	if len(files) == 0 {
+		result.Note = "No OpenAPI or Swagger specs found"
+	}
+	return result, nil
+}
+
+// findOpenAPISpecs returns the YAML and JSON files under root whose top-level
+// openapi or swagger key marks them as specs
+func findOpenAPISpecs(root string) ([]string, error) {
+	candidates, err := listFiles(root, DefaultWalkOptions())
+	if err != nil {
+		return nil, err
+	}
+	var specs []string
+	for _, file := range candidates {
+		switch strings.ToLower(filepath.Ext(file)) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		head := make([]byte, 4096)
+		n, _ := io.ReadFull(f, head)
+		f.Close()
+		if openAPIHeadPattern.Match(head[:n]) {
+			specs = append(specs, file)
+			if len(specs) == OPENAPI_MAX_SPECS {
+				break
+			}
+		}
+	}
+	return specs, nil
+}
+
+// readOpenAPISpec parses and summarises a spec. If tag is set, only the
+// endpoints with that tag are listed.
+func readOpenAPISpec(file, tag string) (OpenAPISpec, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return OpenAPISpec{}, err
+	}
+	if info.Size() > OPENAPI_MAX_FILE_BYTES {
+		return OpenAPISpec{}, fmt.Errorf("the spec is %s; summarize_openapi reads specs up to %s", formatBytes(int(info.Size())), formatBytes(OPENAPI_MAX_FILE_BYTES))
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return OpenAPISpec{}, err
+	}
+	// JSON is YAML, so one parser reads both
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return OpenAPISpec{}, err
+	}
+	s := openAPISummarizer{doc: doc}
+	spec := OpenAPISpec{File: file, Version: s.text(doc["openapi"]), Endpoints: []OpenAPIEndpoint{}, Schemas: []OpenAPISchema{}}
+	if spec.Version == "" {
+		spec.Version = s.text(doc["swagger"])
+		s.swagger = true
+	}
+	if spec.Version == "" {
+		return OpenAPISpec{}, fmt.Errorf("not an OpenAPI or Swagger spec (no openapi or swagger key)")
+	}
+
+	about := s.object(doc["info"])
+	spec.Title = s.text(about["title"])
+	spec.APIVersion = s.text(about["version"])
+	spec.Description = s.brief(about["description"])
+	if s.swagger {
+		if host := s.text(doc["host"]); host != "" {
+			spec.Servers = append(spec.Servers, host+s.text(doc["basePath"]))
+		}
+	}
+	for _, server := range s.list(doc["servers"]) {
+		spec.Servers = append(spec.Servers, s.text(s.object(server)["url"]))
+	}
+	schemes := s.object(s.object(doc["components"])["securitySchemes"])
+	if s.swagger {
+		schemes = s.object(doc["securityDefinitions"])
+	}
+	for _, name := range sortedKeys(schemes) {
+		scheme := s.object(schemes[name])
+		kind := s.text(scheme["type"])
+		if detail := s.text(scheme["scheme"]) + s.text(scheme["in"]); detail != "" {
+			kind += " (" + detail + ")"
+		}
+		spec.Security = append(spec.Security, name+": "+kind)
+	}
+
+	paths := s.object(doc["paths"])
+	for _, path := range sortedKeys(paths) {
+		item := s.object(s.resolve(paths[path]))
+		for _, method := range openAPIMethods {
+			operation, ok := item[method].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			endpoint := s.endpoint(method, path, operation, s.list(item["parameters"]))
+			if tag != "" && !containsString(endpoint.Tags, tag) {
+				continue
+			}
+			if len(spec.Endpoints) == OPENAPI_MAX_ENDPOINTS {
+				spec.Truncated = true
+				break
+			}
+			spec.Endpoints = append(spec.Endpoints, endpoint)
+		}
+	}
+
+	schemas := s.object(s.object(doc["components"])["schemas"])
+	if s.swagger {
+		schemas = s.object(doc["definitions"])
+	}
+	for _, name := range sortedKeys(schemas) {
+		if len(spec.Schemas) == OPENAPI_MAX_SCHEMAS {
+			spec.Truncated = true
+			break
+		}
+		spec.Schemas = append(spec.Schemas, s.schema(name, s.object(schemas[name])))
+	}
+	return spec, nil
+}
+
+// openAPISummarizer summarises the parts of a parsed spec
+type openAPISummarizer struct {
+	doc     map[string]interface{}
+	swagger bool // Swagger 2 rather than OpenAPI 3
+}
+
+// endpoint summarises an operation. pathParameters are those declared for
+// all operations of the path, which the operation's own override.
+func (s openAPISummarizer) endpoint(method, path string, operation map[string]interface{}, pathParameters []interface{}) OpenAPIEndpoint {
+	endpoint := OpenAPIEndpoint{
+		Method:      strings.ToUpper(method),
+		Path:        path,
+		OperationID: s.text(operation["operationId"]),
+		Summary:     s.brief(operation["summary"]),
+		Deprecated:  operation["deprecated"] == true,
+	}
+	if endpoint.Summary == "" {
+		endpoint.Summary = s.brief(operation["description"])
+	}
+	for _, tag := range s.list(operation["tags"]) {
+		endpoint.Tags = append(endpoint.Tags, s.text(tag))
+	}
+
+	parameters := make(map[string]map[string]interface{})
+	var order []string
+	for _, parameter := range append(append([]interface{}{}, pathParameters...), s.list(operation["parameters"])...) {
+		p := s.object(s.resolve(parameter))
+		key := s.text(p["in"]) + ":" + s.text(p["name"])
+		if _, ok := parameters[key]; !ok {
+			order = append(order, key)
+		}
+		parameters[key] = p
+	}
+	for _, key := range order {
+		p := parameters[key]
+		if s.text(p["in"]) == "body" {
+			// Swagger 2 passes the request body as a parameter
+			endpoint.RequestBody = s.typeOf(p["schema"], 0)
+			continue
+		}
+		schema := p["schema"]
+		if s.swagger {
+			schema = p // Swagger 2 parameters carry their type themselves
+		}
+		entry := key + ": " + s.typeOf(schema, 0)
+		if p["required"] == true {
+			entry += " *"
+		}
+		endpoint.Parameters = append(endpoint.Parameters, entry)
+	}
+
+	if body := s.object(s.resolve(operation["requestBody"])); body != nil {
+		endpoint.RequestBody = s.contentType(body)
+		if body["required"] == true {
+			endpoint.RequestBody += " *"
+		}
+	}
+	responses := s.object(operation["responses"])
+	for _, status := range sortedKeys(responses) {
+		response := s.object(s.resolve(responses[status]))
+		entry := status
+		if content := s.contentType(response); content != "" {
+			entry += ": " + content
+		} else if schema, ok := response["schema"]; ok {
+			entry += ": " + s.typeOf(schema, 0)
+		}
+		endpoint.Responses = append(endpoint.Responses, entry)
+	}
+	return endpoint
+}
+
+// contentType summarises the content of an OpenAPI 3 request body or
+// response: the schema of its JSON media type, or of its first one
+func (s openAPISummarizer) contentType(body map[string]interface{}) string {
+	content := s.object(body["content"])
+	if len(content) == 0 {
+		return ""
+	}
+	mediaTypes := sortedKeys(content)
+	mediaType := mediaTypes[0]
+	for _, candidate := range mediaTypes {
+		if strings.Contains(candidate, "json") {
+			mediaType = candidate
+			break
+		}
+	}
+	kind := s.typeOf(s.object(content[mediaType])["schema"], 0)
+	if !strings.Contains(mediaType, "json") {
+		kind += " (" + mediaType + ")"
+	}
+	return kind
+}
+
+// schema summarises a named schema
+func (s openAPISummarizer) schema(name string, schema map[string]interface{}) OpenAPISchema {
+	// Its own properties are listed below, so the type only says "object"
+	summary := OpenAPISchema{Name: name, Type: s.typeOf(schema, OPENAPI_MAX_SCHEMA_SPAN), Description: s.brief(schema["description"])}
+	for _, value := range s.list(schema["enum"]) {
+		summary.Enum = append(summary.Enum, s.text(value))
+	}
+	// The properties of all parts of a composition (allOf) are listed
+	parts := append([]interface{}{schema}, s.list(schema["allOf"])...)
+	for _, part := range parts {
+		object := s.object(part)
+		if _, ok := object["$ref"]; ok {
+			continue // named in Type
+		}
+		required := make(map[string]bool)
+		for _, field := range s.list(object["required"]) {
+			required[s.text(field)] = true
+		}
+		properties := s.object(object["properties"])
+		for _, property := range sortedKeys(properties) {
+			if len(summary.Properties) == OPENAPI_MAX_PROPERTIES {
+				summary.Properties = append(summary.Properties, "...")
+				return summary
+			}
+			entry := property + ": " + s.typeOf(properties[property], 1)
+			if required[property] {
+				entry += " *"
+			}
+			summary.Properties = append(summary.Properties, entry)
+		}
+	}
+	return summary
+}
+
+// typeOf renders a schema as a compact type: the name of a referenced
+// schema, T[] for arrays, map[T] for maps, A | B for oneOf and anyOf, A & B
+// for allOf and {a, b} for inline objects, spelled out to
+// OPENAPI_MAX_SCHEMA_SPAN levels
+func (s openAPISummarizer) typeOf(value interface{}, depth int) string {
+	schema := s.object(value)
+	if schema == nil {
+		return "any"
+	}
+	if ref, ok := schema["$ref"].(string); ok {
+		return ref[strings.LastIndex(ref, "/")+1:]
+	}
+	for _, composition := range []struct{ key, separator string }{{"oneOf", " | "}, {"anyOf", " | "}, {"allOf", " & "}} {
+		if parts := s.list(schema[composition.key]); len(parts) > 0 {
+			var kinds []string
+			for _, part := range parts {
+				kinds = append(kinds, s.typeOf(part, depth+1))
+			}
+			return strings.Join(kinds, composition.separator)
+		}
+	}
+
+	kind := s.text(schema["type"])
+	if kinds := s.list(schema["type"]); len(kinds) > 0 {
+		// OpenAPI 3.1 allows a list of types, e.g. [string, "null"]
+		var names []string
+		for _, k := range kinds {
+			names = append(names, s.text(k))
+		}
+		kind = strings.Join(names, " | ")
+	}
+	switch {
+	case kind == "array":
+		return s.typeOf(schema["items"], depth+1) + "[]"
+	case schema["additionalProperties"] != nil && schema["additionalProperties"] != false && schema["properties"] == nil:
+		return "map[" + s.typeOf(schema["additionalProperties"], depth+1) + "]"
+	case schema["properties"] != nil:
+		properties := s.object(schema["properties"])
+		if depth >= OPENAPI_MAX_SCHEMA_SPAN {
+			return "object"
+		}
+		var fields []string
+		for _, property := range sortedKeys(properties) {
+			fields = append(fields, property+": "+s.typeOf(properties[property], depth+1))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	case kind == "":
+		if len(s.list(schema["enum"])) > 0 {
+			return "enum"
+		}
+		return "any"
+	}
+	if format := s.text(schema["format"]); format != "" {
+		kind += "(" + format + ")"
+	}
+	if len(s.list(schema["enum"])) > 0 {
+		kind += " enum"
+	}
+	return kind
+}
+
+// resolve follows a local $ref (#/components/...) to what it refers to, and
+// returns anything else as it is
+func (s openAPISummarizer) resolve(value interface{}) interface{} {
+	for range 10 { // a chain of references, but not a cycle
+		ref, ok := s.object(value)["$ref"].(string)
+		if !ok || !strings.HasPrefix(ref, "#/") {
+			return value
+		}
+		var target interface{} = s.doc
+		for _, key := range strings.Split(ref[2:], "/") {
+			key = strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+			target = s.object(target)[key]
+		}
+		if target == nil {
+			return value
+		}
+		value = target
+	}
+	return value
+}
+
+// object returns value as a mapping, or nil
+func (s openAPISummarizer) object(value interface{}) map[string]interface{} {
+	object, _ := value.(map[string]interface{})
+	return object
+}
+
+// list returns value as a sequence, or nil
+func (s openAPISummarizer) list(value interface{}) []interface{} {
+	list, _ := value.([]interface{})
+	return list
+}
+
+// text returns a scalar as a string, or "" for anything else
+func (s openAPISummarizer) text(value interface{}) string {
+	switch value := value.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	case string:
+		return value
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// brief returns the first line of a description, shortened to
+// OPENAPI_MAX_TEXT_CHARS
+func (s openAPISummarizer) brief(value interface{}) string {
+	text := strings.TrimSpace(s.text(value))
+	if line, _, found := strings.Cut(text, "\n"); found {
+		text = strings.TrimSpace(line)
+	}
+	return truncateRunes(text, OPENAPI_MAX_TEXT_CHARS)
+}
+
+// sortedKeys returns the keys of a mapping in order
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
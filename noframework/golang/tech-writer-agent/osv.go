@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Limits of check_vulnerabilities
+const (
+	OSV_MAX_DEPENDENCIES = 1000 // queried, the most one batch query takes
+	OSV_MAX_DETAILS      = 100  // vulnerabilities whose details are fetched
+	OSV_MAX_RESPONSE     = 8 * 1024 * 1024
+	OSV_TIMEOUT          = 30 * time.Second // per request
+	OSV_SUMMARY_CHARS    = 200
+)
+
+// osvAPI is the OSV.dev API the dependencies are looked up in
+var osvAPI = "https://api.osv.dev/v1"
+
+// OSV ecosystems of the dependencies found
+const (
+	EcosystemGo   = "Go"
+	EcosystemNPM  = "npm"
+	EcosystemPyPI = "PyPI"
+)
+
+// Dependency is a package at the version a project uses
+type Dependency struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Ecosystem string `json:"ecosystem"`
+	Source    string `json:"source"` // the file the version was read from
+}
+
+// Vulnerability is a known vulnerability of a dependency
+type Vulnerability struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases,omitempty"` // e.g. the CVE
+	Summary  string   `json:"summary,omitempty"`
+	Severity string   `json:"severity,omitempty"` // the database's rating, else the CVSS vector
+	FixedIn  []string `json:"fixed_in,omitempty"`
+	URL      string   `json:"url"`
+}
+
+// VulnerableDependency is a dependency with known vulnerabilities
+type VulnerableDependency struct {
+	Dependency
+	Vulnerabilities []Vulnerability `json:"vulnerabilities"`
+}
+
+// VulnerabilitiesResult represents the known vulnerabilities of a project's
+// dependencies
+type VulnerabilitiesResult struct {
+	DependenciesChecked int                    `json:"dependencies_checked"`
+	Ecosystems          map[string]int         `json:"ecosystems,omitempty"` // dependencies checked per ecosystem
+	VulnerabilityCount  int                    `json:"vulnerability_count"`
+	Vulnerable          []VulnerableDependency `json:"vulnerable"`
+	Truncated           bool                   `json:"truncated,omitempty"` // more dependencies than OSV_MAX_DEPENDENCIES, or vulnerabilities than OSV_MAX_DETAILS
+	Note                string                 `json:"note,omitempty"`
+}
+
+// newCheckVulnerabilitiesTool creates the check_vulnerabilities tool, which
+// is registered only with --osv since it sends the names and versions of the
+// project's dependencies to OSV.dev
+func newCheckVulnerabilitiesTool() Tool {
+	client := &http.Client{Timeout: OSV_TIMEOUT}
+	return Tool{
+		Name:        "check_vulnerabilities",
+		Description: "Look up the known vulnerabilities of the project's dependencies in the OSV.dev database. Dependencies are read from go.mod, package-lock.json (or node_modules), requirements.txt pins and a Python virtual environment. Use it for security sections and reviews",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Project directory containing the manifests"},
+		},
+		Function: func(args map[string]interface{}) (interface{}, error) {
+			directory, ok := args["directory"].(string)
+			if !ok {
+				return nil, fmt.Errorf("directory parameter is required")
+			}
+			return checkVulnerabilities(client, directory), nil
+		},
+		Limits: ToolLimits{Timeout: OSV_TIMEOUT * 3},
+	}
+}
+
+// checkVulnerabilities queries OSV.dev for the dependencies of the project in
+// directory. Problems are reported as {"error": ...} results like the file
+// tools do.
+func checkVulnerabilities(client *http.Client, directory string) interface{} {
+	if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+		return map[string]string{"error": fmt.Sprintf("Not a directory: %s", directory)}
+	}
+	result := VulnerabilitiesResult{Ecosystems: map[string]int{}, Vulnerable: []VulnerableDependency{}}
+	dependencies := projectDependencies(directory)
+	if len(dependencies) == 0 {
+		result.Note = "No dependencies with exact versions found (go.mod, package-lock.json or node_modules, pinned requirements.txt, .venv)"
+		return result
+	}
+	if len(dependencies) > OSV_MAX_DEPENDENCIES {
+		dependencies = dependencies[:OSV_MAX_DEPENDENCIES]
+		result.Truncated = true
+	}
+
+	ids, err := osvQueryBatch(client, dependencies)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error querying OSV.dev: %s", err)}
+	}
+	details := make(map[string]*osvVulnerability)
+	for i, dependency := range dependencies {
+		result.DependenciesChecked++
+		result.Ecosystems[dependency.Ecosystem]++
+		if len(ids[i]) == 0 {
+			continue
+		}
+		vulnerable := VulnerableDependency{Dependency: dependency}
+		for _, id := range ids[i] {
+			result.VulnerabilityCount++
+			vulnerability := Vulnerability{ID: id, URL: "https://osv.dev/vulnerability/" + id}
+			if _, fetched := details[id]; !fetched && len(details) < OSV_MAX_DETAILS {
+				details[id], _ = osvVulnerabilityDetails(client, id) // a failed lookup leaves only the ID
+			} else if !fetched {
+				result.Truncated = true
+			}
+			if detail := details[id]; detail != nil {
+				detail.describe(&vulnerability, dependency)
+			}
+			vulnerable.Vulnerabilities = append(vulnerable.Vulnerabilities, vulnerability)
+		}
+		result.Vulnerable = append(result.Vulnerable, vulnerable)
+	}
+	sort.SliceStable(result.Vulnerable, func(i, j int) bool {
+		return len(result.Vulnerable[i].Vulnerabilities) > len(result.Vulnerable[j].Vulnerabilities)
+	})
+	if result.VulnerabilityCount == 0 {
+		result.Note = "OSV.dev knows of no vulnerabilities in these versions"
+	}
+	return result
+}
+
+// osvVulnerability is the part of an OSV record the tool reports
+type osvVulnerability struct {
+	ID       string   `json:"id"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Aliases  []string `json:"aliases"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Ranges []struct {
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+		DatabaseSpecific struct {
+			Severity string `json:"severity"`
+		} `json:"database_specific"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// describe fills in what the record says about the vulnerability of
+// dependency: its summary, severity and the versions that fix it
+func (v *osvVulnerability) describe(vulnerability *Vulnerability, dependency Dependency) {
+	vulnerability.Aliases = v.Aliases
+	vulnerability.Summary = v.Summary
+	if vulnerability.Summary == "" {
+		vulnerability.Summary = strings.Join(strings.Fields(truncateRunes(v.Details, OSV_SUMMARY_CHARS)), " ")
+	}
+	vulnerability.Severity = v.DatabaseSpecific.Severity
+	for _, affected := range v.Affected {
+		if affected.Package.Ecosystem != dependency.Ecosystem || !strings.EqualFold(affected.Package.Name, dependency.Name) {
+			continue
+		}
+		if vulnerability.Severity == "" {
+			vulnerability.Severity = affected.DatabaseSpecific.Severity
+		}
+		for _, r := range affected.Ranges {
+			for _, event := range r.Events {
+				if fixed := event["fixed"]; fixed != "" && !containsString(vulnerability.FixedIn, fixed) {
+					vulnerability.FixedIn = append(vulnerability.FixedIn, fixed)
+				}
+			}
+		}
+	}
+	if vulnerability.Severity == "" && len(v.Severity) > 0 {
+		vulnerability.Severity = v.Severity[0].Score
+	}
+}
+
+// osvQueryBatch returns the IDs of the vulnerabilities of each dependency,
+// following the pages of results OSV.dev splits long lists into
+func osvQueryBatch(client *http.Client, dependencies []Dependency) ([][]string, error) {
+	type query struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Version   string `json:"version"`
+		PageToken string `json:"page_token,omitempty"`
+	}
+	queries := make([]query, len(dependencies))
+	for i, dependency := range dependencies {
+		queries[i].Package.Name = dependency.Name
+		queries[i].Package.Ecosystem = dependency.Ecosystem
+		queries[i].Version = dependency.Version
+	}
+
+	ids := make([][]string, len(dependencies))
+	pending := make([]int, len(dependencies)) // indexes of the queries still to send
+	for i := range pending {
+		pending[i] = i
+	}
+	for len(pending) > 0 {
+		batch := make([]query, len(pending))
+		for i, index := range pending {
+			batch[i] = queries[index]
+		}
+		var response struct {
+			Results []struct {
+				Vulns []struct {
+					ID string `json:"id"`
+				} `json:"vulns"`
+				NextPageToken string `json:"next_page_token"`
+			} `json:"results"`
+		}
+		if err := osvRequest(client, http.MethodPost, "/querybatch", map[string]interface{}{"queries": batch}, &response); err != nil {
+			return nil, err
+		}
+		if len(response.Results) != len(batch) {
+			return nil, fmt.Errorf("%d results for %d queries", len(response.Results), len(batch))
+		}
+		var next []int
+		for i, result := range response.Results {
+			index := pending[i]
+			for _, vuln := range result.Vulns {
+				ids[index] = append(ids[index], vuln.ID)
+			}
+			if result.NextPageToken != "" {
+				queries[index].PageToken = result.NextPageToken
+				next = append(next, index)
+			}
+		}
+		pending = next
+	}
+	return ids, nil
+}
+
+// osvVulnerabilityDetails fetches the OSV record of a vulnerability
+func osvVulnerabilityDetails(client *http.Client, id string) (*osvVulnerability, error) {
+	var vulnerability osvVulnerability
+	if err := osvRequest(client, http.MethodGet, "/vulns/"+url.PathEscape(id), nil, &vulnerability); err != nil {
+		return nil, err
+	}
+	return &vulnerability, nil
+}
+
+// osvRequest sends a request to the OSV.dev API and decodes the response
+// into response
+func osvRequest(client *http.Client, method, path string, body interface{}, response interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, osvAPI+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "tech-writer-agent/"+Version)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s %s: %s", method, path, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, OSV_MAX_RESPONSE)).Decode(response)
+}
+
+// projectDependencies returns the dependencies of the project in directory
+// whose exact versions are known: the requirements of go.mod, the packages
+// of package-lock.json (or, without one, those installed in node_modules),
+// the pins of requirements.txt and the packages of a Python virtual
+// environment
+func projectDependencies(directory string) []Dependency {
+	var dependencies []Dependency
+	seen := make(map[string]bool)
+	add := func(dependency Dependency) {
+		key := dependency.Ecosystem + "\x00" + strings.ToLower(dependency.Name) + "\x00" + dependency.Version
+		if dependency.Name != "" && dependency.Version != "" && !seen[key] {
+			seen[key] = true
+			dependencies = append(dependencies, dependency)
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(directory, "go.mod")); err == nil {
+		for _, requirement := range goRequirements(data) {
+			// OSV records Go versions without the v
+			add(Dependency{Name: requirement.Module, Version: strings.TrimPrefix(requirement.Version, "v"), Ecosystem: EcosystemGo, Source: "go.mod"})
+		}
+	}
+
+	if locked := packageLockDependencies(filepath.Join(directory, "package-lock.json")); locked != nil {
+		for _, dependency := range locked {
+			add(dependency)
+		}
+	} else {
+		for _, installed := range nodeDependencyLicenses(directory) {
+			add(Dependency{Name: installed.Name, Version: installed.Version, Ecosystem: EcosystemNPM, Source: "node_modules"})
+		}
+	}
+
+	for _, dependency := range requirementPins(filepath.Join(directory, "requirements.txt")) {
+		add(dependency)
+	}
+	for _, installed := range pythonDependencyLicenses(directory) {
+		add(Dependency{Name: installed.Name, Version: installed.Version, Ecosystem: EcosystemPyPI, Source: installed.Source})
+	}
+	return dependencies
+}
+
+// packageLockDependencies reads the packages of an npm lock file: the
+// "packages" of lockfile versions 2 and 3, else the "dependencies" of
+// version 1. It returns nil if there is no lock file.
+func packageLockDependencies(file string) []Dependency {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	type lockedPackage struct {
+		Version      string                   `json:"version"`
+		Link         bool                     `json:"link"`
+		Dependencies map[string]lockedPackage `json:"dependencies"` // nested, in version 1
+	}
+	var lock struct {
+		Packages     map[string]lockedPackage `json:"packages"`
+		Dependencies map[string]lockedPackage `json:"dependencies"`
+	}
+	if json.Unmarshal(data, &lock) != nil {
+		return nil
+	}
+	dependencies := []Dependency{}
+	if len(lock.Packages) > 0 {
+		for path, pkg := range lock.Packages {
+			// "node_modules/a/node_modules/@scope/b" is the package @scope/b
+			index := strings.LastIndex(path, "node_modules/")
+			if index < 0 || pkg.Link {
+				continue // the project itself, or a workspace
+			}
+			dependencies = append(dependencies, Dependency{Name: path[index+len("node_modules/"):], Version: pkg.Version, Ecosystem: EcosystemNPM, Source: "package-lock.json"})
+		}
+	} else {
+		var walk func(map[string]lockedPackage)
+		walk = func(packages map[string]lockedPackage) {
+			for name, pkg := range packages {
+				dependencies = append(dependencies, Dependency{Name: name, Version: pkg.Version, Ecosystem: EcosystemNPM, Source: "package-lock.json"})
+				walk(pkg.Dependencies)
+			}
+		}
+		walk(lock.Dependencies)
+	}
+	sort.Slice(dependencies, func(i, j int) bool {
+		if dependencies[i].Name != dependencies[j].Name {
+			return dependencies[i].Name < dependencies[j].Name
+		}
+		return dependencies[i].Version < dependencies[j].Version
+	})
+	return dependencies
+}
+
+// requirementPinPattern matches a requirement pinned to one version, such as
+// "requests==2.31.0" or "Django[argon2] == 4.2.1 ; python_version >= '3.8'"
+var requirementPinPattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(?:\[[^\]]*\])?\s*===?\s*([A-Za-z0-9][A-Za-z0-9.+!_-]*)\s*(?:;.*)?$`)
+
+// requirementPins reads the requirements of a requirements.txt file that are
+// pinned to one version; ranges say nothing about the version installed
+func requirementPins(file string) []Dependency {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var dependencies []Dependency
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if comment := strings.Index(line, "#"); comment >= 0 {
+			line = line[:comment]
+		}
+		line = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "\\"))
+		if options := strings.Index(line, " --"); options >= 0 {
+			line = line[:options] // --hash=... and other per-requirement options
+		}
+		if match := requirementPinPattern.FindStringSubmatch(line); match != nil {
+			dependencies = append(dependencies, Dependency{Name: match[1], Version: match[2], Ecosystem: EcosystemPyPI, Source: "requirements.txt"})
+		}
+	}
+	return dependencies
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Limits of get_file_outline
+const (
+	OUTLINE_MAX_FILE_BYTES  = 2 * 1024 * 1024
+	OUTLINE_MAX_ITEMS       = 500
+	OUTLINE_SIGNATURE_CHARS = 200
+)
+
+// OutlineItem is a class, function or other definition in a source file
+type OutlineItem struct {
+	Kind      string        `json:"kind"` // class, function, method, interface, ...
+	Name      string        `json:"name"`
+	Signature string        `json:"signature"` // the definition's header, up to its body
+	Line      int           `json:"line"`
+	EndLine   int           `json:"end_line"`
+	Children  []OutlineItem `json:"children,omitempty"` // e.g. the methods of a class
+}
+
+// FileOutlineResult represents the outline of a source file
+type FileOutlineResult struct {
+	File      string        `json:"file"`
+	Language  string        `json:"language"`
+	Items     []OutlineItem `json:"items"`
+	Truncated bool          `json:"truncated,omitempty"` // more than OUTLINE_MAX_ITEMS definitions
+}
+
+// getFileOutline implements the get_file_outline tool: it parses a source
+// file and lists its classes, functions and methods with their signatures
+func getFileOutline(args map[string]interface{}) (interface{}, error) {
+	filePath, ok := args["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("File not found: %s", filePath)}, nil
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	if info.Size() > OUTLINE_MAX_FILE_BYTES {
+		return map[string]string{"error": fmt.Sprintf("File is too large to outline (%s)", formatBytes(int(info.Size())))}, nil
+	}
+
+	if detectLanguage(filePath) == "Go" {
+		return map[string]string{"error": "Use extract_symbols for Go files"}, nil
+	}
+	language := outlineLanguage(filePath)
+	if language == "" {
+		return map[string]string{"error": fmt.Sprintf("No outline support for %s; supported languages: %s", filePath, strings.Join(outlineLanguages(), ", "))}, nil
+	}
+	source, err := os.ReadFile(filePath)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	items, err := parseOutline(language, source)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error parsing %s: %s", filePath, err)}, nil
+	}
+
+	result := FileOutlineResult{File: filePath, Language: language, Items: items}
+	if countOutlineItems(items) > OUTLINE_MAX_ITEMS {
+		result.Items = limitOutline(items, OUTLINE_MAX_ITEMS)
+		result.Truncated = true
+	}
+	return result, nil
+}
+
+// outlineLanguage returns the outline grammar for a file, or "" if there is
+// none. TSX needs its own grammar.
+func outlineLanguage(path string) string {
+	language := detectLanguage(path)
+	if language == "TypeScript" && strings.HasSuffix(strings.ToLower(path), ".tsx") {
+		language = "TSX"
+	}
+	for _, supported := range outlineLanguages() {
+		if supported == language {
+			return language
+		}
+	}
+	return ""
+}
+
+func countOutlineItems(items []OutlineItem) int {
+	count := len(items)
+	for _, item := range items {
+		count += countOutlineItems(item.Children)
+	}
+	return count
+}
+
+// limitOutline keeps the first max items, counting children
+func limitOutline(items []OutlineItem, max int) []OutlineItem {
+	var kept []OutlineItem
+	for _, item := range items {
+		if max <= 0 {
+			break
+		}
+		max--
+		item.Children = limitOutline(item.Children, max)
+		max -= countOutlineItems(item.Children)
+		kept = append(kept, item)
+	}
+	return kept
+}
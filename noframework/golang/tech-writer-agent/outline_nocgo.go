@@ -0,0 +1,16 @@
+//go:build !cgo
+
+package main
+
+import "fmt"
+
+// The tree-sitter grammars are C code, so builds without cgo (e.g. cross
+// compiled with CGO_ENABLED=0) have no outline support
+
+func outlineLanguages() []string {
+	return nil
+}
+
+func parseOutline(language string, source []byte) ([]OutlineItem, error) {
+	return nil, fmt.Errorf("get_file_outline needs a build with cgo")
+}
@@ -0,0 +1,230 @@
+//go:build cgo
+
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/c"
+	"github.com/smacker/go-tree-sitter/cpp"
+	"github.com/smacker/go-tree-sitter/csharp"
+	"github.com/smacker/go-tree-sitter/java"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/php"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/ruby"
+	"github.com/smacker/go-tree-sitter/rust"
+	"github.com/smacker/go-tree-sitter/typescript/tsx"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+// outlineNode says how a tree-sitter node type appears in the outline.
+// Containers (classes, modules, ...) are searched for nested definitions;
+// functions are not, so local helpers don't clutter the outline.
+type outlineNode struct {
+	kind      string
+	container bool
+}
+
+// outlineGrammar is a tree-sitter grammar and its definition node types
+type outlineGrammar struct {
+	language func() *sitter.Language
+	nodes    map[string]outlineNode
+}
+
+var (
+	classNode     = outlineNode{kind: "class", container: true}
+	interfaceNode = outlineNode{kind: "interface", container: true}
+	functionNode  = outlineNode{kind: "function"}
+	methodNode    = outlineNode{kind: "method"}
+)
+
+// The node types of JavaScript, shared by TypeScript
+var javascriptNodes = map[string]outlineNode{
+	"class_declaration":              classNode,
+	"function_declaration":           functionNode,
+	"generator_function_declaration": functionNode,
+	"method_definition":              methodNode,
+}
+
+var typescriptNodes = mergeOutlineNodes(javascriptNodes, map[string]outlineNode{
+	"abstract_class_declaration": classNode,
+	"interface_declaration":      interfaceNode,
+	"type_alias_declaration":     {kind: "type"},
+	"enum_declaration":           {kind: "enum"},
+	"internal_module":            {kind: "namespace", container: true},
+	"method_signature":           methodNode,
+	"abstract_method_signature":  methodNode,
+})
+
+var cNodes = map[string]outlineNode{
+	"function_definition": functionNode,
+	"struct_specifier":    {kind: "struct"},
+	"enum_specifier":      {kind: "enum"},
+}
+
+// outlineGrammars are the grammars by language name, as detectLanguage
+// reports it
+var outlineGrammars = map[string]outlineGrammar{
+	"Python": {python.GetLanguage, map[string]outlineNode{
+		"class_definition":    classNode,
+		"function_definition": functionNode,
+	}},
+	"JavaScript": {javascript.GetLanguage, javascriptNodes},
+	"TypeScript": {typescript.GetLanguage, typescriptNodes},
+	"TSX":        {tsx.GetLanguage, typescriptNodes},
+	"Java": {java.GetLanguage, map[string]outlineNode{
+		"class_declaration":       classNode,
+		"record_declaration":      classNode,
+		"interface_declaration":   interfaceNode,
+		"enum_declaration":        {kind: "enum", container: true},
+		"method_declaration":      methodNode,
+		"constructor_declaration": {kind: "constructor"},
+	}},
+	"C#": {csharp.GetLanguage, map[string]outlineNode{
+		"namespace_declaration":   {kind: "namespace", container: true},
+		"class_declaration":       classNode,
+		"record_declaration":      classNode,
+		"struct_declaration":      {kind: "struct", container: true},
+		"interface_declaration":   interfaceNode,
+		"enum_declaration":        {kind: "enum"},
+		"method_declaration":      methodNode,
+		"constructor_declaration": {kind: "constructor"},
+	}},
+	"Rust": {rust.GetLanguage, map[string]outlineNode{
+		"mod_item":                {kind: "module", container: true},
+		"struct_item":             {kind: "struct"},
+		"enum_item":               {kind: "enum"},
+		"trait_item":              {kind: "trait", container: true},
+		"impl_item":               {kind: "impl", container: true},
+		"type_item":               {kind: "type"},
+		"function_item":           functionNode,
+		"function_signature_item": functionNode,
+	}},
+	"C": {c.GetLanguage, cNodes},
+	"C++": {cpp.GetLanguage, mergeOutlineNodes(cNodes, map[string]outlineNode{
+		"namespace_definition": {kind: "namespace", container: true},
+		"class_specifier":      classNode,
+		"struct_specifier":     {kind: "struct", container: true},
+	})},
+	"Ruby": {ruby.GetLanguage, map[string]outlineNode{
+		"module":           {kind: "module", container: true},
+		"class":            classNode,
+		"method":           methodNode,
+		"singleton_method": methodNode,
+	}},
+	"PHP": {php.GetLanguage, map[string]outlineNode{
+		"namespace_definition":  {kind: "namespace", container: true},
+		"class_declaration":     classNode,
+		"interface_declaration": interfaceNode,
+		"trait_declaration":     {kind: "trait", container: true},
+		"function_definition":   functionNode,
+		"method_declaration":    methodNode,
+	}},
+}
+
+func mergeOutlineNodes(base, extra map[string]outlineNode) map[string]outlineNode {
+	merged := make(map[string]outlineNode, len(base)+len(extra))
+	for nodeType, node := range base {
+		merged[nodeType] = node
+	}
+	for nodeType, node := range extra {
+		merged[nodeType] = node
+	}
+	return merged
+}
+
+// outlineLanguages lists the languages get_file_outline supports
+func outlineLanguages() []string {
+	languages := make([]string, 0, len(outlineGrammars))
+	for language := range outlineGrammars {
+		languages = append(languages, language)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// parseOutline parses source with the grammar of language and returns its
+// definitions
+func parseOutline(language string, source []byte) ([]OutlineItem, error) {
+	grammar := outlineGrammars[language]
+	parser := sitter.NewParser()
+	defer parser.Close()
+	parser.SetLanguage(grammar.language())
+	tree, err := parser.ParseCtx(context.Background(), nil, source)
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Close()
+	return outlineChildren(tree.RootNode(), source, grammar.nodes, false), nil
+}
+
+// outlineChildren collects the definitions below node, looking through
+// nodes that aren't definitions themselves (exports, decorators, class
+// bodies, ...). Functions inside a class are reported as methods.
+func outlineChildren(node *sitter.Node, source []byte, nodes map[string]outlineNode, inClass bool) []OutlineItem {
+	var items []OutlineItem
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		child := node.NamedChild(i)
+		definition, ok := nodes[child.Type()]
+		if !ok {
+			items = append(items, outlineChildren(child, source, nodes, inClass)...)
+			continue
+		}
+		// A struct or enum type used without a body, e.g. "struct point p;"
+		if (definition.kind == "struct" || definition.kind == "enum") && child.ChildByFieldName("body") == nil {
+			continue
+		}
+		if definition.kind == "function" && inClass {
+			definition.kind = "method"
+		}
+		item := OutlineItem{
+			Kind:      definition.kind,
+			Name:      definitionName(child, source),
+			Signature: definitionHeader(child, source),
+			Line:      int(child.StartPoint().Row) + 1,
+			EndLine:   int(child.EndPoint().Row) + 1,
+		}
+		if definition.container {
+			item.Children = outlineChildren(child, source, nodes, definition.kind != "namespace" && definition.kind != "module")
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// definitionName finds the name of a definition: its "name" field, or for
+// C-style declarations the identifier inside its declarator, or for Rust
+// impl blocks the implemented type
+func definitionName(node *sitter.Node, source []byte) string {
+	if name := node.ChildByFieldName("name"); name != nil {
+		return name.Content(source)
+	}
+	for _, field := range []string{"declarator", "type"} {
+		if declarator := node.ChildByFieldName(field); declarator != nil {
+			if inner := definitionName(declarator, source); inner != "" {
+				return inner
+			}
+			return declarator.Content(source)
+		}
+	}
+	return ""
+}
+
+// definitionHeader returns the text of a definition up to its body, with
+// whitespace collapsed
+func definitionHeader(node *sitter.Node, source []byte) string {
+	end := node.EndByte()
+	if body := node.ChildByFieldName("body"); body != nil {
+		end = body.StartByte()
+	}
+	header := string(source[node.StartByte():end])
+	if end == node.EndByte() {
+		header, _, _ = strings.Cut(header, "\n")
+	}
+	header = strings.Join(strings.Fields(header), " ")
+	return truncateRunes(strings.TrimRight(header, ":;"), OUTLINE_SIGNATURE_CHARS)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Limits of map_ownership
+const (
+	OWNERS_DEFAULT_DEPTH      = 1
+	OWNERS_MAX_DEPTH          = 4
+	OWNERS_DEFAULT_COMMITTERS = 3
+	OWNERS_MAX_COMMITTERS     = 10
+	OWNERS_MAX_DIRECTORIES    = 200
+	OWNERS_MAX_COMMITS        = 5000 // of history read for the committers
+	OWNERS_MAX_RULES          = 300  // CODEOWNERS rules listed
+)
+
+// codeownersLocations are where GitHub, GitLab and Bitbucket look for the
+// CODEOWNERS file, in the order they do
+var codeownersLocations = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS", ".gitlab/CODEOWNERS", ".bitbucket/CODEOWNERS"}
+
+// CodeownersRule is one line of a CODEOWNERS file
+type CodeownersRule struct {
+	Pattern string   `json:"pattern"`
+	Owners  []string `json:"owners"`            // none means the files are explicitly unowned
+	Section string   `json:"section,omitempty"` // GitLab [Section] the rule is in
+	Line    int      `json:"line"`
+}
+
+// OwnerShare is an owner set and how many of a directory's files it owns
+type OwnerShare struct {
+	Owners string `json:"owners"` // space-separated, as in CODEOWNERS
+	Files  int    `json:"files"`
+}
+
+// Committer is an author and their commits to a directory
+type Committer struct {
+	Name    string `json:"name"`
+	Commits int    `json:"commits"`
+}
+
+// DirectoryOwnership is who owns and who works on one directory
+type DirectoryOwnership struct {
+	Path          string       `json:"path"`
+	Files         int          `json:"files"`
+	Owners        []OwnerShare `json:"owners,omitempty"`         // by CODEOWNERS, most files first
+	UnownedFiles  int          `json:"unowned_files,omitempty"`  // matched by no CODEOWNERS rule with owners
+	TopCommitters []Committer  `json:"top_committers,omitempty"` // by commits touching the directory
+}
+
+// OwnershipResult represents the ownership of a repository's directories
+type OwnershipResult struct {
+	CodeownersFile string               `json:"codeowners_file,omitempty"`
+	Rules          []CodeownersRule     `json:"rules,omitempty"`
+	Directories    []DirectoryOwnership `json:"directories"`
+	CommitsRead    int                  `json:"commits_read"`
+	Shallow        bool                 `json:"shallow,omitempty"`   // a shallow clone has only the latest commits
+	Truncated      bool                 `json:"truncated,omitempty"` // more directories than OWNERS_MAX_DIRECTORIES, or rules than OWNERS_MAX_RULES
+	Note           string               `json:"note,omitempty"`
+}
+
+// mapOwnership implements the map_ownership tool: for each directory down
+// to the given depth, the owners the CODEOWNERS file assigns to its files
+// and the authors with the most commits touching it, for documenting who
+// owns what
+func mapOwnership(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	depth := OWNERS_DEFAULT_DEPTH
+	if val, ok := intArg(args, "depth"); ok && val > 0 {
+		depth = min(val, OWNERS_MAX_DEPTH)
+	}
+	maxCommitters := OWNERS_DEFAULT_COMMITTERS
+	if val, ok := intArg(args, "max_committers"); ok && val >= 0 {
+		maxCommitters = min(val, OWNERS_MAX_COMMITTERS)
+	}
+	since, _ := args["since"].(string)
+
+	files, err := listFiles(directory, DefaultWalkOptions())
+	if err != nil {
+		return nil, err
+	}
+	result := OwnershipResult{Directories: []DirectoryOwnership{}}
+	var rules []CodeownersRule
+	for _, location := range codeownersLocations {
+		if rules, err = parseCodeowners(filepath.Join(directory, filepath.FromSlash(location))); err == nil {
+			result.CodeownersFile = location
+			break
+		}
+	}
+
+	directories := make(map[string]*DirectoryOwnership)
+	shares := make(map[string]map[string]int)
+	entry := func(dir string) *DirectoryOwnership {
+		if _, ok := directories[dir]; !ok {
+			directories[dir] = &DirectoryOwnership{Path: dir}
+			shares[dir] = make(map[string]int)
+		}
+		return directories[dir]
+	}
+	for _, file := range files {
+		rel, err := filepath.Rel(directory, file)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		dir := ownershipDirectory(rel, depth)
+		d := entry(dir)
+		d.Files++
+		if result.CodeownersFile == "" {
+			continue
+		}
+		if owners := codeownersFor(rules, rel); len(owners) > 0 {
+			shares[dir][strings.Join(owners, " ")]++
+		} else {
+			d.UnownedFiles++
+		}
+	}
+
+	// Committers per directory, from one pass over the history
+	committers := make(map[string]map[string]int)
+	gitArgs := []string{"log", "--relative", "-n", fmt.Sprint(OWNERS_MAX_COMMITS), "--format=%x1e%aN", "--name-only"}
+	if since != "" {
+		gitArgs = append(gitArgs, "--since="+since)
+	}
+	if output, err := runGit(directory, append(gitArgs, "--", ".")...); err != nil {
+		result.Note = "No commit history: " + err.Error()
+	} else {
+		for _, record := range strings.Split(output, "\x1e") {
+			lines := strings.Split(strings.TrimSpace(record), "\n")
+			author := strings.TrimSpace(lines[0])
+			if author == "" {
+				continue
+			}
+			result.CommitsRead++
+			touched := make(map[string]bool)
+			for _, file := range lines[1:] {
+				if file = strings.TrimSpace(file); file != "" {
+					touched[ownershipDirectory(file, depth)] = true
+				}
+			}
+			for dir := range touched {
+				if _, ok := directories[dir]; !ok {
+					continue // no longer exists, or ignored
+				}
+				if committers[dir] == nil {
+					committers[dir] = make(map[string]int)
+				}
+				committers[dir][author]++
+			}
+		}
+		if shallow, err := runGit(directory, "rev-parse", "--is-shallow-repository"); err == nil {
+			result.Shallow = strings.TrimSpace(shallow) == "true"
+		}
+	}
+
+	for dir, d := range directories {
+		for owners, count := range shares[dir] {
+			d.Owners = append(d.Owners, OwnerShare{Owners: owners, Files: count})
+		}
+		sort.Slice(d.Owners, func(i, j int) bool {
+			if d.Owners[i].Files != d.Owners[j].Files {
+				return d.Owners[i].Files > d.Owners[j].Files
+			}
+			return d.Owners[i].Owners < d.Owners[j].Owners
+		})
+		for name, count := range committers[dir] {
+			d.TopCommitters = append(d.TopCommitters, Committer{Name: name, Commits: count})
+		}
+		sort.Slice(d.TopCommitters, func(i, j int) bool {
+			if d.TopCommitters[i].Commits != d.TopCommitters[j].Commits {
+				return d.TopCommitters[i].Commits > d.TopCommitters[j].Commits
+			}
+			return d.TopCommitters[i].Name < d.TopCommitters[j].Name
+		})
+		if len(d.TopCommitters) > maxCommitters {
+			d.TopCommitters = d.TopCommitters[:maxCommitters]
+		}
+		result.Directories = append(result.Directories, *d)
+	}
+	sort.Slice(result.Directories, func(i, j int) bool {
+		return result.Directories[i].Path < result.Directories[j].Path
+	})
+	if len(result.Directories) > OWNERS_MAX_DIRECTORIES {
+		result.Directories = result.Directories[:OWNERS_MAX_DIRECTORIES]
+		result.Truncated = true
+	}
+	result.Rules = rules
+	if len(rules) > OWNERS_MAX_RULES {
+		result.Rules = rules[:OWNERS_MAX_RULES]
+		result.Truncated = true
+	}
+	if result.CodeownersFile == "" && result.Note == "" {
+		result.Note = "No CODEOWNERS file; ownership is shown by committers only"
+	}
+	return result, nil
+}
+
+// ownershipDirectory returns the directory of a slash-separated relative
+// file path, cut to depth levels, or "." for files at the top
+func ownershipDirectory(rel string, depth int) string {
+	dir := path.Dir(rel)
+	if dir == "." {
+		return dir
+	}
+	parts := strings.Split(dir, "/")
+	return strings.Join(parts[:min(depth, len(parts))], "/")
+}
+
+// parseCodeowners reads the rules of a CODEOWNERS file. GitLab section
+// headers ([Section], ^[Optional section] and their default owners) are
+// recorded with the rules that follow them.
+func parseCodeowners(file string) ([]CodeownersRule, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var rules []CodeownersRule
+	section := ""
+	var sectionOwners []string
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "^[") {
+			header := strings.TrimPrefix(text, "^")
+			end := strings.Index(header, "]")
+			if end < 0 {
+				continue
+			}
+			section = header[1:end]
+			sectionOwners = nil
+			for _, field := range strings.Fields(header[end+1:]) {
+				if !strings.HasPrefix(field, "[") { // [2] approvals
+					sectionOwners = append(sectionOwners, field)
+				}
+			}
+			continue
+		}
+		if comment := strings.Index(text, " #"); comment >= 0 {
+			text = strings.TrimSpace(text[:comment])
+		}
+		fields := strings.Fields(strings.ReplaceAll(text, `\ `, "\x00"))
+		rule := CodeownersRule{Pattern: strings.ReplaceAll(fields[0], "\x00", " "), Owners: fields[1:], Section: section, Line: line}
+		if len(rule.Owners) == 0 && section != "" {
+			rule.Owners = sectionOwners
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// codeownersFor returns the owners of a slash-separated relative path: those
+// of the last matching rule, as GitHub and GitLab (within a section) apply
+// them
+func codeownersFor(rules []CodeownersRule, rel string) []string {
+	var owners []string
+	for _, rule := range rules {
+		if codeownersMatch(rule.Pattern, rel) {
+			owners = rule.Owners
+		}
+	}
+	return owners
+}
+
+// codeownersMatch reports whether a CODEOWNERS pattern, which follows
+// .gitignore rules, matches a file: the file itself or, since a pattern
+// naming a directory covers everything in it, one of its directories
+func codeownersMatch(pattern, rel string) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+	if !dirOnly && matchGlob(pattern, rel) {
+		return true
+	}
+	// dir/* covers the files in dir, but not those in its subdirectories
+	if strings.HasSuffix(pattern, "/*") {
+		return false
+	}
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if matchGlob(pattern, dir) {
+			return true
+		}
+	}
+	return false
+}
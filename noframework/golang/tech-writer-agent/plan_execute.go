@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Maximum LLM turns spent executing a single plan step
+	PLAN_STEP_MAX_ACTIONS = 5
+	// Maximum number of times the plan is revised after failed steps
+	PLAN_MAX_REPLANS = 3
+	// Maximum number of steps accepted from the planner
+	PLAN_MAX_STEPS = 12
+)
+
+// PlanExecuteAgent implements the Plan-and-Execute pattern: the model first
+// writes an explicit plan, each step is then carried out with tools, and the
+// remaining plan is revised whenever a step fails. A final turn writes the
+// answer from the step results.
+type PlanExecuteAgent struct {
+	agentCore
+}
+
+// planStep is one executed step and what came of it
+type planStep struct {
+	description string
+	result      string
+	succeeded   bool
+}
+
+// NewPlanExecuteAgent creates a new Plan-and-Execute agent. maxIters bounds
+// the total number of LLM turns across planning, execution and synthesis.
+func NewPlanExecuteAgent(llmClient LLMClient, systemPrompt string, maxIters int, verbose bool, opts AgentOptions) *PlanExecuteAgent {
+	return &PlanExecuteAgent{agentCore: newAgentCore(llmClient, systemPrompt, maxIters, verbose, opts)}
+}
+
+// Run plans, executes and summarises the analysis for the given prompt
+func (a *PlanExecuteAgent) Run(userPrompt string) (string, error) {
+	a.startClock()
+
+	plan, err := a.makePlan(userPrompt, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var completed []planStep
+	replans := 0
+	for len(plan) > 0 {
+		if a.interruptRequested() {
+			log.Printf("Interrupted with %d plan steps left; writing a best-effort answer", len(plan))
+			a.truncated = true
+			break
+		}
+		if a.outOfTime() || a.iterations >= a.maxIters-1 {
+			log.Printf("Stopping with %d plan steps left: time or iteration budget exhausted", len(plan))
+			a.truncated = true
+			break
+		}
+
+		step := plan[0]
+		plan = plan[1:]
+		log.Printf("Executing plan step %d: %s", len(completed)+1, step)
+
+		result, ok, err := a.executeStep(userPrompt, step, completed)
+		if err != nil {
+			return "", err
+		}
+		completed = append(completed, planStep{description: step, result: result, succeeded: ok})
+
+		if !ok && replans < PLAN_MAX_REPLANS && !a.interrupted {
+			replans++
+			log.Printf("Step failed; revising the remaining plan (%d/%d)", replans, PLAN_MAX_REPLANS)
+			if plan, err = a.makePlan(userPrompt, completed); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return a.synthesize(userPrompt, completed)
+}
+
+// makePlan asks the model for the steps still needed, given those completed.
+// A planning turn that times out is retried while time and iterations are
+// left; once they run out no steps are returned, so the answer is written
+// from those completed.
+func (a *PlanExecuteAgent) makePlan(userPrompt string, completed []planStep) ([]string, error) {
+	prompt := fmt.Sprintf(`You are planning an analysis of a codebase. You will be able to use these tools while carrying out each step:
+
+%s
+
+User Request: %s
+%s
+Write the plan as a numbered list with one concrete, tool-oriented step per line (at most %d steps).
+Do not include a step for writing the final document; that happens after the plan is complete.
+Plan:`, a.getToolDescriptions(), userPrompt, formatPlanSteps(completed), PLAN_MAX_STEPS)
+
+	response, err := a.turn(prompt)
+	for errors.Is(err, errTimeout) && !a.outOfTime() && !a.interruptRequested() && a.iterations < a.maxIters-1 {
+		// Like a timed-out turn of a step, the planning turn is retried
+		log.Printf("Planning turn timed out after %s; retrying", a.opts.IterationTimeout)
+		response, err = a.turn(prompt)
+	}
+	if errors.Is(err, errTimeout) {
+		// No time or turns left to plan: the answer is written from what is done
+		log.Printf("Time or iteration budget exhausted while planning; writing a best-effort answer")
+		a.truncated = true
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("planning failed: %w", err)
+	}
+
+	steps := parsePlan(response)
+	if len(steps) == 0 && len(completed) == 0 {
+		return nil, fmt.Errorf("planning failed: no steps found in response")
+	}
+	if len(steps) > PLAN_MAX_STEPS {
+		steps = steps[:PLAN_MAX_STEPS]
+	}
+	if a.verbose {
+		log.Printf("Plan:\n%s", strings.Join(steps, "\n"))
+	}
+	return steps, nil
+}
+
+// executeStep runs a short ReAct loop for one plan step. It returns the step
+// result and whether the model reported the step as done.
+func (a *PlanExecuteAgent) executeStep(userPrompt, step string, completed []planStep) (string, bool, error) {
+	history := fmt.Sprintf(`You are carrying out one step of a plan to analyse a codebase. You have access to the following tools:
+
+%s
+
+Use the following format:
+
+Thought: reason about what you need to do next
+Action: the action to take, should be one of the tool names
+Action Input: the input to the action as a JSON object
+Observation: the result of the action
+... (this Thought/Action/Action Input/Observation can repeat up to %d times)
+Step Result: a detailed summary of what you found for this step, including file names and facts needed for the final document
+or, if the step cannot be completed:
+Step Failed: why the step could not be completed
+
+User Request: %s
+%s
+Current step: %s
+
+Thought:`, a.getToolDescriptions(), PLAN_STEP_MAX_ACTIONS, userPrompt, formatPlanSteps(completed), step)
+	// Each step starts a fresh conversation, so earlier results are not "above"
+	a.resetToolCalls()
+
+	for i := 0; i < PLAN_STEP_MAX_ACTIONS; i++ {
+		if a.interruptRequested() {
+			return "Step interrupted: the user stopped the analysis", false, nil
+		}
+		if a.outOfTime() || a.iterations >= a.maxIters-1 {
+			return "Step interrupted: time or iteration budget exhausted", false, nil
+		}
+
+		deadline := a.iterationDeadline()
+		a.iterations++
+		a.opts.Events.OnIteration(IterationEvent{Iteration: a.iterations, MaxIterations: a.maxIters})
+		response, err := a.complete(history, a.iterations, deadline)
+		if errors.Is(err, errTimeout) {
+			continue
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("LLM error in iteration %d: %w", a.iterations, err)
+		}
+
+		if result, ok := textAfterMarker(response, "Step Result:"); ok {
+			return result, true, nil
+		}
+		if reason, ok := textAfterMarker(response, "Step Failed:"); ok {
+			return reason, false, nil
+		}
+
+		action, actionInput, err := a.parseAction(response)
+		if err != nil {
+			history += response + "\n"
+			continue
+		}
+		observation := a.useTool(action, actionInput, a.iterations, deadline)
+		if a.stuck != nil {
+			return "", false, fmt.Errorf("iteration %d: %w", a.iterations, a.stuck)
+		}
+
+		history += response
+		if !strings.HasSuffix(response, "\n") {
+			history += "\n"
+		}
+		history += fmt.Sprintf("Observation: %s\nThought: ", observation)
+	}
+
+	return fmt.Sprintf("Step did not finish within %d actions", PLAN_STEP_MAX_ACTIONS), false, nil
+}
+
+// synthesize writes the final answer from the step results
+func (a *PlanExecuteAgent) synthesize(userPrompt string, completed []planStep) (string, error) {
+	prompt := fmt.Sprintf(`You have finished carrying out a plan to analyse a codebase.
+
+User Request: %s
+%s
+Using only these results, write the final answer to the user request.
+Final Answer:`, userPrompt, formatPlanSteps(completed))
+
+	a.iterations++
+	response, err := a.complete(prompt, a.iterations, a.finalDeadline())
+	if err != nil {
+		return "", fmt.Errorf("LLM error while writing final answer: %w", err)
+	}
+
+	finalAnswer, ok := extractFinalAnswer(response)
+	if !ok {
+		finalAnswer = strings.TrimSpace(response)
+	}
+	a.opts.Events.OnFinal(FinalEvent{Iteration: a.iterations, Answer: finalAnswer, Truncated: a.truncated})
+	return finalAnswer, nil
+}
+
+// turn makes a planning call, counting it against the iteration budget
+func (a *PlanExecuteAgent) turn(prompt string) (string, error) {
+	a.iterations++
+	return a.complete(prompt, a.iterations, a.iterationDeadline())
+}
+
+// formatPlanSteps renders completed steps for inclusion in a prompt
+func formatPlanSteps(steps []planStep) string {
+	if len(steps) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("\nCompleted steps:\n")
+	for i, step := range steps {
+		status := "done"
+		if !step.succeeded {
+			status = "FAILED"
+		}
+		fmt.Fprintf(&b, "%d. [%s] %s\n   Result: %s\n", i+1, status, step.description, step.result)
+	}
+	return b.String()
+}
+
+var planLineRegex = regexp.MustCompile(`^\s*\d+[.)]\s+(.+)$`)
+
+// parsePlan extracts the numbered steps from a planner response
+func parsePlan(response string) []string {
+	var steps []string
+	for _, line := range strings.Split(response, "\n") {
+		if match := planLineRegex.FindStringSubmatch(line); match != nil {
+			steps = append(steps, strings.TrimSpace(match[1]))
+		}
+	}
+	return steps
+}
+
+// textAfterMarker returns the trimmed text following marker in response
+func textAfterMarker(response, marker string) (string, bool) {
+	idx := strings.Index(response, marker)
+	if idx < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(response[idx+len(marker):]), true
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowPlanner answers every call after a delay: a plan to planning prompts
+// and a final answer to the synthesis prompt
+type slowPlanner struct {
+	delay time.Duration
+}
+
+func (s *slowPlanner) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
+	time.Sleep(s.delay)
+	if strings.HasSuffix(prompt, "Plan:") {
+		return "1. List the files", nil
+	}
+	return "Final Answer: best effort", nil
+}
+
+func TestPlanExecuteAfterMaxDuration(t *testing.T) {
+	// Planning outlasts --max-duration, so no step runs, but the final
+	// answer is still written after the run's deadline has passed
+	agent := NewPlanExecuteAgent(&slowPlanner{delay: 40 * time.Millisecond}, "", 10, false, AgentOptions{MaxDuration: 20 * time.Millisecond})
+	answer, err := agent.Run("Document the code base")
+	if err != nil {
+		t.Fatalf("Run() = %v, want a best-effort answer", err)
+	}
+	if answer != "best effort" || !agent.Truncated() {
+		t.Errorf("Run() = %q, truncated %v, want the best-effort answer, truncated", answer, agent.Truncated())
+	}
+}
+
+// stallingPlanner stalls on its first call, then plans one step, carries it
+// out and answers
+type stallingPlanner struct {
+	calls atomic.Int32
+	stall time.Duration
+}
+
+func (s *stallingPlanner) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
+	if s.calls.Add(1) == 1 {
+		time.Sleep(s.stall)
+	}
+	switch {
+	case strings.HasSuffix(prompt, "Plan:"):
+		return "1. List the files", nil
+	case strings.HasSuffix(prompt, "Thought:"):
+		return "Step Result: the files are listed", nil
+	}
+	return "Final Answer: complete", nil
+}
+
+func TestPlanExecuteRetriesTimedOutPlanning(t *testing.T) {
+	// The first planning turn outlasts --iteration-timeout with time left
+	// in the run, so it is retried rather than failing the run
+	llm := &stallingPlanner{stall: 60 * time.Millisecond}
+	agent := NewPlanExecuteAgent(llm, "", 10, false, AgentOptions{IterationTimeout: 20 * time.Millisecond})
+	answer, err := agent.Run("Document the code base")
+	if err != nil {
+		t.Fatalf("Run() = %v, want the planning turn retried", err)
+	}
+	if answer != "complete" || agent.Truncated() {
+		t.Errorf("Run() = %q, truncated %v, want the complete answer", answer, agent.Truncated())
+	}
+}
+
+// hungLLM never answers until released, like a provider that hangs
+type hungLLM struct {
+	release chan struct{}
+}
+
+func (h *hungLLM) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
+	<-h.release
+	return "", nil
+}
+
+func TestReActAfterMaxDuration(t *testing.T) {
+	// The first turn outlasts --max-duration, and the forced final answer
+	// is still written after the run's deadline has passed
+	agent := NewReActAgent(&slowPlanner{delay: 40 * time.Millisecond}, "", 10, false, AgentOptions{MaxDuration: 20 * time.Millisecond})
+	answer, err := agent.Run("Document the code base")
+	if err != nil {
+		t.Fatalf("Run() = %v, want a best-effort answer", err)
+	}
+	if answer != "best effort" || !agent.Truncated() {
+		t.Errorf("Run() = %q, truncated %v, want the best-effort answer, truncated", answer, agent.Truncated())
+	}
+
+	// A provider that hangs on the forced answer too is given up on after
+	// --iteration-timeout
+	hung := &hungLLM{release: make(chan struct{})}
+	defer close(hung.release)
+	agent = NewReActAgent(hung, "", 10, false, AgentOptions{MaxDuration: 20 * time.Millisecond, IterationTimeout: 50 * time.Millisecond})
+	done := make(chan error, 1)
+	go func() {
+		_, err := agent.Run("Document the code base")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errTimeout) {
+			t.Errorf("Run() = %v, want the forced answer timed out", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() hangs on the forced answer despite the iteration timeout")
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// PLUGIN_DEFAULT_TIMEOUT limits a plugin call unless the plugin's
+// configuration sets its own timeout
+const PLUGIN_DEFAULT_TIMEOUT = 60 * time.Second
+
+// PLUGIN_MAX_LINE_BYTES limits a plugin's response
+const PLUGIN_MAX_LINE_BYTES = 16 * 1024 * 1024
+
+// pluginToolNamePattern restricts the names of plugin tools to the
+// characters of the built-in ones, which the agents' parsers expect
+var pluginToolNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// pluginRequest is a JSON-RPC request to a plugin
+type pluginRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+// pluginResponse is a JSON-RPC response from a plugin
+type pluginResponse struct {
+	ID     *int            `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// pluginToolSpec is a tool as a plugin describes it
+type pluginToolSpec struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Arguments   []struct {
+		Name        string `json:"name"`
+		Type        string `json:"type"`
+		Description string `json:"description"`
+		Required    bool   `json:"required"`
+		Default     string `json:"default"`
+	} `json:"arguments"`
+}
+
+// pluginError is an error a plugin returned for a call, as opposed to a
+// failure to talk to it
+type pluginError struct{ message string }
+
+func (e *pluginError) Error() string { return e.message }
+
+// Plugin is a running plugin process: an executable that adds tools. The
+// agent starts each one at startup and talks JSON-RPC 2.0 to it, one JSON
+// object per line on the plugin's standard input and output (its standard
+// error goes to the log):
+//
+//	→ {"jsonrpc":"2.0","id":1,"method":"describe","params":{}}
+//	← {"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"list_routes","description":"...","arguments":[{"name":"directory","type":"string","description":"...","required":true}]}]}}
+//	→ {"jsonrpc":"2.0","id":2,"method":"invoke","params":{"name":"list_routes","arguments":{"directory":"/repo"}}}
+//	← {"jsonrpc":"2.0","id":2,"result":{"routes":["GET /users"]}}
+//
+// The result of invoke, any JSON value, is what the model sees. An error
+// response ({"error":{"code":1,"message":"..."}}) is shown to the model as
+// {"error": message}, like the built-in tools' problems. Calls are made one
+// at a time; the plugin runs in the agent's working directory with
+// TECH_WRITER_DIRECTORY set to the repository being analysed, and is told
+// to stop by closing its standard input.
+type Plugin struct {
+	config  PluginConfig
+	timeout time.Duration
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	lines   chan []byte // the lines of its standard output
+	done    chan struct{}
+
+	mu     sync.Mutex
+	nextID int
+	broken error // set once the plugin has failed; later calls fail at once
+}
+
+// timeout returns the plugin's call timeout
+func (c PluginConfig) timeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return PLUGIN_DEFAULT_TIMEOUT, nil
+	}
+	timeout, err := time.ParseDuration(c.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", c.Timeout)
+	}
+	return timeout, nil
+}
+
+// startPlugin starts a plugin's process
+func startPlugin(config PluginConfig, directory string) (*Plugin, error) {
+	timeout, err := config.timeout()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Env = append(os.Environ(), "TECH_WRITER_DIRECTORY="+directory)
+	for name, value := range config.Env {
+		cmd.Env = append(cmd.Env, name+"="+value)
+	}
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting plugin %s: %w", config.Name, err)
+	}
+
+	p := &Plugin{config: config, timeout: timeout, cmd: cmd, stdin: stdin, lines: make(chan []byte), done: make(chan struct{})}
+	go func() {
+		defer close(p.lines)
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), PLUGIN_MAX_LINE_BYTES)
+		for scanner.Scan() {
+			line := append([]byte(nil), scanner.Bytes()...)
+			select {
+			case p.lines <- line:
+			case <-p.done:
+				return
+			}
+		}
+	}()
+	return p, nil
+}
+
+// call sends a request and waits for the response with the same id,
+// decoding its result into result. A plugin that doesn't answer within its
+// timeout, or exits, is stopped and fails all later calls.
+func (p *Plugin) call(method string, params, result interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.broken != nil {
+		return p.broken
+	}
+	fail := func(err error) error {
+		p.broken = fmt.Errorf("plugin %s: %w", p.config.Name, err)
+		p.cmd.Process.Kill() // it may be stuck
+		p.stop()
+		return p.broken
+	}
+
+	p.nextID++
+	request, err := json.Marshal(pluginRequest{JSONRPC: "2.0", ID: p.nextID, Method: method, Params: params})
+	if err != nil {
+		return err
+	}
+	if _, err := p.stdin.Write(append(request, '\n')); err != nil {
+		return fail(err)
+	}
+	deadline := time.After(p.timeout)
+	for {
+		select {
+		case line, ok := <-p.lines:
+			if !ok {
+				return fail(fmt.Errorf("exited"))
+			}
+			var response pluginResponse
+			if json.Unmarshal(line, &response) != nil || response.ID == nil || *response.ID != p.nextID {
+				continue // not our response, e.g. a stray print
+			}
+			if response.Error != nil {
+				return &pluginError{message: response.Error.Message}
+			}
+			if result == nil {
+				return nil
+			}
+			return json.Unmarshal(response.Result, result)
+		case <-deadline:
+			return fail(fmt.Errorf("no response to %s within %s", method, p.timeout))
+		}
+	}
+}
+
+// describe asks the plugin for its tools
+func (p *Plugin) describe() ([]Tool, error) {
+	var described struct {
+		Tools []pluginToolSpec `json:"tools"`
+	}
+	if err := p.call("describe", map[string]interface{}{}, &described); err != nil {
+		return nil, err
+	}
+	var tools []Tool
+	for _, spec := range described.Tools {
+		if !pluginToolNamePattern.MatchString(spec.Name) {
+			return nil, fmt.Errorf("plugin %s: invalid tool name %q", p.config.Name, spec.Name)
+		}
+		tool := Tool{Name: spec.Name, Description: spec.Description, Function: p.invoker(spec.Name), Limits: ToolLimits{Timeout: p.timeout + 5*time.Second}}
+		for _, arg := range spec.Arguments {
+			tool.Arguments = append(tool.Arguments, ToolArgument{Name: arg.Name, Type: arg.Type, Description: arg.Description, Required: arg.Required, Default: arg.Default})
+		}
+		tools = append(tools, tool)
+	}
+	return tools, nil
+}
+
+// invoker returns the Function of one of the plugin's tools
+func (p *Plugin) invoker(name string) func(args map[string]interface{}) (interface{}, error) {
+	return func(args map[string]interface{}) (interface{}, error) {
+		var result interface{}
+		err := p.call("invoke", map[string]interface{}{"name": name, "arguments": args}, &result)
+		if perr, ok := err.(*pluginError); ok {
+			return map[string]string{"error": perr.message}, nil
+		}
+		return result, err
+	}
+}
+
+// stop ends the plugin's process
+func (p *Plugin) stop() {
+	select {
+	case <-p.done:
+		return
+	default:
+		close(p.done)
+	}
+	p.stdin.Close()
+	exited := make(chan struct{})
+	go func() {
+		p.cmd.Wait()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		p.cmd.Process.Kill()
+		<-exited
+	}
+}
+
+// Close asks the plugin to exit by closing its standard input, killing it
+// if it doesn't within a few seconds
+func (p *Plugin) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stop()
+}
+
+// startPlugins starts the configured plugins and registers their tools. A
+// plugin's tool may not replace a built-in tool or another plugin's.
+func startPlugins(configs []PluginConfig, directory string) ([]*Plugin, error) {
+	var plugins []*Plugin
+	closeAll := func() {
+		for _, p := range plugins {
+			p.Close()
+		}
+	}
+	for _, config := range configs {
+		p, err := startPlugin(config, directory)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		plugins = append(plugins, p)
+		tools, err := p.describe()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		for _, tool := range tools {
+			if _, exists := Tools[tool.Name]; exists {
+				closeAll()
+				return nil, fmt.Errorf("plugin %s: tool %s already exists", config.Name, tool.Name)
+			}
+			RegisterTool(tool)
+		}
+		log.Printf("Plugin %s added %d tools", config.Name, len(tools))
+	}
+	return plugins, nil
+}
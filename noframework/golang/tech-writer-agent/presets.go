@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Preset is a documentation task with a built-in prompt (--preset). A
+// --prompt file, if given as well, adds its instructions after the preset's.
+type Preset struct {
+	Name        string
+	Description string // for -help and error messages
+	Prompt      string
+}
+
+// presets are the --preset tasks by name
+var presets = map[string]Preset{
+	PresetAPIReference: {
+		Name:        PresetAPIReference,
+		Description: "a reference of the public API: exported symbols, endpoints and command-line flags",
+		Prompt:      API_REFERENCE_PROMPT,
+	},
+	PresetC4: {
+		Name:        PresetC4,
+		Description: "C4 model context, container and component views, as Mermaid diagrams or a Structurizr DSL workspace",
+		Prompt:      C4_PROMPT,
+	},
+	PresetChangelog: {
+		Name:        PresetChangelog,
+		Description: "a changelog of the changes between two tags, grouped into breaking changes, features and fixes",
+		Prompt:      CHANGELOG_PROMPT,
+	},
+	PresetOnboarding: {
+		Name:        PresetOnboarding,
+		Description: "a guide for new engineers: setup, key flows, where to start reading and a glossary",
+		Prompt:      ONBOARDING_PROMPT,
+	},
+	PresetReadme: {
+		Name:        PresetReadme,
+		Description: "a conventional README: overview, installation, usage, configuration and contributing",
+		Prompt:      README_PROMPT,
+	},
+}
+
+// presetNames lists the presets for help and error messages
+func presetNames() string {
+	var names []string
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// taskPrompt returns the prompt of a run: the --preset's, followed by the
+// --prompt file's, either of which may be missing
+func taskPrompt(args *Args) (string, error) {
+	var parts []string
+	if preset, ok := presets[args.Preset]; ok {
+		parts = append(parts, strings.TrimSpace(preset.Prompt))
+	}
+	if args.Preset == PresetC4 {
+		parts = append(parts, c4SyntaxPrompt(args.C4Syntax))
+	}
+	if args.PromptFile != "" {
+		prompt, err := readPromptFile(args.PromptFile)
+		if err != nil {
+			return "", err
+		}
+		if len(parts) > 0 {
+			prompt = "Further instructions:\n" + prompt
+		}
+		parts = append(parts, prompt)
+	}
+	if len(parts) == 0 {
+		return "", fmt.Errorf("no prompt: give -prompt or -preset")
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
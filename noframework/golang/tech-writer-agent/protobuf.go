@@ -0,0 +1,511 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// Limits of extract_protobuf
+const (
+	PROTO_MAX_FILES      = 200             // read per call
+	PROTO_MAX_FILE_BYTES = 2 * 1024 * 1024 // of a .proto file
+	PROTO_MAX_DOC_CHARS  = 200             // of a definition's comment
+)
+
+// ProtoRPC is a method of a gRPC service
+type ProtoRPC struct {
+	Name            string `json:"name"`
+	Request         string `json:"request"`
+	Response        string `json:"response"`
+	ClientStreaming bool   `json:"client_streaming,omitempty"`
+	ServerStreaming bool   `json:"server_streaming,omitempty"`
+	HTTP            string `json:"http,omitempty"` // the google.api.http mapping, e.g. GET /v1/{name=books/*}
+	Doc             string `json:"doc,omitempty"`
+	Line            int    `json:"line"`
+}
+
+// ProtoService is a gRPC service
+type ProtoService struct {
+	Name string     `json:"name"`
+	Doc  string     `json:"doc,omitempty"`
+	Line int        `json:"line"`
+	RPCs []ProtoRPC `json:"rpcs"`
+}
+
+// ProtoMessage is a message type. Nested messages are listed separately,
+// named Outer.Inner.
+type ProtoMessage struct {
+	Name   string   `json:"name"`
+	Doc    string   `json:"doc,omitempty"`
+	Line   int      `json:"line"`
+	Fields []string `json:"fields"` // e.g. "repeated string tags = 3", "oneof kind: Cat cat = 4"
+}
+
+// ProtoEnum is an enum type
+type ProtoEnum struct {
+	Name   string   `json:"name"`
+	Doc    string   `json:"doc,omitempty"`
+	Line   int      `json:"line"`
+	Values []string `json:"values"` // e.g. "STATUS_ACTIVE = 1"
+}
+
+// ProtoFile is what one .proto file defines
+type ProtoFile struct {
+	File     string            `json:"file"`
+	Syntax   string            `json:"syntax,omitempty"` // proto2, proto3 or an edition
+	Package  string            `json:"package,omitempty"`
+	Imports  []string          `json:"imports,omitempty"`
+	Options  map[string]string `json:"options,omitempty"` // file options, e.g. go_package
+	Services []ProtoService    `json:"services,omitempty"`
+	Messages []ProtoMessage    `json:"messages,omitempty"`
+	Enums    []ProtoEnum       `json:"enums,omitempty"`
+}
+
+// ProtobufResult represents the definitions of the .proto files read
+type ProtobufResult struct {
+	Files        []ProtoFile `json:"files"`
+	ServiceCount int         `json:"service_count"`
+	RPCCount     int         `json:"rpc_count"`
+	MessageCount int         `json:"message_count"`
+	Truncated    bool        `json:"truncated,omitempty"` // more than PROTO_MAX_FILES files
+	Errors       []string    `json:"errors,omitempty"`    // files that could not be read
+}
+
+// extractProtobuf implements the extract_protobuf tool: the services, RPCs,
+// messages and enums of a .proto file or of the .proto files under a
+// directory, so gRPC APIs are documented from their definitions
+func extractProtobuf(args map[string]interface{}) (interface{}, error) {
+	root, ok := args["path"].(string)
+	if !ok || root == "" {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("Path not found: %s", root)}, nil
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading path: %s", err)}, nil
+	}
+
+	files := []string{root}
+	if info.IsDir() {
+		opts := DefaultWalkOptions()
+		opts.Pattern = "*.proto"
+		files, err = listFiles(root, opts)
+		if err != nil {
+			return nil, err
+		}
+	} else if !isProtoFile(root) {
+		return map[string]string{"error": fmt.Sprintf("%s is not a .proto file", root)}, nil
+	}
+
+	result := ProtobufResult{Files: []ProtoFile{}}
+	for _, file := range files {
+		if len(result.Files)+len(result.Errors) == PROTO_MAX_FILES {
+			result.Truncated = true
+			break
+		}
+		if info, err := os.Stat(file); err == nil && info.Size() > PROTO_MAX_FILE_BYTES {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: larger than %s", file, formatBytes(PROTO_MAX_FILE_BYTES)))
+			continue
+		}
+		source, err := os.ReadFile(file)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", file, err))
+			continue
+		}
+		proto := parseProto(string(source))
+		proto.File = file
+		result.ServiceCount += len(proto.Services)
+		for _, service := range proto.Services {
+			result.RPCCount += len(service.RPCs)
+		}
+		result.MessageCount += len(proto.Messages)
+		result.Files = append(result.Files, proto)
+	}
+	return result, nil
+}
+
+// protoToken is a token of a .proto file: a word (identifier, keyword or
+// number), a string literal's content or a punctuation character
+type protoToken struct {
+	text   string
+	line   int
+	doc    string // the comment just before it, if any
+	quoted bool
+}
+
+// tokenizeProto splits a .proto file into tokens. Comments are dropped, but
+// one that ends right before a token (with no blank line between) becomes
+// that token's doc.
+func tokenizeProto(source string) []protoToken {
+	var tokens []protoToken
+	runes := []rune(source)
+	line := 1
+	var doc []string
+	newlines := 0     // since the last comment or token
+	trailing := false // a comment now would follow a token on its line
+	isWord := func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' }
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			newlines++
+			trailing = false
+			if newlines > 1 {
+				doc = nil
+			}
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			end := i
+			for end < len(runes) && runes[end] != '\n' {
+				end++
+			}
+			if !trailing {
+				if newlines > 1 {
+					doc = nil
+				}
+				doc = append(doc, strings.TrimSpace(strings.TrimLeft(string(runes[i:end]), "/")))
+				newlines = 0
+			}
+			i = end
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			end := i + 2
+			for end < len(runes) && !(runes[end] == '*' && end+1 < len(runes) && runes[end+1] == '/') {
+				end++
+			}
+			text := string(runes[i+2 : min(end, len(runes))])
+			line += strings.Count(text, "\n")
+			if !trailing {
+				doc = nil
+				for _, l := range strings.Split(text, "\n") {
+					if l = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(l), "*")); l != "" {
+						doc = append(doc, l)
+					}
+				}
+				newlines = 0
+			}
+			i = min(end+2, len(runes))
+		case r == '"' || r == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r && runes[j] != '\n'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				b.WriteRune(runes[j])
+			}
+			tokens = append(tokens, protoToken{text: b.String(), line: line, quoted: true})
+			doc, newlines, trailing = nil, 0, true
+			i = j + 1
+		case isWord(r) || r == '-' || r == '+':
+			j := i + 1
+			for j < len(runes) && isWord(runes[j]) {
+				j++
+			}
+			tokens = append(tokens, protoToken{text: string(runes[i:j]), line: line, doc: strings.Join(doc, " ")})
+			doc, newlines, trailing = nil, 0, true
+			i = j
+		default:
+			tokens = append(tokens, protoToken{text: string(r), line: line})
+			doc, newlines, trailing = nil, 0, true
+			i++
+		}
+	}
+	return tokens
+}
+
+// protoParser reads the definitions from the tokens of a .proto file. It is
+// lenient: what it doesn't understand is skipped to the end of its
+// statement or block.
+type protoParser struct {
+	tokens []protoToken
+	pos    int
+	file   ProtoFile
+}
+
+// parseProto returns the definitions of a .proto file
+func parseProto(source string) ProtoFile {
+	p := &protoParser{tokens: tokenizeProto(source)}
+	p.topLevel()
+	return p.file
+}
+
+// peek returns the next token's text, or "" at the end
+func (p *protoParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos].text
+	}
+	return ""
+}
+
+// next consumes and returns the next token
+func (p *protoParser) next() protoToken {
+	if p.pos < len(p.tokens) {
+		p.pos++
+		return p.tokens[p.pos-1]
+	}
+	return protoToken{}
+}
+
+// accept consumes the next token if it is text
+func (p *protoParser) accept(text string) bool {
+	if p.peek() == text && p.pos < len(p.tokens) && !p.tokens[p.pos].quoted {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// until returns the text of the tokens up to (not including) the first of
+// stops at nesting depth 0, joined by spaces, and leaves it unconsumed
+func (p *protoParser) until(stops ...string) string {
+	var words []string
+	depth := 0
+	for p.pos < len(p.tokens) {
+		token := p.tokens[p.pos]
+		if depth == 0 && !token.quoted && containsString(stops, token.text) {
+			break
+		}
+		if !token.quoted {
+			switch token.text {
+			case "{", "[", "(", "<":
+				depth++
+			case "}", "]", ")", ">":
+				depth--
+			}
+		}
+		if token.quoted {
+			words = append(words, `"`+token.text+`"`)
+		} else {
+			words = append(words, token.text)
+		}
+		p.pos++
+	}
+	return strings.Join(words, " ")
+}
+
+// skip consumes the rest of a statement: up to and including its ";", or
+// its block if one comes first
+func (p *protoParser) skip() {
+	p.until(";", "{", "}")
+	if p.accept("{") {
+		p.block()
+	} else {
+		p.accept(";")
+	}
+}
+
+// block consumes tokens up to and including the "}" closing a block whose
+// "{" has been consumed
+func (p *protoParser) block() {
+	p.until("}")
+	p.accept("}")
+}
+
+// topLevel reads the statements of the file
+func (p *protoParser) topLevel() {
+	for p.pos < len(p.tokens) {
+		token := p.next()
+		switch token.text {
+		case "syntax", "edition":
+			p.accept("=")
+			p.file.Syntax = p.next().text
+			if token.text == "edition" {
+				p.file.Syntax = "edition " + p.file.Syntax
+			}
+			p.accept(";")
+		case "package":
+			p.file.Package = p.until(";")
+			p.accept(";")
+		case "import":
+			p.accept("public")
+			p.accept("weak")
+			p.file.Imports = append(p.file.Imports, p.next().text)
+			p.accept(";")
+		case "option":
+			name := strings.Trim(p.until("=", ";"), "() ")
+			if p.accept("=") {
+				if p.file.Options == nil {
+					p.file.Options = make(map[string]string)
+				}
+				p.file.Options[name] = strings.Trim(p.until(";"), `"`)
+			}
+			p.accept(";")
+		case "message":
+			p.message(token, "")
+		case "enum":
+			p.enum(token, "")
+		case "service":
+			p.service(token)
+		case ";":
+		default:
+			p.pos--
+			p.skip()
+		}
+	}
+}
+
+// message reads a message definition; its "message" keyword, carrying its
+// doc, has been consumed. prefix qualifies the names of nested types.
+func (p *protoParser) message(keyword protoToken, prefix string) {
+	name := prefix + p.next().text
+	if !p.accept("{") {
+		p.skip()
+		return
+	}
+	index := len(p.file.Messages)
+	p.file.Messages = append(p.file.Messages, ProtoMessage{Name: name, Doc: protoDoc(keyword.doc), Line: keyword.line, Fields: []string{}})
+	p.messageBody(index, name, "")
+}
+
+// messageBody reads the fields and nested types of the message at index
+// up to its closing "}". oneof names the oneof being read, if any.
+func (p *protoParser) messageBody(index int, name, oneof string) {
+	for p.pos < len(p.tokens) {
+		token := p.next()
+		switch token.text {
+		case "}":
+			return
+		case ";":
+		case "message":
+			p.message(token, name+".")
+		case "enum":
+			p.enum(token, name+".")
+		case "oneof":
+			oneofName := p.next().text
+			if p.accept("{") {
+				p.messageBody(index, name, oneofName)
+			}
+		case "option", "reserved", "extensions", "extend":
+			p.pos--
+			p.skip()
+		default:
+			// A field: [label] type name = number [options];
+			p.pos--
+			field := p.until("=", ";", "{", "}")
+			if p.accept("=") {
+				field += " = " + p.next().text
+				p.until(";", "}")
+				p.accept(";")
+			} else {
+				p.skip() // a proto2 group or something unexpected
+				continue
+			}
+			field = strings.ReplaceAll(strings.ReplaceAll(field, " < ", "<"), " , ", ", ")
+			field = strings.ReplaceAll(field, " >", ">")
+			if oneof != "" {
+				field = "oneof " + oneof + ": " + field
+			}
+			p.file.Messages[index].Fields = append(p.file.Messages[index].Fields, field)
+		}
+	}
+}
+
+// enum reads an enum definition; its "enum" keyword has been consumed
+func (p *protoParser) enum(keyword protoToken, prefix string) {
+	enum := ProtoEnum{Name: prefix + p.next().text, Doc: protoDoc(keyword.doc), Line: keyword.line, Values: []string{}}
+	if !p.accept("{") {
+		p.skip()
+		return
+	}
+	for p.pos < len(p.tokens) {
+		token := p.next()
+		switch token.text {
+		case "}":
+			p.file.Enums = append(p.file.Enums, enum)
+			return
+		case ";":
+		case "option", "reserved":
+			p.pos--
+			p.skip()
+		default:
+			if p.accept("=") {
+				enum.Values = append(enum.Values, token.text+" = "+p.next().text)
+			}
+			p.until(";", "}")
+			p.accept(";")
+		}
+	}
+	p.file.Enums = append(p.file.Enums, enum)
+}
+
+// service reads a service definition; its "service" keyword has been
+// consumed
+func (p *protoParser) service(keyword protoToken) {
+	service := ProtoService{Name: p.next().text, Doc: protoDoc(keyword.doc), Line: keyword.line, RPCs: []ProtoRPC{}}
+	if !p.accept("{") {
+		p.skip()
+		return
+	}
+	for p.pos < len(p.tokens) {
+		token := p.next()
+		switch token.text {
+		case "}":
+			p.file.Services = append(p.file.Services, service)
+			return
+		case ";":
+		case "rpc":
+			// rpc Name ([stream] Request) returns ([stream] Response) {options} or ;
+			rpc := ProtoRPC{Name: p.next().text, Doc: protoDoc(token.doc), Line: token.line}
+			p.accept("(")
+			rpc.ClientStreaming = p.accept("stream")
+			rpc.Request = p.until(")")
+			p.accept(")")
+			p.accept("returns")
+			p.accept("(")
+			rpc.ServerStreaming = p.accept("stream")
+			rpc.Response = p.until(")")
+			p.accept(")")
+			if p.accept("{") {
+				rpc.HTTP = p.rpcOptions()
+			} else {
+				p.accept(";")
+			}
+			service.RPCs = append(service.RPCs, rpc)
+		default:
+			p.pos--
+			p.skip()
+		}
+	}
+	p.file.Services = append(p.file.Services, service)
+}
+
+// rpcOptions reads an RPC's option block up to its closing "}", returning
+// its HTTP mapping (option (google.api.http) = { get: "/v1/..." }), if any
+func (p *protoParser) rpcOptions() string {
+	http := ""
+	for depth := 1; depth > 0 && p.pos < len(p.tokens); {
+		token := p.next()
+		if token.quoted {
+			continue
+		}
+		switch token.text {
+		case "{":
+			depth++
+		case "}":
+			depth--
+		case "get", "put", "post", "delete", "patch":
+			if http == "" && p.accept(":") && p.pos < len(p.tokens) && p.tokens[p.pos].quoted {
+				http = strings.ToUpper(token.text) + " " + p.next().text
+			}
+		}
+	}
+	return http
+}
+
+// protoDoc shortens a definition's comment to PROTO_MAX_DOC_CHARS
+func protoDoc(doc string) string {
+	return truncateRunes(strings.TrimSpace(doc), PROTO_MAX_DOC_CHARS)
+}
+
+// isProtoFile reports whether path is a protocol buffers definition
+func isProtoFile(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".proto")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// markdownSection is a run of document lines starting at a level-2 heading
+// (or the preamble before the first heading when heading is -1)
+type markdownSection struct {
+	heading int // index into lines of the "## " line, or -1
+	start   int
+	end     int // exclusive
+}
+
+// splitSections finds the level-2 sections of a Markdown document, ignoring
+// headings inside fenced code blocks
+func splitSections(lines []string) []markdownSection {
+	sections := []markdownSection{{heading: -1, start: 0}}
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if !inFence && strings.HasPrefix(line, "## ") {
+			sections[len(sections)-1].end = i
+			sections = append(sections, markdownSection{heading: i, start: i})
+		}
+	}
+	sections[len(sections)-1].end = len(lines)
+	return sections
+}
+
+// addProvenanceFootnotes appends a footnote to each level-2 heading listing the
+// files the agent read that the section refers to. A source is tied to a
+// section when its repo-relative path, or its base name if no other source
+// shares it, appears in the section text. This is a heuristic: the document
+// is written in one answer, so which reads informed which section isn't
+// known, and sources a section doesn't name are missed.
+func addProvenanceFootnotes(document string, sources []string, baseDir string) string {
+	if len(sources) == 0 {
+		return document
+	}
+
+	type source struct {
+		rel  string
+		name *regexp.Regexp
+		path *regexp.Regexp
+	}
+	baseNames := make(map[string]int)
+	for _, path := range sources {
+		baseNames[filepath.Base(path)]++
+	}
+	var candidates []source
+	for _, path := range sources {
+		rel := path
+		if r, err := filepath.Rel(baseDir, path); err == nil && !strings.HasPrefix(r, "..") {
+			rel = r
+		}
+		rel = filepath.ToSlash(rel)
+		candidate := source{rel: rel, path: wordPattern(rel)}
+		if baseNames[filepath.Base(path)] == 1 {
+			candidate.name = wordPattern(filepath.Base(path))
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	lines := strings.Split(document, "\n")
+	var footnotes []string
+	for _, section := range splitSections(lines) {
+		if section.heading < 0 {
+			continue
+		}
+		text := strings.Join(lines[section.start:section.end], "\n")
+		var cited []string
+		for _, candidate := range candidates {
+			if candidate.path.MatchString(text) || (candidate.name != nil && candidate.name.MatchString(text)) {
+				cited = append(cited, "`"+candidate.rel+"`")
+			}
+		}
+		if len(cited) == 0 {
+			continue
+		}
+		id := fmt.Sprintf("src-%d", len(footnotes)+1)
+		lines[section.heading] = strings.TrimRight(lines[section.heading], " ") + "[^" + id + "]"
+		footnotes = append(footnotes, fmt.Sprintf("[^%s]: Sources: %s", id, strings.Join(cited, ", ")))
+	}
+
+	if len(footnotes) == 0 {
+		return document
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n\n" + strings.Join(footnotes, "\n") + "\n"
+}
+
+// wordPattern matches s as a whole token, so "main.go" doesn't match "domain.go"
+func wordPattern(s string) *regexp.Regexp {
+	return regexp.MustCompile(`(^|[^\w./-])` + regexp.QuoteMeta(s) + `($|[^\w./-]|\.($|[^\w]))`)
+}
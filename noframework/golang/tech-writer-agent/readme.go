@@ -0,0 +1,165 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PresetReadme writes a conventional README (--preset readme)
+const PresetReadme = "readme"
+
+// README_PROMPT is the task of --preset readme
+const README_PROMPT = `Write a README.md for this repository, as its maintainers would, for people who find the project and want to use or contribute to it.
+
+Start with a level-1 heading with the project's name and a one- or two-sentence description of what it is and who it is for. Then use these level-2 headings, in this order:
+## Overview
+What the project does, its main features and how it is organised, briefly.
+## Installation
+Requirements (language versions, system packages, services) and the exact commands to install or build it, from the package manifests, Makefile, Dockerfile and CI configuration.
+## Usage
+How to run or call it, with short, real examples of commands or code taken from the code base, its tests and examples.
+## Configuration
+The configuration files, environment variables, command-line options and their defaults, in a table where that helps. Say so in one sentence if there is nothing to configure.
+## Contributing
+How to set up a development environment, run the tests and linters, and submit changes, following CONTRIBUTING files and CI where they exist.
+## License
+Only if the repository has a license: name it and point to the file.
+
+Only state what the files show: read the manifests, entry points and configuration before writing, and don't invent commands, options or badges.`
+
+// readmeNames are the file names of READMEs that --readme-merge can merge with
+var readmeNames = []string{"README.md", "readme.md", "Readme.md", "README.markdown", "README"}
+
+// readmeTopics are the conventional sections of a README in order, each
+// with the headings that name it
+var readmeTopics = [][]string{
+	{"overview", "about", "introduction", "description", "features", "what is it"},
+	{"installation", "install", "installing", "getting started", "quick start", "quickstart", "setup", "requirements", "prerequisites", "building", "build"},
+	{"usage", "examples", "example", "how to use", "using"},
+	{"configuration", "config", "settings", "options", "environment variables"},
+	{"contributing", "contribute", "development", "how to contribute"},
+	{"license", "licence", "licensing"},
+}
+
+// ReadmeMerge records how --readme-merge combined the repository's README
+// with the generated one
+type ReadmeMerge struct {
+	Existing string   `json:"existing"`        // the README merged with, relative to the analysed directory
+	Added    []string `json:"added,omitempty"` // the generated sections it lacked
+}
+
+// readmeSection is a level-2 section of a README, with its heading line
+type readmeSection struct {
+	title string
+	topic int // index in readmeTopics, or -1 for a section of its own
+	text  string
+}
+
+// findReadme returns the Markdown README of directory, or "" if it has none
+func findReadme(directory string) string {
+	for _, name := range readmeNames {
+		if info, err := os.Stat(filepath.Join(directory, name)); err == nil && info.Mode().IsRegular() {
+			return name
+		}
+	}
+	return ""
+}
+
+// mergeReadme merges the generated README into the existing one without
+// overwriting it: every part of existing is kept as written, and the
+// conventional sections of generated whose topic existing lacks are added,
+// each before the first section of a later topic that follows those of
+// earlier topics. It returns the merged README and the titles of the
+// sections added. An existing README without a title and introduction gets
+// generated's.
+func mergeReadme(existing, generated string) (string, []string) {
+	preamble, sections := splitReadme(existing)
+	generatedPreamble, generatedSections := splitReadme(generated)
+	if strings.TrimSpace(preamble) == "" {
+		preamble = generatedPreamble
+	}
+	covered := make(map[int]bool)
+	for _, section := range sections {
+		covered[section.topic] = true
+	}
+
+	var added []string
+	for _, section := range generatedSections {
+		if section.topic < 0 || covered[section.topic] {
+			continue
+		}
+		covered[section.topic] = true
+		start := 0
+		for i, other := range sections {
+			if other.topic >= 0 && other.topic < section.topic {
+				start = i + 1
+			}
+		}
+		at := len(sections)
+		for i := start; i < len(sections); i++ {
+			if sections[i].topic > section.topic {
+				at = i
+				break
+			}
+		}
+		sections = append(sections[:at], append([]readmeSection{section}, sections[at:]...)...)
+		added = append(added, section.title)
+	}
+
+	parts := []string{strings.TrimSpace(preamble)}
+	for _, section := range sections {
+		parts = append(parts, strings.TrimSpace(section.text))
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n\n")) + "\n", added
+}
+
+// splitReadme splits a README at its level-2 headings outside code blocks,
+// into the text before the first and the sections
+func splitReadme(document string) (string, []readmeSection) {
+	var preamble []string
+	var sections []readmeSection
+	var lines []string
+	flush := func() {
+		if len(sections) > 0 {
+			sections[len(sections)-1].text = strings.Join(lines, "\n")
+		} else {
+			preamble = lines
+		}
+		lines = nil
+	}
+	inFence := ""
+	for _, line := range strings.Split(strings.ReplaceAll(document, "\r\n", "\n"), "\n") {
+		if inFence != "" {
+			if closesFence(line, inFence) {
+				inFence = ""
+			}
+		} else if m := fencePattern.FindStringSubmatch(line); m != nil {
+			inFence = m[1]
+		} else if m := headingPattern.FindStringSubmatch(line); m != nil && m[1] == "##" {
+			flush()
+			title := plainText((&htmlRenderer{}).inline(m[2]))
+			sections = append(sections, readmeSection{title: title, topic: readmeTopic(title)})
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return strings.Join(preamble, "\n"), sections
+}
+
+// readmeTopic returns the index in readmeTopics of the topic title names, or
+// -1. Emoji, numbering and punctuation around the name don't matter.
+func readmeTopic(title string) int {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r == '\'')
+	})
+	name := strings.Join(words, " ")
+	for i, names := range readmeTopics {
+		for _, candidate := range names {
+			if name == candidate {
+				return i
+			}
+		}
+	}
+	return -1
+}
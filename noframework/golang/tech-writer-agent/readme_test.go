@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeReadme(t *testing.T) {
+	existing := strings.Join([]string{
+		"# widget",
+		"",
+		"[![CI](https://example.com/badge.svg)](https://example.com)",
+		"",
+		"## 🚀 Getting Started",
+		"",
+		"```sh",
+		"## not a heading",
+		"make install",
+		"```",
+		"",
+		"## FAQ",
+		"",
+		"Hand-written answers.",
+		"",
+		"## License",
+		"",
+		"MIT",
+	}, "\n")
+	generated := strings.Join([]string{
+		"# Widget",
+		"",
+		"Generated introduction.",
+		"",
+		"## Overview",
+		"",
+		"Widgets, generated.",
+		"",
+		"## Installation",
+		"",
+		"Generated installation.",
+		"",
+		"## Usage",
+		"",
+		"Generated usage.",
+		"",
+		"## Contributing",
+		"",
+		"Generated contributing.",
+		"",
+		"## License",
+		"",
+		"Generated license.",
+	}, "\n")
+
+	merged, added := mergeReadme(existing, generated)
+	if want := []string{"Overview", "Usage", "Contributing"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("mergeReadme() added %q, want %q", added, want)
+	}
+	for _, kept := range []string{"# widget\n\n[![CI]", "## not a heading\nmake install", "Hand-written answers.", "MIT"} {
+		if !strings.Contains(merged, kept) {
+			t.Errorf("mergeReadme() lost %q:\n%s", kept, merged)
+		}
+	}
+	for _, replaced := range []string{"Generated introduction.", "Generated installation.", "Generated license."} {
+		if strings.Contains(merged, replaced) {
+			t.Errorf("mergeReadme() overwrote with %q:\n%s", replaced, merged)
+		}
+	}
+
+	// Each added section goes before the next of a later topic, and the
+	// existing sections keep their order
+	order := []string{"# widget", "## Overview", "## 🚀 Getting Started", "## FAQ", "## Usage", "## Contributing", "## License"}
+	last := -1
+	for _, heading := range order {
+		at := strings.Index(merged, heading+"\n")
+		if at <= last {
+			t.Fatalf("mergeReadme() doesn't order %q after the headings before it:\n%s", heading, merged)
+		}
+		last = at
+	}
+
+	// Without a README of its own, the generated one is kept whole
+	if merged, added := mergeReadme("", generated); merged != generated+"\n" || len(added) != 5 {
+		t.Errorf("mergeReadme() of no README = %d sections:\n%s", len(added), merged)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Above this many files the repository map lists directories instead of files
+const REPO_MAP_MAX_FILES = 300
+
+// repoMap describes the layout of the repository for the prompt: every file
+// the tools can see, or for large repositories each directory with its file
+// count, so the model can plan its exploration without listing first
+func repoMap(directory string) (string, error) {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return "", fmt.Errorf("error resolving directory path: %w", err)
+	}
+	files, err := listFiles(absDir, DefaultWalkOptions())
+	if err != nil {
+		return "", err
+	}
+
+	rels := make([]string, 0, len(files))
+	for _, file := range files {
+		if rel, err := filepath.Rel(absDir, file); err == nil {
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+	}
+	sort.Strings(rels)
+
+	var b strings.Builder
+	if len(rels) <= REPO_MAP_MAX_FILES {
+		fmt.Fprintf(&b, "%d files:\n", len(rels))
+		for _, rel := range rels {
+			fmt.Fprintf(&b, "- %s\n", rel)
+		}
+		return b.String(), nil
+	}
+
+	counts := make(map[string]int)
+	for _, rel := range rels {
+		counts[path.Dir(rel)]++
+	}
+	dirs := make([]string, 0, len(counts))
+	for dir := range counts {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	fmt.Fprintf(&b, "%d files in %d directories (file counts exclude subdirectories):\n", len(rels), len(dirs))
+	for _, dir := range dirs {
+		fmt.Fprintf(&b, "- %s/ (%d files)\n", dir, counts[dir])
+	}
+	return b.String(), nil
+}
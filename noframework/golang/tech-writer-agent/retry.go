@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// RunAttempt records one attempt of an --auto-retry run in the metadata
+type RunAttempt struct {
+	Model         string `json:"model"`
+	Iterations    int    `json:"iterations"`
+	MaxIterations int    `json:"max_iterations"`
+	RepoMap       bool   `json:"repo_map,omitempty"`
+	Truncated     bool   `json:"truncated,omitempty"`
+	Error         string `json:"error,omitempty"`
+	ResultFile    string `json:"result_file,omitempty"` // where a superseded attempt's document was kept
+}
+
+// newRunAttempt describes an attempt made with args that ended with runInfo
+// and err
+func newRunAttempt(args *Args, runInfo RunInfo, err error) RunAttempt {
+	attempt := RunAttempt{
+		Model:         args.Model,
+		Iterations:    runInfo.Iterations,
+		MaxIterations: runInfo.MaxIterations,
+		RepoMap:       args.RepoMap,
+		Truncated:     runInfo.Truncated,
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	return attempt
+}
+
+// needsRetry reports whether an attempt failed in a way a second attempt with
+// more room could fix: the agent ran but errored or hit its limits. Runs the
+// user interrupted are never retried.
+func needsRetry(runInfo RunInfo, err error) bool {
+	if runInfo.MaxIterations == 0 || runInfo.Partial {
+		return false
+	}
+	return err != nil || runInfo.Truncated
+}
+
+// retryArgs adjusts args for the second attempt: twice the iteration cap of
+// the first, the repository map in the prompt, and --retry-model if set
+func retryArgs(args *Args, first RunInfo) *Args {
+	retry := *args
+	retry.MaxIterations = 2 * first.MaxIterations
+	retry.RepoMap = true
+	if args.RetryModel != "" {
+		retry.Model = args.RetryModel
+	}
+	return &retry
+}
+
+// describeFailure summarises why an attempt is being retried
+func describeFailure(runInfo RunInfo, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("answer forced after %d of %d iterations", runInfo.Iterations, runInfo.MaxIterations)
+}
+
+// attemptPath returns where the document of a superseded attempt is kept,
+// e.g. report.md -> report.attempt-1.md
+func attemptPath(outputFile string, attempt int) string {
+	ext := filepath.Ext(outputFile)
+	return fmt.Sprintf("%s.attempt-%d%s", strings.TrimSuffix(outputFile, ext), attempt, ext)
+}
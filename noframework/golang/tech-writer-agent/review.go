@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Prompt for the reviewer pass: verify the draft against the files and return
+// the corrected document
+const REVIEW_PROMPT = `Base directory: %s
+
+Another model wrote the technical document below about the codebase in this directory, in answer to this request:
+
+%s
+
+Check the document's factual claims against the actual files using the tools: file paths, names of functions, types, commands and configuration, described behaviour, and dependencies. Read the files the document cites and anything else you need to confirm or refute a claim.
+
+Then give as your Final Answer the complete corrected document: fix claims that are wrong, remove or qualify claims you cannot verify, and keep the structure, tone and everything that is correct. Do not add commentary about the review itself.
+
+Document to review:
+
+%s`
+
+// reviewDocument has reviewer check draft's claims against the files in
+// directory with the usual tools and returns its corrected version, with the
+// agent that produced it for its sources
+func reviewDocument(draft, userPrompt, directory string, reviewer LLMClient, maxIters int, verbose bool, opts AgentOptions) (string, Agent, error) {
+	agent := NewReActAgent(reviewer, GetReActSystemPrompt(), maxIters, verbose, opts)
+	reviewed, err := agent.Run(fmt.Sprintf(REVIEW_PROMPT, directory, userPrompt, draft))
+	if err != nil {
+		return "", agent, fmt.Errorf("review failed: %w", err)
+	}
+	reviewed = strings.TrimSpace(reviewed)
+	if reviewed == "" {
+		return "", agent, fmt.Errorf("review returned an empty document")
+	}
+	return reviewed, agent, nil
+}
+
+// beforeReviewPath returns where the writer's draft of outputFile is kept for
+// comparison, e.g. report.md -> report.before-review.md
+func beforeReviewPath(outputFile string) string {
+	ext := filepath.Ext(outputFile)
+	return strings.TrimSuffix(outputFile, ext) + ".before-review" + ext
+}
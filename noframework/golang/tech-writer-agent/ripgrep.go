@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// When ripgrep (rg) is on the PATH, file listings and search_in_files use it
+// instead of walking the tree in Go: it skips ignored directories without
+// entering them and matches file contents much faster. Its results still pass through
+// the same hidden-file, gitignore and pattern rules (fileFilter), so the
+// agent sees the same files either way, except that ripgrep also honours
+// .gitignore files in subdirectories. Any ripgrep failure falls back to the
+// Go implementation. TECH_WRITER_RIPGREP=off disables it.
+
+// ripgrepPath returns the path of the rg binary, or "" to use the Go walk
+var ripgrepPath = sync.OnceValue(func() string {
+	if os.Getenv("TECH_WRITER_RIPGREP") == "off" {
+		return ""
+	}
+	path, err := exec.LookPath("rg")
+	if err != nil {
+		return ""
+	}
+	return path
+})
+
+// ripgrepArgs are the arguments selecting the files filter would list: only
+// the directory's own .gitignore rules (not global, parent or .ignore files,
+// which fileFilter applies or not itself), hidden files included since
+// fileFilter decides about them, and never .git
+func ripgrepArgs(filter *fileFilter) []string {
+	args := []string{
+		"--no-config", "--hidden", "--sort", "path", "--glob", "!.git/",
+		"--no-ignore-global", "--no-ignore-parent", "--no-ignore-dot", "--no-ignore-exclude", "--no-require-git",
+	}
+	if !filter.opts.RespectGitignore {
+		args = append(args, "--no-ignore")
+	}
+	if !filter.opts.IncludeSubdirs {
+		args = append(args, "--max-depth", "1")
+	}
+	// ripgrep's globs have the same meaning as ours (see glob.go), except
+	// that a leading "!" excludes
+	if pattern := normalizeGlob(filter.opts.Pattern); pattern != "*" && !strings.HasPrefix(pattern, "!") {
+		args = append(args, "--glob", pattern)
+	}
+	return args
+}
+
+// ripgrepCommand runs rg in absDir, so the paths it prints are relative to it
+func ripgrepCommand(rg, absDir string, args []string) *exec.Cmd {
+	cmd := exec.Command(rg, args...)
+	cmd.Dir = absDir
+	return cmd
+}
+
+// ripgrepRelative converts a path printed by rg to a relative OS path
+func ripgrepRelative(path string) string {
+	return filepath.FromSlash(strings.TrimPrefix(path, "./"))
+}
+
+// ripgrepFiles lists the files in absDir with rg --files
+func ripgrepFiles(rg, absDir string, filter *fileFilter) ([]string, error) {
+	cmd := ripgrepCommand(rg, absDir, append(ripgrepArgs(filter), "--files", "--null"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	// Exit status 1 means no files; 2 means some paths couldn't be read,
+	// which the Go walk skips too, unless nothing was listed at all
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || len(output) > 0)) {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	files := []string{}
+	for _, path := range strings.Split(string(output), "\x00") {
+		if path == "" {
+			continue
+		}
+		relPath := ripgrepRelative(path)
+		if filter.keep(relPath) {
+			files = append(files, filepath.Join(absDir, relPath))
+		}
+	}
+	return files, nil
+}
+
+// ripgrepMessage is the part of rg --json output search_in_files uses
+type ripgrepMessage struct {
+	Type string `json:"type"`
+	Data struct {
+		Path       ripgrepText `json:"path"`
+		Lines      ripgrepText `json:"lines"`
+		LineNumber int         `json:"line_number"`
+	} `json:"data"`
+}
+
+// ripgrepText is text in rg --json output, base64-encoded when it isn't
+// valid UTF-8
+type ripgrepText struct {
+	Text  *string `json:"text"`
+	Bytes string  `json:"bytes"`
+}
+
+func (t ripgrepText) String() string {
+	if t.Text != nil {
+		return *t.Text
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(t.Bytes)
+	return strings.ToValidUTF8(string(decoded), "")
+}
+
+// ripgrepSearch finds the lines matching re with rg --json, stopping once
+// more than maxResults have been found. rg's regular expressions accept the
+// RE2 syntax search_in_files documents; one it rejects is an error, so the
+// caller falls back to the Go search.
+func ripgrepSearch(rg, absDir string, re *regexp.Regexp, filter *fileFilter, maxResults int) (SearchResult, error) {
+	cmd := ripgrepCommand(rg, absDir, append(ripgrepArgs(filter), "--json", "--regexp", re.String()))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return SearchResult{}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return SearchResult{}, err
+	}
+
+	result := SearchResult{Matches: []SearchMatch{}}
+	skip := make(map[string]bool)
+	reader := bufio.NewReader(stdout)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		var message ripgrepMessage
+		if len(line) > 0 && json.Unmarshal(line, &message) == nil && message.Type == "match" {
+			relPath := ripgrepRelative(message.Data.Path.String())
+			path := filepath.Join(absDir, relPath)
+			// ripgrep stops reading a file at the first NUL byte but may
+			// report the matches before it, while the Go search skips
+			// binary files entirely
+			skipped, checked := skip[path]
+			if !checked {
+				skipped = !filter.keep(relPath) || isBinary(path)
+				skip[path] = skipped
+			}
+			if !skipped {
+				result.Matches = append(result.Matches, SearchMatch{
+					File: path,
+					Line: message.Data.LineNumber,
+					Text: truncateRunes(strings.TrimSpace(message.Data.Lines.String()), SEARCH_MAX_LINE_CHARS),
+				})
+			}
+		}
+		if len(result.Matches) > maxResults {
+			result.Matches = result.Matches[:maxResults]
+			result.Truncated = true
+			cmd.Process.Kill()
+			break
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			}
+			break
+		}
+	}
+	io.Copy(io.Discard, stdout)
+	waitErr := cmd.Wait()
+	if err != nil {
+		return SearchResult{}, err
+	}
+	// Exit status 1 means no matches; 2 means an error, which only counts if
+	// it produced nothing (e.g. a rejected regular expression) rather than
+	// an unreadable file
+	var exitErr *exec.ExitError
+	if waitErr != nil && !result.Truncated && !(errors.As(waitErr, &exitErr) && (exitErr.ExitCode() == 1 || len(result.Matches) > 0)) {
+		return SearchResult{}, fmt.Errorf("%w: %s", waitErr, strings.TrimSpace(stderr.String()))
+	}
+	result.Count = len(result.Matches)
+	return result, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// rootLabelPattern is what a root's label may look like; it must not
+// contain the colon that ends it in a path
+var rootLabelPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// rootToolPathArgs are the tool arguments naming a file or directory, which
+// may start with a root's label
+var rootToolPathArgs = []string{"directory", "path", "file_path"}
+
+// Root is one of the directories of a run analysing several (--compare, or
+// several positional directories), which the tools address as "label:path"
+type Root struct {
+	Label     string `json:"label"`
+	Directory string `json:"directory"`
+	Commit    string `json:"commit,omitempty"`
+}
+
+// labeledRoots holds the roots of the run; there are none when a single
+// directory is analysed, and then labels mean nothing
+var labeledRoots = struct {
+	sync.RWMutex
+	roots []Root
+}{}
+
+// setRoots sets the labeled roots the tools resolve paths against
+func setRoots(roots []Root) error {
+	resolved := make([]Root, len(roots))
+	for i, root := range roots {
+		absDir, err := filepath.Abs(root.Directory)
+		if err != nil {
+			return fmt.Errorf("error resolving directory path: %w", err)
+		}
+		resolved[i] = root
+		resolved[i].Directory = absDir
+	}
+	labeledRoots.Lock()
+	defer labeledRoots.Unlock()
+	labeledRoots.roots = resolved
+	return nil
+}
+
+// resolveRootPrefix turns a path starting with a root's label and a colon
+// into one under that root. Other paths are returned as they are.
+func resolveRootPrefix(path string) string {
+	labeledRoots.RLock()
+	defer labeledRoots.RUnlock()
+	for _, root := range labeledRoots.roots {
+		if rest, ok := strings.CutPrefix(path, root.Label+":"); ok {
+			return filepath.Join(root.Directory, strings.TrimLeft(rest, `/\`))
+		}
+	}
+	return path
+}
+
+// resolveRootArgs applies resolveRootPrefix to the path arguments of a tool
+// call, which validateToolArgs has checked
+func resolveRootArgs(args map[string]interface{}) map[string]interface{} {
+	for _, name := range rootToolPathArgs {
+		if value, ok := args[name].(string); ok {
+			args[name] = resolveRootPrefix(value)
+		}
+	}
+	return args
+}
+
+// parseRoots reads the positional directories of a multi-root run, each
+// "label=directory" or a directory labeled with its base name
+func parseRoots(positional []string) ([]Root, error) {
+	var roots []Root
+	seen := make(map[string]bool)
+	for _, arg := range positional {
+		label, directory, labeled := strings.Cut(arg, "=")
+		if !labeled {
+			directory = arg
+			label = filepath.Base(filepath.Clean(arg))
+		}
+		if !rootLabelPattern.MatchString(label) {
+			return nil, fmt.Errorf("invalid label %q for %s; give one as label=directory, with letters, digits, '.', '-' and '_'", label, directory)
+		}
+		if seen[label] {
+			return nil, fmt.Errorf("two directories are labeled %q; give them labels as label=directory", label)
+		}
+		seen[label] = true
+		if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("directory not found: %s", directory)
+		}
+		roots = append(roots, Root{Label: label, Directory: directory, Commit: gitHeadCommit(directory)})
+	}
+	return roots, nil
+}
+
+// rootsPrompt introduces the directories of a multi-root run and how the
+// tools address them, asking for one document of the system they make up
+func rootsPrompt(roots []Root) string {
+	var b strings.Builder
+	b.WriteString("The code base spans several directories, documented together as one system:\n")
+	for _, root := range roots {
+		fmt.Fprintf(&b, "- %s: %s\n", root.Label, root.Directory)
+	}
+	fmt.Fprintf(&b, "Every tool takes paths in any of them, absolute or starting with a label and a colon for its root, e.g. %q. ", roots[len(roots)-1].Label+":README.md")
+	b.WriteString("Explore each of them, and document how they fit together (the interfaces, configuration and deployment that connect them) as well as each part. Say which directory each file you cite is in.\n")
+	return b.String()
+}
+
+// rootDirectories returns the directories of the run: its roots, or
+// directory alone
+func rootDirectories(directory string, roots []Root) []string {
+	if len(roots) == 0 {
+		return []string{directory}
+	}
+	directories := make([]string, len(roots))
+	for i, root := range roots {
+		directories[i] = root.Directory
+	}
+	return directories
+}
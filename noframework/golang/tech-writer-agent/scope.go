@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// walkScope narrows what the file-walking tools see to the --include and
+// --exclude patterns, on top of the ignore files. The patterns are globs as
+// in glob.go, relative to the analysed directory whichever directory a tool
+// walks; a --compare run has two, and the patterns apply in each. It also says whether files marked linguist-vendored or
+// linguist-generated are shown (--include-generated).
+var walkScope = struct {
+	sync.RWMutex
+	roots            []string
+	include          []string
+	exclude          []string
+	includeGenerated bool
+}{}
+
+// setWalkScope sets the analysed directory and the --include and --exclude
+// patterns, which the flags have validated
+func setWalkScope(root string, include, exclude []string, includeGenerated bool) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("error resolving directory path: %w", err)
+	}
+	walkScope.Lock()
+	defer walkScope.Unlock()
+	walkScope.roots = []string{absRoot}
+	walkScope.include = include
+	walkScope.exclude = exclude
+	walkScope.includeGenerated = includeGenerated
+	return nil
+}
+
+// addWalkScopeRoot adds the second code base of a --compare run to the
+// directories the patterns are relative to
+func addWalkScopeRoot(root string) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("error resolving directory path: %w", err)
+	}
+	walkScope.Lock()
+	defer walkScope.Unlock()
+	walkScope.roots = append(walkScope.roots, absRoot)
+	return nil
+}
+
+// scopeFilter applies the walk scope to the paths under one walked directory
+type scopeFilter struct {
+	prefix  string // of the walked directory relative to the analysed one, "" or ending in "/"
+	include []string
+	exclude []string
+}
+
+// newScopeFilter returns the scope of the paths under absDir, or nil if
+// there are no patterns or absDir is outside the analysed directories
+func newScopeFilter(absDir string) *scopeFilter {
+	walkScope.RLock()
+	defer walkScope.RUnlock()
+	if len(walkScope.include) == 0 && len(walkScope.exclude) == 0 {
+		return nil
+	}
+	for _, root := range walkScope.roots {
+		rel, err := filepath.Rel(root, absDir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		prefix := ""
+		if rel != "." {
+			prefix = filepath.ToSlash(rel) + "/"
+		}
+		return &scopeFilter{prefix: prefix, include: walkScope.include, exclude: walkScope.exclude}
+	}
+	return nil
+}
+
+// excludes returns why relPath (relative to the walked directory) is out of
+// scope, or "" if it is in it. A pattern matching one of the file's
+// directories matches the file, so "--exclude testdata" cuts out every
+// testdata directory and "--include src" keeps src.
+func (s *scopeFilter) excludes(relPath string) string {
+	if s == nil {
+		return ""
+	}
+	slashPath := s.prefix + filepath.ToSlash(relPath)
+	for _, pattern := range s.exclude {
+		if scopeMatch(pattern, slashPath) {
+			return fmt.Sprintf("matched by the --exclude pattern %q", pattern)
+		}
+	}
+	if len(s.include) == 0 {
+		return ""
+	}
+	for _, pattern := range s.include {
+		if scopeMatch(pattern, slashPath) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("matched by none of the --include patterns %s", strings.Join(s.include, ", "))
+}
+
+// scopeMatch reports whether pattern matches slashPath or one of its
+// directories
+func scopeMatch(pattern, slashPath string) bool {
+	for p := slashPath; p != "."; p = path.Dir(p) {
+		if matchGlob(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// hideGenerated reports whether the file tools hide files marked
+// linguist-vendored or linguist-generated
+func hideGenerated() bool {
+	walkScope.RLock()
+	defer walkScope.RUnlock()
+	return !walkScope.includeGenerated
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Limits of search_in_files, which keep its observation small
+const (
+	SEARCH_DEFAULT_MAX_RESULTS = 50
+	SEARCH_MAX_RESULTS         = 500
+	SEARCH_MAX_LINE_CHARS      = 200
+	SEARCH_MAX_LINE_BYTES      = 1024 * 1024 // longer lines (e.g. minified code) end the scan of a file
+)
+
+// SearchMatch is one line found by search_in_files
+type SearchMatch struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// SearchResult represents the result of searching file contents
+type SearchResult struct {
+	Matches   []SearchMatch `json:"matches"`
+	Count     int           `json:"count"`
+	Truncated bool          `json:"truncated,omitempty"` // more lines matched than max_results
+}
+
+// searchInFiles implements the search_in_files tool: it finds the lines
+// containing query in the files find_all_matching_files would list, skipping
+// binary files
+func searchInFiles(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	query, ok := args["query"].(string)
+	if !ok || query == "" {
+		return nil, fmt.Errorf("query parameter is required")
+	}
+
+	useRegex, _ := args["regex"].(bool)
+	caseSensitive := true
+	if val, ok := args["case_sensitive"].(bool); ok {
+		caseSensitive = val
+	}
+	opts := DefaultWalkOptions()
+	if val, ok := args["file_pattern"].(string); ok && val != "" {
+		opts.Pattern = val
+	}
+	maxResults := SEARCH_DEFAULT_MAX_RESULTS
+	if val, ok := intArg(args, "max_results"); ok && val > 0 {
+		maxResults = min(val, SEARCH_MAX_RESULTS)
+	}
+
+	if !useRegex {
+		query = regexp.QuoteMeta(query)
+	}
+	if !caseSensitive {
+		query = "(?i)" + query
+	}
+	re, err := regexp.Compile(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	return searchFiles(directory, re, opts, maxResults)
+}
+
+// searchFiles returns up to maxResults lines matching re in the files
+// listFiles would list with opts, skipping binary files
+func searchFiles(directory string, re *regexp.Regexp, opts WalkOptions, maxResults int) (SearchResult, error) {
+	if rg := ripgrepPath(); rg != "" {
+		absDir, err := filepath.Abs(directory)
+		if err != nil {
+			return SearchResult{}, fmt.Errorf("error resolving directory path: %w", err)
+		}
+		if _, err := os.Stat(absDir); err == nil {
+			filter, err := newFileFilter(absDir, opts)
+			if err != nil {
+				return SearchResult{}, err
+			}
+			result, err := ripgrepSearch(rg, absDir, re, filter, maxResults)
+			if err == nil {
+				return result, nil
+			}
+			log.Printf("ripgrep search failed, searching in Go instead: %v", err)
+		}
+	}
+
+	files, err := listFiles(directory, opts)
+	if err != nil {
+		return SearchResult{}, err
+	}
+
+	result := SearchResult{Matches: []SearchMatch{}}
+	for _, file := range files {
+		if isBinary(file) {
+			continue
+		}
+		matches, err := searchFile(file, re, maxResults-len(result.Matches)+1)
+		if err != nil {
+			continue // Skip files we can't read, as listFiles does
+		}
+		result.Matches = append(result.Matches, matches...)
+		if len(result.Matches) > maxResults {
+			result.Matches = result.Matches[:maxResults]
+			result.Truncated = true
+			break
+		}
+	}
+	result.Count = len(result.Matches)
+	return result, nil
+}
+
+// searchFile returns up to limit lines of path matching re
+func searchFile(path string, re *regexp.Regexp, limit int) ([]SearchMatch, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matches []SearchMatch
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), SEARCH_MAX_LINE_BYTES)
+	for line := 1; scanner.Scan() && len(matches) < limit; line++ {
+		text := scanner.Text()
+		if re.MatchString(text) {
+			matches = append(matches, SearchMatch{
+				File: path,
+				Line: line,
+				Text: truncateRunes(strings.TrimSpace(text), SEARCH_MAX_LINE_CHARS),
+			})
+		}
+	}
+	return matches, nil
+}
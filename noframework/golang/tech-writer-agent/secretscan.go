@@ -0,0 +1,170 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Thresholds of the high-entropy check. Random keys of this length have an
+// entropy near log2 of their length, and switch between upper case, lower
+// case and digits at about every other character. Long identifiers such as
+// getUserProfileById2023 can reach the same entropy, but switch at most at
+// each word.
+const (
+	SECRET_MIN_ENTROPY_LENGTH = 24
+	SECRET_MIN_ENTROPY_BITS   = 4.0  // per character
+	SECRET_MIN_CLASS_CHANGES  = 0.45 // of adjacent characters
+)
+
+// secretAssignmentPattern matches a quoted value assigned to a key whose
+// name suggests a credential, e.g. password = "hunter22" or "api_key": "...".
+// The quotes may be JSON-escaped. Placeholders such as "${DB_PASSWORD}" or
+// "<token>" are left alone.
+var secretAssignmentPattern = regexp.MustCompile(`(?i)\b((?:password|passwd|secret|token|api[_-]?key|access[_-]?key|private[_-]?key|client[_-]?secret)\w*\\?["']?\s*[:=]+\s*\\?["'])([^"'\\\s${}<>\[\]]{8,})(\\?["'])`)
+
+// entropyTokenPattern matches the candidates for the high-entropy check:
+// runs of the characters of base64 and base62 keys. "/" is left out so that
+// file paths are split into their names, except in integrity hashes
+// (sha512-...), which are matched whole so that highEntropy can skip them.
+var entropyTokenPattern = regexp.MustCompile(`sha(?:1|256|384|512)-[A-Za-z0-9+/]+=*|[A-Za-z0-9+_=-]{24,}`)
+
+// secretScan holds the pre-send secret scan's setting (--scan-secrets) and
+// what it has removed in this process, by kind
+var secretScan struct {
+	sync.Mutex
+	enabled    bool
+	redactions map[string]int
+}
+
+// enableSecretScan turns the scan of tool results on or off
+func enableSecretScan(enabled bool) {
+	secretScan.Lock()
+	defer secretScan.Unlock()
+	secretScan.enabled = enabled
+}
+
+// scanPromptText removes credentials from file contents or a tool's result
+// before they are sent to the model, if the scan is enabled. See
+// scrubSecrets.
+func scanPromptText(text string) string {
+	secretScan.Lock()
+	defer secretScan.Unlock()
+	if !secretScan.enabled {
+		return text
+	}
+	if secretScan.redactions == nil {
+		secretScan.redactions = make(map[string]int)
+	}
+	return scrubSecrets(text, secretScan.redactions)
+}
+
+// secretScanRedactions returns what the scan has removed so far, by kind
+func secretScanRedactions() map[string]int {
+	secretScan.Lock()
+	defer secretScan.Unlock()
+	if len(secretScan.redactions) == 0 {
+		return nil
+	}
+	redactions := make(map[string]int, len(secretScan.redactions))
+	for kind, count := range secretScan.redactions {
+		redactions[kind] = count
+	}
+	return redactions
+}
+
+// scrubSecrets replaces with REDACTED the credentials in text, which may be
+// JSON: the known key and token formats (secretPatterns) and provider keys,
+// quoted values assigned to credential-like names, and high-entropy strings
+// that look like random keys. Counts by kind are added to redactions.
+func scrubSecrets(text string, redactions map[string]int) string {
+	for _, secret := range secretPatterns {
+		text = redactMatches(text, secret.pattern, 0, "secret:"+secret.kind, nil, redactions)
+	}
+	text = redactProviderKeys(text, redactions)
+	text = redactMatches(text, secretAssignmentPattern, 2, "secret:assignment", nil, redactions)
+	return redactMatches(text, entropyTokenPattern, 0, "secret:high_entropy", highEntropy, redactions)
+}
+
+// redactMatches replaces the given group of each match of re in text that
+// accept (if not nil) accepts with REDACTED, counting them as kind.
+//
+// The patterns are matched against a copy of text in which the letters of
+// JSON escapes are blanked out, so that a key after "\n" still starts at a
+// word boundary and no replacement splits an escape.
+func redactMatches(text string, re *regexp.Regexp, group int, kind string, accept func(string) bool, redactions map[string]int) string {
+	masked := []byte(text)
+	for i := 0; i < len(masked)-1; i++ {
+		if masked[i] != '\\' {
+			continue
+		}
+		switch masked[i+1] {
+		case 'b', 'f', 'n', 'r', 't':
+			masked[i+1] = ' '
+		case 'u':
+			for j := i + 1; j < min(i+6, len(masked)); j++ {
+				masked[j] = ' '
+			}
+		}
+		i++ // an escaped quote or backslash stays as it is
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllSubmatchIndex(masked, -1) {
+		start, end := match[2*group], match[2*group+1]
+		if start < 0 || (accept != nil && !accept(text[start:end])) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(REDACTED)
+		last = end
+		redactions[kind]++
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// highEntropy reports whether token looks like a random key: long, mixing
+// upper and lower case letters and digits throughout, with a high Shannon
+// entropy.
+// Hexadecimal strings (commit hashes, checksums, UUIDs) and integrity
+// hashes (sha512-...) are not counted, since tools report them deliberately.
+func highEntropy(token string) bool {
+	if len(token) < SECRET_MIN_ENTROPY_LENGTH || strings.HasPrefix(token, "sha") {
+		return false
+	}
+	var classes [4]int // upper, lower, digit, other
+	changes, previous := 0, -1
+	counts := make(map[rune]int)
+	for _, r := range token {
+		class := 3
+		switch {
+		case r >= 'A' && r <= 'Z':
+			class = 0
+		case r >= 'a' && r <= 'z':
+			class = 1
+		case r >= '0' && r <= '9':
+			class = 2
+		}
+		if previous >= 0 && class != previous {
+			changes++
+		}
+		previous = class
+		classes[class]++
+		counts[r]++
+	}
+	if classes[0] == 0 || classes[1] == 0 || classes[2] == 0 || float64(changes)/float64(len(token)-1) < SECRET_MIN_CLASS_CHANGES {
+		return false
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(len(token))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy >= SECRET_MIN_ENTROPY_BITS
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Documentation site generators --site writes projects for
+const (
+	SiteMkDocs     = "mkdocs"
+	SiteDocusaurus = "docusaurus"
+)
+
+// DOCUSAURUS_VERSION is the Docusaurus release the exported package.json asks for
+const DOCUSAURUS_VERSION = "^3.5.2"
+
+// packageNamePattern matches what npm doesn't allow in a package name
+var packageNamePattern = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// mkdocsConfig is the mkdocs.yml of an exported site
+type mkdocsConfig struct {
+	SiteName string              `yaml:"site_name"`
+	RepoURL  string              `yaml:"repo_url,omitempty"`
+	DocsDir  string              `yaml:"docs_dir"`
+	Nav      []map[string]string `yaml:"nav"`
+	Plugins  []string            `yaml:"plugins,omitempty"`
+}
+
+// siteFrontMatter is the YAML front matter of an exported page
+type siteFrontMatter struct {
+	Title           string `yaml:"title"`
+	SidebarPosition int    `yaml:"sidebar_position,omitempty"` // Docusaurus only
+	Slug            string `yaml:"slug,omitempty"`             // "/" makes the index the site's home page
+}
+
+// siteOutputDir returns the directory a --site project for outputFile is
+// written to, e.g. "output/20250101-repo-model-mkdocs"
+func siteOutputDir(outputFile, site string) string {
+	return strings.TrimSuffix(outputFile, filepath.Ext(outputFile)) + "-" + site
+}
+
+// writeSite writes pages, as splitDocument makes them, to dir as a project
+// that site builds as it is: the pages under docs/ with YAML front matter,
+// and the configuration with the navigation in the pages' order. repoURL
+// links the site to the repository when it is on the web.
+func writeSite(dir, site string, pages []SplitPage, siteName, repoURL string) error {
+	docsDir := filepath.Join(dir, "docs")
+	if err := os.MkdirAll(docsDir, 0755); err != nil {
+		return fmt.Errorf("error creating site directory: %w", err)
+	}
+	entries, err := os.ReadDir(docsDir)
+	if err != nil {
+		return fmt.Errorf("error reading site directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && splitPagePattern.MatchString(entry.Name()) {
+			if err := os.Remove(filepath.Join(docsDir, entry.Name())); err != nil {
+				return fmt.Errorf("error removing earlier page: %w", err)
+			}
+		}
+	}
+
+	mermaid := false
+	for i, page := range pages {
+		for _, diagram := range findDiagrams(strings.Split(page.Markdown, "\n")) {
+			mermaid = mermaid || diagram.Language == "mermaid"
+		}
+		frontMatter := siteFrontMatter{Title: plainText((&htmlRenderer{}).inline(page.Title))}
+		if site == SiteDocusaurus {
+			frontMatter.SidebarPosition = i + 1
+			if i == 0 {
+				frontMatter.Slug = "/"
+			}
+		}
+		header, err := encodeYAML(frontMatter)
+		if err != nil {
+			return fmt.Errorf("error encoding front matter: %w", err)
+		}
+		content := "---\n" + header + "---\n\n" + page.Markdown
+		if err := os.WriteFile(filepath.Join(docsDir, page.File), []byte(content), 0644); err != nil {
+			return fmt.Errorf("error writing page: %w", err)
+		}
+	}
+	if !strings.HasPrefix(repoURL, "http://") && !strings.HasPrefix(repoURL, "https://") {
+		repoURL = ""
+	}
+
+	files := make(map[string]string)
+	switch site {
+	case SiteMkDocs:
+		config := mkdocsConfig{SiteName: siteName, RepoURL: repoURL, DocsDir: "docs"}
+		for i, page := range pages {
+			title := plainText((&htmlRenderer{}).inline(page.Title))
+			if i == 0 {
+				title = "Home"
+			}
+			config.Nav = append(config.Nav, map[string]string{title: page.File})
+		}
+		if mermaid {
+			config.Plugins = []string{"search", "mermaid2"}
+		}
+		data, err := encodeYAML(config)
+		if err != nil {
+			return fmt.Errorf("error encoding mkdocs.yml: %w", err)
+		}
+		files["mkdocs.yml"] = data
+	case SiteDocusaurus:
+		files["docusaurus.config.js"] = docusaurusConfig(siteName, repoURL, mermaid)
+		files["sidebars.js"] = "module.exports = {\n  docs: [{type: 'autogenerated', dirName: '.'}],\n};\n"
+		dependencies := map[string]string{
+			"@docusaurus/core":           DOCUSAURUS_VERSION,
+			"@docusaurus/preset-classic": DOCUSAURUS_VERSION,
+			"react":                      "^18.2.0",
+			"react-dom":                  "^18.2.0",
+		}
+		if mermaid {
+			dependencies["@docusaurus/theme-mermaid"] = DOCUSAURUS_VERSION
+		}
+		name := strings.Trim(packageNamePattern.ReplaceAllString(strings.ToLower(siteName), "-"), "-._")
+		if name == "" {
+			name = "docs"
+		}
+		data, err := json.MarshalIndent(map[string]any{
+			"name":         name + "-docs",
+			"private":      true,
+			"scripts":      map[string]string{"start": "docusaurus start", "build": "docusaurus build", "serve": "docusaurus serve"},
+			"dependencies": dependencies,
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error encoding package.json: %w", err)
+		}
+		files["package.json"] = string(data) + "\n"
+	default:
+		return fmt.Errorf("unknown site generator %q", site)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			return fmt.Errorf("error writing %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// encodeYAML returns value as YAML indented by two spaces
+func encodeYAML(value any) (string, error) {
+	var b strings.Builder
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return b.String(), encoder.Close()
+}
+
+// docusaurusConfig returns the docusaurus.config.js of a docs-only site.
+// The pages are plain Markdown rather than MDX, so that braces and angle
+// brackets in the text don't break the build, and broken links only warn.
+func docusaurusConfig(siteName, repoURL string, mermaid bool) string {
+	// Where GitHub Pages would serve the site; only the build needs them right
+	url, baseURL := "https://example.com", "/"
+	if name, ok := githubRepoName(repoURL); ok {
+		owner, repo, _ := strings.Cut(name, "/")
+		url, baseURL = "https://"+strings.ToLower(owner)+".github.io", "/"+repo+"/"
+	}
+	quote := func(s string) string {
+		data, _ := json.Marshal(s)
+		return string(data)
+	}
+	var b strings.Builder
+	b.WriteString("module.exports = {\n")
+	fmt.Fprintf(&b, "  title: %s,\n  url: %s,\n  baseUrl: %s,\n", quote(siteName), quote(url), quote(baseURL))
+	b.WriteString("  onBrokenLinks: 'warn',\n  onBrokenMarkdownLinks: 'warn',\n  onBrokenAnchors: 'warn',\n")
+	if mermaid {
+		b.WriteString("  markdown: {format: 'detect', mermaid: true},\n  themes: ['@docusaurus/theme-mermaid'],\n")
+	} else {
+		b.WriteString("  markdown: {format: 'detect'},\n")
+	}
+	b.WriteString("  presets: [\n    ['classic', {\n      docs: {routeBasePath: '/', sidebarPath: require.resolve('./sidebars.js')},\n      blog: false,\n    }],\n  ],\n")
+	if repoURL != "" {
+		fmt.Fprintf(&b, "  themeConfig: {\n    navbar: {title: %s, items: [{href: %s, label: 'Repository', position: 'right'}]},\n  },\n", quote(siteName), quote(repoURL))
+	}
+	b.WriteString("};\n")
+	return b.String()
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// SPLIT_INDEX is the base name of the first page of a split document, which
+// links to the others
+const SPLIT_INDEX = "index"
+
+// anchorLinkPattern matches links to an anchor of the same document, in
+// Markdown and in raw HTML
+var anchorLinkPattern = regexp.MustCompile(`(\]\(|href=["'])#([^()\s"']+)`)
+
+// splitPagePattern matches the section pages writeSplitOutput writes
+var splitPagePattern = regexp.MustCompile(`^\d{2,}-.+\.(?:md|html)$`)
+
+// SplitPage is a file of a split document: its index, or one of its major
+// sections with the sections under it
+type SplitPage struct {
+	File     string // relative to the split directory, e.g. "02-architecture.md"
+	Title    string // the heading's Markdown
+	Markdown string
+	Sections []SplitPage // the sections one level down, their File with the anchor
+}
+
+// splitHeading is a heading of the document being split
+type splitHeading struct {
+	line  int
+	level int
+	text  string
+	id    string // as GitHub and --format html make it across the whole document
+}
+
+// splitDocument splits document into an index and a page for each major
+// section: each heading, outside code blocks, of the highest level below the
+// title. Page files take extension, with a number to keep their order. A
+// page's headings move up so that it starts with a level-1 heading, and links
+// to anchors elsewhere in the document are pointed at the page that now has
+// them. The index keeps the title, or starts with one made of title if the
+// document has none, and the text before the first major section, and lists
+// the pages with their sections.
+func splitDocument(document, title, extension string) []SplitPage {
+	lines := strings.Split(strings.TrimRight(strings.ReplaceAll(document, "\r\n", "\n"), "\n"), "\n")
+
+	var headings []splitHeading
+	ids := make(map[string]int)
+	inFence := ""
+	for i, line := range lines {
+		if inFence != "" {
+			if closesFence(line, inFence) {
+				inFence = ""
+			}
+		} else if m := fencePattern.FindStringSubmatch(line); m != nil {
+			inFence = m[1]
+		} else if m := headingPattern.FindStringSubmatch(line); m != nil {
+			headings = append(headings, splitHeading{line: i, level: len(m[1]), text: m[2], id: uniqueID(ids, m[2])})
+		}
+	}
+
+	// The title is a level-1 heading before any other; the major sections are
+	// the highest level of the rest
+	titled := len(headings) > 0 && headings[0].level == 1
+	sections := headings
+	if titled {
+		title, sections = headings[0].text, headings[1:]
+	}
+	level := 0
+	for _, h := range sections {
+		if level == 0 || h.level < level {
+			level = h.level
+		}
+	}
+
+	index := SplitPage{File: SPLIT_INDEX + extension, Title: title}
+	pages := []SplitPage{index}
+	owner := make([]int, len(lines)) // the page each line goes to
+	next := 0
+	for i := range lines {
+		if next < len(sections) && sections[next].line == i {
+			if h := sections[next]; h.level == level {
+				pages = append(pages, SplitPage{File: fmt.Sprintf("%02d-%s%s", len(pages), h.id, extension), Title: h.text})
+			}
+			next++
+		}
+		owner[i] = len(pages) - 1
+	}
+
+	// Where each anchor is now: its page, and its id there, which differs
+	// when a duplicate heading is on a page without the others
+	type anchor struct {
+		page int
+		id   string
+	}
+	anchors := make(map[string]anchor)
+	pageIDs := make([]map[string]int, len(pages))
+	for i := range pageIDs {
+		pageIDs[i] = make(map[string]int)
+	}
+	for _, h := range headings {
+		page := owner[h.line]
+		id := uniqueID(pageIDs[page], h.text)
+		anchors[h.id] = anchor{page: page, id: id}
+		if page > 0 && h.level == level+1 {
+			pages[page].Sections = append(pages[page].Sections, SplitPage{File: pages[page].File + "#" + id, Title: h.text})
+		}
+	}
+
+	shift := level - 1
+	if level == 0 {
+		shift = 0
+	}
+	content := make([][]string, len(pages))
+	inFence = ""
+	for i, line := range lines {
+		page := owner[i]
+		if inFence != "" {
+			if closesFence(line, inFence) {
+				inFence = ""
+			}
+		} else if m := fencePattern.FindStringSubmatch(line); m != nil {
+			inFence = m[1]
+		} else {
+			if m := headingPattern.FindStringSubmatch(line); m != nil && page > 0 && len(m[1]) > shift {
+				line = strings.Replace(line, m[1], m[1][shift:], 1)
+			}
+			line = anchorLinkPattern.ReplaceAllStringFunc(line, func(link string) string {
+				m := anchorLinkPattern.FindStringSubmatch(link)
+				target, ok := anchors[m[2]]
+				if !ok {
+					return link
+				}
+				if target.page == page {
+					return m[1] + "#" + target.id
+				}
+				return m[1] + pages[target.page].File + "#" + target.id
+			})
+		}
+		content[page] = append(content[page], line)
+	}
+
+	for i := 1; i < len(pages); i++ {
+		pages[i].Markdown = strings.TrimSpace(strings.Join(content[i], "\n")) + "\n"
+	}
+	var b strings.Builder
+	if !titled {
+		fmt.Fprintf(&b, "# %s\n\n", title)
+	}
+	if intro := strings.TrimSpace(strings.Join(content[0], "\n")); intro != "" {
+		b.WriteString(intro + "\n\n")
+	}
+	if len(pages) > 1 {
+		b.WriteString("## Contents\n\n")
+		for _, page := range pages[1:] {
+			fmt.Fprintf(&b, "- [%s](%s)\n", page.Title, page.File)
+			for _, section := range page.Sections {
+				fmt.Fprintf(&b, "  - [%s](%s)\n", section.Title, section.File)
+			}
+		}
+	}
+	pages[0].Title = title
+	pages[0].Markdown = strings.TrimRight(b.String(), "\n") + "\n"
+	return pages
+}
+
+// uniqueID returns the anchor of a heading of text, suffixed with a number
+// if ids already has it, and records it in ids
+func uniqueID(ids map[string]int, text string) string {
+	id := headingID(plainText((&htmlRenderer{}).inline(text)))
+	if n := ids[id]; n > 0 {
+		ids[id]++
+		return fmt.Sprintf("%s-%d", id, n)
+	}
+	ids[id] = 1
+	return id
+}
+
+// addPageNavigation ends each section page with links to the pages before
+// and after it and to the index
+func addPageNavigation(pages []SplitPage) {
+	for i := 1; i < len(pages); i++ {
+		links := []string{fmt.Sprintf("[Contents](%s)", pages[0].File)}
+		if i > 1 {
+			links = append([]string{fmt.Sprintf("← [%s](%s)", pages[i-1].Title, pages[i-1].File)}, links...)
+		}
+		if i < len(pages)-1 {
+			links = append(links, fmt.Sprintf("[%s](%s) →", pages[i+1].Title, pages[i+1].File))
+		}
+		pages[i].Markdown += "\n---\n\n" + strings.Join(links, " · ") + "\n"
+	}
+}
+
+// splitOutputDir returns the directory a split of outputFile is written to:
+// its path without the extension
+func splitOutputDir(outputFile string) string {
+	dir := strings.TrimSuffix(outputFile, filepath.Ext(outputFile))
+	if dir == outputFile {
+		dir += ".d"
+	}
+	return dir
+}
+
+// writeSplitOutput writes pages to dir, rendered as HTML pages for
+// FormatHTML, replacing the section pages of an earlier split there
+func writeSplitOutput(dir string, pages []SplitPage, format string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("error creating split output directory: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading split output directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && splitPagePattern.MatchString(entry.Name()) {
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return fmt.Errorf("error removing earlier page: %w", err)
+			}
+		}
+	}
+	for _, page := range pages {
+		content := page.Markdown
+		if format == FormatHTML {
+			content = renderHTML(page.Markdown, plainText((&htmlRenderer{}).inline(page.Title)))
+		}
+		if err := os.WriteFile(filepath.Join(dir, page.File), []byte(content), 0644); err != nil {
+			return fmt.Errorf("error writing page: %w", err)
+		}
+	}
+	return nil
+}
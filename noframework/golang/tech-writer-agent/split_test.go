@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitDocument(t *testing.T) {
+	document := "# Widget\n\nAn overview; see [setup](#setup) and [the API](#api-1).\n\n" +
+		"## Setup\n\n### Build\n\nThen read [the API](#api).\n\n```sh\n## not a heading, nor [a link](#setup)\n```\n\n" +
+		"## API\n\nBack to [Build](#build) or [nowhere](#missing).\n\n### API\n\n" +
+		"## API\n\n<a href=\"#widget\">Top</a>\n"
+	pages := splitDocument(document, "fallback", ".md")
+
+	var files []string
+	for _, page := range pages {
+		files = append(files, page.File)
+	}
+	if want := []string{"index.md", "01-setup.md", "02-api.md", "03-api-2.md"}; !reflect.DeepEqual(files, want) {
+		t.Fatalf("splitDocument() files = %v, want %v", files, want)
+	}
+
+	wantIndex := "# Widget\n\nAn overview; see [setup](01-setup.md#setup) and [the API](02-api.md#api-1).\n\n" +
+		"## Contents\n\n- [Setup](01-setup.md)\n  - [Build](01-setup.md#build)\n- [API](02-api.md)\n  - [API](02-api.md#api-1)\n- [API](03-api-2.md)\n"
+	if pages[0].Title != "Widget" || pages[0].Markdown != wantIndex {
+		t.Errorf("index %q =\n%s\nwant\n%s", pages[0].Title, pages[0].Markdown, wantIndex)
+	}
+	if want := "# Setup\n\n## Build\n\nThen read [the API](02-api.md#api).\n\n```sh\n## not a heading, nor [a link](#setup)\n```\n"; pages[1].Markdown != want {
+		t.Errorf("first page =\n%s\nwant\n%s", pages[1].Markdown, want)
+	}
+	if want := "# API\n\nBack to [Build](01-setup.md#build) or [nowhere](#missing).\n\n## API\n"; pages[2].Markdown != want {
+		t.Errorf("second page =\n%s\nwant\n%s", pages[2].Markdown, want)
+	}
+	// The third "API" heading is api-2 in the document but api on its own page
+	if want := "# API\n\n<a href=\"index.md#widget\">Top</a>\n"; pages[3].Markdown != want {
+		t.Errorf("third page =\n%s\nwant\n%s", pages[3].Markdown, want)
+	}
+
+	// Without a title or sections, the index is all there is
+	if pages := splitDocument("Just text.\n", "Repo", ".html"); len(pages) != 1 || pages[0].Markdown != "# Repo\n\nJust text.\n" {
+		t.Errorf("splitDocument() of plain text = %+v", pages)
+	}
+}
+
+func TestWriteSplitOutput(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "result")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"07-old.md", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages := splitDocument("# T\n\n## A\n\n## B\n", "", ".md")
+	addPageNavigation(pages)
+	if err := writeSplitOutput(dir, pages, FormatMarkdown); err != nil {
+		t.Fatalf("writeSplitOutput() = %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if want := []string{"01-a.md", "02-b.md", "index.md", "notes.txt"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("split directory has %v, want %v", names, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "01-a.md")); string(data) != "# A\n\n---\n\n[Contents](index.md) · [B](02-b.md) →\n" {
+		t.Errorf("first page =\n%s", data)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// repoFingerprint hashes the relative paths and contents of the files the
+// agent can see in directory (gitignore and hidden-file rules applied), so
+// any change that could affect the documentation changes the fingerprint
+func repoFingerprint(directory string) (string, error) {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return "", fmt.Errorf("error resolving directory path: %w", err)
+	}
+	files, err := listFiles(absDir, DefaultWalkOptions())
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	tree := sha256.New()
+	for _, path := range files {
+		rel, err := filepath.Rel(absDir, path)
+		if err != nil {
+			return "", err
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", rel, err)
+		}
+		content := sha256.New()
+		_, err = io.Copy(content, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("error reading %s: %w", rel, err)
+		}
+		fmt.Fprintf(tree, "%s\x00%x\n", filepath.ToSlash(rel), content.Sum(nil))
+	}
+	return "sha256:" + hex.EncodeToString(tree.Sum(nil)), nil
+}
+
+// gitHeadCommit returns the commit checked out in directory, or the one a
+// tarball download was made from, or "" if it is neither
+func gitHeadCommit(directory string) string {
+	output, err := exec.Command("git", "-C", directory, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return tarballCommit(directory)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// remoteHeadCommit returns the commit at the head of the default branch of
+// the remote repository, or of ref, a branch or tag
+func remoteHeadCommit(repoURL, ref string) (string, error) {
+	if !strings.Contains(repoURL, "://") {
+		repoURL = "https://github.com/" + repoURL
+	}
+	patterns := []string{"HEAD"}
+	if ref != "" {
+		// A tag's own line comes after its peeled "^{}" line, the commit
+		patterns = []string{"refs/tags/" + ref + "^{}", "refs/tags/" + ref, "refs/heads/" + ref}
+	}
+	output, err := exec.Command("git", append([]string{"ls-remote", repoURL}, patterns...)...).Output()
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote %s: %w", repoURL, err)
+	}
+	commits := make(map[string]string)
+	for _, line := range strings.Split(string(output), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			commits[fields[1]] = fields[0]
+		}
+	}
+	for _, pattern := range patterns {
+		if commit, ok := commits[pattern]; ok {
+			return commit, nil
+		}
+	}
+	if ref != "" {
+		return "", fmt.Errorf("git ls-remote %s: no branch or tag %s", repoURL, ref)
+	}
+	return "", fmt.Errorf("git ls-remote %s: no HEAD", repoURL)
+}
+
+// isCommitID reports whether ref is a full commit SHA, which never moves
+func isCommitID(ref string) bool {
+	if len(ref) != 40 {
+		return false
+	}
+	for _, c := range ref {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// runStaleCheck implements the stale-check command: it reports which
+// documents in an output directory no longer match the current state of the
+// repository they describe, and fails if any are stale
+func runStaleCheck(argv []string) error {
+	fs := flag.NewFlagSet("stale-check", flag.ExitOnError)
+	outputDir := fs.String("output-dir", "output", "Directory containing previously generated results")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s stale-check [--output-dir DIR | DIR]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	if fs.NArg() > 0 {
+		*outputDir = fs.Arg(0)
+	}
+
+	metadataFiles, err := filepath.Glob(filepath.Join(*outputDir, "*.metadata.json"))
+	if err != nil {
+		return err
+	}
+	if len(metadataFiles) == 0 {
+		return fmt.Errorf("no results found in %s", *outputDir)
+	}
+
+	// Remote lookups are shared by every document generated from the same repo
+	remoteHeads := make(map[string]string)
+	stale := 0
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "STATUS\tDOCUMENT\tSOURCE")
+	for _, metadataFile := range metadataFiles {
+		name := strings.TrimSuffix(filepath.Base(metadataFile), ".metadata.json")
+		status, source := checkStaleness(metadataFile, remoteHeads)
+		if status == "stale" {
+			stale++
+		}
+		fmt.Fprintf(out, "%s\t%s\t%s\n", status, name, source)
+	}
+	out.Flush()
+
+	if stale > 0 {
+		return fmt.Errorf("%d of %d documents are stale", stale, len(metadataFiles))
+	}
+	return nil
+}
+
+// checkStaleness compares one result's recorded fingerprint with its source.
+// Documents cloned from GitHub are compared by commit with the head of the
+// branch or tag they were generated from, local directories by content
+// fingerprint. The status is current, stale, unknown or an error.
+func checkStaleness(metadataFile string, remoteHeads map[string]string) (status, source string) {
+	data, err := os.ReadFile(metadataFile)
+	if err != nil {
+		return "error: " + err.Error(), ""
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return "error: invalid metadata", ""
+	}
+
+	switch {
+	case metadata.GitHubURL != "" && metadata.Commit != "":
+		source = metadata.GitHubURL
+		if metadata.Ref != "" {
+			source += "@" + metadata.Ref
+		}
+		// A document of a pinned commit stays current
+		if isCommitID(metadata.Ref) {
+			return "current", source
+		}
+		head, ok := remoteHeads[source]
+		if !ok {
+			if head, err = remoteHeadCommit(metadata.GitHubURL, metadata.Ref); err != nil {
+				return "error: " + err.Error(), source
+			}
+			remoteHeads[source] = head
+		}
+		if head != metadata.Commit {
+			return "stale", source
+		}
+		return "current", source
+
+	case metadata.Directory != "" && metadata.Fingerprint != "":
+		if _, err := os.Stat(metadata.Directory); err != nil {
+			return "error: directory not found", metadata.Directory
+		}
+		fingerprint, err := repoFingerprint(metadata.Directory)
+		if err != nil {
+			return "error: " + err.Error(), metadata.Directory
+		}
+		if fingerprint != metadata.Fingerprint {
+			return "stale", metadata.Directory
+		}
+		return "current", metadata.Directory
+	}
+
+	// Generated before fingerprints were recorded
+	source = metadata.GitHubURL
+	if source == "" {
+		source = metadata.Directory
+	}
+	return "unknown", source
+}
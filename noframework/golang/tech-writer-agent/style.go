@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Built-in style guides, condensed to the rules that matter for generated docs
+const (
+	GOOGLE_STYLE_GUIDE = `Google developer documentation style:
+- Use second person ("you") and active voice; write in present tense.
+- Use sentence case for headings.
+- Be conversational and friendly without being frivolous; avoid jargon where a plain word works.
+- Put conditions before instructions ("To build the project, run ...").
+- Use numbered lists for sequences and bulleted lists for everything else; make list items parallel.
+- Format code, file names, commands and identifiers as code.
+- Avoid "please", "simply", "just", "easy" and Latin abbreviations such as "e.g." and "i.e.".
+- Spell out acronyms on first use.`
+
+	MICROSOFT_STYLE_GUIDE = `Microsoft Writing Style Guide:
+- Be warm, relaxed, crisp and clear; use contractions.
+- Address the reader as "you"; use active voice and present tense.
+- Use sentence-style capitalization for headings and titles.
+- Get to the point fast: lead with what's most important and keep sentences short.
+- Use bulleted lists for unordered items and numbered lists for procedures.
+- Format code elements, file names and commands as code.
+- Avoid "please", unnecessary adverbs and words such as "simply" or "easy".
+- Use bias-free, inclusive language.`
+
+	STYLE_REWRITE_PROMPT = `Rewrite the following technical document so that it follows the style guide below.
+Rules:
+- Change only wording, tone, capitalization and formatting. Do not add, remove or alter technical facts, file names or claims.
+- Keep all code blocks, inline code, links and Mermaid diagrams exactly as they are.
+- Keep the heading structure and the order of sections.
+Return only the rewritten Markdown document.
+
+Style guide:
+%s
+
+Document:
+%s`
+)
+
+var builtinStyleGuides = map[string]string{
+	"google":    GOOGLE_STYLE_GUIDE,
+	"microsoft": MICROSOFT_STYLE_GUIDE,
+}
+
+// loadStyleGuide returns a built-in style guide by name, or reads a custom
+// guide from the given file path
+func loadStyleGuide(nameOrPath string) (string, error) {
+	if guide, ok := builtinStyleGuides[strings.ToLower(nameOrPath)]; ok {
+		return guide, nil
+	}
+	content, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		return "", fmt.Errorf("style guide %q is neither built in (google, microsoft) nor a readable file: %w", nameOrPath, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// applyStyleGuide asks llmClient to rewrite document according to guide
+func applyStyleGuide(document, guide string, llmClient LLMClient) (string, error) {
+	styled, err := llmClient.Complete(fmt.Sprintf(STYLE_REWRITE_PROMPT, guide, document), "You are a meticulous technical editor.", 0.0)
+	if err != nil {
+		return "", fmt.Errorf("style rewrite failed: %w", err)
+	}
+	styled = strings.TrimSpace(styled)
+	if styled == "" {
+		return "", fmt.Errorf("style rewrite returned an empty document")
+	}
+	return styled, nil
+}
+
+// beforeStylePath returns where the pre-style version of outputFile is kept
+// for review, e.g. report.md -> report.before-style.md
+func beforeStylePath(outputFile string) string {
+	ext := filepath.Ext(outputFile)
+	return strings.TrimSuffix(outputFile, ext) + ".before-style" + ext
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/doc"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Limits of extract_symbols, which keep its observation small
+const (
+	SYMBOLS_MAX_PACKAGES = 50
+	SYMBOLS_DOC_CHARS    = 300
+	SYMBOLS_DECL_CHARS   = 600
+)
+
+// GoSymbol is a declaration reported by extract_symbols
+type GoSymbol struct {
+	Name         string     `json:"name"`
+	Signature    string     `json:"signature"` // the declaration without function bodies or doc comments
+	Doc          string     `json:"doc,omitempty"`
+	Position     string     `json:"position"` // file:line
+	Methods      []GoSymbol `json:"methods,omitempty"`
+	Constructors []GoSymbol `json:"constructors,omitempty"` // functions returning the type
+}
+
+// GoPackage summarises the API of one Go package
+type GoPackage struct {
+	Name      string     `json:"name"`
+	Dir       string     `json:"dir"`
+	Doc       string     `json:"doc,omitempty"` // the package synopsis
+	Files     int        `json:"files"`
+	Constants []GoSymbol `json:"constants,omitempty"`
+	Variables []GoSymbol `json:"variables,omitempty"`
+	Types     []GoSymbol `json:"types,omitempty"`
+	Functions []GoSymbol `json:"functions,omitempty"`
+}
+
+// SymbolsResult represents the packages found by extract_symbols
+type SymbolsResult struct {
+	Packages  []GoPackage `json:"packages"`
+	Errors    []string    `json:"errors,omitempty"`    // files that failed to parse
+	Truncated bool        `json:"truncated,omitempty"` // more than SYMBOLS_MAX_PACKAGES packages
+}
+
+// extractSymbols implements the extract_symbols tool: it parses Go files
+// and returns their packages' declarations and doc comments, a compact
+// alternative to reading the source for an API overview
+func extractSymbols(args map[string]interface{}) (interface{}, error) {
+	path, ok := args["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("path parameter is required")
+	}
+	recursive, _ := args["recursive"].(bool)
+	includeTests, _ := args["include_tests"].(bool)
+	exportedOnly := true
+	if val, ok := args["exported_only"].(bool); ok {
+		exportedOnly = val
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Path not found: %s", path)}, nil
+	}
+	var files []string
+	if !info.IsDir() {
+		files = []string{path}
+	} else {
+		opts := DefaultWalkOptions()
+		opts.Pattern = "*.go"
+		opts.IncludeSubdirs = recursive
+		if files, err = listFiles(path, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	// Group the files by directory and package (a directory may hold an
+	// external test package next to the package itself)
+	fset := token.NewFileSet()
+	type packageKey struct{ dir, name string }
+	parsed := make(map[packageKey][]*ast.File)
+	var keys []packageKey
+	result := SymbolsResult{Packages: []GoPackage{}}
+	for _, file := range files {
+		if !strings.HasSuffix(file, ".go") || (!includeTests && strings.HasSuffix(file, "_test.go")) {
+			continue
+		}
+		astFile, err := parser.ParseFile(fset, file, nil, parser.ParseComments)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		key := packageKey{filepath.Dir(file), astFile.Name.Name}
+		if _, ok := parsed[key]; !ok {
+			keys = append(keys, key)
+		}
+		parsed[key] = append(parsed[key], astFile)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].dir != keys[j].dir {
+			return keys[i].dir < keys[j].dir
+		}
+		return keys[i].name < keys[j].name
+	})
+	if len(keys) > SYMBOLS_MAX_PACKAGES {
+		keys = keys[:SYMBOLS_MAX_PACKAGES]
+		result.Truncated = true
+	}
+
+	var mode doc.Mode
+	if !exportedOnly {
+		mode = doc.AllDecls | doc.AllMethods
+	}
+	for _, key := range keys {
+		pkg, err := doc.NewFromFiles(fset, parsed[key], key.dir, mode)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", key.dir, err))
+			continue
+		}
+		result.Packages = append(result.Packages, describePackage(fset, pkg, key.dir, len(parsed[key])))
+	}
+	return result, nil
+}
+
+// describePackage converts the documentation go/doc extracted for a package
+func describePackage(fset *token.FileSet, pkg *doc.Package, dir string, files int) GoPackage {
+	described := GoPackage{Name: pkg.Name, Dir: dir, Doc: pkg.Synopsis(pkg.Doc), Files: files}
+	symbol := func(name string, node ast.Node, docText string) GoSymbol {
+		position := fset.Position(node.Pos())
+		return GoSymbol{
+			Name:      name,
+			Signature: truncateRunes(printDecl(fset, node), SYMBOLS_DECL_CHARS),
+			Doc:       truncateRunes(strings.TrimSpace(docText), SYMBOLS_DOC_CHARS),
+			Position:  fmt.Sprintf("%s:%d", filepath.Base(position.Filename), position.Line),
+		}
+	}
+	values := func(values []*doc.Value) []GoSymbol {
+		var symbols []GoSymbol
+		for _, value := range values {
+			symbols = append(symbols, symbol(strings.Join(value.Names, ", "), value.Decl, value.Doc))
+		}
+		return symbols
+	}
+	funcs := func(funcs []*doc.Func) []GoSymbol {
+		var symbols []GoSymbol
+		for _, fn := range funcs {
+			symbols = append(symbols, symbol(fn.Name, fn.Decl, fn.Doc))
+		}
+		return symbols
+	}
+
+	described.Constants = values(pkg.Consts)
+	described.Variables = values(pkg.Vars)
+	described.Functions = funcs(pkg.Funcs)
+	for _, t := range pkg.Types {
+		typeSymbol := symbol(t.Name, t.Decl, t.Doc)
+		typeSymbol.Methods = funcs(t.Methods)
+		typeSymbol.Constructors = funcs(t.Funcs)
+		described.Types = append(described.Types, typeSymbol)
+		// Grouped constants and variables of the type, e.g. enum values
+		described.Constants = append(described.Constants, values(t.Consts)...)
+		described.Variables = append(described.Variables, values(t.Vars)...)
+	}
+	return described
+}
+
+// printDecl renders a declaration as source without function bodies or doc
+// comments
+func printDecl(fset *token.FileSet, node ast.Node) string {
+	if fn, ok := node.(*ast.FuncDecl); ok {
+		withoutBody := *fn
+		withoutBody.Body = nil
+		withoutBody.Doc = nil
+		node = &withoutBody
+	}
+	if decl, ok := node.(*ast.GenDecl); ok {
+		withoutDoc := *decl
+		withoutDoc.Doc = nil
+		node = &withoutDoc
+	}
+	var b bytes.Buffer
+	config := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := config.Fprint(&b, fset, node); err != nil {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Observations are split into chunks of roughly this many characters
+	// before embedding
+	SYNTHESIS_CHUNK_CHARS = 2000
+	// Number of chunks retrieved as evidence for each section
+	SYNTHESIS_TOP_K = 6
+	// Maximum inputs per embeddings request
+	EMBEDDING_BATCH_SIZE = 64
+)
+
+const SECTION_REWRITE_PROMPT = `You are revising one section of a technical document about a codebase.
+Rewrite the section below so that it is accurate, specific and complete, using the evidence gathered from the codebase.
+- Keep the section heading exactly as it is.
+- Prefer facts from the evidence over the draft where they disagree.
+- Cite file names where relevant.
+- Do not add content that belongs to other sections.
+Return only the revised section in Markdown.
+
+Document outline:
+%s
+
+Section draft:
+%s
+
+Evidence from the codebase:
+%s`
+
+// evidenceChunk is a piece of a tool observation with its embedding
+type evidenceChunk struct {
+	label  string
+	text   string
+	vector []float64
+}
+
+// synthesizeWithEmbeddings revises each level-2 section of draft using the
+// observations most relevant to it, retrieved by embedding similarity, rather
+// than whatever survived in the agent's context window. Sections are
+// rewritten independently; if a rewrite fails the draft section is kept.
+func synthesizeWithEmbeddings(draft string, observations []Observation, llmClient LLMClient, embedder Embedder, systemPrompt string, events EventSink) (string, error) {
+	chunks := chunkObservations(observations)
+	if len(chunks) == 0 {
+		return draft, nil
+	}
+
+	lines := strings.Split(draft, "\n")
+	sections := splitSections(lines)
+	var headings []string
+	var sectionTexts []string
+	for _, section := range sections {
+		if section.heading >= 0 {
+			headings = append(headings, lines[section.heading])
+			sectionTexts = append(sectionTexts, strings.Join(lines[section.start:section.end], "\n"))
+		}
+	}
+	if len(sectionTexts) == 0 {
+		return draft, nil
+	}
+
+	log.Printf("Embedding %d observation chunks for %d sections", len(chunks), len(sectionTexts))
+	texts := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		texts = append(texts, chunk.text)
+	}
+	vectors, err := embedBatched(embedder, texts)
+	if err != nil {
+		return "", fmt.Errorf("error embedding observations: %w", err)
+	}
+	for i := range chunks {
+		chunks[i].vector = vectors[i]
+	}
+	sectionVectors, err := embedBatched(embedder, sectionTexts)
+	if err != nil {
+		return "", fmt.Errorf("error embedding sections: %w", err)
+	}
+
+	outline := strings.Join(headings, "\n")
+	var out []string
+	sectionIndex := 0
+	for _, section := range sections {
+		original := strings.Join(lines[section.start:section.end], "\n")
+		if section.heading < 0 {
+			out = append(out, original)
+			continue
+		}
+
+		evidence := topChunks(chunks, sectionVectors[sectionIndex], SYNTHESIS_TOP_K)
+		sectionIndex++
+		var evidenceText strings.Builder
+		for _, chunk := range evidence {
+			fmt.Fprintf(&evidenceText, "--- %s ---\n%s\n\n", chunk.label, chunk.text)
+		}
+
+		prompt := fmt.Sprintf(SECTION_REWRITE_PROMPT, outline, original, evidenceText.String())
+		started := time.Now()
+		revised, err := llmClient.Complete(prompt, systemPrompt, 0.0)
+		events.OnLLMCall(LLMCallEvent{
+			Response: revised,
+			Err:      err,
+			Duration: time.Since(started),
+		})
+		if err != nil || strings.TrimSpace(revised) == "" {
+			log.Printf("Keeping draft of %q: rewrite failed: %v", strings.TrimSpace(lines[section.heading]), err)
+			out = append(out, original)
+			continue
+		}
+		out = append(out, strings.TrimSpace(revised)+"\n")
+	}
+
+	return strings.Join(out, "\n"), nil
+}
+
+// chunkObservations splits tool observations into labelled chunks
+func chunkObservations(observations []Observation) []evidenceChunk {
+	var chunks []evidenceChunk
+	for _, observation := range observations {
+		content := observation.Content
+		// For read_file results embed the file text rather than the JSON wrapper
+		var file FileReadResult
+		if json.Unmarshal([]byte(content), &file) == nil && file.Content != "" {
+			content = file.Content
+		}
+
+		argsJSON, _ := json.Marshal(observation.Args)
+		label := fmt.Sprintf("%s %s", observation.Tool, argsJSON)
+		for part, text := range splitChunks(content, SYNTHESIS_CHUNK_CHARS) {
+			chunks = append(chunks, evidenceChunk{
+				label: fmt.Sprintf("%s (part %d)", label, part+1),
+				text:  text,
+			})
+		}
+	}
+	return chunks
+}
+
+// splitChunks splits text into pieces of at most size bytes, preferring line
+// breaks. A line longer than size is cut at a rune boundary, so that no piece
+// holds half of a UTF-8 character.
+func splitChunks(text string, size int) []string {
+	var chunks []string
+	for len(text) > size {
+		cut := strings.LastIndex(text[:size], "\n")
+		if cut <= 0 {
+			cut = size
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+			if cut == 0 { // size is smaller than the first rune
+				_, cut = utf8.DecodeRuneInString(text)
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	if strings.TrimSpace(text) != "" {
+		chunks = append(chunks, text)
+	}
+	return chunks
+}
+
+// embedBatched embeds texts in batches the provider will accept
+func embedBatched(embedder Embedder, texts []string) ([][]float64, error) {
+	var vectors [][]float64
+	for start := 0; start < len(texts); start += EMBEDDING_BATCH_SIZE {
+		end := start + EMBEDDING_BATCH_SIZE
+		if end > len(texts) {
+			end = len(texts)
+		}
+		batch, err := embedder.Embed(texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		vectors = append(vectors, batch...)
+	}
+	return vectors, nil
+}
+
+// topChunks returns the k chunks most similar to query, most similar first
+func topChunks(chunks []evidenceChunk, query []float64, k int) []evidenceChunk {
+	type scoredChunk struct {
+		chunk evidenceChunk
+		score float64
+	}
+	ranked := make([]scoredChunk, len(chunks))
+	for i, chunk := range chunks {
+		ranked[i] = scoredChunk{chunk, cosineSimilarity(chunk.vector, query)}
+	}
+	sort.SliceStable(ranked, func(a, b int) bool { return ranked[a].score > ranked[b].score })
+
+	if k > len(ranked) {
+		k = len(ranked)
+	}
+	top := make([]evidenceChunk, 0, k)
+	for _, r := range ranked[:k] {
+		top = append(top, r.chunk)
+	}
+	return top
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitChunks(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		size int
+		want []string
+	}{
+		{"short", "one line", 20, []string{"one line"}},
+		{"line breaks", "first line\nsecond line\nthird", 14, []string{"first line", "second line", "third"}},
+		{"long line", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		// "é" and "世" are two and three bytes: the cuts move back to their start
+		{"runes", "aéééé", 4, []string{"aé", "éé", "é"}},
+		{"wide runes", "世界世界", 5, []string{"世", "界", "世", "界"}},
+		{"rune wider than size", "世界", 2, []string{"世", "界"}},
+		{"blank rest", "abcd\n\n  ", 4, []string{"abcd"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitChunks(tt.text, tt.size)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitChunks(%q, %d) = %q, want %q", tt.text, tt.size, got, tt.want)
+			}
+			for _, chunk := range got {
+				if !utf8.ValidString(chunk) {
+					t.Errorf("splitChunks(%q, %d) split a rune: %q", tt.text, tt.size, chunk)
+				}
+			}
+		})
+	}
+
+	// Only the line breaks cut at are dropped, and no chunk is over size
+	text := strings.Repeat("naïve café 日本語 ", 20) + "\n" + strings.Repeat("ü", 100)
+	chunks := splitChunks(text, 64)
+	if got, want := strings.Join(chunks, ""), strings.ReplaceAll(text, "\n", ""); got != want {
+		t.Errorf("splitChunks() = %q, want the pieces of %q", got, want)
+	}
+	for _, chunk := range chunks {
+		if len(chunk) > 64 || !utf8.ValidString(chunk) {
+			t.Errorf("splitChunks() chunk of %d bytes: %q", len(chunk), chunk)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// Progress of a tarball download is shown every this many bytes
+	TARBALL_PROGRESS_BYTES = 16 << 20
+	// Suffix of the file, next to a tree extracted from a tarball, holding the
+	// commit it was made from; the tree itself has no .git to ask
+	TARBALL_COMMIT_SUFFIX = ".tarball-commit"
+)
+
+// codeloadBaseURL serves GitHub's tarballs of a repository at a ref
+var codeloadBaseURL = "https://codeload.github.com"
+
+// gitAvailable reports whether git is installed
+func gitAvailable() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+}
+
+// githubRepoName returns owner/repo for a GitHub repository URL, or false
+// for repositories elsewhere, which have no tarballs to fall back on
+func githubRepoName(repoURL string) (string, bool) {
+	name := getRepoNameFromURL(repoURL)
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" || strings.Contains(name, ":") || strings.HasPrefix(repoURL, "file://") {
+		return "", false
+	}
+	return name, true
+}
+
+// downloadTarball extracts GitHub's tarball of repoURL at ref ("" is the
+// default branch) into repoPath, for when git is missing or can't reach the
+// repository. The tree has no history, and the commit it was made from is
+// kept next to it for tarballCommit.
+func downloadTarball(session *cloneSession, repoURL, repoPath, ref string) error {
+	name, ok := githubRepoName(repoURL)
+	if !ok {
+		return fmt.Errorf("%s is not a GitHub repository", repoURL)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	segments := strings.Split(ref, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	tarballURL := codeloadBaseURL + "/" + name + "/tar.gz/" + strings.Join(segments, "/")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(session.ctx, http.MethodGet, tarballURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if session.ctx.Err() != nil {
+			return fmt.Errorf("tarball download timed out after %s (--clone-timeout)", session.timeout)
+		}
+		return fmt.Errorf("error downloading %s: %w", tarballURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading %s: %s", tarballURL, resp.Status)
+	}
+
+	body := &tarballProgress{reader: resp.Body, out: session.progress, label: session.label}
+	commit, err := extractTarball(body, repoPath)
+	if err != nil {
+		if session.ctx.Err() != nil {
+			return fmt.Errorf("tarball download timed out after %s (--clone-timeout)", session.timeout)
+		}
+		return fmt.Errorf("error extracting %s: %w", tarballURL, err)
+	}
+	if body.out != nil {
+		fmt.Fprintf(body.out, "%s: received tarball, %s\n", body.label, formatBytes(int(body.read)))
+	}
+	if err := os.WriteFile(repoPath+TARBALL_COMMIT_SUFFIX, []byte(commit+"\n"), 0644); err != nil {
+		return fmt.Errorf("error recording the tarball's commit: %w", err)
+	}
+	return nil
+}
+
+// tarballProgress shows how much of a tarball has been received
+type tarballProgress struct {
+	reader io.Reader
+	out    io.Writer // nil shows nothing (--quiet)
+	label  string
+	read   int64
+	shown  int64
+}
+
+func (p *tarballProgress) Read(data []byte) (int, error) {
+	n, err := p.reader.Read(data)
+	p.read += int64(n)
+	if p.out != nil && p.read-p.shown >= TARBALL_PROGRESS_BYTES {
+		fmt.Fprintf(p.out, "%s: receiving tarball, %s\n", p.label, formatBytes(int(p.read)))
+		p.shown = p.read
+	}
+	return n, err
+}
+
+// extractTarball writes the files of a GitHub tarball to dest, without the
+// owner-repo-commit directory they are in, and returns the commit git archive
+// records in its global header. Entries that would land outside dest are
+// skipped, as are links pointing outside it. Nothing is written through a
+// link, and links that resolve outside dest on disk, say through a chain of
+// links, are removed at the end.
+func extractTarball(r io.Reader, dest string) (string, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	commit := ""
+	var links []string
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader {
+			commit = header.PAXRecords["comment"]
+			continue
+		}
+		_, rel, _ := strings.Cut(strings.TrimPrefix(header.Name, "/"), "/")
+		rel = path.Clean(rel)
+		if rel == "." || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		target := filepath.Join(dest, filepath.FromSlash(rel))
+		if linkedParent(dest, rel) {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return "", err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return "", err
+			}
+			// Replace a link rather than write to where it points
+			if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+				if err := os.Remove(target); err != nil {
+					return "", err
+				}
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm()|0600)
+			if err != nil {
+				return "", err
+			}
+			_, err = io.Copy(file, reader)
+			file.Close()
+			if err != nil {
+				return "", err
+			}
+		case tar.TypeSymlink:
+			linked := path.Join(path.Dir(rel), header.Linkname)
+			if path.IsAbs(header.Linkname) || linked == ".." || strings.HasPrefix(linked, "../") {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return "", err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return "", err
+			}
+			links = append(links, target)
+		}
+	}
+	for _, link := range links {
+		if !resolvesInside(dest, link) {
+			if err := os.Remove(link); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+	}
+	return commit, nil
+}
+
+// linkedParent reports whether a directory of rel below dest is a link,
+// through which an entry could be written outside dest
+func linkedParent(dest, rel string) bool {
+	dir := dest
+	parts := strings.Split(rel, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvesInside reports whether link resolves, following every link on the
+// way, to an existing path inside dest
+func resolvesInside(dest, link string) bool {
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		return false
+	}
+	root, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(root, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// isTarballTree reports whether repoPath was extracted from a tarball rather
+// than cloned
+func isTarballTree(repoPath string) bool {
+	_, err := os.Stat(repoPath + TARBALL_COMMIT_SUFFIX)
+	return err == nil
+}
+
+// tarballCommit returns the commit that the tree directory is in was
+// extracted from, or "" if it isn't in one
+func tarballCommit(directory string) string {
+	dir, err := filepath.Abs(directory)
+	if err != nil {
+		return ""
+	}
+	for {
+		if data, err := os.ReadFile(dir + TARBALL_COMMIT_SUFFIX); err == nil {
+			return strings.TrimSpace(string(data))
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
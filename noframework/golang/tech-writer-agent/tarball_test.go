@@ -0,0 +1,97 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry is an entry of a test tarball, a file, directory or link
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string // the content of a file, or the target of a link
+}
+
+// buildTarball returns a gzipped tarball of entries under GitHub's
+// owner-repo-commit directory
+func buildTarball(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": "abc123"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		header := &tar.Header{Name: "owner-repo-abc123/" + entry.name, Typeflag: entry.typeflag, Mode: 0644}
+		switch entry.typeflag {
+		case tar.TypeReg:
+			header.Size = int64(len(entry.body))
+		case tar.TypeSymlink:
+			header.Linkname = entry.body
+		case tar.TypeDir:
+			header.Mode = 0755
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if entry.typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractTarball(t *testing.T) {
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "repo")
+	tarball := buildTarball(t, []tarEntry{
+		{"b/", tar.TypeDir, ""},
+		{"src/main.go", tar.TypeReg, "package main\n"},
+		{"link.go", tar.TypeSymlink, "src/main.go"},
+		// Each link stays inside lexically, but together they lead out of dest
+		{"b/c", tar.TypeSymlink, ".."},
+		{"e", tar.TypeSymlink, "b/c/.."},
+		{"e/evil", tar.TypeReg, "escaped"},
+		{"f", tar.TypeSymlink, "b/c/../evil-file"},
+		{"f", tar.TypeReg, "replaces the link"},
+		{"../outside", tar.TypeReg, "escaped"},
+		{"g", tar.TypeSymlink, "/etc/passwd"},
+	})
+	commit, err := extractTarball(bytes.NewReader(tarball), dest)
+	if err != nil {
+		t.Fatalf("extractTarball() = %v", err)
+	}
+	if commit != "abc123" {
+		t.Errorf("extractTarball() commit = %q", commit)
+	}
+
+	for _, escaped := range []string{"evil", "evil-file", "outside"} {
+		if _, err := os.Lstat(filepath.Join(parent, escaped)); err == nil {
+			t.Errorf("extractTarball() wrote %s outside the destination", escaped)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dest, "link.go")); err != nil || string(data) != "package main\n" {
+		t.Errorf("link inside the tree = %q, %v", data, err)
+	}
+	if info, err := os.Lstat(filepath.Join(dest, "f")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("file over a link = %v, %v, want a regular file", info, err)
+	}
+	for _, removed := range []string{"e", "g"} {
+		if _, err := os.Lstat(filepath.Join(dest, removed)); err == nil {
+			t.Errorf("extractTarball() kept link %s, which leads outside the destination", removed)
+		}
+	}
+}
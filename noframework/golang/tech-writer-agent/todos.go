@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TODOS_DEFAULT_MAX_RESULTS is find_todos' default limit on matching lines;
+// the maximum is search_in_files' SEARCH_MAX_RESULTS
+const TODOS_DEFAULT_MAX_RESULTS = 200
+
+// TODO_DEFAULT_TAGS are the markers find_todos looks for unless told otherwise
+var TODO_DEFAULT_TAGS = []string{"TODO", "FIXME", "HACK", "XXX"}
+
+// todoTagPattern restricts tags to identifier characters, so they can be
+// put into the regular expression as they are
+var todoTagPattern = regexp.MustCompile(`^\w+$`)
+
+// TodoItem is one line carrying a marker such as TODO
+type TodoItem struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Tag  string `json:"tag"`
+	Text string `json:"text"`
+}
+
+// TodosResult represents the markers found in a repository
+type TodosResult struct {
+	Items     []TodoItem     `json:"items"`
+	Tags      map[string]int `json:"tags"` // lines per tag among the items returned
+	FileCount int            `json:"file_count"`
+	Count     int            `json:"count"`               // matching lines
+	Truncated bool           `json:"truncated,omitempty"` // more lines matched than max_results
+}
+
+// findTodos implements the find_todos tool: the TODO, FIXME, HACK and XXX
+// comments across the repository, for the open issues and technical debt a
+// document often covers. Tags are matched as whole, upper-case words, so
+// "todo" in prose or an identifier like TODO_LIST is not reported.
+func findTodos(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	tags := TODO_DEFAULT_TAGS
+	if val, ok := args["tags"].(string); ok && strings.TrimSpace(val) != "" {
+		tags = nil
+		for _, tag := range strings.Split(val, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "" {
+				continue
+			}
+			if !todoTagPattern.MatchString(tag) {
+				return nil, fmt.Errorf("invalid tag %q: tags may only contain letters, digits and underscores", tag)
+			}
+			tags = append(tags, tag)
+		}
+	}
+	opts := DefaultWalkOptions()
+	if val, ok := args["file_pattern"].(string); ok && val != "" {
+		opts.Pattern = val
+	}
+	maxResults := TODOS_DEFAULT_MAX_RESULTS
+	if val, ok := intArg(args, "max_results"); ok && val > 0 {
+		maxResults = min(val, SEARCH_MAX_RESULTS)
+	}
+
+	re := regexp.MustCompile(`\b(` + strings.Join(tags, "|") + `)\b`)
+	found, err := searchFiles(directory, re, opts, maxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	result := TodosResult{Items: []TodoItem{}, Tags: map[string]int{}, Count: found.Count, Truncated: found.Truncated}
+	files := make(map[string]bool)
+	for _, match := range found.Matches {
+		// The tag may lie beyond the text kept of a very long line
+		tag := "?"
+		if groups := re.FindStringSubmatch(match.Text); groups != nil {
+			tag = groups[1]
+		}
+		result.Items = append(result.Items, TodoItem{File: match.File, Line: match.Line, Tag: tag, Text: strings.TrimSpace(match.Text)})
+		result.Tags[tag]++
+		files[match.File] = true
+	}
+	result.FileCount = len(files)
+	return result, nil
+}
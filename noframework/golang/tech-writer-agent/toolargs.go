@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Argument types of the tools. Other types, which plugins may declare, are
+// passed through unchecked.
+const (
+	ArgString  = "string"
+	ArgInteger = "integer"
+	ArgNumber  = "number"
+	ArgBool    = "bool"
+)
+
+// validateToolArgs checks the arguments the model gave a tool against the
+// tool's declared Arguments and returns them coerced to the declared types,
+// the way the tools read them: integers and numbers as float64 (as JSON
+// decodes them), bools as bool and strings as string. Lossless conversions
+// are made, such as "10" to 10 for an integer or "true" to true for a bool;
+// a null counts as leaving the argument out.
+//
+// Every problem is reported in one error, worded for the model: unknown
+// arguments (with the ones the tool accepts), missing required ones and
+// values that don't fit their type.
+func validateToolArgs(tool Tool, args map[string]interface{}) (map[string]interface{}, error) {
+	declared := make(map[string]ToolArgument, len(tool.Arguments))
+	for _, arg := range tool.Arguments {
+		declared[arg.Name] = arg
+	}
+
+	var problems []string
+	coerced := make(map[string]interface{}, len(args))
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := args[name]
+		arg, ok := declared[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown argument %q", name))
+			continue
+		}
+		if value == nil {
+			continue
+		}
+		value, err := coerceToolArg(arg.Type, value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s", name, err))
+			continue
+		}
+		coerced[name] = value
+	}
+	for _, arg := range tool.Arguments {
+		if _, given := coerced[arg.Name]; arg.Required && !given {
+			problems = append(problems, fmt.Sprintf("missing required argument %s (%s)", arg.Name, arg.Type))
+		}
+	}
+
+	if len(problems) == 0 {
+		return coerced, nil
+	}
+	var accepted []string
+	for _, arg := range tool.Arguments {
+		accepted = append(accepted, fmt.Sprintf("%s (%s)", arg.Name, arg.Type))
+	}
+	if len(accepted) == 0 {
+		accepted = []string{"none"}
+	}
+	return nil, fmt.Errorf("invalid arguments for %s: %s; the tool's arguments are: %s", tool.Name, strings.Join(problems, "; "), strings.Join(accepted, ", "))
+}
+
+// coerceToolArg converts value to the argument type kind, or explains why
+// it can't
+func coerceToolArg(kind string, value interface{}) (interface{}, error) {
+	switch kind {
+	case ArgString:
+		switch value := value.(type) {
+		case string:
+			return value, nil
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(value), nil
+		}
+	case ArgInteger, ArgNumber:
+		number, ok := value.(float64)
+		if text, isText := value.(string); isText {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			number, ok = parsed, err == nil
+		}
+		if !ok {
+			break
+		}
+		if kind == ArgInteger && (number != math.Trunc(number) || math.IsInf(number, 0)) {
+			return nil, fmt.Errorf("must be a whole number, got %v", value)
+		}
+		return number, nil
+	case ArgBool:
+		switch value := value.(type) {
+		case bool:
+			return value, nil
+		case string:
+			if parsed, err := strconv.ParseBool(strings.TrimSpace(value)); err == nil {
+				return parsed, nil
+			}
+		}
+	default:
+		return value, nil
+	}
+	return nil, fmt.Errorf("must be %s, got %s", describeArgType(kind), describeJSONValue(value))
+}
+
+// describeArgType names an argument type with its article
+func describeArgType(kind string) string {
+	switch kind {
+	case ArgInteger:
+		return "an integer"
+	case ArgBool:
+		return "a bool (true or false)"
+	}
+	return "a " + kind
+}
+
+// describeJSONValue names the JSON type of a decoded value, with the value
+// itself for scalars
+func describeJSONValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return fmt.Sprintf("the string %q", truncateRunes(value, 40))
+	case float64:
+		return fmt.Sprintf("the number %v", value)
+	case bool:
+		return fmt.Sprintf("%v", value)
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
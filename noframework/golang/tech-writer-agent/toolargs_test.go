@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateToolArgs(t *testing.T) {
+	tool := Tool{
+		Name: "example",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: ArgString, Required: true},
+			{Name: "limit", Type: ArgInteger},
+			{Name: "ratio", Type: ArgNumber},
+			{Name: "regex", Type: ArgBool},
+		},
+	}
+	tests := []struct {
+		args    map[string]interface{}
+		want    map[string]interface{}
+		wantErr []string // parts of the error message
+	}{
+		{
+			args: map[string]interface{}{"path": "a", "limit": 10.0, "regex": true},
+			want: map[string]interface{}{"path": "a", "limit": 10.0, "regex": true},
+		},
+		{
+			args: map[string]interface{}{"path": 7.0, "limit": "25", "ratio": " 0.5", "regex": "false"},
+			want: map[string]interface{}{"path": "7", "limit": 25.0, "ratio": 0.5, "regex": false},
+		},
+		{
+			args: map[string]interface{}{"path": "a", "limit": nil},
+			want: map[string]interface{}{"path": "a"},
+		},
+		{
+			args:    map[string]interface{}{"limit": 2.5, "regex": "maybe", "colour": "red"},
+			wantErr: []string{`unknown argument "colour"`, "limit must be a whole number, got 2.5", `regex must be a bool (true or false), got the string "maybe"`, "missing required argument path (string)"},
+		},
+		{
+			args:    map[string]interface{}{"path": []interface{}{"a"}},
+			wantErr: []string{"path must be a string, got an array"},
+		},
+	}
+	for _, tt := range tests {
+		got, err := validateToolArgs(tool, tt.args)
+		if tt.wantErr != nil {
+			if err == nil {
+				t.Errorf("validateToolArgs(%v) succeeded, want an error", tt.args)
+				continue
+			}
+			for _, part := range tt.wantErr {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("validateToolArgs(%v) error %q does not mention %q", tt.args, err, part)
+				}
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("validateToolArgs(%v) failed: %v", tt.args, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("validateToolArgs(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
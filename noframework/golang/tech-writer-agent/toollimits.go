@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Default limits of a tool call (--tool-timeout, --tool-max-output)
+const (
+	TOOL_DEFAULT_TIMEOUT          = 2 * time.Minute
+	TOOL_DEFAULT_MAX_OUTPUT_BYTES = 256 * 1024 // of the observation, after JSON encoding
+)
+
+// ToolLimits bounds a tool call: how long ExecuteTool waits for it and how
+// much of its result becomes the observation. 0 means the default; a
+// negative value means no limit.
+type ToolLimits struct {
+	Timeout        time.Duration
+	MaxOutputBytes int
+}
+
+// ToolLimitConfig sets a tool's limits in the --config file, e.g.
+// "tool_limits": {"read_file": {"timeout": "30s", "max_output_bytes": 131072}}
+type ToolLimitConfig struct {
+	Timeout        string `json:"timeout"`          // e.g. "30s"; "0s" for no limit
+	MaxOutputBytes *int   `json:"max_output_bytes"` // 0 for no limit
+}
+
+// limits converts the configured limits
+func (c ToolLimitConfig) limits() (ToolLimits, error) {
+	var limits ToolLimits
+	if c.Timeout != "" {
+		timeout, err := time.ParseDuration(c.Timeout)
+		if err != nil || timeout < 0 {
+			return ToolLimits{}, fmt.Errorf("invalid timeout %q", c.Timeout)
+		}
+		limits.Timeout = timeout
+		if timeout == 0 {
+			limits.Timeout = -1
+		}
+	}
+	if c.MaxOutputBytes != nil {
+		if *c.MaxOutputBytes < 0 {
+			return ToolLimits{}, fmt.Errorf("max_output_bytes must not be negative")
+		}
+		limits.MaxOutputBytes = *c.MaxOutputBytes
+		if limits.MaxOutputBytes == 0 {
+			limits.MaxOutputBytes = -1
+		}
+	}
+	return limits, nil
+}
+
+// toolLimits holds the limits ExecuteTool enforces: the defaults for all
+// tools and the ones the --config file sets for particular tools
+var toolLimits = struct {
+	sync.RWMutex
+	defaults ToolLimits
+	perTool  map[string]ToolLimits
+}{defaults: ToolLimits{Timeout: TOOL_DEFAULT_TIMEOUT, MaxOutputBytes: TOOL_DEFAULT_MAX_OUTPUT_BYTES}}
+
+// setToolLimits sets the default limits and the per-tool ones
+func setToolLimits(defaults ToolLimits, perTool map[string]ToolLimits) {
+	toolLimits.Lock()
+	defer toolLimits.Unlock()
+	toolLimits.defaults = defaults
+	toolLimits.perTool = perTool
+}
+
+// limitsFor returns the limits of a call to tool. Limits set in the
+// configuration come first, then the tool's own, then the defaults.
+func limitsFor(tool Tool) ToolLimits {
+	toolLimits.RLock()
+	defer toolLimits.RUnlock()
+	limits := toolLimits.perTool[tool.Name]
+	if limits.Timeout == 0 {
+		limits.Timeout = tool.Limits.Timeout
+	}
+	if limits.Timeout == 0 {
+		limits.Timeout = toolLimits.defaults.Timeout
+	}
+	if limits.MaxOutputBytes == 0 {
+		limits.MaxOutputBytes = tool.Limits.MaxOutputBytes
+	}
+	if limits.MaxOutputBytes == 0 {
+		limits.MaxOutputBytes = toolLimits.defaults.MaxOutputBytes
+	}
+	return limits
+}
+
+// capToolOutput cuts an observation longer than maxBytes at a character
+// boundary and says how much was left out, so the model can ask for less
+func capToolOutput(output string, maxBytes int) string {
+	if maxBytes <= 0 || len(output) <= maxBytes {
+		return output
+	}
+	cut := maxBytes
+	for cut > 0 && !utf8.RuneStart(output[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s\n[... output truncated: %s of %s shown; ask for less, e.g. with a narrower pattern, max_results or a line range ...]", output[:cut], formatBytes(cut), formatBytes(len(output)))
+}
@@ -1,22 +1,36 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
-	
-	gitignore "github.com/denormal/go-gitignore"
+	"time"
 )
 
 // Tool represents a callable tool function
 type Tool struct {
 	Name        string
 	Description string
+	Arguments   []ToolArgument
 	Function    func(args map[string]interface{}) (interface{}, error)
+	Limits      ToolLimits // the tool's own limits, if the defaults don't suit it
+}
+
+// ToolArgument describes one argument of a tool for the model
+type ToolArgument struct {
+	Name        string
+	Type        string // ArgString, ArgBool, ArgInteger or ArgNumber; checked by validateToolArgs
+	Description string
+	Required    bool
+	Default     string // rendered verbatim, e.g. `"*"` or `true`
 }
 
 // ToolResult represents the result of a tool call
@@ -28,14 +42,21 @@ type ToolResult struct {
 
 // FileSearchResult represents the result of finding files
 type FileSearchResult struct {
-	Files []string `json:"files"`
-	Count int      `json:"count"`
+	Files []string      `json:"files"`
+	Count int           `json:"count"`
+	Links []SkippedLink `json:"skipped_links,omitempty"` // symbolic links not listed or followed
 }
 
-// FileReadResult represents the result of reading a file
+// FileReadResult represents the result of reading a file. Files larger than
+// READ_FILE_CHUNK_BYTES are returned a chunk at a time, with the fields below
+// Content describing where the chunk lies.
 type FileReadResult struct {
-	File    string `json:"file"`
-	Content string `json:"content"`
+	File       string `json:"file"`
+	Content    string `json:"content"`
+	Size       int64  `json:"size,omitempty"`        // bytes in the whole file
+	Offset     int64  `json:"offset,omitempty"`      // of the chunk
+	NextOffset int64  `json:"next_offset,omitempty"` // of the following chunk, if any
+	Note       string `json:"note,omitempty"`
 }
 
 // Available tools
@@ -43,13 +64,243 @@ var Tools = map[string]Tool{
 	"find_all_matching_files": {
 		Name:        "find_all_matching_files",
 		Description: "Find files matching a pattern while respecting .gitignore",
-		Function:    findAllMatchingFiles,
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Directory to search in"},
+			{Name: "pattern", Type: "string", Description: "File pattern to match (glob format). Without a slash it matches file names at any depth (\"*.ts\"); with a slash it matches the path relative to directory, where ** spans any number of directories (\"src/**/*.ts\")", Default: `"*"`},
+			{Name: "respect_gitignore", Type: "bool", Description: "Whether to respect .gitignore patterns (and .git/info/exclude and the global excludes file)", Default: "true"},
+			{Name: "include_hidden", Type: "bool", Description: "Whether to include hidden files", Default: "false"},
+			{Name: "include_subdirs", Type: "bool", Description: "Whether to include subdirectories", Default: "true"},
+			{Name: "follow_symlinks", Type: "bool", Description: "Whether to list linked files and walk linked directories; links that aren't followed are listed under skipped_links", Default: "false"},
+		},
+		Function: findAllMatchingFiles,
 	},
-	"read_file": {
-		Name:        "read_file",
-		Description: "Read the contents of a file",
-		Function:    readFile,
+	"read_file": newReadFileTool(0),
+	"read_file_lines": {
+		Name:        "read_file_lines",
+		Description: "Read part of a file: a range of lines, or with offset a range of bytes. Use it for large files, e.g. around a line found by search_in_files",
+		Arguments: []ToolArgument{
+			{Name: "file_path", Type: "string", Required: true, Description: "Path to the file to read"},
+			{Name: "start_line", Type: "integer", Description: "First line to read, counting from 1", Default: "1"},
+			{Name: "end_line", Type: "integer", Description: fmt.Sprintf("Last line to read (at most %d lines are returned)", READ_LINES_MAX), Default: fmt.Sprintf("start_line + %d", READ_LINES_DEFAULT-1)},
+			{Name: "offset", Type: "integer", Description: "Byte offset to read from instead of lines"},
+			{Name: "length", Type: "integer", Description: fmt.Sprintf("Bytes to read from offset (at most %d)", READ_BYTES_MAX), Default: fmt.Sprint(READ_BYTES_DEFAULT)},
+		},
+		Function: readFileLines,
+	},
+	"file_stat": {
+		Name:        "file_stat",
+		Description: "Get a file's size in bytes, modification time, line count and language without reading it, to decide whether and how to read it",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "Path to the file"},
+		},
+		Function: fileStat,
+	},
+	"list_archive": {
+		Name:        "list_archive",
+		Description: fmt.Sprintf("List the files inside a zip, jar or tar (optionally gzip or bzip2 compressed) archive with their sizes, without extracting it. At most %d files are listed", ARCHIVE_MAX_ENTRIES),
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "Path to the archive"},
+		},
+		Function: listArchive,
+	},
+	"read_archive_member": {
+		Name:        "read_archive_member",
+		Description: fmt.Sprintf("Read a text file inside a zip, jar or tar archive, as listed by list_archive. At most the first %s are returned", formatBytes(ARCHIVE_MAX_MEMBER_READ)),
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "Path to the archive"},
+			{Name: "member", Type: "string", Required: true, Description: "Name of the file inside the archive"},
+		},
+		Function: readArchiveMember,
+	},
+	"find_usages": {
+		Name:        "find_usages",
+		Description: "Find where an identifier (function, class, variable, config key, ...) appears, returning the matching lines grouped by file. Respects .gitignore and skips binary files. Use it to map which components use which",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Directory to search in"},
+			{Name: "identifier", Type: "string", Required: true, Description: "The identifier to find, taken literally"},
+			{Name: "whole_word", Type: "bool", Description: "Whether to skip matches inside longer identifiers (e.g. Parse in ParseFile)", Default: "true"},
+			{Name: "case_sensitive", Type: "bool", Description: "Whether case must match", Default: "true"},
+			{Name: "file_pattern", Type: "string", Description: "Only search files matching this glob, as in find_all_matching_files", Default: `"*"`},
+			{Name: "max_results", Type: "integer", Description: fmt.Sprintf("Maximum number of matching lines to return (at most %d)", SEARCH_MAX_RESULTS), Default: fmt.Sprint(USAGES_DEFAULT_MAX_RESULTS)},
+		},
+		Function: findUsages,
+	},
+	"find_todos": {
+		Name:        "find_todos",
+		Description: "Collect the TODO, FIXME, HACK and XXX comments across the repository with their file, line and text. Use it for a section on open issues and technical debt",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Directory to search in"},
+			{Name: "tags", Type: "string", Description: "Comma-separated markers to look for, matched as whole upper-case words", Default: `"TODO,FIXME,HACK,XXX"`},
+			{Name: "file_pattern", Type: "string", Description: "Only search files matching this glob, as in find_all_matching_files", Default: `"*"`},
+			{Name: "max_results", Type: "integer", Description: fmt.Sprintf("Maximum number of lines to return (at most %d)", SEARCH_MAX_RESULTS), Default: fmt.Sprint(TODOS_DEFAULT_MAX_RESULTS)},
+		},
+		Function: findTodos,
+	},
+	"measure_complexity": {
+		Name:        "measure_complexity",
+		Description: "Measure the cyclomatic complexity of each function in a source file or directory, returning the most complex functions and files with their line counts. Supports Go and the get_file_outline languages. Use it to ground statements about the most complex parts of the code",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "Source file or directory to measure"},
+			{Name: "pattern", Type: "string", Description: "For a directory, only measure files matching this glob, as in find_all_matching_files", Default: `"*"`},
+			{Name: "max_results", Type: "integer", Description: fmt.Sprintf("Maximum number of functions and of files to list (at most %d)", COMPLEXITY_MAX_RESULTS), Default: fmt.Sprint(COMPLEXITY_DEFAULT_MAX_RESULTS)},
+		},
+		Function: measureComplexity,
+	},
+	"extract_protobuf": {
+		Name:        "extract_protobuf",
+		Description: "Extract the services, RPCs (with streaming and HTTP mappings), messages with their fields, and enums from a .proto file or all .proto files under a directory, with their comments. Use it to document gRPC and protobuf APIs",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "A .proto file, or a directory to search for them"},
+		},
+		Function: extractProtobuf,
+	},
+	"summarize_openapi": {
+		Name:        "summarize_openapi",
+		Description: "Summarise OpenAPI 3 and Swagger 2 specs (YAML or JSON): the endpoints with their parameters, request bodies and responses, and the schemas with their properties, in a compact form. Use it instead of reading a large spec with read_file",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "A spec file, or a directory to search for specs"},
+			{Name: "tag", Type: "string", Description: "Only list the endpoints with this tag"},
+		},
+		Function: summarizeOpenAPI,
+	},
+	"read_coverage": {
+		Name:        "read_coverage",
+		Description: "Read the project's test coverage reports (Go cover profiles, LCOV, Cobertura or JaCoCo XML) and return the overall and per-package coverage, least covered first. Reports exist only where tests were run with coverage; use it for statements about test quality",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "Project directory, searched in the usual report locations (coverage.out, lcov.info, coverage/, coverage.xml, target/site/jacoco/, ...), or a report file"},
+		},
+		Function: readCoverage,
+	},
+	"detect_licenses": {
+		Name:        "detect_licenses",
+		Description: "Identify the project's license (SPDX identifier) from its LICENSE/COPYING files and package manifests, and the licenses of its installed dependencies (Go module cache or vendor directory, node_modules, Python .venv), listing copyleft and unidentified ones. Use it to answer licensing and compliance questions",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Root directory of the project"},
+		},
+		Function: detectLicenses,
 	},
+	"git_log": {
+		Name:        "git_log",
+		Description: "List recent commits of a git repository: hash, author, date, subject and the files each touched. Use it to describe recent activity and the areas under development",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Directory inside the repository"},
+			{Name: "count", Type: "integer", Description: fmt.Sprintf("Number of commits, newest first (at most %d)", GIT_LOG_MAX_COUNT), Default: fmt.Sprint(GIT_LOG_DEFAULT_COUNT)},
+			{Name: "path", Type: "string", Description: "Only commits touching this file or directory"},
+			{Name: "include_files", Type: "bool", Description: "Whether to list the files each commit touched", Default: "true"},
+		},
+		Function: gitLog,
+	},
+	"map_ownership": {
+		Name:        "map_ownership",
+		Description: "Map who owns what: for each directory, the owners the CODEOWNERS file assigns to its files (and how many files no rule covers) and the authors with the most commits touching it. Use it for ownership and contact sections",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Repository directory"},
+			{Name: "depth", Type: "integer", Description: fmt.Sprintf("Directory levels to break the repository down to (at most %d)", OWNERS_MAX_DEPTH), Default: fmt.Sprint(OWNERS_DEFAULT_DEPTH)},
+			{Name: "max_committers", Type: "integer", Description: fmt.Sprintf("Top committers listed per directory (at most %d)", OWNERS_MAX_COMMITTERS), Default: fmt.Sprint(OWNERS_DEFAULT_COMMITTERS)},
+			{Name: "since", Type: "string", Description: "Only count commits since this date, e.g. 2024-01-01 or \"1 year ago\""},
+		},
+		Function: mapOwnership,
+	},
+	"git_diff": {
+		Name:        "git_diff",
+		Description: fmt.Sprintf("Compare two commits, tags or branches of a git repository: the changed files with added and deleted line counts, and the diff (cut at %d KB; narrow it with path). Use it for what changed between versions", GIT_DIFF_MAX_BYTES/1024),
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Directory inside the repository"},
+			{Name: "from", Type: "string", Required: true, Description: "Older ref, e.g. v1.0.0 or a commit hash"},
+			{Name: "to", Type: "string", Description: "Newer ref", Default: `"HEAD"`},
+			{Name: "path", Type: "string", Description: "Only changes to this file or directory"},
+			{Name: "stat_only", Type: "bool", Description: "Whether to return only the changed files and line counts, without the diff", Default: "false"},
+		},
+		Function: gitDiff,
+	},
+	"extract_symbols": {
+		Name:        "extract_symbols",
+		Description: "Parse Go source and return each package's doc synopsis and declarations (constants, variables, types with their methods, functions) with signatures, doc comments and positions. Much cheaper than reading Go files for an API overview",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "A .go file, or a directory holding a package"},
+			{Name: "recursive", Type: "bool", Description: "Whether to include the packages in subdirectories (respecting .gitignore)", Default: "false"},
+			{Name: "exported_only", Type: "bool", Description: "Whether to report only exported declarations", Default: "true"},
+			{Name: "include_tests", Type: "bool", Description: "Whether to include _test.go files", Default: "false"},
+		},
+		Function: extractSymbols,
+	},
+	"get_file_outline": {
+		Name:        "get_file_outline",
+		Description: "Parse a source file and list its classes, functions, methods and other definitions with their signatures and line ranges, nested by class. Supports Python, JavaScript, TypeScript, Java, C#, Rust, C, C++, Ruby and PHP; use extract_symbols for Go. Much cheaper than reading the file for a structural overview",
+		Arguments: []ToolArgument{
+			{Name: "path", Type: "string", Required: true, Description: "The source file to outline"},
+		},
+		Function: getFileOutline,
+	},
+	"count_loc": {
+		Name:        "count_loc",
+		Description: "Count files and lines (total and blank) per language across a directory, respecting .gitignore. Use it for an overview of the codebase's size and languages",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Directory to count"},
+			{Name: "pattern", Type: "string", Description: "Only count files matching this glob, as in find_all_matching_files", Default: `"*"`},
+		},
+		Function: countLOC,
+	},
+	"search_in_files": {
+		Name:        "search_in_files",
+		Description: "Search file contents for a substring or regular expression, returning the file, line number and text of each matching line. Respects .gitignore and skips binary files.",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Directory to search in"},
+			{Name: "query", Type: "string", Required: true, Description: "Text to find (a regular expression if regex is true)"},
+			{Name: "regex", Type: "bool", Description: "Whether query is a regular expression (Go RE2 syntax)", Default: "false"},
+			{Name: "case_sensitive", Type: "bool", Description: "Whether case must match", Default: "true"},
+			{Name: "file_pattern", Type: "string", Description: "Only search files matching this glob, as in find_all_matching_files", Default: `"*"`},
+			{Name: "max_results", Type: "integer", Description: fmt.Sprintf("Maximum number of matching lines to return (at most %d)", SEARCH_MAX_RESULTS), Default: fmt.Sprint(SEARCH_DEFAULT_MAX_RESULTS)},
+		},
+		Function: searchInFiles,
+	},
+	"explain_ignore": {
+		Name:        "explain_ignore",
+		Description: "Explain whether a path is excluded from the file listings and which rule or .gitignore pattern excludes it",
+		Arguments: []ToolArgument{
+			{Name: "directory", Type: "string", Required: true, Description: "Base directory of the search (where .gitignore is read)"},
+			{Name: "path", Type: "string", Required: true, Description: "Path to explain, absolute or relative to directory"},
+		},
+		Function: explainIgnoreTool,
+	},
+}
+
+// RegisterTool makes an optional tool available to the agent. Tools that only
+// make sense in some modes (e.g. interactive) are registered at startup.
+func RegisterTool(tool Tool) {
+	Tools[tool.Name] = tool
+}
+
+// DescribeTools formats the registered tools, sorted by name, for the prompt
+func DescribeTools() string {
+	names := make([]string, 0, len(Tools))
+	for name := range Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	var descriptions []string
+	for i, name := range names {
+		tool := Tools[name]
+		var b strings.Builder
+		fmt.Fprintf(&b, "%d. %s: %s", i+1, tool.Name, tool.Description)
+		if len(tool.Arguments) > 0 {
+			b.WriteString("\n   Arguments:")
+		}
+		for _, arg := range tool.Arguments {
+			requirement := "optional"
+			if arg.Required {
+				requirement = "required"
+			}
+			fmt.Fprintf(&b, "\n   - %s (%s, %s): %s", arg.Name, arg.Type, requirement, arg.Description)
+			if arg.Default != "" {
+				fmt.Fprintf(&b, ", default: %s", arg.Default)
+			}
+		}
+		descriptions = append(descriptions, b.String())
+	}
+	
+	return strings.Join(descriptions, "\n\n")
 }
 
 // findAllMatchingFiles finds files matching a pattern
@@ -80,120 +331,240 @@ func findAllMatchingFiles(args map[string]interface{}) (interface{}, error) {
 		includeSubdirs = val
 	}
 	
-	log.Printf("Tool invoked: find_all_matching_files(directory='%s', pattern='%s', respect_gitignore=%v, include_hidden=%v, include_subdirs=%v)",
-		directory, pattern, respectGitignore, includeHidden, includeSubdirs)
+	followSymlinks, _ := args["follow_symlinks"].(bool)
 	
+	walked, err := walkFiles(directory, WalkOptions{
+		Pattern:          pattern,
+		RespectGitignore: respectGitignore,
+		IncludeHidden:    includeHidden,
+		IncludeSubdirs:   includeSubdirs,
+		FollowSymlinks:   followSymlinks,
+	})
+	if err != nil {
+		return nil, err
+	}
+	matchingFiles := walked.Files
+	// Walk already visits entries in lexical order; sort anyway so the listing
+	// stays stable for reproducible runs whatever produced it
+	sort.Strings(matchingFiles)
+	
+	return FileSearchResult{
+		Files: matchingFiles,
+		Count: len(matchingFiles),
+		Links: walked.Links,
+	}, nil
+}
+
+// WalkOptions controls which files listFiles returns
+type WalkOptions struct {
+	Pattern          string // glob matched against the base name, or the relative path if it has a slash (see glob.go)
+	RespectGitignore bool
+	IncludeHidden    bool
+	IncludeSubdirs   bool
+	FollowSymlinks   bool // walk linked directories and list linked files, skipping loops
+}
+
+// DefaultWalkOptions returns the options used by find_all_matching_files when
+// the model supplies no arguments
+func DefaultWalkOptions() WalkOptions {
+	return WalkOptions{
+		Pattern:          "*",
+		RespectGitignore: true,
+		IncludeHidden:    false,
+		IncludeSubdirs:   true,
+	}
+}
+
+// listFiles walks directory and returns the absolute paths of files matching
+// opts, applying the hidden-file and gitignore rules shared by all file-walking
+// tools. A missing directory yields an empty list.
+func listFiles(directory string, opts WalkOptions) ([]string, error) {
+	result, err := walkFiles(directory, opts)
+	return result.Files, err
+}
+
+// walkFiles is listFiles, also reporting the symbolic links it didn't follow
+func walkFiles(directory string, opts WalkOptions) (WalkResult, error) {
 	// Resolve directory path
 	absDir, err := filepath.Abs(directory)
 	if err != nil {
-		return nil, fmt.Errorf("error resolving directory path: %w", err)
+		return WalkResult{}, fmt.Errorf("error resolving directory path: %w", err)
 	}
 	
 	// Check if directory exists
 	if _, err := os.Stat(absDir); os.IsNotExist(err) {
 		log.Printf("Directory not found: %s", directory)
-		return FileSearchResult{Files: []string{}, Count: 0}, nil
+		return WalkResult{Files: []string{}}, nil
 	}
 	
-	// Get gitignore matcher if needed
-	var matcher gitignore.GitIgnore
-	if respectGitignore {
-		matcher = loadGitignoreMatcher(absDir)
+	filter, err := newFileFilter(absDir, opts)
+	if err != nil {
+		return WalkResult{}, err
 	}
 	
-	var matchingFiles []string
-	
-	// Walk the directory tree
-	err = filepath.Walk(absDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip files we can't access
-		}
-		
-		// Skip directories
-		if info.IsDir() {
-			// Always skip .git directory
-			if filepath.Base(path) == ".git" {
-				return filepath.SkipDir
-			}
-			// Skip subdirectories if not included
-			if !includeSubdirs && path != absDir {
-				return filepath.SkipDir
-			}
-			return nil
+	// ripgrep walks large trees much faster, pruning ignored directories.
+	// Like the walk below it doesn't list links unless following them, but
+	// it doesn't report them, so they are looked for separately.
+	if rg := ripgrepPath(); rg != "" && !opts.FollowSymlinks {
+		files, err := ripgrepFiles(rg, absDir, filter)
+		if err == nil {
+			walker := &treeWalker{filter: filter, result: WalkResult{Files: files}}
+			walker.findLinks(absDir, "")
+			return walker.result, nil
 		}
-		
-		// Get relative path for pattern matching
-		relPath, err := filepath.Rel(absDir, path)
-		if err != nil {
-			return nil
+		log.Printf("ripgrep listing failed, walking the directory instead: %v", err)
+	}
+	
+	walker := &treeWalker{filter: filter, result: WalkResult{Files: []string{}}}
+	realDir := absDir
+	if opts.FollowSymlinks {
+		walker.visited = make(map[string]bool)
+		if realDir, err = filepath.EvalSymlinks(absDir); err != nil {
+			return WalkResult{}, fmt.Errorf("error resolving directory path: %w", err)
 		}
-		
-		// Skip hidden files if not included
-		if !includeHidden && strings.HasPrefix(filepath.Base(path), ".") {
-			// Check if any parent directory is hidden
-			parts := strings.Split(relPath, string(filepath.Separator))
-			hasHiddenParent := false
-			for i := 0; i < len(parts)-1; i++ { // Exclude the filename itself
-				if strings.HasPrefix(parts[i], ".") {
-					hasHiddenParent = true
-					break
-				}
-			}
+	}
+	walker.walk(absDir, "", realDir)
+	return walker.result, nil
+}
+
+// fileFilter applies the hidden-file, gitignore and pattern rules of
+// WalkOptions, the walk scope and the linguist attributes to paths relative
+// to the walked directory
+type fileFilter struct {
+	opts     WalkOptions
+	rules    ignoreRules
+	scope    *scopeFilter       // --include and --exclude
+	linguist linguistAttributes // hidden vendored and generated files
+}
+
+// newFileFilter checks the pattern and loads the ignore files of absDir:
+// git's only if opts respects them
+func newFileFilter(absDir string, opts WalkOptions) (*fileFilter, error) {
+	if err := validateGlob(opts.Pattern); err != nil {
+		return nil, err
+	}
+	filter := &fileFilter{opts: opts}
+	filter.rules = loadIgnoreRules(absDir, opts.RespectGitignore)
+	filter.scope = newScopeFilter(absDir)
+	if hideGenerated() {
+		filter.linguist = loadLinguistAttributes(absDir)
+	}
+	return filter, nil
+}
+
+// keep reports whether the file at relPath belongs in the listing
+func (f *fileFilter) keep(relPath string) bool {
+	if !f.opts.IncludeSubdirs && strings.ContainsRune(relPath, filepath.Separator) {
+		return false
+	}
+	
+	// Skip hidden files if not included
+	if !f.opts.IncludeHidden && strings.HasPrefix(filepath.Base(relPath), ".") {
+		// Check if any parent directory is hidden
+		parts := strings.Split(relPath, string(filepath.Separator))
+		for i := 0; i < len(parts)-1; i++ { // Exclude the filename itself
 			// Only skip if it's in a hidden directory
-			if hasHiddenParent {
-				return nil
+			if strings.HasPrefix(parts[i], ".") {
+				return false
 			}
-			// Hidden files in non-hidden directories (like .gitignore) should be included
-		}
-		
-		// Skip gitignored files
-		if respectGitignore && shouldIgnore(relPath, matcher) {
-			return nil
 		}
-		
-		// Check if file matches pattern
-		matched, err := filepath.Match(pattern, filepath.Base(path))
-		if err != nil {
-			return nil
-		}
-		
-		if matched {
-			matchingFiles = append(matchingFiles, path)
-		}
-		
-		return nil
-	})
-	
-	if err != nil {
-		return nil, fmt.Errorf("error walking directory: %w", err)
+		// Hidden files in non-hidden directories (like .gitignore) should be included
 	}
 	
-	log.Printf("Found %d matching files", len(matchingFiles))
+	// Skip ignored files
+	if shouldIgnore(relPath, f.rules) {
+		return false
+	}
+	if f.scope.excludes(relPath) != "" {
+		return false
+	}
+	if attr, _, _ := f.linguist.marked(relPath); attr != "" {
+		return false
+	}
 	
-	return FileSearchResult{
-		Files: matchingFiles,
-		Count: len(matchingFiles),
-	}, nil
+	// Check if file matches pattern
+	return matchGlob(f.opts.Pattern, filepath.ToSlash(relPath))
+}
+
+// newReadFileTool creates the read_file tool. With maxBytes (--max-file-bytes)
+// files over that size are returned as their head and tail; otherwise files
+// over READ_FILE_CHUNK_BYTES are returned a chunk at a time.
+func newReadFileTool(maxBytes int64) Tool {
+	description := fmt.Sprintf("Read the contents of a file. Files over %s are returned in chunks: the result gives the file's size and the next_offset to pass for the following chunk", formatBytes(READ_FILE_CHUNK_BYTES))
+	if maxBytes > 0 {
+		description = fmt.Sprintf("Read the contents of a file. Of files over %s only the beginning and end are returned, with the number of lines omitted between them; pass an offset to read the file in chunks of that size instead", formatBytes(int(maxBytes)))
+	}
+	return Tool{
+		Name:        "read_file",
+		Description: description,
+		Arguments: []ToolArgument{
+			{Name: "file_path", Type: "string", Required: true, Description: "Path to the file to read"},
+			{Name: "offset", Type: "integer", Description: "Byte offset of the chunk to read, from a previous result's next_offset", Default: "0"},
+			{Name: "raw", Type: "bool", Description: "Return Jupyter notebooks (.ipynb) as their JSON instead of converting them to readable cells", Default: "false"},
+			{Name: "force", Type: "bool", Description: "Read files classified as minified code or lockfiles, which are otherwise refused with the reason", Default: "false"},
+		},
+		Function: func(args map[string]interface{}) (interface{}, error) {
+			return readFile(args, maxBytes)
+		},
+	}
 }
 
 // readFile reads the contents of a file
-func readFile(args map[string]interface{}) (interface{}, error) {
+func readFile(args map[string]interface{}, maxBytes int64) (interface{}, error) {
 	filePath, ok := args["file_path"].(string)
 	if !ok {
 		return nil, fmt.Errorf("file_path parameter is required")
 	}
 	
-	log.Printf("Tool invoked: read_file(file_path='%s')", filePath)
-	
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
 		return map[string]string{"error": fmt.Sprintf("File not found: %s", filePath)}, nil
 	}
 	
 	// Check if it's a binary file
-	if isBinary(filePath) {
-		log.Printf("File detected as binary: %s", filePath)
-		return map[string]string{"error": fmt.Sprintf("Cannot read binary file: %s", filePath)}, nil
+	class := classifyFile(filePath)
+	if class.Kind == FileBinary {
+		if format, _ := archiveFormat(filePath); format != "" {
+			return map[string]string{"error": fmt.Sprintf("Cannot read binary file: %s is a %s archive; use list_archive and read_archive_member to see its files", filePath, format)}, nil
+		}
+		return map[string]string{"error": fmt.Sprintf("Cannot read binary file: %s (%s)", filePath, class.Reason)}, nil
+	}
+	
+	// Large files are read a chunk at a time, or as their head and tail,
+	// rather than loaded whole
+	chunkBytes := int64(READ_FILE_CHUNK_BYTES)
+	if maxBytes > 0 {
+		chunkBytes = maxBytes
+	}
+	offset, hasOffset := intArg(args, "offset")
+	force, _ := args["force"].(bool)
+	
+	if class.Kind == FileUTF16 && err == nil {
+		return readUTF16File(filePath, info.Size(), int64(offset), chunkBytes, class)
+	}
+	
+	// Notebooks are converted from JSON to readable cells unless asked for raw
+	if raw, _ := args["raw"].(bool); err == nil && !raw && !hasOffset && strings.EqualFold(filepath.Ext(filePath), ".ipynb") {
+		if result, ok := readNotebook(filePath, info.Size()); ok {
+			if len(result.Content) > int(chunkBytes) {
+				result.Content = strings.ToValidUTF8(result.Content[:chunkBytes], "")
+				result.Note += fmt.Sprintf(". Only the first %s of the converted notebook is shown; use search_in_files to find later cells", formatBytes(int(chunkBytes)))
+			}
+			return result, nil
+		}
+	}
+	
+	// Minified code and lockfiles are only read when asked for explicitly
+	if (class.Kind == FileMinified || class.Kind == FileLockfile) && !force && !hasOffset {
+		return map[string]string{"error": fmt.Sprintf("Not reading %s: it is classified %s because %s. It would fill the context with little to document; use search_in_files or read_file_lines for the part you need, or call read_file with force true to read it anyway", filePath, class.Kind, class.Reason)}, nil
+	}
+	
+	if err == nil && (info.Size() > chunkBytes || offset > 0) {
+		if maxBytes > 0 && !hasOffset {
+			return readFileHeadTail(filePath, info.Size(), maxBytes)
+		}
+		return readFileChunk(filePath, info.Size(), int64(offset), chunkBytes)
 	}
 	
 	// Read the file
@@ -206,7 +577,6 @@ func readFile(args map[string]interface{}) (interface{}, error) {
 	}
 	
 	fileContent := string(content)
-	log.Printf("Successfully read file: %s (%d chars)", filePath, len(fileContent))
 	
 	return FileReadResult{
 		File:    filePath,
@@ -214,87 +584,432 @@ func readFile(args map[string]interface{}) (interface{}, error) {
 	}, nil
 }
 
-// loadGitignoreMatcher creates a gitignore matcher from .gitignore file
-func loadGitignoreMatcher(directory string) gitignore.GitIgnore {
-	gitignorePath := filepath.Join(directory, ".gitignore")
-	
-	// Try to load from file
-	matcher, err := gitignore.NewFromFile(gitignorePath)
+// READ_FILE_CHUNK_BYTES is the most read_file returns at once
+const READ_FILE_CHUNK_BYTES = 64 * 1024
+
+// readUTF16File returns the chunk of at most chunkBytes of a UTF-16 file,
+// decoded, starting at offset in the decoded text
+func readUTF16File(filePath string, size, offset, chunkBytes int64, class FileClass) (interface{}, error) {
+	if size > UTF16_MAX_BYTES {
+		return map[string]string{"error": fmt.Sprintf("Cannot read %s: it is UTF-16 text (%s) and over %s", filePath, class.Reason, formatBytes(UTF16_MAX_BYTES))}, nil
+	}
+	content, err := readUTF16(filePath)
 	if err != nil {
-		// If no .gitignore file, create empty matcher
-		// For now, we'll return nil and handle it in the caller
-		log.Printf("No .gitignore found: %v", err)
-		return nil
-	} else {
-		log.Printf("Loaded gitignore patterns from %s", gitignorePath)
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
 	}
-	
-	return matcher
+	if offset < 0 || (offset > 0 && offset >= int64(len(content))) {
+		return map[string]string{"error": fmt.Sprintf("Offset %d is outside the decoded file (%d bytes)", offset, len(content))}, nil
+	}
+	end := min(offset+chunkBytes, int64(len(content)))
+	result := FileReadResult{
+		File:    filePath,
+		Content: strings.ToValidUTF8(content[offset:end], ""),
+		Note:    fmt.Sprintf("Decoded from UTF-16 (%s)", class.Reason),
+	}
+	if offset > 0 || end < int64(len(content)) {
+		result.Size = int64(len(content))
+		result.Offset = offset
+		if end < int64(len(content)) {
+			result.NextOffset = end
+			result.Note += fmt.Sprintf(". This is bytes %d-%d of the %d decoded; call read_file with offset %d for the next chunk", offset, end, len(content), end)
+		}
+	}
+	return result, nil
 }
 
-// shouldIgnore checks if a file should be ignored based on gitignore patterns
-// This function works around several issues in the go-gitignore library:
-// 1. The library doesn't handle directory patterns correctly (e.g., "node_modules/")
-// 2. The library's Match() method can cause nil pointer panics
-// 3. The library doesn't work well when not in the repository directory
-func shouldIgnore(relPath string, matcher gitignore.GitIgnore) bool {
-	if matcher == nil {
-		return false
+// readFileChunk reads the chunk of at most chunkBytes of a large file
+// starting at offset. Chunks end at a line break where there is one, so lines
+// aren't split between chunks, and NextOffset continues from there.
+func readFileChunk(filePath string, size, offset, chunkBytes int64) (interface{}, error) {
+	if offset < 0 || offset >= size {
+		return map[string]string{"error": fmt.Sprintf("Offset %d is outside the file (%d bytes)", offset, size)}, nil
 	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsPermission(err) {
+			return map[string]string{"error": fmt.Sprintf("Permission denied when reading file: %s", filePath)}, nil
+		}
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	defer file.Close()
 	
-	// First try the matcher's Ignore method
-	if matcher.Ignore(relPath) {
-		return true
+	buffer := make([]byte, chunkBytes)
+	n, err := file.ReadAt(buffer, offset)
+	if err != nil && err != io.EOF {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	chunk := buffer[:n]
+	end := offset + int64(n)
+	if end < size {
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			chunk = chunk[:i+1]
+			end = offset + int64(i+1)
+		}
 	}
 	
-	// The go-gitignore library has issues with directory patterns.
-	// Check if the file is in a directory that should be ignored.
-	parts := strings.Split(relPath, string(filepath.Separator))
-	for i := 1; i <= len(parts); i++ {
-		dirPath := strings.Join(parts[:i], string(filepath.Separator))
-		// Check both with and without trailing slash
-		if matcher.Ignore(dirPath) || matcher.Ignore(dirPath + "/") {
-			return true
+	result := FileReadResult{
+		File:    filePath,
+		Content: strings.ToValidUTF8(string(chunk), ""),
+		Size:    size,
+		Offset:  offset,
+	}
+	if end < size {
+		result.NextOffset = end
+		result.Note = fmt.Sprintf("This is bytes %d-%d of %d. Call read_file with offset %d for the next chunk, or use search_in_files or read_file_lines to go straight to the relevant part", offset, end, size, end)
+	} else {
+		result.Note = fmt.Sprintf("This is bytes %d-%d of %d, the end of the file", offset, end, size)
+	}
+	return result, nil
+}
+
+// readFileHeadTail returns the first and last maxBytes/2 of a file, cut at
+// line breaks, with a marker giving the size and line count of the part in
+// between. The middle is only scanned to count its lines.
+func readFileHeadTail(filePath string, size, maxBytes int64) (interface{}, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsPermission(err) {
+			return map[string]string{"error": fmt.Sprintf("Permission denied when reading file: %s", filePath)}, nil
 		}
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	defer file.Close()
+	
+	half := maxBytes / 2
+	head := make([]byte, half)
+	if _, err := file.ReadAt(head, 0); err != nil && err != io.EOF {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	if i := bytes.LastIndexByte(head, '\n'); i >= 0 {
+		head = head[:i+1]
+	}
+	tail := make([]byte, half)
+	if _, err := file.ReadAt(tail, size-half); err != nil && err != io.EOF {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
 	}
 	
-	return false
+	headEnd, tailStart := int64(len(head)), size-int64(len(tail))
+	omittedLines, err := countNewlines(io.NewSectionReader(file, headEnd, tailStart-headEnd))
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	marker := fmt.Sprintf("\n[... %d lines (%s) omitted ...]\n\n", omittedLines, formatBytes(int(tailStart-headEnd)))
+	return FileReadResult{
+		File:    filePath,
+		Content: strings.ToValidUTF8(string(head), "") + marker + strings.ToValidUTF8(string(tail), ""),
+		Size:    size,
+		Note:    fmt.Sprintf("The file is larger than %s, so only its beginning and end are shown. Call read_file with offset %d to read the omitted part in chunks, or use search_in_files or read_file_lines to go straight to the relevant part", formatBytes(int(maxBytes)), headEnd),
+	}, nil
 }
 
+// countNewlines counts the line breaks in r
+func countNewlines(r io.Reader) (int, error) {
+	count := 0
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buffer)
+		count += bytes.Count(buffer[:n], []byte{'\n'})
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
 
+// Limits of read_file_lines, which reads part of a file
+const (
+	READ_LINES_DEFAULT = 200
+	READ_LINES_MAX     = 1000
+	READ_BYTES_DEFAULT = 8 * 1024
+	READ_BYTES_MAX     = 64 * 1024
+)
 
-// isBinary checks if a file is binary by reading the first few bytes
-func isBinary(filePath string) bool {
+// FileLinesResult represents a line range read from a file
+type FileLinesResult struct {
+	File       string `json:"file"`
+	StartLine  int    `json:"start_line"`
+	EndLine    int    `json:"end_line"`    // last line returned
+	TotalLines int    `json:"total_lines"` // lines in the whole file
+	Content    string `json:"content"`
+}
+
+// FileBytesResult represents a byte range read from a file
+type FileBytesResult struct {
+	File    string `json:"file"`
+	Offset  int64  `json:"offset"`
+	Length  int    `json:"length"` // bytes returned
+	Size    int64  `json:"size"`   // bytes in the whole file
+	Content string `json:"content"`
+}
+
+// readFileLines reads a line range, or with offset a byte range, of a file
+func readFileLines(args map[string]interface{}) (interface{}, error) {
+	filePath, ok := args["file_path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("file_path parameter is required")
+	}
+	
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("File not found: %s", filePath)}, nil
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	if class := classifyFile(filePath); class.Kind == FileUTF16 {
+		return map[string]string{"error": fmt.Sprintf("Cannot read lines of %s: it is UTF-16 text (%s); use read_file, which decodes it", filePath, class.Reason)}, nil
+	} else if class.Kind == FileBinary {
+		return map[string]string{"error": fmt.Sprintf("Cannot read binary file: %s (%s)", filePath, class.Reason)}, nil
+	}
 	file, err := os.Open(filePath)
 	if err != nil {
-		return true // Assume binary if we can't open
+		if os.IsPermission(err) {
+			return map[string]string{"error": fmt.Sprintf("Permission denied when reading file: %s", filePath)}, nil
+		}
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
 	}
 	defer file.Close()
 	
-	// Read first 512 bytes
-	buffer := make([]byte, 512)
-	n, err := file.Read(buffer)
-	if err != nil && err != io.EOF {
-		return true
+	if offset, ok := intArg(args, "offset"); ok {
+		if offset < 0 || int64(offset) > info.Size() {
+			return map[string]string{"error": fmt.Sprintf("offset %d is outside the file (%d bytes)", offset, info.Size())}, nil
+		}
+		length := READ_BYTES_DEFAULT
+		if val, ok := intArg(args, "length"); ok && val > 0 {
+			length = min(val, READ_BYTES_MAX)
+		}
+		buffer := make([]byte, length)
+		n, err := file.ReadAt(buffer, int64(offset))
+		if err != nil && err != io.EOF {
+			return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+		}
+		return FileBytesResult{
+			File:    filePath,
+			Offset:  int64(offset),
+			Length:  n,
+			Size:    info.Size(),
+			Content: strings.ToValidUTF8(string(buffer[:n]), "\uFFFD"),
+		}, nil
+	}
+	
+	startLine := 1
+	if val, ok := intArg(args, "start_line"); ok && val > 0 {
+		startLine = val
+	}
+	endLine := startLine + READ_LINES_DEFAULT - 1
+	if val, ok := intArg(args, "end_line"); ok && val > 0 {
+		endLine = val
+	}
+	if endLine < startLine {
+		return map[string]string{"error": fmt.Sprintf("end_line %d is before start_line %d", endLine, startLine)}, nil
 	}
+	endLine = min(endLine, startLine+READ_LINES_MAX-1)
 	
-	// Check for null bytes (common in binary files)
-	for i := 0; i < n; i++ {
-		if buffer[i] == 0 {
-			return true
+	// Read to the end to count the lines, keeping only the requested ones
+	var content strings.Builder
+	reader := bufio.NewReader(file)
+	totalLines := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			totalLines++
+			if totalLines >= startLine && totalLines <= endLine {
+				content.WriteString(line)
+			}
+		}
+		if err == io.EOF {
+			break
 		}
+		if err != nil {
+			return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+		}
+	}
+	if startLine > totalLines {
+		return map[string]string{"error": fmt.Sprintf("start_line %d is past the end of the file (%d lines)", startLine, totalLines)}, nil
+	}
+	
+	return FileLinesResult{
+		File:       filePath,
+		StartLine:  startLine,
+		EndLine:    min(endLine, totalLines),
+		TotalLines: totalLines,
+		Content:    content.String(),
+	}, nil
+}
+
+// FileStatResult describes a file without reading it into the conversation
+type FileStatResult struct {
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`               // bytes
+	Modified string    `json:"modified"`           // RFC 3339
+	Lines    int       `json:"lines"`              // 0 for binary files
+	Language string    `json:"language,omitempty"` // from the name or shebang, if known
+	Binary   bool      `json:"binary,omitempty"`
+	Content  FileClass `json:"content"` // what the file tools make of it
+}
+
+// fileStat reports a file's size, modification time, line count and language
+func fileStat(args map[string]interface{}) (interface{}, error) {
+	// Not file_path: a stat doesn't make the file a source of the document
+	filePath, ok := args["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("path parameter is required")
 	}
 	
-	// Check if it's mostly printable ASCII
-	printable := 0
-	for i := 0; i < n; i++ {
-		if buffer[i] >= 32 && buffer[i] <= 126 || buffer[i] == '\n' || buffer[i] == '\r' || buffer[i] == '\t' {
-			printable++
+	info, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return map[string]string{"error": fmt.Sprintf("File not found: %s", filePath)}, nil
+	}
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
+	}
+	if info.IsDir() {
+		return map[string]string{"error": fmt.Sprintf("%s is a directory; use find_all_matching_files to list it", filePath)}, nil
+	}
+	
+	result := FileStatResult{
+		File:     filePath,
+		Size:     info.Size(),
+		Modified: info.ModTime().Format(time.RFC3339),
+		Language: detectLanguage(filePath),
+		Content:  classifyFile(filePath),
+	}
+	result.Binary = result.Content.Kind == FileBinary || result.Content.Kind == FileUTF16
+	if !result.Binary {
+		if result.Lines, err = countLines(filePath); err != nil {
+			return map[string]string{"error": fmt.Sprintf("Error reading file: %s", err)}, nil
 		}
 	}
+	return result, nil
+}
+
+// countLines counts the lines of a file, including a last line without a
+// newline
+func countLines(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
 	
-	// If less than 80% printable, consider it binary
-	return float64(printable)/float64(n) < 0.8
+	lines := 0
+	last := byte('\n')
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := file.Read(buffer)
+		if n > 0 {
+			lines += bytes.Count(buffer[:n], []byte{'\n'})
+			last = buffer[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if last != '\n' {
+		lines++
+	}
+	return lines, nil
+}
+
+// intArg returns an integer argument; JSON numbers arrive as float64
+func intArg(args map[string]interface{}, name string) (int, bool) {
+	switch val := args[name].(type) {
+	case float64:
+		return int(val), true
+	case int:
+		return val, true
+	}
+	return 0, false
+}
+
+// newAskUserTool returns the ask_user tool, which lets the agent pause and put a
+// clarifying question to the person running it. Questions are written to out,
+// answers read line by line from in, and each exchange is recorded in trace.
+func newAskUserTool(in io.Reader, out io.Writer, trace *TraceRecorder) Tool {
+	reader := bufio.NewReader(in)
+	return Tool{
+		Name:        "ask_user",
+		Description: "Ask the user a clarifying question when the request is ambiguous and wait for their answer. Use sparingly",
+		Limits:      ToolLimits{Timeout: -1}, // the user may take a while
+		Arguments: []ToolArgument{
+			{Name: "question", Type: "string", Required: true, Description: "The question to ask"},
+		},
+		Function: func(args map[string]interface{}) (interface{}, error) {
+			question, ok := args["question"].(string)
+			if !ok || strings.TrimSpace(question) == "" {
+				return nil, fmt.Errorf("question parameter is required")
+			}
+			
+			fmt.Fprintf(out, "\nThe agent asks: %s\n> ", question)
+			
+			answer, err := reader.ReadString('\n')
+			answer = strings.TrimSpace(answer)
+			if err != nil && answer == "" {
+				return nil, fmt.Errorf("no answer available: %w", err)
+			}
+			if answer == "" {
+				answer = "(no answer given; use your best judgement)"
+			}
+			
+			trace.Record(TraceEvent{Type: TraceClarification, Question: question, Answer: answer})
+			return map[string]string{"question": question, "answer": answer}, nil
+		},
+	}
+}
+
+// shouldIgnore checks if a file should be ignored based on gitignore patterns
+func shouldIgnore(relPath string, rules ignoreRules) bool {
+	match, _ := ignoreMatch(relPath, false, rules)
+	return match != nil
+}
+
+// ignoreMatch returns the pattern that excludes relPath, or nil, and the
+// ignore file it is in. relPath is relative to the walked directory. As in
+// git, the last matching pattern of a file decides, so "!pattern" re-includes
+// what an earlier pattern excluded, but an excluded directory excludes
+// everything in it: a negation cannot re-include a file whose parent
+// directory is ignored.
+func ignoreMatch(relPath string, isDir bool, rules ignoreRules) (*gitignorePattern, *ignoreFile) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+	
+	parts := strings.Split(relPath, string(filepath.Separator))
+	for i := 1; i < len(parts); i++ {
+		dirPath := strings.Join(parts[:i], "/")
+		if match, file := rules.match(dirPath, true); match != nil && !match.Negate {
+			return match, file
+		}
+	}
+	
+	if match, file := rules.match(filepath.ToSlash(relPath), isDir); match != nil && !match.Negate {
+		return match, file
+	}
+	return nil, nil
+}
+
+
+
+// isBinary reports whether a file is not text the tools can scan as bytes:
+// binary content, an extension --binary-extensions lists, or UTF-16 text,
+// which only read_file decodes (see classifyFile)
+func isBinary(filePath string) bool {
+	kind := classifyFile(filePath).Kind
+	return kind == FileBinary || kind == FileUTF16
+}
+
+// isBinaryContent checks if the first bytes of a file look binary (or are
+// UTF-16, which reads as binary byte by byte)
+func isBinaryContent(buffer []byte) bool {
+	return classifyContent(buffer).Kind != FileText
 }
 
 // ExecuteTool executes a tool by name with the given arguments
@@ -304,16 +1019,38 @@ func ExecuteTool(toolName string, args map[string]interface{}) (string, error) {
 		return "", fmt.Errorf("unknown tool: %s", toolName)
 	}
 	
-	result, err := tool.Function(args)
+	args, err := validateToolArgs(tool, args)
 	if err != nil {
 		return "", err
 	}
+	args = resolveRootArgs(args)
 	
-	// Convert result to JSON string
-	jsonBytes, err := json.MarshalIndent(result, "", "  ")
+	// A call that overruns its timeout is abandoned; tools don't take a context
+	limits := limitsFor(tool)
+	var deadline time.Time
+	if limits.Timeout > 0 {
+		deadline = time.Now().Add(limits.Timeout)
+	}
+	output, err := runWithTimeout(deadline, func() (string, error) {
+		result, err := tool.Function(args)
+		if err != nil {
+			return "", err
+		}
+		
+		// Convert result to JSON string
+		jsonBytes, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return "", fmt.Errorf("error marshaling result: %w", err)
+		}
+		return string(jsonBytes), nil
+	})
+	if errors.Is(err, errTimeout) {
+		return "", fmt.Errorf("%s: %w after %s", toolName, errTimeout, limits.Timeout)
+	}
 	if err != nil {
-		return "", fmt.Errorf("error marshaling result: %w", err)
+		return "", err
 	}
 	
-	return string(jsonBytes), nil
+	// Keep credentials in the files out of the prompt, and the prompt in bounds
+	return capToolOutput(scanPromptText(output), limits.MaxOutputBytes), nil
 }
\ No newline at end of file
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Trace event types
+const (
+	TraceLLMCall     = "llm_call"
+	TraceToolCall    = "tool_call"
+	TraceFinalAnswer = "final_answer"
+	// TraceLLMTimeout records an LLM call abandoned at the time limit. Replay
+	// skips these, just as the agent ignored the late response.
+	TraceLLMTimeout = "llm_timeout"
+	// TraceClarification records an ask_user question and the user's answer
+	TraceClarification = "clarification"
+)
+
+// TraceEvent is one line of a run transcript (JSON Lines). Completions are
+// recorded whole: the agent requests non-streaming chat completions and
+// parses actions from the ReAct text, so there are no native tool-call deltas
+// to record. A streaming client would need its own event type for them.
+type TraceEvent struct {
+	Time        string                 `json:"time"`
+	Type        string                 `json:"type"`
+	Iteration   int                    `json:"iteration,omitempty"`
+	Completion  string                 `json:"completion,omitempty"`
+	Tool        string                 `json:"tool,omitempty"`
+	Args        map[string]interface{} `json:"args,omitempty"`
+	Observation string                 `json:"observation,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Cached      bool                   `json:"cached,omitempty"`
+	Question    string                 `json:"question,omitempty"`
+	Answer      string                 `json:"answer,omitempty"`
+	DurationMs  int64                  `json:"duration_ms,omitempty"`
+}
+
+// TraceRecorder appends TraceEvents to a JSONL file. A nil recorder discards
+// events, so callers don't need to check whether tracing is enabled.
+type TraceRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// NewTraceRecorder creates (or truncates) the transcript file at path
+func NewTraceRecorder(path string) (*TraceRecorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating trace file: %w", err)
+	}
+	return &TraceRecorder{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Record writes an event, stamping it with the current time
+func (t *TraceRecorder) Record(event TraceEvent) {
+	if t == nil {
+		return
+	}
+	event.Time = time.Now().Format(time.RFC3339Nano)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	// Tracing is diagnostic; a failed write must not abort the run
+	_ = t.enc.Encode(event)
+}
+
+// Close flushes and closes the transcript file
+func (t *TraceRecorder) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.file.Close()
+}
+
+// OnIteration implements EventSink; iterations are implied by the other events
+func (t *TraceRecorder) OnIteration(event IterationEvent) {}
+
+// OnLLMCall implements EventSink
+func (t *TraceRecorder) OnLLMCall(event LLMCallEvent) {
+	eventType := TraceLLMCall
+	if errors.Is(event.Err, errTimeout) {
+		eventType = TraceLLMTimeout
+	}
+	t.Record(TraceEvent{
+		Type:       eventType,
+		Iteration:  event.Iteration,
+		Completion: event.Response,
+		Error:      errorString(event.Err),
+		DurationMs: event.Duration.Milliseconds(),
+	})
+}
+
+// OnToolCall implements EventSink
+func (t *TraceRecorder) OnToolCall(event ToolCallEvent) {
+	t.Record(TraceEvent{
+		Type:        TraceToolCall,
+		Iteration:   event.Iteration,
+		Tool:        event.Tool,
+		Args:        event.Args,
+		Observation: event.Observation,
+		Error:       errorString(event.Err),
+		Cached:      event.Cached,
+		DurationMs:  event.Duration.Milliseconds(),
+	})
+}
+
+// OnFinal implements EventSink
+func (t *TraceRecorder) OnFinal(event FinalEvent) {
+	t.Record(TraceEvent{Type: TraceFinalAnswer, Iteration: event.Iteration})
+}
+
+// readTrace loads all events from a transcript file
+func readTrace(path string) ([]TraceEvent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening trace file: %w", err)
+	}
+	defer file.Close()
+
+	var events []TraceEvent
+	scanner := bufio.NewScanner(file)
+	// Completions and observations can be far larger than the default 64KB line limit
+	scanner.Buffer(make([]byte, 0, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var event TraceEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("error parsing trace line %d: %w", line, err)
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading trace file: %w", err)
+	}
+	return events, nil
+}
+
+// ReplayClient implements LLMClient by serving the completions recorded in a
+// transcript, in order, without contacting any provider
+type ReplayClient struct {
+	mu        sync.Mutex
+	responses []TraceEvent
+	next      int
+}
+
+// NewReplayClient loads the LLM calls recorded in the transcript at path
+func NewReplayClient(path string) (*ReplayClient, error) {
+	events, err := readTrace(path)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &ReplayClient{}
+	for _, event := range events {
+		if event.Type == TraceLLMCall {
+			client.responses = append(client.responses, event)
+		}
+	}
+	if len(client.responses) == 0 {
+		return nil, fmt.Errorf("trace %s contains no recorded LLM calls", path)
+	}
+	return client, nil
+}
+
+// Complete implements the LLMClient interface by returning the next recorded completion
+func (c *ReplayClient) Complete(prompt string, systemPrompt string, temperature float32) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.next >= len(c.responses) {
+		return "", fmt.Errorf("replay exhausted: the trace only recorded %d LLM calls", len(c.responses))
+	}
+	event := c.responses[c.next]
+	c.next++
+
+	if event.Error != "" {
+		return "", fmt.Errorf("%s", event.Error)
+	}
+	return event.Completion, nil
+}
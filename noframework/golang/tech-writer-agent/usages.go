@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// USAGES_DEFAULT_MAX_RESULTS is find_usages' default limit on matching lines;
+// the maximum is search_in_files' SEARCH_MAX_RESULTS
+const USAGES_DEFAULT_MAX_RESULTS = 100
+
+// UsageLine is one line where an identifier appears
+type UsageLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// UsageFile lists the lines of one file where an identifier appears
+type UsageFile struct {
+	File  string      `json:"file"`
+	Count int         `json:"count"`
+	Lines []UsageLine `json:"lines"`
+}
+
+// UsagesResult represents the places an identifier appears, grouped by file
+type UsagesResult struct {
+	Identifier string      `json:"identifier"`
+	Files      []UsageFile `json:"files"`
+	FileCount  int         `json:"file_count"`
+	Count      int         `json:"count"`               // matching lines
+	Truncated  bool        `json:"truncated,omitempty"` // more lines matched than max_results
+}
+
+// findUsages implements the find_usages tool: the files and lines where an
+// identifier appears, so the agent can see which components use which
+func findUsages(args map[string]interface{}) (interface{}, error) {
+	directory, ok := args["directory"].(string)
+	if !ok {
+		return nil, fmt.Errorf("directory parameter is required")
+	}
+	identifier, ok := args["identifier"].(string)
+	if !ok || strings.TrimSpace(identifier) == "" {
+		return nil, fmt.Errorf("identifier parameter is required")
+	}
+	identifier = strings.TrimSpace(identifier)
+	wholeWord := true
+	if val, ok := args["whole_word"].(bool); ok {
+		wholeWord = val
+	}
+	caseSensitive := true
+	if val, ok := args["case_sensitive"].(bool); ok {
+		caseSensitive = val
+	}
+	opts := DefaultWalkOptions()
+	if val, ok := args["file_pattern"].(string); ok && val != "" {
+		opts.Pattern = val
+	}
+	maxResults := USAGES_DEFAULT_MAX_RESULTS
+	if val, ok := intArg(args, "max_results"); ok && val > 0 {
+		maxResults = min(val, SEARCH_MAX_RESULTS)
+	}
+
+	re := regexp.MustCompile(identifierPattern(identifier, wholeWord, caseSensitive))
+	found, err := searchFiles(directory, re, opts, maxResults)
+	if err != nil {
+		return nil, err
+	}
+
+	result := UsagesResult{Identifier: identifier, Files: []UsageFile{}, Count: found.Count, Truncated: found.Truncated}
+	for _, match := range found.Matches {
+		// Matches arrive grouped by file
+		if n := len(result.Files); n == 0 || result.Files[n-1].File != match.File {
+			result.Files = append(result.Files, UsageFile{File: match.File})
+		}
+		file := &result.Files[len(result.Files)-1]
+		file.Lines = append(file.Lines, UsageLine{Line: match.Line, Text: match.Text})
+		file.Count++
+	}
+	result.FileCount = len(result.Files)
+	return result, nil
+}
+
+// identifierPattern returns the regular expression matching identifier. As
+// a whole word it must not be part of a longer identifier; "$" counts as an
+// identifier character as in JavaScript and PHP. \b would not do, since it
+// treats "$" as a boundary.
+func identifierPattern(identifier string, wholeWord, caseSensitive bool) string {
+	pattern := regexp.QuoteMeta(identifier)
+	if wholeWord {
+		pattern = `(?:^|[^\w$])` + pattern + `(?:[^\w$]|$)`
+	}
+	if !caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	return pattern
+}
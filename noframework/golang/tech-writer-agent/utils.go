@@ -3,9 +3,12 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"net/url"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -15,6 +18,21 @@ import (
 const (
 	MAX_ITERATIONS = 50
 	
+	// Bounds for the iteration cap derived from repository size
+	MIN_ITERATIONS         = 15
+	MAX_ITERATIONS_CEILING = 150
+	
+	// Iteration budget for each follow-up question in chat mode
+	FOLLOW_UP_MAX_ITERATIONS = 15
+	
+	// Identical tool calls answered with a reminder before the agent is
+	// treated as looping and given a corrective message
+	LOOP_REPEAT_LIMIT = 2
+	// Corrective messages issued before a looping run is aborted
+	LOOP_MAX_CORRECTIONS = 3
+	// Characters of the earlier result quoted in a corrective message
+	LOOP_RESULT_PREVIEW_CHARS = 500
+	
 	ROLE_AND_TASK = `You are an expert tech writer that helps teams understand codebases with accurate and concise supporting analysis and documentation. 
 Your task is to analyse the local filesystem to understand the structure and functionality of a codebase.`
 
@@ -70,6 +88,47 @@ func GetReActSystemPrompt() string {
 	return fmt.Sprintf("%s\n\n%s", GetTechWriterSystemPrompt(), REACT_PLANNING_STRATEGY)
 }
 
+// adaptiveMaxIterations scales the iteration cap with the number of files the
+// agent can see in directories (two for --compare), clamped to [floor, ceiling]. Each tenfold
+// increase in file count adds roughly 36 iterations: a 10-file repo gets the
+// floor, 100 files about 50 and 10,000 files about 125. If the repository
+// can't be listed, MAX_ITERATIONS is used (still clamped).
+func adaptiveMaxIterations(directories []string, floor, ceiling int) int {
+	count := 0
+	for _, directory := range directories {
+		files, err := listFiles(directory, DefaultWalkOptions())
+		if err != nil {
+			log.Printf("Could not gather repository statistics, using %d iterations: %v", MAX_ITERATIONS, err)
+			return clampIterations(MAX_ITERATIONS, floor, ceiling)
+		}
+		count += len(files)
+	}
+	iterations := iterationsForFileCount(count, floor, ceiling)
+	log.Printf("Repository has %d files; adaptive iteration cap is %d", count, iterations)
+	return iterations
+}
+
+// iterationsForFileCount is the adaptiveMaxIterations scale for a known
+// number of files
+func iterationsForFileCount(files, floor, ceiling int) int {
+	count := math.Max(float64(files), 10)
+	return clampIterations(MIN_ITERATIONS+int(math.Round(11*math.Log2(count/10))), floor, ceiling)
+}
+
+// clampIterations limits iterations to [floor, ceiling]
+func clampIterations(iterations, floor, ceiling int) int {
+	if ceiling < floor {
+		ceiling = floor
+	}
+	if iterations < floor {
+		iterations = floor
+	}
+	if iterations > ceiling {
+		iterations = ceiling
+	}
+	return iterations
+}
+
 // readPromptFile reads a prompt from an external file
 func readPromptFile(filePath string) (string, error) {
 	content, err := os.ReadFile(filePath)
@@ -109,8 +168,12 @@ func validateGitHubURL(url string) bool {
 	return false
 }
 
-// getRepoNameFromURL extracts owner/repo from GitHub URL
+// getRepoNameFromURL extracts owner/repo from GitHub URL, or the cache name
+// of a repository on disk from its file:// URL
 func getRepoNameFromURL(url string) string {
+	if strings.HasPrefix(url, "file://") {
+		return localRepoName(url)
+	}
 	url = strings.TrimSuffix(strings.TrimSuffix(url, "/"), ".git")
 	
 	if strings.HasPrefix(url, "https://github.com/") {
@@ -121,24 +184,76 @@ func getRepoNameFromURL(url string) string {
 	return url
 }
 
-// cloneRepo clones a repository to the cache directory
-func cloneRepo(repoURL, cacheDir string) (string, error) {
+// truncateRunes shortens s to at most n runes, marking the cut
+func truncateRunes(s string, n int) string {
+	if runes := []rune(s); len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return s
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, path[1:])
+}
+
+// CloneOptions choose what cloneRepo checks out and how it uses the cache
+type CloneOptions struct {
+	Ref      string        // branch, tag or full commit SHA; "" is the default branch
+	Refresh  bool          // fetch the ref again and reset a cached clone to it
+	NoCache  bool          // clone into a temporary directory the caller removes
+	Sparse   []string      // directories to check out (cone mode), fetching only their files; nil is the whole tree
+	Progress io.Writer     // where git's download progress is shown; nil shows none
+	Timeout  time.Duration // limit on the whole clone or refresh; 0 is none
+}
+
+// cloneRepo clones a repository to the cache directory: its default branch,
+// or opts.Ref (a branch, tag or full commit SHA) if given. Each ref is cached
+// in its own directory, owner/repo@ref, and reused as it is unless
+// opts.Refresh is set. A sparse clone is widened to the directories a later
+// run needs.
+func cloneRepo(repoURL, cacheDir string, opts CloneOptions) (string, error) {
+	ref := opts.Ref
 	repoName := getRepoNameFromURL(repoURL)
+	session, cancel := newCloneSession(repoName, opts)
+	defer cancel()
+	if ref != "" {
+		repoName += "@" + url.PathEscape(ref)
+	}
 	
-	// Expand tilde in cache directory
-	if strings.HasPrefix(cacheDir, "~") {
-		homeDir, err := os.UserHomeDir()
+	repoPath := filepath.Join(expandHome(cacheDir), repoName)
+	if opts.NoCache {
+		tempDir, err := os.MkdirTemp("", "tech-writer-clone-")
 		if err != nil {
-			return "", fmt.Errorf("error getting home directory: %w", err)
+			return "", fmt.Errorf("error creating clone directory: %w", err)
+		}
+		repoPath = tempDir
+	} else if _, err := os.Stat(repoPath); err == nil {
+		// Already cloned
+		touchCachedRepo(repoPath)
+		if !isTarballTree(repoPath) {
+			if err := setSparseCheckout(session, repoPath, opts.Sparse); err != nil {
+				return "", fmt.Errorf("failed to update the sparse checkout: %w", err)
+			}
+			if opts.Refresh {
+				return repoPath, refreshClone(session, repoPath, ref)
+			}
+			return repoPath, nil
+		}
+		if !opts.Refresh {
+			return repoPath, nil
+		}
+		// A tarball has no history to fetch into: download it again
+		if err := removeCachedRepo(repoPath); err != nil {
+			return "", fmt.Errorf("failed to refresh %s: %w", repoPath, err)
 		}
-		cacheDir = filepath.Join(homeDir, cacheDir[1:])
-	}
-	
-	repoPath := filepath.Join(cacheDir, repoName)
-	
-	// Check if already cloned
-	if _, err := os.Stat(repoPath); err == nil {
-		return repoPath, nil
 	}
 	
 	// Create parent directory
@@ -146,66 +261,250 @@ func cloneRepo(repoURL, cacheDir string) (string, error) {
 		return "", fmt.Errorf("error creating cache directory: %w", err)
 	}
 	
-	// Clone the repository
-	cmd := exec.Command("git", "clone", "--depth", "1", repoURL, repoPath)
-	output, err := cmd.CombinedOutput()
+	// Without git, or if git can't reach a GitHub repository, fall back on
+	// GitHub's tarball of the ref
+	var err error
+	if _, github := githubRepoName(repoURL); !gitAvailable() && !github {
+		err = fmt.Errorf("git is needed to clone %s, and was not found", repoURL)
+	} else if !gitAvailable() {
+		log.Printf("git not found; downloading a tarball of %s instead of cloning it", repoURL)
+		err = downloadTarball(session, repoURL, repoPath, ref)
+	} else if err = gitClone(session, repoURL, repoPath, ref, opts.Sparse); err != nil {
+		if _, github := githubRepoName(repoURL); github && session.ctx.Err() == nil {
+			log.Printf("Cloning %s failed, downloading a tarball instead: %v", repoURL, err)
+			os.RemoveAll(repoPath)
+			if tarballErr := downloadTarball(session, repoURL, repoPath, ref); tarballErr != nil {
+				err = fmt.Errorf("%w; the tarball download failed too: %v", err, tarballErr)
+			} else {
+				err = nil
+			}
+		}
+	}
 	if err != nil {
-		return "", fmt.Errorf("failed to clone repository: %s\n%s", err, string(output))
+		removeCachedRepo(repoPath)
+		return "", err
 	}
-	
 	return repoPath, nil
 }
 
+// gitClone makes repoPath a shallow clone of repoURL at ref, or at the
+// default branch, checking out only the sparse directories if given
+func gitClone(session *cloneSession, repoURL, repoPath, ref string, sparse []string) error {
+	if ref != "" || len(sparse) > 0 {
+		if ref == "" {
+			ref = "HEAD"
+		}
+		return fetchRef(session, repoURL, repoPath, ref, sparse)
+	}
+	if err := session.git("", "clone", "--depth", "1", repoURL, repoPath); err != nil {
+		return fmt.Errorf("failed to clone repository: %w", err)
+	}
+	return nil
+}
+
+// refreshClone updates a cached clone to the current commit of ref, or of
+// the default branch, discarding anything left in the work tree
+func refreshClone(session *cloneSession, repoPath, ref string) error {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	steps := [][]string{
+		{"fetch", "--depth", "1", "origin", ref},
+		{"reset", "--quiet", "--hard", "FETCH_HEAD"},
+		{"clean", "--quiet", "-fdx"},
+	}
+	for _, step := range steps {
+		if err := session.git(repoPath, step...); err != nil {
+			return fmt.Errorf("failed to refresh %s: %w", repoPath, err)
+		}
+	}
+	return nil
+}
+
+// fetchRef makes repoPath a shallow checkout of ref. Unlike git clone
+// --branch, fetching works for commit SHAs as well as branches and tags.
+// With sparse directories it is a partial clone too: only the files in them
+// are downloaded, at checkout, and the rest when a later run needs them.
+func fetchRef(session *cloneSession, repoURL, repoPath, ref string, sparse []string) error {
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+	steps := [][]string{
+		{"init", "--quiet"},
+		{"remote", "add", "origin", repoURL},
+	}
+	fetch := []string{"fetch", "--depth", "1", "origin", ref}
+	if len(sparse) > 0 {
+		steps = append(steps,
+			[]string{"config", "remote.origin.promisor", "true"},
+			[]string{"config", "remote.origin.partialclonefilter", "blob:none"},
+			append([]string{"sparse-checkout", "set", "--cone"}, sparse...),
+		)
+		fetch = append(fetch, "--filter=blob:none")
+	}
+	steps = append(steps, fetch, []string{"checkout", "--detach", "FETCH_HEAD"})
+	for _, step := range steps {
+		if err := session.git(repoPath, step...); err != nil {
+			return fmt.Errorf("failed to check out %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// setSparseCheckout adds dirs to the directories a sparse clone checks out,
+// or checks out the whole tree if dirs is empty, fetching the missing files.
+// A full clone already has everything.
+func setSparseCheckout(session *cloneSession, repoPath string, dirs []string) error {
+	if output, _ := runGit(repoPath, "config", "--bool", "core.sparseCheckout"); strings.TrimSpace(output) != "true" {
+		return nil
+	}
+	if len(dirs) == 0 {
+		return session.git(repoPath, "sparse-checkout", "disable")
+	}
+	return session.git(repoPath, append([]string{"sparse-checkout", "add"}, dirs...)...)
+}
+
+// sparseDirs derives the directories a sparse clone needs from --subdir and
+// the --include patterns (relative to the subdirectory): each pattern's
+// leading directories without wildcards. It returns nil, the whole tree,
+// if a pattern has none, as "*.go" matches files at any depth.
+func sparseDirs(subdir string, include []string) []string {
+	base := strings.Trim(filepath.ToSlash(filepath.Clean(subdir)), "/")
+	if base == "." {
+		base = ""
+	}
+	if len(include) == 0 {
+		if base == "" {
+			return nil
+		}
+		return []string{base}
+	}
+	var dirs []string
+	for _, pattern := range include {
+		var literal []string
+		segments := strings.Split(strings.Trim(pattern, "/"), "/")
+		// The last segment may name a file rather than a directory
+		for _, segment := range segments[:len(segments)-1] {
+			if strings.ContainsAny(segment, "*?[{") {
+				break
+			}
+			literal = append(literal, segment)
+		}
+		if len(literal) == 0 {
+			if base == "" {
+				return nil
+			}
+			return []string{base}
+		}
+		dirs = append(dirs, path.Join(append([]string{base}, literal...)...))
+	}
+	return dirs
+}
+
 // Metadata represents the metadata for a tech writer output
 type Metadata struct {
-	Model     string `json:"model"`
-	GitHubURL string `json:"github_url"`
-	RepoName  string `json:"repo_name"`
-	Timestamp string `json:"timestamp"`
-	EvalOutput string `json:"eval_output,omitempty"`
-	EvalError  string `json:"eval_error,omitempty"`
-}
-
-// createMetadata creates a metadata JSON file for the tech writer output
-func createMetadata(outputFile, modelName, repoURL, repoName, techWriterResult, evalPromptFile string) error {
-	metadata := Metadata{
-		Model:     modelName,
-		GitHubURL: repoURL,
-		RepoName:  repoName,
-		Timestamp: time.Now().Format(time.RFC3339),
-	}
-	
-	// Run evaluation if prompt provided
-	if evalPromptFile != "" {
-		evalPrompt, err := readPromptFile(evalPromptFile)
+	Model         string         `json:"model"`
+	Framework     string         `json:"framework,omitempty"` // the --framework that produced the result
+	GitHubURL     string         `json:"github_url"`
+	RepoName      string         `json:"repo_name"`
+	GitHub        *GitHubInfo    `json:"github,omitempty"`      // the --repo as the GitHub API describes it
+	Directory     string         `json:"directory,omitempty"`   // absolute path that was analysed
+	Fingerprint   string         `json:"fingerprint,omitempty"` // content hash of the visible files, see repoFingerprint
+	Commit        string         `json:"commit,omitempty"`      // git HEAD of the analysed tree, if any
+	Ref           string         `json:"ref,omitempty"`         // the --ref cloned; Commit is what it resolved to
+	Subdir        string         `json:"subdir,omitempty"`      // the --subdir of the repository analysed
+	Diff          *DiffRange     `json:"diff,omitempty"`        // the --from-ref and --to-ref documented
+	Incremental   *UpdatePlan    `json:"incremental,omitempty"` // the earlier document an --incremental run updated
+	Compare       *Comparison    `json:"compare,omitempty"`     // the second code base of a --compare run
+	Roots         []Root         `json:"roots,omitempty"`       // the labeled directories of a run analysing several
+	Timestamp     string         `json:"timestamp"`
+	PromptHash    string         `json:"prompt_hash,omitempty"` // of the prompt file, see promptHash
+	Seed          *int           `json:"seed,omitempty"`
+	Iterations    int            `json:"iterations,omitempty"`     // LLM turns the agent used
+	MaxIterations int            `json:"max_iterations,omitempty"` // the iteration cap it was given
+	Truncated     bool           `json:"truncated,omitempty"`      // answer forced before exploration finished
+	Partial       bool           `json:"partial,omitempty"`        // stopped early by the user (Ctrl-C)
+	ReviewModel   string         `json:"review_model,omitempty"`
+	StyleGuide    string         `json:"style_guide,omitempty"`
+	StyleModel    string         `json:"style_model,omitempty"`
+	LintFindings  []LintFinding  `json:"lint_findings,omitempty"`
+	Diagrams      []DiagramCheck `json:"diagram_checks,omitempty"` // the --diagrams check of each diagram
+	Split         string         `json:"split_output,omitempty"` // directory of the --split-output pages
+	Site          string         `json:"site,omitempty"`         // directory of the --site project
+	Published     string         `json:"published,omitempty"`    // the wiki --publish pushed the pages to
+	Readme        *ReadmeMerge   `json:"readme_merge,omitempty"` // what --readme-merge added to the README
+	Workspace     string         `json:"c4_workspace,omitempty"` // the Structurizr workspace of --preset c4
+	Attempts      []RunAttempt   `json:"attempts,omitempty"`   // both attempts of an --auto-retry run
+	Redactions    map[string]int `json:"redactions,omitempty"` // guardrail replacements by kind
+	Withheld      map[string]int `json:"prompt_redactions,omitempty"` // secrets kept from the model by kind (--scan-secrets)
+	Metrics       *RunMetrics    `json:"metrics,omitempty"`
+	PostErrors    []string       `json:"post_process_errors,omitempty"` // failed steps after the analysis
+	EvalOutput    string         `json:"eval_output,omitempty"`
+	EvalError     string         `json:"eval_error,omitempty"`
+}
+
+// Policies for failures after the analysis (--post-process-errors). Either
+// way the result is saved first and the failures are recorded.
+const (
+	PostProcessFail   = "fail"   // exit non-zero at the end of the run
+	PostProcessRecord = "record" // only record them
+)
+
+// createMetadata completes metadata (timestamp, optional evaluation) and writes
+// it next to the tech writer output. When evaluating, the metadata is written
+// first so a failed or hung evaluation still leaves it on disk. The written
+// metadata is returned.
+func createMetadata(outputFile string, metadata Metadata, techWriterResult, evalPromptFile string) (Metadata, error) {
+	if metadata.Timestamp == "" {
+		metadata.Timestamp = time.Now().Format(time.RFC3339)
+	}
+	if evalPromptFile == "" {
+		return metadata, writeMetadata(metadataPath(outputFile), metadata)
+	}
+	if err := writeMetadata(metadataPath(outputFile), metadata); err != nil {
+		return metadata, err
+	}
+	
+	// Run evaluation
+	evalPrompt, err := readPromptFile(evalPromptFile)
+	if err != nil {
+		metadata.EvalError = err.Error()
+	} else {
+		// Create LLM client for evaluation
+		llmClient, err := NewLLMClient(metadata.Model, "", LLMOptions{Seed: metadata.Seed})
 		if err != nil {
 			metadata.EvalError = err.Error()
 		} else {
-			// Prepare the full prompt with the tech writer result
-			fullPrompt := fmt.Sprintf("%s\n\n%s", evalPrompt, techWriterResult)
-			
-			// Create LLM client for evaluation
-			llmClient, err := NewLLMClient(modelName, "")
-			if err != nil {
-				metadata.EvalError = err.Error()
-			} else {
-				// Call the API for evaluation
-				evalResult, err := llmClient.Complete(fullPrompt, "", 0)
-				if err != nil {
-					metadata.EvalError = err.Error()
-				} else {
-					metadata.EvalOutput = evalResult
-				}
-			}
+			metadata.EvalOutput, metadata.EvalError = evaluateResult(llmClient, evalPrompt, techWriterResult)
 		}
 	}
 	
-	// Create metadata filename
+	return metadata, writeMetadata(metadataPath(outputFile), metadata)
+}
+
+// evaluateResult asks the judge model to assess a tech writer result. It
+// returns the evaluation, or the error message if the call failed.
+func evaluateResult(judge LLMClient, evalPrompt, techWriterResult string) (output, errorMessage string) {
+	// Prepare the full prompt with the tech writer result
+	fullPrompt := fmt.Sprintf("%s\n\n%s", evalPrompt, techWriterResult)
+	
+	evalResult, err := judge.Complete(fullPrompt, "", 0)
+	if err != nil {
+		return "", err.Error()
+	}
+	return evalResult, ""
+}
+
+// metadataPath returns the metadata file kept next to outputFile, e.g.
+// report.md -> report.metadata.json
+func metadataPath(outputFile string) string {
 	dir := filepath.Dir(outputFile)
 	base := strings.TrimSuffix(filepath.Base(outputFile), filepath.Ext(outputFile))
-	metadataFile := filepath.Join(dir, base+".metadata.json")
-	
-	// Save the metadata
+	return filepath.Join(dir, base+".metadata.json")
+}
+
+// writeMetadata saves metadata as indented JSON
+func writeMetadata(metadataFile string, metadata Metadata) error {
 	jsonData, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling metadata: %w", err)
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WALK_MAX_REPORTED_LINKS limits the skipped links a listing reports
+const WALK_MAX_REPORTED_LINKS = 50
+
+// Reasons a symbolic link is skipped
+const (
+	LinkNotFollowed = "not followed" // following is off
+	LinkBroken      = "broken"       // the target doesn't exist
+	LinkLoop        = "loop"         // the target contains the link
+	LinkDuplicate   = "duplicate"    // the target directory was already listed
+)
+
+// SkippedLink is a symbolic link the walk didn't list or follow
+type SkippedLink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+}
+
+// WalkResult is the outcome of walking a directory tree
+type WalkResult struct {
+	Files []string
+	Links []SkippedLink // visible links that were skipped, at most WALK_MAX_REPORTED_LINKS
+}
+
+// treeWalker lists the files under root. Unlike filepath.Walk it can follow
+// symbolic links: each directory's real path is remembered, so a link back
+// to an ancestor (a loop) or to a directory already walked is skipped
+// rather than walked again.
+type treeWalker struct {
+	filter  *fileFilter
+	visited map[string]bool // real paths of the directories walked; nil when not following links
+	result  WalkResult
+}
+
+// walk lists dir, whose path relative to the root is rel and whose real
+// path (links resolved) is real
+func (w *treeWalker) walk(dir, rel, real string) {
+	if w.visited != nil {
+		w.visited[real] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return // Skip directories we can't access
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		relPath := filepath.Join(rel, entry.Name())
+		switch {
+		case entry.IsDir():
+			// Always skip .git directory
+			if entry.Name() != ".git" && w.filter.opts.IncludeSubdirs {
+				w.walk(path, relPath, filepath.Join(real, entry.Name()))
+			}
+		case entry.Type()&os.ModeSymlink != 0:
+			w.walkLink(path, relPath, real)
+		case entry.Type().IsRegular():
+			if w.filter.keep(relPath) {
+				w.result.Files = append(w.result.Files, path)
+			}
+		}
+	}
+}
+
+// walkLink lists the file, or walks the directory, a symbolic link points
+// to if links are followed, and otherwise reports the link
+func (w *treeWalker) walkLink(path, relPath, parentReal string) {
+	target, _ := os.Readlink(path)
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		w.skipLink(relPath, target, LinkBroken)
+	case w.visited == nil:
+		w.skipLink(relPath, target, LinkNotFollowed)
+	case !info.IsDir():
+		if info.Mode().IsRegular() && w.filter.keep(relPath) {
+			w.result.Files = append(w.result.Files, path)
+		}
+	case !w.filter.opts.IncludeSubdirs:
+	default:
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			w.skipLink(relPath, target, LinkBroken)
+			return
+		}
+		if parentReal == real || strings.HasPrefix(parentReal, real+string(filepath.Separator)) {
+			w.skipLink(relPath, target, LinkLoop)
+		} else if w.visited[real] {
+			w.skipLink(relPath, target, LinkDuplicate)
+		} else {
+			w.walk(path, relPath, real)
+		}
+	}
+}
+
+// findLinks reports the symbolic links under dir, whose path relative to the
+// root is rel, as the walk would without following them, but lists no files:
+// the ripgrep listing has them and doesn't report links. Ignored directories,
+// whose links would be hidden anyway, aren't entered.
+func (w *treeWalker) findLinks(dir, rel string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if len(w.result.Links) >= WALK_MAX_REPORTED_LINKS {
+			return
+		}
+		path := filepath.Join(dir, entry.Name())
+		relPath := filepath.Join(rel, entry.Name())
+		switch {
+		case entry.IsDir():
+			if entry.Name() == ".git" || !w.filter.opts.IncludeSubdirs {
+				continue
+			}
+			if match, _ := ignoreMatch(relPath, true, w.filter.rules); match == nil {
+				w.findLinks(path, relPath)
+			}
+		case entry.Type()&os.ModeSymlink != 0:
+			w.walkLink(path, relPath, "")
+		}
+	}
+}
+
+// skipLink reports a link unless the listing would hide it anyway (ignored
+// or hidden); directory links are judged as if they were files
+func (w *treeWalker) skipLink(relPath, target, reason string) {
+	visible := *w.filter
+	visible.opts.Pattern = "*"
+	if !visible.keep(relPath) || len(w.result.Links) >= WALK_MAX_REPORTED_LINKS {
+		return
+	}
+	w.result.Links = append(w.result.Links, SkippedLink{Path: filepath.ToSlash(relPath), Target: target, Reason: reason})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWalkFilesReportsLinks(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		".gitignore":           "node_modules/\n",
+		"main.go":              "package main\n",
+		"docs/guide.md":        "# Guide\n",
+		"node_modules/x/a.js":  "",
+		"node_modules/x/b.txt": "",
+	})
+	for link, target := range map[string]string{
+		"gone":                "missing.go",
+		"docs/readme.md":      "guide.md",
+		"shared":              "docs",
+		"node_modules/x/c.js": "a.js",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, filepath.FromSlash(link))); err != nil {
+			t.Skip("symbolic links aren't supported:", err)
+		}
+	}
+	want := []SkippedLink{
+		{Path: "docs/readme.md", Target: "guide.md", Reason: LinkNotFollowed},
+		{Path: "gone", Target: "missing.go", Reason: LinkBroken},
+		{Path: "shared", Target: "docs", Reason: LinkNotFollowed},
+	}
+
+	// The Go walk, and a listing by a stand-in for rg that prints the
+	// files as rg --files would
+	saved := ripgrepPath
+	defer func() { ripgrepPath = saved }()
+	rg := filepath.Join(t.TempDir(), "rg")
+	if err := os.WriteFile(rg, []byte("#!/bin/sh\nprintf '.gitignore\\0docs/guide.md\\0main.go\\0'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, path := range map[string]string{"go": "", "ripgrep": rg} {
+		ripgrepPath = func() string { return path }
+		result, err := walkFiles(dir, DefaultWalkOptions())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Files) != 3 {
+			t.Errorf("%s walkFiles() files = %q", name, result.Files)
+		}
+		if !reflect.DeepEqual(result.Links, want) {
+			t.Errorf("%s walkFiles() links = %v, want %v", name, result.Links, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PublishWiki publishes the result to the --repo's GitHub wiki (--publish)
+const PublishWiki = "wiki"
+
+// WIKI_HOME is the page a GitHub wiki opens on, which the index becomes
+const WIKI_HOME = "Home"
+
+// WIKI_SIDEBAR is the page GitHub shows beside every page of a wiki
+const WIKI_SIDEBAR = "_Sidebar"
+
+// WIKI_PAGES_FILE lists, one per line, the pages the last publish wrote, so
+// that the next removes them and no others
+const WIKI_PAGES_FILE = ".tech-writer-pages"
+
+// githubWikiBaseURL is where GitHub serves wiki repositories
+var githubWikiBaseURL = "https://github.com"
+
+// publishWiki writes pages, as splitDocument makes them without an
+// extension, to the wiki of the GitHub repository repoName ("owner/name")
+// and pushes them with message, authenticating with token if it is set.
+// The index becomes the wiki's Home page, a sidebar lists the pages, and
+// the pages an earlier publish wrote, as listed in WIKI_PAGES_FILE, are
+// replaced; other pages are left alone. It returns the wiki's URL and
+// whether anything changed.
+func publishWiki(repoName string, pages []SplitPage, message, token string) (string, bool, error) {
+	wikiURL := fmt.Sprintf("%s/%s/wiki", githubWikiBaseURL, repoName)
+	tempDir, err := os.MkdirTemp("", "tech-writer-wiki-")
+	if err != nil {
+		return wikiURL, false, fmt.Errorf("error creating wiki clone directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+	dir := filepath.Join(tempDir, "wiki")
+
+	remote := fmt.Sprintf("%s/%s.wiki.git", githubWikiBaseURL, repoName)
+	if err := wikiGit(tempDir, token, "clone", "-q", "--depth", "1", remote, dir); err != nil {
+		return wikiURL, false, fmt.Errorf("error cloning the wiki (GitHub only creates it with its first page, so add one on %s first): %w", wikiURL, err)
+	}
+
+	earlier, err := os.ReadFile(filepath.Join(dir, WIKI_PAGES_FILE))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return wikiURL, false, fmt.Errorf("error reading the wiki's page list: %w", err)
+	}
+	for _, name := range strings.Split(string(earlier), "\n") {
+		name = strings.TrimSpace(name)
+		if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name+".md")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return wikiURL, false, fmt.Errorf("error removing earlier page: %w", err)
+		}
+	}
+
+	pages = renameWikiPage(pages, pages[0].File, WIKI_HOME)
+	var sidebar, written strings.Builder
+	for _, page := range pages {
+		fmt.Fprintf(&sidebar, "- [%s](%s)\n", page.Title, page.File)
+		fmt.Fprintln(&written, page.File)
+		if err := os.WriteFile(filepath.Join(dir, page.File+".md"), []byte(page.Markdown), 0644); err != nil {
+			return wikiURL, false, fmt.Errorf("error writing wiki page: %w", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, WIKI_SIDEBAR+".md"), []byte(sidebar.String()), 0644); err != nil {
+		return wikiURL, false, fmt.Errorf("error writing wiki sidebar: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, WIKI_PAGES_FILE), []byte(written.String()), 0644); err != nil {
+		return wikiURL, false, fmt.Errorf("error writing the wiki's page list: %w", err)
+	}
+
+	if err := wikiGit(dir, token, "add", "-A"); err != nil {
+		return wikiURL, false, err
+	}
+	if status, err := runGit(dir, "status", "--porcelain"); err != nil {
+		return wikiURL, false, err
+	} else if strings.TrimSpace(status) == "" {
+		return wikiURL, false, nil
+	}
+	commit := []string{"commit", "-q", "-m", message}
+	if email, _ := runGit(dir, "config", "user.email"); strings.TrimSpace(email) == "" {
+		commit = append([]string{"-c", "user.name=tech-writer-agent", "-c", "user.email=tech-writer-agent@users.noreply.github.com"}, commit...)
+	}
+	if err := wikiGit(dir, token, commit...); err != nil {
+		return wikiURL, false, err
+	}
+	if err := wikiGit(dir, token, "push", "-q", "origin", "HEAD"); err != nil {
+		return wikiURL, false, fmt.Errorf("error pushing the wiki: %w", err)
+	}
+	return wikiURL, true, nil
+}
+
+// wikiGit runs git in directory, sending token, if set, as GitHub's
+// credentials without writing it into the clone or the command line. Git
+// never prompts for credentials. Errors include what git printed.
+func wikiGit(directory, token string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-C", directory}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if token != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+		cmd.Env = append(cmd.Env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic "+credentials)
+	}
+	command := args[0]
+	for i := 0; command == "-c" && i+2 < len(args); i += 2 {
+		command = args[i+2]
+	}
+	if _, err := cmd.Output(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return fmt.Errorf("git %s: %s", command, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return fmt.Errorf("git %s: %w", command, err)
+	}
+	return nil
+}
+
+// renameWikiPage renames the page from to, in its File and in the links of
+// every page
+func renameWikiPage(pages []SplitPage, from, to string) []SplitPage {
+	link := regexp.MustCompile(`(\]\(|href=["'])` + regexp.QuoteMeta(from) + `([#)"'])`)
+	renamed := make([]SplitPage, len(pages))
+	for i, page := range pages {
+		if page.File == from {
+			page.File = to
+		}
+		page.Markdown = link.ReplaceAllString(page.Markdown, "${1}"+to+"${2}")
+		renamed[i] = page
+	}
+	return renamed
+}
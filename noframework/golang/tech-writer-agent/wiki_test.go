@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPublishWiki(t *testing.T) {
+	base := t.TempDir()
+	remote := filepath.Join(base, "owner", "name.wiki.git")
+	seed := t.TempDir()
+	gitFixture(t, base, []string{"init", "-q", "--bare", remote})
+	gitFixture(t, seed, []string{"init", "-q"})
+	for _, page := range []string{"Home.md", "2024-Roadmap.md", "10-Year-Plan.md", "Notes.md"} {
+		if err := os.WriteFile(filepath.Join(seed, page), []byte("Written by hand.\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gitFixture(t, seed, []string{"add", "-A"}, []string{"commit", "-q", "-m", "Hand-written pages"}, []string{"push", "-q", remote, "HEAD:master"})
+	gitFixture(t, base, []string{"-C", remote, "symbolic-ref", "HEAD", "refs/heads/master"})
+
+	saved := githubWikiBaseURL
+	githubWikiBaseURL = "file://" + base
+	defer func() { githubWikiBaseURL = saved }()
+
+	publish := func(files ...string) []string {
+		t.Helper()
+		var pages []SplitPage
+		for _, file := range files {
+			pages = append(pages, SplitPage{File: file, Title: file, Markdown: "# " + file + "\n"})
+		}
+		if _, _, err := publishWiki("owner/name", pages, "Update the documentation", ""); err != nil {
+			t.Fatal(err)
+		}
+		clone := filepath.Join(t.TempDir(), "wiki")
+		gitFixture(t, base, []string{"clone", "-q", remote, clone})
+		entries, err := os.ReadDir(clone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	publish("index", "01-overview", "02-architecture", "03-testing")
+	// The second run drops a section: its earlier page goes, the numbered
+	// pages written by hand stay
+	got := publish("index", "01-overview", "02-architecture")
+	want := []string{WIKI_PAGES_FILE, "01-overview.md", "02-architecture.md", "10-Year-Plan.md", "2024-Roadmap.md", "Home.md", "Notes.md", WIKI_SIDEBAR + ".md"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("publishWiki() left %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Workspace tools whose manifests at the repository root list its packages
+const (
+	WorkspaceGo    = "go.work"
+	WorkspacePnpm  = "pnpm"
+	WorkspaceLerna = "lerna"
+	WorkspaceNpm   = "npm" // package.json workspaces, as npm and yarn use them
+	WorkspaceCargo = "cargo"
+)
+
+// WorkspacePackage is a package of a monorepo, as its workspace manifest
+// lists it
+type WorkspacePackage struct {
+	Name      string `json:"name"` // from the package's own manifest, or its directory
+	Dir       string `json:"dir"`  // relative to the repository root, slash-separated
+	Workspace string `json:"workspace"`
+	Files     int    `json:"files"` // visible files in it, nested packages included
+}
+
+// cargoArrayPattern matches a members = [...] or exclude = [...] array of a
+// Cargo.toml, which may span lines
+var cargoArrayPattern = regexp.MustCompile(`(?m)^(members|exclude)\s*=\s*\[([^\]]*)\]`)
+
+// quotedPattern matches a TOML string
+var quotedPattern = regexp.MustCompile(`"([^"]*)"|'([^']*)'`)
+
+// tomlNamePattern matches the name = "..." of a Cargo.toml [package]
+var tomlNamePattern = regexp.MustCompile(`(?m)^name\s*=\s*"([^"]+)"`)
+
+// goModulePattern matches the module line of a go.mod
+var goModulePattern = regexp.MustCompile(`(?m)^module\s+"?([^\s"]+)`)
+
+// discoverPackages finds the packages the workspace manifests at the root of
+// directory list: go.work, pnpm-workspace.yaml, lerna.json, the workspaces of
+// package.json and the [workspace] of Cargo.toml. Only directories with the
+// package's own manifest, visible to the tools, count. A package listed by
+// two manifests is reported once. It returns nil for a repository without
+// workspaces.
+func discoverPackages(directory string) ([]WorkspacePackage, error) {
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving directory path: %w", err)
+	}
+	files, err := listFiles(absDir, DefaultWalkOptions())
+	if err != nil {
+		return nil, err
+	}
+	// The directories holding each kind of manifest, and the file counts
+	manifests := make(map[string][]string)
+	var relFiles []string
+	for _, file := range files {
+		rel, err := filepath.Rel(absDir, file)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		relFiles = append(relFiles, rel)
+		if dir := path.Dir(rel); dir != "." {
+			manifests[path.Base(rel)] = append(manifests[path.Base(rel)], dir)
+		}
+	}
+	read := func(name string) []byte {
+		data, _ := os.ReadFile(filepath.Join(absDir, name))
+		return data
+	}
+
+	var packages []WorkspacePackage
+	seen := make(map[string]bool)
+	add := func(workspace, manifest string, dirs []string, nameOf func(data []byte) string) {
+		for _, dir := range dirs {
+			if seen[dir] {
+				continue
+			}
+			seen[dir] = true
+			name := nameOf(read(path.Join(dir, manifest)))
+			if name == "" {
+				name = path.Base(dir)
+			}
+			packages = append(packages, WorkspacePackage{Name: name, Dir: dir, Workspace: workspace})
+		}
+	}
+	npmName := func(data []byte) string {
+		var manifest struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(data, &manifest)
+		return manifest.Name
+	}
+
+	if data := read("go.work"); data != nil {
+		add(WorkspaceGo, "go.mod", existing(goWorkUses(data), manifests["go.mod"]), func(data []byte) string {
+			if match := goModulePattern.FindSubmatch(data); match != nil {
+				return string(match[1])
+			}
+			return ""
+		})
+	}
+	if data := read("pnpm-workspace.yaml"); data != nil {
+		var workspace struct {
+			Packages []string `yaml:"packages"`
+		}
+		if err := yaml.Unmarshal(data, &workspace); err != nil {
+			return nil, fmt.Errorf("error parsing pnpm-workspace.yaml: %w", err)
+		}
+		add(WorkspacePnpm, "package.json", matchWorkspace(workspace.Packages, manifests["package.json"]), npmName)
+	}
+	if data := read("lerna.json"); data != nil {
+		var lerna struct {
+			Packages []string `json:"packages"`
+		}
+		if err := json.Unmarshal(data, &lerna); err != nil {
+			return nil, fmt.Errorf("error parsing lerna.json: %w", err)
+		}
+		if len(lerna.Packages) == 0 {
+			lerna.Packages = []string{"packages/*"}
+		}
+		add(WorkspaceLerna, "package.json", matchWorkspace(lerna.Packages, manifests["package.json"]), npmName)
+	}
+	if data := read("package.json"); data != nil {
+		add(WorkspaceNpm, "package.json", matchWorkspace(npmWorkspaces(data), manifests["package.json"]), npmName)
+	}
+	if data := read("Cargo.toml"); data != nil {
+		members, exclude := cargoWorkspace(data)
+		for _, pattern := range exclude {
+			members = append(members, "!"+pattern)
+		}
+		add(WorkspaceCargo, "Cargo.toml", matchWorkspace(members, manifests["Cargo.toml"]), func(data []byte) string {
+			if match := tomlNamePattern.FindSubmatch(data); match != nil {
+				return string(match[1])
+			}
+			return ""
+		})
+	}
+
+	for i := range packages {
+		for _, rel := range relFiles {
+			if strings.HasPrefix(rel, packages[i].Dir+"/") {
+				packages[i].Files++
+			}
+		}
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Dir < packages[j].Dir })
+	return packages, nil
+}
+
+// goWorkUses returns the directories a go.work uses, inside or outside use
+// blocks
+func goWorkUses(data []byte) []string {
+	var dirs []string
+	inUse := false
+	for _, line := range strings.Split(string(data), "\n") {
+		line, _, _ = strings.Cut(line, "//")
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "use (") || strings.HasPrefix(line, "use("):
+			inUse = true
+			continue
+		case inUse && strings.HasPrefix(line, ")"):
+			inUse = false
+			continue
+		case !inUse && strings.HasPrefix(line, "use "):
+			line = strings.TrimSpace(strings.TrimPrefix(line, "use "))
+		case !inUse:
+			continue
+		}
+		if dir := path.Clean(strings.Trim(line, `"`)); line != "" && dir != "." {
+			dirs = append(dirs, strings.TrimPrefix(dir, "./"))
+		}
+	}
+	return dirs
+}
+
+// npmWorkspaces returns the workspaces of a package.json: an array, or
+// yarn's {"packages": [...]}
+func npmWorkspaces(data []byte) []string {
+	var manifest struct {
+		Workspaces json.RawMessage `json:"workspaces"`
+	}
+	if json.Unmarshal(data, &manifest) != nil || manifest.Workspaces == nil {
+		return nil
+	}
+	var patterns []string
+	if json.Unmarshal(manifest.Workspaces, &patterns) == nil {
+		return patterns
+	}
+	var yarn struct {
+		Packages []string `json:"packages"`
+	}
+	json.Unmarshal(manifest.Workspaces, &yarn)
+	return yarn.Packages
+}
+
+// cargoWorkspace returns the members and exclude patterns of the
+// [workspace] section of a Cargo.toml
+func cargoWorkspace(data []byte) (members, exclude []string) {
+	text := string(data)
+	start := strings.Index(text, "\n[workspace]")
+	if strings.HasPrefix(text, "[workspace]") {
+		start = 0
+	} else if start < 0 {
+		return nil, nil
+	}
+	section := text[start+1:]
+	if end := strings.Index(section[1:], "\n["); end >= 0 {
+		section = section[:end+1]
+	}
+	for _, array := range cargoArrayPattern.FindAllStringSubmatch(section, -1) {
+		var values []string
+		for _, quoted := range quotedPattern.FindAllStringSubmatch(array[2], -1) {
+			values = append(values, quoted[1]+quoted[2])
+		}
+		if array[1] == "members" {
+			members = append(members, values...)
+		} else {
+			exclude = append(exclude, values...)
+		}
+	}
+	return members, exclude
+}
+
+// matchWorkspace returns the directories matched by the workspace patterns,
+// globs as in glob.go of which a leading "!" excludes
+func matchWorkspace(patterns, dirs []string) []string {
+	var matched []string
+	for _, dir := range dirs {
+		included := false
+		for _, pattern := range patterns {
+			negated := strings.HasPrefix(pattern, "!")
+			pattern = strings.TrimSuffix(normalizeGlob(strings.TrimPrefix(pattern, "!")), "/")
+			if matchSegments(strings.Split(pattern, "/"), strings.Split(dir, "/")) {
+				included = !negated
+			}
+		}
+		if included {
+			matched = append(matched, dir)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+// existing returns the listed directories that are among dirs
+func existing(listed, dirs []string) []string {
+	var found []string
+	for _, dir := range listed {
+		for _, candidate := range dirs {
+			if candidate == dir {
+				found = append(found, dir)
+				break
+			}
+		}
+	}
+	return found
+}
+
+// findPackage returns the package named name, or in the directory name
+func findPackage(packages []WorkspacePackage, name string) (WorkspacePackage, bool) {
+	for _, pkg := range packages {
+		if pkg.Name == name || pkg.Dir == strings.Trim(filepath.ToSlash(name), "/") {
+			return pkg, true
+		}
+	}
+	return WorkspacePackage{}, false
+}
+
+// runPackages implements the packages command, which lists the packages of
+// a monorepo that --package can analyse on their own
+func runPackages(argv []string) error {
+	fs := flag.NewFlagSet("packages", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "Print the packages as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s packages [--json] [DIR]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+	directory := "."
+	if fs.NArg() > 0 {
+		directory = fs.Arg(0)
+	}
+
+	packages, err := discoverPackages(directory)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := json.MarshalIndent(packages, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	if len(packages) == 0 {
+		fmt.Printf("No workspace packages found in %s\n", directory)
+		return nil
+	}
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "PACKAGE\tDIRECTORY\tFILES\tWORKSPACE")
+	for _, pkg := range packages {
+		fmt.Fprintf(out, "%s\t%s\t%d\t%s\n", pkg.Name, pkg.Dir, pkg.Files, pkg.Workspace)
+	}
+	out.Flush()
+	fmt.Printf("%d packages; analyse one with --package NAME, or all of them with --agent-type hierarchical\n", len(packages))
+	return nil
+}
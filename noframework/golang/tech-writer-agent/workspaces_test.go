@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestDiscoverPackages(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // workspace name dir
+	}{
+		{
+			name: "go.work",
+			files: map[string]string{
+				"go.work":        "go 1.23\n\nuse (\n\t./api // the server\n\t./cli\n)\nuse ./missing\n",
+				"api/go.mod":     "module example.com/api\n",
+				"api/main.go":    "package main",
+				"cli/go.mod":     "module example.com/cli\n",
+				"tools/go.mod":   "module example.com/tools\n",
+				"tools/tools.go": "package tools",
+			},
+			want: []string{"go.work example.com/api api", "go.work example.com/cli cli"},
+		},
+		{
+			name: "pnpm with exclusions",
+			files: map[string]string{
+				"pnpm-workspace.yaml":             "packages:\n  - 'apps/*'\n  - 'packages/**'\n  - '!packages/**/test'\n",
+				"apps/web/package.json":           `{"name": "@acme/web"}`,
+				"packages/ui/package.json":        `{"name": "@acme/ui"}`,
+				"packages/ui/test/package.json":   `{"name": "ui-test"}`,
+				"packages/ui/node_modules/x/a.js": "",
+				"docs/package.json":               `{"name": "docs"}`,
+			},
+			want: []string{"pnpm @acme/web apps/web", "pnpm @acme/ui packages/ui"},
+		},
+		{
+			name: "lerna defaults and npm workspaces",
+			files: map[string]string{
+				"lerna.json":               `{"version": "1.0.0"}`,
+				"package.json":             `{"name": "root", "workspaces": {"packages": ["packages/*", "tools/*"]}}`,
+				"packages/a/package.json":  `{"name": "a"}`,
+				"tools/build/package.json": `{}`,
+			},
+			want: []string{"lerna a packages/a", "npm build tools/build"},
+		},
+		{
+			name: "cargo",
+			files: map[string]string{
+				"Cargo.toml":             "[workspace]\nmembers = [\n  \"crates/*\",\n]\nexclude = [\"crates/old\"]\n\n[workspace.dependencies]\nserde = \"1\"\n",
+				"crates/core/Cargo.toml": "[package]\nname = \"acme-core\"\n",
+				"crates/old/Cargo.toml":  "[package]\nname = \"acme-old\"\n",
+				"crates/core/src/lib.rs": "",
+				"examples/x/Cargo.toml":  "[package]\nname = \"x\"\n",
+			},
+			want: []string{"cargo acme-core crates/core"},
+		},
+		{
+			name:  "no workspace",
+			files: map[string]string{"package.json": `{"name": "single"}`, "src/index.js": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packages, err := discoverPackages(writeFixture(t, tt.files))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, pkg := range packages {
+				got = append(got, fmt.Sprintf("%s %s %s", pkg.Workspace, pkg.Name, pkg.Dir))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("discoverPackages() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}